@@ -9,6 +9,10 @@ package main
 import (
 	"fmt"
 	"log"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
 
 	"github.com/markkurossi/mpc"
 	"github.com/markkurossi/mpc/circuit"
@@ -25,18 +29,26 @@ func bmrMode(file string, params *utils.Params, player int) error {
 		return err
 	}
 
-	if player >= len(circ.Inputs) {
+	parties, err := circ.Inputs.Parties()
+	if err != nil {
+		return err
+	}
+	var numPlayers int
+	for _, party := range parties {
+		numPlayers = max(numPlayers, party+1)
+	}
+	if player >= numPlayers {
 		return fmt.Errorf("invalid party number %d for %d-party computation",
-			player, len(circ.Inputs))
+			player, numPlayers)
 	}
 
-	input, err := circ.Inputs[player].Parse(inputFlag)
+	input, err := playerInput(circ, parties, player, inputFlag)
 	if err != nil {
 		return err
 	}
 
 	for idx, arg := range circ.Inputs {
-		if idx == player {
+		if parties[idx] == player {
 			fmt.Printf(" + In%d: %s\n", idx, arg)
 		} else {
 			fmt.Printf(" - In%d: %s\n", idx, arg)
@@ -54,7 +66,12 @@ func bmrMode(file string, params *utils.Params, player int) error {
 	}
 	defer nw.Close()
 
-	numPlayers := len(circ.Inputs)
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	nw.SetLogger(slog.New(slog.NewTextHandler(os.Stdout,
+		&slog.HandlerOptions{Level: level})))
 
 	for i := 0; i < numPlayers; i++ {
 		if i == player {
@@ -73,10 +90,43 @@ func bmrMode(file string, params *utils.Params, player int) error {
 		return err
 	}
 
-	mpc.PrintResults(result, circ.Outputs)
+	mpc.PrintEncodedResults(result, circ.Outputs, resultEncodings)
 	return nil
 }
 
+// playerInput parses the values of the circuit inputs that the player
+// provides. The values are given in the order of the inputs and they
+// are combined into one value at the input offsets.
+func playerInput(circ *circuit.Circuit, parties []int, player int,
+	values []string) (*big.Int, error) {
+
+	result := new(big.Int)
+	for idx, l := range circ.Inputs.Layout() {
+		if parties[idx] != player {
+			continue
+		}
+		arg := circ.Inputs[idx]
+		count := 1
+		if len(arg.Compound) > 0 && len(values) > 0 &&
+			!strings.HasPrefix(strings.TrimSpace(values[0]), "{") {
+			count = len(arg.Compound)
+		}
+		if count > len(values) {
+			return nil, fmt.Errorf("not enough values for input %s", arg.Name)
+		}
+		v, err := arg.Parse(values[:count])
+		if err != nil {
+			return nil, err
+		}
+		values = values[count:]
+		result.Or(result, v.Lsh(v, uint(l.Offset)))
+	}
+	if len(values) > 0 {
+		return nil, fmt.Errorf("too many input values: %v", values)
+	}
+	return result, nil
+}
+
 func makeAddr(player int) string {
 	return fmt.Sprintf("127.0.0.1:%d", 8080+player)
 }
@@ -10,6 +10,7 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -20,15 +21,24 @@ import (
 	"github.com/markkurossi/mpc/compiler/utils"
 )
 
+// statsFanOut specifies the number of highest fan-out wires in the
+// circuit statistics.
+const statsFanOut = 10
+
 func compileFiles(files []string, params *utils.Params, inputSizes [][]int,
-	compile, ssa, dot, svg bool, circFormat string) error {
+	compile, ssa, dot, svg, ssaSvg, explain, stats bool,
+	circFormat string) error {
 
 	var circ *circuit.Circuit
 	var err error
 
 	for _, file := range files {
 		if compile {
-			params.CircOut, err = makeOutput(file, circFormat)
+			suffix := circFormat
+			if circFormat == "verilog" {
+				suffix = "v"
+			}
+			params.CircOut, err = makeOutput(file, suffix)
 			if err != nil {
 				return err
 			}
@@ -73,6 +83,23 @@ func compileFiles(files []string, params *utils.Params, inputSizes [][]int,
 					}
 				}
 			}
+			if ssaSvg {
+				params.SSACircSvgOut, err = makeOutput(file, "ssa.svg")
+				if err != nil {
+					return err
+				}
+			}
+			if compile && circFormat == "mpclc" && !dot && !svg &&
+				!ssaSvg && !explain && !stats && params.FanOutWarning == 0 {
+				// Stream the circuit to the output file without
+				// building the compiled gate slice.
+				_, _, err = compiler.New(params).CompileFileStream(file,
+					inputSizes, params.CircOut)
+				if err != nil {
+					return err
+				}
+				continue
+			}
 			circ, _, err = compiler.New(params).CompileFile(file, inputSizes)
 			if err != nil {
 				return err
@@ -80,6 +107,19 @@ func compileFiles(files []string, params *utils.Params, inputSizes [][]int,
 		} else {
 			return fmt.Errorf("unknown file type '%s'", file)
 		}
+		if explain && circ != nil {
+			err = circ.Explain(os.Stdout)
+			if err != nil {
+				return err
+			}
+		}
+		if stats && circ != nil {
+			data, err := json.MarshalIndent(circ.Summary(statsFanOut), "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		}
 	}
 	return nil
 }
@@ -9,11 +9,12 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net"
+	"math/big"
 	"os"
 	"runtime"
 	"runtime/pprof"
@@ -29,8 +30,13 @@ import (
 )
 
 var (
-	port    = ":8080"
-	verbose = false
+	port            = ":8080"
+	verbose         = false
+	tableChecksum   = false
+	otBatch         = 0
+	mpcProfileFile  string
+	garbleSeed      string
+	resultEncodings []circuit.Encoding
 )
 
 type input []string
@@ -40,7 +46,7 @@ func (i *input) String() string {
 }
 
 func (i *input) Set(value string) error {
-	for _, v := range strings.Split(value, ",") {
+	for _, v := range circuit.SplitInputs(value) {
 		*i = append(*i, v)
 	}
 	return nil
@@ -56,19 +62,52 @@ func init() {
 func main() {
 	evaluator := flag.Bool("e", false, "evaluator / garbler mode")
 	stream := flag.Bool("stream", false, "streaming mode")
+	compress := flag.Bool("compress", false,
+		"compress garbled gates in streaming mode")
 	compile := flag.Bool("circ", false, "compile MPCL to circuit")
 	circFormat := flag.String("format", "mpclc",
-		"circuit format: mpclc, bristol")
+		"circuit format: mpclc, bristol, verilog")
 	ssa := flag.Bool("ssa", false, "compile MPCL to SSA assembly")
 	dot := flag.Bool("dot", false, "create Graphviz DOT output")
+	debugNames := flag.Bool("debug-names", false,
+		"name SSA values after their source expressions")
 	svg := flag.Bool("svg", false, "create SVG output")
+	ssaSvg := flag.Bool("ssa-svg", false,
+		"create SVG output of the SSA blocks and their circuit gates")
+	noUnroll := flag.Bool("no-unroll", false,
+		fmt.Sprintf("fail on loops with more than %d iterations",
+			utils.NoUnrollLimit))
+	explain := flag.Bool("explain", false,
+		"print the boolean formula of each output bit")
+	repl := flag.Bool("repl", false,
+		"evaluate MPCL expressions and statements interactively")
+	stats := flag.Bool("stats", false,
+		"print the circuit statistics in JSON format")
+	cost := flag.Bool("cost", false,
+		"print the AND gate cost of each source line")
+	fanOut := flag.Int("fanout-warn", 0,
+		"warn about wires with fan-out above the `limit`")
 	optimize := flag.Int("O", 1, "optimization level")
+	fTableChecksum := flag.Bool("table-checksum", false,
+		"checksum garbled tables against transport corruption (both parties)")
+	fOTBatch := flag.Int("ot-batch", 0,
+		"evaluator: OT inputs in batches of `n` wires and evaluate ready gates")
+	fAddr := flag.String("addr", port,
+		"evaluator address, unix:`path` for a Unix domain socket")
+	selftest := flag.Bool("selftest", false,
+		"run the OT known-answer self-tests and exit")
 	fVerbose := flag.Bool("v", false, "verbose output")
 	fDiagnostics := flag.Bool("d", false, "diagnostics output")
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to `file`")
 	memprofile := flag.String("memprofile", "",
 		"write memory profile to `file`")
+	mpcprofile := flag.String("mpcprofile", "",
+		"write MPC protocol profile to `file` in JSON")
 	bmr := flag.Int("bmr", -1, "semi-honest secure BMR protocol player number")
+	fEncoding := flag.String("encoding", "",
+		"comma-separated list of result `encodings`: default, hex, base64, raw")
+	seed := flag.String("seed", "",
+		"seed OT and garbling randomness for reproducible runs (INSECURE)")
 	mpclcErrLoc := flag.Bool("mpclc-err-loc", false,
 		"print MPCLC error locations")
 	benchmarkCompile := flag.Bool("benchmark-compile", false,
@@ -77,7 +116,28 @@ func main() {
 
 	log.SetFlags(0)
 
+	port = *fAddr
 	verbose = *fVerbose
+	tableChecksum = *fTableChecksum
+	otBatch = *fOTBatch
+
+	if len(*fEncoding) > 0 {
+		for _, name := range strings.Split(*fEncoding, ",") {
+			enc, err := circuit.ParseEncoding(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			resultEncodings = append(resultEncodings, enc)
+		}
+	}
+
+	if *selftest {
+		if err := ot.SelfTest(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("OT self-test passed")
+		return
+	}
 
 	if len(*cpuprofile) > 0 {
 		f, err := os.Create(*cpuprofile)
@@ -91,22 +151,43 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	mpcProfileFile = *mpcprofile
+
 	params := utils.NewParams()
 	defer params.Close()
 
 	params.Verbose = *fVerbose
 	params.Diagnostics = *fDiagnostics
 	params.MPCLCErrorLoc = *mpclcErrLoc
+	params.DebugNames = *debugNames
+	params.NoUnroll = *noUnroll
+	params.FanOutWarning = *fanOut
 	params.BenchmarkCompile = *benchmarkCompile
+	params.CompressGates = *compress
 
 	if *optimize > 0 {
 		params.OptPruneGates = true
 	}
-	if *ssa && !*compile {
+	if *optimize > 1 {
+		params.OptRebalance = true
+		params.OptRenumberWires = true
+	}
+	if *cost {
+		params.CostOut = os.Stdout
+	}
+	if *ssa && !*compile && !*cost && !*ssaSvg {
 		params.NoCircCompile = true
 	}
 
-	if *compile || *ssa {
+	if *repl {
+		err := compiler.NewREPL(params).Run(os.Stdin, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *compile || *ssa || *explain || *stats || *cost || *ssaSvg {
 		inputSizes := make([][]int, 2)
 		iSizes, err := circuit.InputSizes(inputFlag)
 		if err != nil {
@@ -125,7 +206,8 @@ func main() {
 		}
 
 		err = compileFiles(flag.Args(), params, inputSizes,
-			*compile, *ssa, *dot, *svg, *circFormat)
+			*compile, *ssa, *dot, *svg, *ssaSvg, *explain, *stats,
+			*circFormat)
 		if err != nil {
 			log.Fatalf("compile failed: %s", err)
 		}
@@ -137,6 +219,12 @@ func main() {
 
 	oti := ot.NewCO()
 
+	if len(*seed) > 0 {
+		seedWarning(os.Stderr)
+		garbleSeed = *seed
+		oti = ot.NewCOWithRand(ot.NewSeededReader([]byte(*seed), "ot"))
+	}
+
 	if *stream {
 		if *evaluator {
 			err = streamEvaluatorMode(oti, inputFlag, len(*cpuprofile) > 0)
@@ -163,7 +251,13 @@ func main() {
 		return
 	}
 
-	if *evaluator {
+	numInputs, err := inputCount(file, params)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if numInputs < 2 {
+		err = localMode(file, params, numInputs)
+	} else if *evaluator {
 		err = evaluatorMode(oti, file, params, len(*cpuprofile) > 0)
 	} else {
 		err = garblerMode(oti, file, params)
@@ -173,6 +267,18 @@ func main() {
 	}
 }
 
+// seedWarning prints a warning about the deterministic randomness of
+// the -seed flag.
+func seedWarning(out io.Writer) {
+	line := strings.Repeat("*", 72)
+	fmt.Fprintf(out, `%s
+* WARNING: the -seed flag makes the OT and garbling randomness
+* deterministic. Anyone who knows the seed can recover all inputs of
+* the computation. Use it only for reproducible demos and debugging.
+%s
+`, line, line)
+}
+
 func loadCircuit(file string, params *utils.Params, inputSizes [][]int) (
 	*circuit.Circuit, error) {
 
@@ -202,6 +308,89 @@ func loadCircuit(file string, params *utils.Params, inputSizes [][]int) (
 	return circ, err
 }
 
+// inputCount returns the number of inputs of the circuit file. The
+// MPCL files are only parsed and their number of inputs is the number
+// of the main function arguments.
+func inputCount(file string, params *utils.Params) (int, error) {
+	if circuit.IsFilename(file) {
+		circ, err := circuit.Parse(file)
+		if err != nil {
+			return 0, err
+		}
+		return len(circ.Inputs), nil
+	} else if strings.HasSuffix(file, ".mpcl") {
+		pkg, err := compiler.New(params).ParseFile(file)
+		if err != nil {
+			return 0, err
+		}
+		main, err := pkg.Main()
+		if err != nil {
+			return 0, err
+		}
+		return len(main.Args), nil
+	}
+	return 0, fmt.Errorf("unknown file type '%s'", file)
+}
+
+// localMode computes the circuit with zero or one inputs locally
+// since there is no peer for the 2-party computation.
+func localMode(file string, params *utils.Params, numInputs int) error {
+	fmt.Printf("Circuit has %d input(s), computing locally without peer\n",
+		numInputs)
+
+	if numInputs == 0 {
+		if len(inputFlag) > 0 {
+			return fmt.Errorf("%s: circuit has no inputs, got %d values",
+				file, len(inputFlag))
+		}
+		var circ *circuit.Circuit
+		var inputs []*big.Int
+		var err error
+		if circuit.IsFilename(file) {
+			// The circuit files are computed as they are.
+			circ, err = loadCircuit(file, params, nil)
+		} else {
+			circ, _, err = compiler.New(params).CompileLocalFile(file, nil)
+			// The false value of the unused input.
+			inputs = []*big.Int{new(big.Int)}
+		}
+		if err != nil {
+			return err
+		}
+		result, err := circ.Compute(inputs)
+		if err != nil {
+			return err
+		}
+		mpc.PrintEncodedResults(result, circ.Outputs, resultEncodings)
+		return nil
+	}
+
+	inputSizes, err := circuit.InputSizes(inputFlag)
+	if err != nil {
+		return err
+	}
+	circ, err := loadCircuit(file, params, [][]int{inputSizes})
+	if err != nil {
+		return err
+	}
+	circ.PrintInputs(circuit.IDGarbler, inputFlag)
+
+	input, err := circ.Inputs[0].Parse(inputFlag)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	inputs := []*big.Int{input}
+	if len(circ.Inputs[0].Compound) > 0 {
+		inputs = circuit.IO(circ.Inputs[0].Compound).Split(input)
+	}
+	result, err := circ.Compute(inputs)
+	if err != nil {
+		return err
+	}
+	mpc.PrintEncodedResults(result, circ.Outputs, resultEncodings)
+	return nil
+}
+
 func memProfile(file string) {
 	if len(file) == 0 {
 		return
@@ -220,6 +409,41 @@ func memProfile(file string) {
 	}
 }
 
+// protocolOptions returns the garbler and evaluator options of the
+// command line flags. Each call creates a new seeded random source
+// for the -seed flag so every computation garbles with the same
+// labels.
+func protocolOptions() *circuit.Options {
+	opts := &circuit.Options{
+		Verbose:       verbose,
+		TableChecksum: tableChecksum,
+	}
+	if len(garbleSeed) > 0 {
+		opts.Rand = ot.NewSeededReader([]byte(garbleSeed), "garble")
+	}
+	if len(mpcProfileFile) > 0 {
+		opts.Profile = new(circuit.Profile)
+	}
+	return opts
+}
+
+// writeProfile writes the protocol profile p to the -mpcprofile file
+// in JSON if p is not nil. The evaluator serving several garblers
+// overwrites the file with the profile of the latest computation.
+func writeProfile(p *circuit.Profile) {
+	if p == nil {
+		return
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		log.Fatal("could not encode MPC profile: ", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(mpcProfileFile, data, 0644); err != nil {
+		log.Fatal("could not write MPC profile: ", err)
+	}
+}
+
 func evaluatorMode(oti ot.OT, file string, params *utils.Params,
 	once bool) error {
 
@@ -230,7 +454,7 @@ func evaluatorMode(oti ot.OT, file string, params *utils.Params,
 	}
 	inputSizes[1] = myInputSizes
 
-	ln, err := net.Listen("tcp", port)
+	ln, err := p2p.Listen(port)
 	if err != nil {
 		return err
 	}
@@ -274,9 +498,9 @@ func evaluatorMode(oti ot.OT, file string, params *utils.Params,
 			oPeerInputSizes = peerInputSizes
 		}
 		circ.PrintInputs(circuit.IDEvaluator, inputFlag)
-		if len(circ.Inputs) != 2 {
-			return fmt.Errorf("invalid circuit for 2-party MPC: %d parties",
-				len(circ.Inputs))
+		if err := circ.Inputs.CheckTwoParty(); err != nil {
+			conn.Close()
+			return fmt.Errorf("%s: %v", file, err)
 		}
 
 		input, err := circ.Inputs[1].Parse(inputFlag)
@@ -284,12 +508,19 @@ func evaluatorMode(oti ot.OT, file string, params *utils.Params,
 			conn.Close()
 			return fmt.Errorf("%s: %v", file, err)
 		}
-		result, err := circuit.Evaluator(conn, oti, circ, input, verbose)
+		opts := protocolOptions()
+		opts.OTBatchSize = otBatch
+		opts.Incremental = true
+		result, err := circuit.EvaluatorWithOptions(conn, oti, circ, input,
+			opts)
 		conn.Close()
 		if err != nil && err != io.EOF {
 			return err
 		}
-		mpc.PrintResults(result, circ.Outputs)
+		if err == nil {
+			writeProfile(opts.Profile)
+		}
+		mpc.PrintEncodedResults(result, circ.Outputs, resultEncodings)
 		if once {
 			return nil
 		}
@@ -304,7 +535,7 @@ func garblerMode(oti ot.OT, file string, params *utils.Params) error {
 	}
 	inputSizes[0] = myInputSizes
 
-	nc, err := net.Dial("tcp", port)
+	nc, err := p2p.Dial(port)
 	if err != nil {
 		return err
 	}
@@ -333,20 +564,21 @@ func garblerMode(oti ot.OT, file string, params *utils.Params) error {
 		return err
 	}
 	circ.PrintInputs(circuit.IDGarbler, inputFlag)
-	if len(circ.Inputs) != 2 {
-		return fmt.Errorf("invalid circuit for 2-party MPC: %d parties",
-			len(circ.Inputs))
+	if err := circ.Inputs.CheckTwoParty(); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
 	}
 
 	input, err := circ.Inputs[0].Parse(inputFlag)
 	if err != nil {
 		return fmt.Errorf("%s: %v", file, err)
 	}
-	result, err := circuit.Garbler(conn, oti, circ, input, verbose)
+	opts := protocolOptions()
+	result, err := circuit.GarblerWithOptions(conn, oti, circ, input, opts)
 	if err != nil {
 		return err
 	}
-	mpc.PrintResults(result, circ.Outputs)
+	writeProfile(opts.Profile)
+	mpc.PrintEncodedResults(result, circ.Outputs, resultEncodings)
 
 	return nil
 }
@@ -9,7 +9,6 @@ package main
 import (
 	"fmt"
 	"io"
-	"net"
 	"strings"
 
 	"github.com/markkurossi/mpc"
@@ -26,7 +25,7 @@ func streamEvaluatorMode(oti ot.OT, input input, once bool) error {
 		return err
 	}
 
-	ln, err := net.Listen("tcp", port)
+	ln, err := p2p.Listen(port)
 	if err != nil {
 		return err
 	}
@@ -52,15 +51,19 @@ func streamEvaluatorMode(oti ot.OT, input input, once bool) error {
 			return err
 		}
 
-		outputs, result, err := circuit.StreamEvaluator(conn, oti, input,
-			verbose)
+		opts := protocolOptions()
+		outputs, result, err := circuit.StreamEvaluatorWithOptions(conn, oti,
+			input, opts)
 		conn.Close()
 
 		if err != nil && err != io.EOF {
 			return fmt.Errorf("%s: %v", nc.RemoteAddr(), err)
 		}
+		if err == nil {
+			writeProfile(opts.Profile)
+		}
 
-		mpc.PrintResults(result, outputs)
+		mpc.PrintEncodedResults(result, outputs, resultEncodings)
 		if once {
 			return nil
 		}
@@ -81,7 +84,7 @@ func streamGarblerMode(params *utils.Params, oti ot.OT, input input,
 	if len(args) != 1 || !strings.HasSuffix(args[0], ".mpcl") {
 		return fmt.Errorf("streaming mode takes single MPCL file")
 	}
-	nc, err := net.Dial("tcp", port)
+	nc, err := p2p.Dial(port)
 	if err != nil {
 		return err
 	}
@@ -94,11 +97,15 @@ func streamGarblerMode(params *utils.Params, oti ot.OT, input input,
 	}
 	inputSizes[1] = sizes
 
+	opts := protocolOptions()
+	params.Rand = opts.Rand
+	params.Profile = opts.Profile
 	outputs, result, err := compiler.New(params).StreamFile(
 		conn, oti, args[0], input, inputSizes)
 	if err != nil {
 		return err
 	}
-	mpc.PrintResults(result, outputs)
+	writeProfile(params.Profile)
+	mpc.PrintEncodedResults(result, outputs, resultEncodings)
 	return nil
 }
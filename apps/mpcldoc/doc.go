@@ -444,8 +444,12 @@ func formatType(out Output, ti *ast.TypeInfo, pp bool) *text.Text {
 	case ast.TypeSlice:
 		return txt.Plainf("[]").Append(formatType(out, ti.ElementType, false))
 
-	case ast.TypeStruct:
-		txt.Plain("struct {")
+	case ast.TypeStruct, ast.TypeUnion:
+		if ti.Type == ast.TypeUnion {
+			txt.Plain("union {")
+		} else {
+			txt.Plain("struct {")
+		}
 
 		if pp {
 			var width int
@@ -7,6 +7,11 @@
 package bmr
 
 import (
+	"bytes"
+	"log/slog"
+	"math/big"
+	"os"
+	"slices"
 	"testing"
 
 	"github.com/markkurossi/mpc/circuit"
@@ -51,9 +56,100 @@ func Test3Party(t *testing.T) {
 	}
 
 	// Play player 0.
-	players[0].Verbose = true
+	players[0].SetLogger(slog.New(slog.NewTextHandler(os.Stdout,
+		&slog.HandlerOptions{Level: slog.LevelDebug})))
 	err = players[0].Play()
 	if err != nil {
 		t.Fatalf("Play: %v", err)
 	}
 }
+
+func TestPartyInputs(t *testing.T) {
+	circ, err := circuit.Parse("testdata/3party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	// The player 0 provides the first two inputs.
+	for idx, party := range []int{0, 0, 1} {
+		circ.Inputs[idx].Party = party
+		circ.Inputs[idx].HasParty = true
+	}
+
+	p0, err := NewPlayer(0, 2)
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	p1, err := NewPlayer(1, 2)
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	for _, p := range []*Player{p0, p1} {
+		if err := p.SetCircuit(circ); err != nil {
+			t.Fatalf("failed to set circuit: %v", err)
+		}
+	}
+	clientFrom, clientTo := ot.NewPipe()
+	serverFrom, serverTo := ot.NewPipe()
+	p0.AddPeer(1, clientFrom, serverTo)
+	p1.AddPeer(0, serverFrom, clientTo)
+
+	go p1.Play()
+	if err := p0.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+
+	// The parties must be valid player numbers.
+	circ.Inputs[2].Party = 2
+	p, err := NewPlayer(0, 2)
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	if err := p.SetCircuit(circ); err == nil {
+		t.Errorf("SetCircuit succeeded with invalid party")
+	}
+}
+
+func TestMarshaledPartyInputs(t *testing.T) {
+	circ, err := circuit.Parse("testdata/3party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	// The player 0 provides the first two inputs.
+	for idx, party := range []int{0, 0, 1} {
+		circ.Inputs[idx].Party = party
+		circ.Inputs[idx].HasParty = true
+	}
+	var buf bytes.Buffer
+	if err := circ.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	circ, err = circuit.Unmarshal(&buf)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	parties, err := circ.Inputs.Parties()
+	if err != nil {
+		t.Fatalf("Parties failed: %v", err)
+	}
+	if !slices.Equal(parties, []int{0, 0, 1}) {
+		t.Fatalf("unmarshaled parties %v, expected [0 0 1]", parties)
+	}
+
+	for i := 0; i < 8; i++ {
+		a := int64(i & 1)
+		b := int64((i >> 1) & 1)
+		c := int64((i >> 2) & 1)
+
+		result, err := RunLocal(circ, []*big.Int{
+			big.NewInt(a), big.NewInt(b), big.NewInt(c),
+		})
+		if err != nil {
+			t.Fatalf("RunLocal(%d,%d,%d): %v", a, b, c, err)
+		}
+		expected := a & b & c
+		if len(result) != 1 || result[0].Int64() != expected {
+			t.Errorf("RunLocal(%d,%d,%d)=%v, expected %d",
+				a, b, c, result, expected)
+		}
+	}
+}
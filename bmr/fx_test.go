@@ -163,3 +163,18 @@ func fxkReceiver(pipe ot.IO, ch chan interface{}, b uint) {
 
 	ch <- xb
 }
+
+func TestLabelOT(t *testing.T) {
+	if len(Label{})*8 != 128 {
+		t.Fatalf("label size %d bits, expected 128", len(Label{})*8)
+	}
+	l, err := NewLabel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Label
+	r.FromOT(l.ToOT())
+	if !r.Equal(l) {
+		t.Errorf("FromOT(ToOT(%v))=%v", l, r)
+	}
+}
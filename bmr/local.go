@@ -0,0 +1,122 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package bmr
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/ot"
+)
+
+// RunLocal evaluates the circuit c with the BMR protocol. The
+// function runs all players in-process and connects them with
+// in-memory pipes. The inputs specify the values of the circuit
+// inputs and they are assigned to players by the inputs' party
+// annotations, see Player.SetCircuit. The function returns the
+// circuit outputs that the players computed.
+func RunLocal(c *circuit.Circuit, inputs []*big.Int) ([]*big.Int, error) {
+	if len(inputs) != len(c.Inputs) {
+		return nil, fmt.Errorf("invalid inputs: got %d, expected %d",
+			len(inputs), len(c.Inputs))
+	}
+	parties, err := c.Inputs.Parties()
+	if err != nil {
+		return nil, fmt.Errorf("invalid circuit: %v", err)
+	}
+	var numPlayers int
+	for _, party := range parties {
+		numPlayers = max(numPlayers, party+1)
+	}
+	if numPlayers == 0 {
+		return nil, fmt.Errorf("invalid circuit: no inputs")
+	}
+
+	// Combine the inputs of each player.
+	values := make([]*big.Int, numPlayers)
+	for i := range values {
+		values[i] = big.NewInt(0)
+	}
+	for idx, l := range c.Inputs.Layout() {
+		if inputs[idx] == nil {
+			return nil, fmt.Errorf("input %s is not set", l.Name)
+		}
+		values[parties[idx]].Or(values[parties[idx]],
+			new(big.Int).Lsh(inputs[idx], uint(l.Offset)))
+	}
+
+	players := make([]*Player, numPlayers)
+	for i := range players {
+		p, err := NewPlayer(i, numPlayers)
+		if err != nil {
+			return nil, err
+		}
+		err = p.SetCircuit(c)
+		if err != nil {
+			return nil, err
+		}
+		p.SetInput(values[i])
+		players[i] = p
+	}
+
+	var pipes []*ot.Pipe
+	for i := 0; i < numPlayers; i++ {
+		for j := i + 1; j < numPlayers; j++ {
+			clientFrom, clientTo := ot.NewPipe()
+			serverFrom, serverTo := ot.NewPipe()
+
+			players[i].AddPeer(j, clientFrom, serverTo)
+			players[j].AddPeer(i, serverFrom, clientTo)
+
+			pipes = append(pipes, clientFrom, clientTo, serverFrom, serverTo)
+		}
+	}
+	closePipes := func() {
+		for _, pipe := range pipes {
+			pipe.Close()
+		}
+	}
+
+	results := make([][]*big.Int, numPlayers)
+	errs := make([]error, numPlayers)
+	var once sync.Once
+	var wg sync.WaitGroup
+
+	for i, p := range players {
+		wg.Add(1)
+		go func(i int, p *Player) {
+			defer wg.Done()
+			errs[i] = p.Play()
+			if errs[i] != nil {
+				// Terminate the other players.
+				once.Do(closePipes)
+			}
+		}(i, p)
+	}
+	wg.Wait()
+	once.Do(closePipes)
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("player %d: %v", i, err)
+		}
+	}
+	for i, p := range players {
+		results[i] = p.Result()
+	}
+	for i := 1; i < numPlayers; i++ {
+		for idx, r := range results[i] {
+			if r.Cmp(results[0][idx]) != 0 {
+				return nil, fmt.Errorf("player %d: output %d mismatch: %v != %v",
+					i, idx, r, results[0][idx])
+			}
+		}
+	}
+	return results[0], nil
+}
@@ -0,0 +1,38 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package bmr
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+func TestRunLocal(t *testing.T) {
+	circ, err := circuit.Parse("testdata/3party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	for i := 0; i < 8; i++ {
+		a := int64(i & 1)
+		b := int64((i >> 1) & 1)
+		c := int64((i >> 2) & 1)
+
+		result, err := RunLocal(circ, []*big.Int{
+			big.NewInt(a), big.NewInt(b), big.NewInt(c),
+		})
+		if err != nil {
+			t.Fatalf("RunLocal(%d,%d,%d): %v", a, b, c, err)
+		}
+		expected := a & b & c
+		if len(result) != 1 || result[0].Int64() != expected {
+			t.Errorf("RunLocal(%d,%d,%d)=%v, expected %d",
+				a, b, c, result, expected)
+		}
+	}
+}
@@ -16,4 +16,8 @@ const (
 	OpInit Operand = iota
 	OpFxLambda
 	OpFxR
+	OpGarble
+	OpInput
+	OpInputLabels
+	OpOutputLambda
 )
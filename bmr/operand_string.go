@@ -11,11 +11,15 @@ func _() {
 	_ = x[OpInit-0]
 	_ = x[OpFxLambda-1]
 	_ = x[OpFxR-2]
+	_ = x[OpGarble-3]
+	_ = x[OpInput-4]
+	_ = x[OpInputLabels-5]
+	_ = x[OpOutputLambda-6]
 }
 
-const _Operand_name = "InitFxLambdaFxR"
+const _Operand_name = "InitFxLambdaFxRGarbleInputInputLabelsOutputLambda"
 
-var _Operand_index = [...]uint8{0, 4, 12, 15}
+var _Operand_index = [...]uint8{0, 4, 12, 15, 21, 26, 37, 49}
 
 func (i Operand) String() string {
 	if i >= Operand(len(_Operand_index)-1) {
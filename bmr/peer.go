@@ -11,7 +11,6 @@ import (
 	"io"
 	"math/big"
 
-	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/ot"
 	"github.com/markkurossi/text/superscript"
 )
@@ -63,87 +62,116 @@ func (peer *Peer) consumer() {
 		superscript.Itoa(peer.this.id), superscript.Itoa(peer.id))
 	err := peer.consumerMsgLoop(id)
 	if err != nil {
-		fmt.Printf("%s: %s\n", id, err)
+		peer.this.logger.Error("consumer failed", "id", id, "err", err)
+		peer.this.fail(err)
 	}
 }
 
 func (peer *Peer) consumerMsgLoop(id string) error {
 	peer.this.Debugf("%s\n", id)
+	this := peer.this
 	for {
 		v, err := peer.from.ReceiveByte()
 		if err != nil {
 			if err != io.EOF {
 				return err
 			}
+			// The peer has closed the connection. This terminates
+			// the protocol unless it is already completed.
+			this.fail(io.ErrUnexpectedEOF)
 			return nil
 		}
 		op := Operand(v)
 		switch op {
 		case OpInit:
-			peer.this.Debugf("%s: %s\n", id, op)
+			this.Debugf("%s: %s\n", id, op)
 			err = peer.otReceiver.InitReceiver(peer.from)
 			if err != nil {
 				return err
 			}
+
 		case OpFxLambda:
 			gid, err := peer.from.ReceiveUint32()
 			if err != nil {
 				return err
 			}
-			peer.this.Debugf("%s: %s: gid=%v\n", id, op, gid)
-			gate := peer.this.circ.Gates[gid]
-			lv := peer.this.lambda.Bit(int(gate.Input1))
+			this.Debugf("%s: %s: gid=%v\n", id, op, gid)
+			if gid >= this.circ.NumGates {
+				return fmt.Errorf("%s: %s: invalid gate %d", id, op, gid)
+			}
+			gate := this.circ.Gates[gid]
+			lv := this.lambda.Bit(int(gate.Input1))
 
 			xb, err := FxReceive(peer.otReceiver, lv)
 			if err != nil {
 				return err
 			}
-			peer.this.m.Lock()
-			v := peer.this.luv.Bit(gid)
+			this.m.Lock()
+			v := this.luv.Bit(gid)
 			v ^= xb
-			peer.this.luv.SetBit(peer.this.luv, gid, v)
-			peer.this.completions++
-			if peer.this.completions == peer.this.syncBarrier(1) {
-				peer.this.c.Signal()
-			}
-			peer.this.m.Unlock()
+			this.luv.SetBit(this.luv, gid, v)
+			this.complete(op)
+			this.m.Unlock()
 
 		case OpFxR:
 			gid, err := peer.from.ReceiveUint32()
 			if err != nil {
 				return err
 			}
-			peer.this.Debugf("%s: %s: gid=%v\n", id, op, gid)
-			gate := peer.this.circ.Gates[gid]
-			luvws := []*big.Int{
-				peer.this.luvw0,
-				peer.this.luvw1,
-				peer.this.luvw2,
-				peer.this.luvw3,
-			}
-			// XXX patch luvws based on gate.Op
-			switch gate.Op {
-			case circuit.AND:
-			default:
-				return fmt.Errorf("gate %v not implemented yet", gate.Op)
-			}
-			var xbs []Label
-			for _, luvw := range luvws {
-				xb, err := FxkReceive(peer.otReceiver, luvw.Bit(gid))
+			this.Debugf("%s: %s: gid=%v\n", id, op, gid)
+			if gid >= this.circ.NumGates || this.rj[gid][0] == nil {
+				return fmt.Errorf("%s: %s: invalid gate %d", id, op, gid)
+			}
+
+			// Wait until our shares of λuvw are computed.
+			this.m.Lock()
+			for this.err == nil && !this.luvwReady {
+				this.c.Wait()
+			}
+			err = this.err
+			var luvw [4]uint
+			for row := 0; row < 4; row++ {
+				luvw[row] = this.luvw[row].Bit(gid)
+			}
+			this.m.Unlock()
+			if err != nil {
+				return err
+			}
+
+			var xbs [4]Label
+			for row := 0; row < 4; row++ {
+				xbs[row], err = FxkReceive(peer.otReceiver, luvw[row])
 				if err != nil {
 					return err
 				}
-				xbs = append(xbs, xb)
 			}
-			peer.this.m.Lock()
-			for i := 0; i < len(xbs); i++ {
-				peer.this.rj[gid][i].Xor(xbs[i])
+			this.m.Lock()
+			for row := 0; row < 4; row++ {
+				this.rj[gid][row][peer.id].Xor(xbs[row])
 			}
-			peer.this.completions++
-			if peer.this.completions == peer.this.syncBarrier(2) {
-				peer.this.c.Signal()
+			this.complete(op)
+			this.m.Unlock()
+
+		case OpGarble, OpInput, OpInputLabels, OpOutputLambda:
+			arg, err := peer.from.ReceiveUint32()
+			if err != nil {
+				return err
+			}
+			data, err := peer.from.ReceiveData()
+			if err != nil {
+				return err
+			}
+			this.Debugf("%s: %s: arg=%v, len=%v\n", id, op, arg, len(data))
+
+			this.m.Lock()
+			err = peer.handleData(op, arg, data)
+			if err == nil {
+				this.complete(op)
+			}
+			this.m.Unlock()
+			if err != nil {
+				return fmt.Errorf("%s: %s: %v", id, op, err)
 			}
-			peer.this.m.Unlock()
 
 		default:
 			return fmt.Errorf("%s: %s: not implemented", id, op)
@@ -152,3 +180,46 @@ func (peer *Peer) consumerMsgLoop(id string) error {
 		peer.to.Flush()
 	}
 }
+
+// handleData handles the data message op with the argument arg. The
+// caller must hold the player's mutex.
+func (peer *Peer) handleData(op Operand, arg int, data []byte) error {
+	this := peer.this
+	var l Label
+
+	switch op {
+	case OpGarble:
+		if arg >= this.circ.NumGates || this.tables[arg][0] == nil {
+			return fmt.Errorf("invalid gate %d", arg)
+		}
+		if len(data) != 4*this.numPlayers*len(l) {
+			return fmt.Errorf("invalid garbled gate length %d", len(data))
+		}
+		for row := 0; row < 4; row++ {
+			for j := 0; j < this.numPlayers; j++ {
+				copy(l[:], data)
+				data = data[len(l):]
+				this.tables[arg][row][j].Xor(l)
+			}
+		}
+
+	case OpInput:
+		this.masked.Xor(this.masked, new(big.Int).SetBytes(data))
+
+	case OpInputLabels:
+		if len(data)%len(l) != 0 ||
+			arg+len(data)/len(l) > len(this.inputLabels) {
+			return fmt.Errorf("invalid input labels: offset=%d, len=%d",
+				arg, len(data))
+		}
+		for i := 0; len(data) > 0; i++ {
+			copy(l[:], data)
+			data = data[len(l):]
+			this.inputLabels[arg+i][peer.id] = l
+		}
+
+	case OpOutputLambda:
+		this.outLambda.Xor(this.outLambda, new(big.Int).SetBytes(data))
+	}
+	return nil
+}
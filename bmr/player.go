@@ -7,71 +7,118 @@
 package bmr
 
 import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
+	"encoding/binary"
 	"fmt"
+	"log/slog"
 	"math/big"
+	"os"
+	"strings"
 	"sync"
 
 	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
 	"github.com/markkurossi/text/superscript"
 	"github.com/markkurossi/text/symbols"
 )
 
 const (
-	// Security parameter k specifies the label sizes in bits.
-	k = 32
+	// Security parameter k specifies the label sizes in bits. The
+	// labels are transferred with oblivious transfers so k matches
+	// the OT label size. The labels also key the AES-based PRF of
+	// the garbling so k must be a valid AES key size. The value sets
+	// the size of the garbled gates, 4·n·k/8 bytes from each player
+	// per AND and OR gate, and of the input label messages so all
+	// players must use the same k.
+	k = ot.LabelBits
 )
 
 // Player implements a multi-party player.
 type Player struct {
-	Verbose    bool
+	// Verbose enables the debugging messages of the player. If set
+	// and no logger is set with SetLogger, Play installs a logger
+	// that writes the messages to os.Stdout at the debug level.
+	//
+	// Deprecated: use SetLogger.
+	Verbose bool
+
+	logger     *slog.Logger
+	hasLogger  bool
 	id         int
 	numPlayers int
 	r          Label
 	peers      []*Peer
 	circ       *circuit.Circuit
+	parties    []int
+	input      *big.Int
 	lambda     *big.Int
+	wires      []Wire
+	numGarbled int
 
 	// Everything below is synchronized with m.
 	m           *sync.Mutex
 	c           *sync.Cond
-	completions int
+	err         error
+	completions map[Operand]int
+	luvwReady   bool
 	luv         *big.Int
 
-	// The XOR shares luvw{0,1,2,3} matching λuvw, λuv̄w, λūvw, λūv̄w.
-	luvw0 *big.Int
-	luvw1 *big.Int
-	luvw2 *big.Int
-	luvw3 *big.Int
+	// The XOR shares luvw{0,1,2,3} matching λuvw, λuv̄w, λūvw, λūv̄w.
+	luvw [4]*big.Int
 
-	// The XOR shares of Rj matching ρij,α,β
-	rj [][]Label
+	// The XOR shares of Rj·λuvw matching ρij,α,β. The shares are
+	// indexed by the gate, the garbled row, and the player j.
+	rj [][4][]Label
+
+	// The garbled gates combined from all players' garbled gate
+	// shares. The rows are indexed like rj.
+	tables [][4][]Label
+
+	// The public values Λ of the input wires, the input wire labels
+	// of all players, and the permutation bits λ of the output
+	// wires.
+	masked      *big.Int
+	inputLabels [][]Label
+	outLambda   *big.Int
+
+	// The circuit outputs that the player computed.
+	result []*big.Int
 }
 
 // NewPlayer creates a new multi-party player.
 func NewPlayer(id, numPlayers int) (*Player, error) {
 	m := new(sync.Mutex)
 	return &Player{
-		id:         id,
-		numPlayers: numPlayers,
-		peers:      make([]*Peer, numPlayers),
-		m:          m,
-		c:          sync.NewCond(m),
-		luv:        big.NewInt(0),
-		luvw0:      big.NewInt(0),
-		luvw1:      big.NewInt(0),
-		luvw2:      big.NewInt(0),
-		luvw3:      big.NewInt(0),
+		logger:      p2p.NopLogger(),
+		id:          id,
+		numPlayers:  numPlayers,
+		peers:       make([]*Peer, numPlayers),
+		m:           m,
+		c:           sync.NewCond(m),
+		completions: make(map[Operand]int),
 	}, nil
 }
 
-// Debugf prints debugging message if Verbose debugging is enabled for
+// SetLogger sets the logger of the player. The protocol phases are
+// logged at the info level and the intermediate values at the debug
+// level. By default, the player does not log anything. The logger
+// must be set before the player is started.
+func (p *Player) SetLogger(logger *slog.Logger) {
+	p.logger = logger
+	p.hasLogger = true
+}
+
+// Debugf logs a debugging message if the debug level is enabled for
 // this Player.
 func (p *Player) Debugf(format string, a ...interface{}) {
-	if !p.Verbose {
+	if !p.logger.Enabled(context.Background(), slog.LevelDebug) {
 		return
 	}
-	fmt.Printf(format, a...)
+	p.logger.Debug(strings.TrimSuffix(fmt.Sprintf(format, a...), "\n"))
 }
 
 // IDString returns the player ID as string.
@@ -79,18 +126,47 @@ func (p *Player) IDString() string {
 	return superscript.Itoa(p.id)
 }
 
-// SetCircuit sets the circuit that is evaluated.
+// SetCircuit sets the circuit that is evaluated. The circuit inputs
+// are assigned to players by their party annotations. Without the
+// annotations, the circuit must have one input for each player.
 func (p *Player) SetCircuit(c *circuit.Circuit) error {
-	if len(c.Inputs) != p.numPlayers {
+	parties, err := c.Inputs.Parties()
+	if err != nil {
+		return fmt.Errorf("invalid circuit: %v", err)
+	}
+	for idx, party := range parties {
+		if party >= p.numPlayers {
+			return fmt.Errorf(
+				"invalid circuit: party %d of input %s >= #players=%d",
+				party, c.Inputs[idx].Name, p.numPlayers)
+		}
+	}
+	annotated := len(c.Inputs) > 0 && c.Inputs[0].HasParty
+	if !annotated && len(c.Inputs) != p.numPlayers {
 		return fmt.Errorf("invalid circuit: #inputs=%d != #players=%d",
 			len(c.Inputs), p.numPlayers)
 	}
 	p.circ = c
+	p.parties = parties
 	return nil
 }
 
-// Play runs the protocol with the peers.
+// SetInput sets the values of the circuit inputs that the player
+// provides. The values are combined into one value at the input
+// offsets. The other players' input bits are ignored.
+func (p *Player) SetInput(input *big.Int) {
+	p.input = input
+}
+
+// Play runs the protocol with the peers. The circuit outputs are
+// available with Result after the function returns successfully.
 func (p *Player) Play() error {
+	if p.Verbose && !p.hasLogger {
+		p.logger = slog.New(slog.NewTextHandler(os.Stdout,
+			&slog.HandlerOptions{
+				Level: slog.LevelDebug,
+			}))
+	}
 	var count int
 	for _, peer := range p.peers {
 		if peer != nil {
@@ -103,19 +179,41 @@ func (p *Player) Play() error {
 	}
 
 	// Init circuit-dependent fields.
-	p.rj = make([][]Label, p.circ.NumGates)
+	p.result = nil
+	p.numGarbled = 0
+	p.rj = make([][4][]Label, p.circ.NumGates)
+	p.tables = make([][4][]Label, p.circ.NumGates)
 	for i := 0; i < p.circ.NumGates; i++ {
 		switch p.circ.Gates[i].Op {
-		case circuit.AND:
-			p.rj[i] = make([]Label, 4)
+		case circuit.XOR, circuit.XNOR, circuit.INV:
+		case circuit.AND, circuit.OR:
+			for row := 0; row < 4; row++ {
+				p.rj[i][row] = make([]Label, p.numPlayers)
+				p.tables[i][row] = make([]Label, p.numPlayers)
+			}
+			p.numGarbled++
 		default:
-			return fmt.Errorf("gate %v not implemented yet", p.circ.Gates[i].Op)
+			return fmt.Errorf("gate %v not implemented yet",
+				p.circ.Gates[i].Op)
 		}
 	}
+	p.luv = big.NewInt(0)
+	for row := 0; row < 4; row++ {
+		p.luvw[row] = big.NewInt(0)
+	}
+	p.masked = big.NewInt(0)
+	p.inputLabels = make([][]Label, p.circ.Inputs.Size())
+	for i := range p.inputLabels {
+		p.inputLabels[i] = make([]Label, p.numPlayers)
+	}
+	p.outLambda = big.NewInt(0)
+	if p.input == nil {
+		p.input = big.NewInt(0)
+	}
 
 	p.Debugf("BMR: #gates=%v\n", p.circ.NumGates)
 
-	p.Debugf("Offline Phase...\n")
+	p.logger.Info("offline phase", "player", p.id)
 	err := p.offlinePhase()
 	if err != nil {
 		return err
@@ -127,12 +225,81 @@ func (p *Player) Play() error {
 		return err
 	}
 
-	p.Debugf("Online Phase...\n")
 	err = p.fgc()
 	if err != nil {
 		return err
 	}
+	err = p.garble()
+	if err != nil {
+		return err
+	}
+
+	p.logger.Info("online phase", "player", p.id)
+	err = p.onlinePhase()
+	if err != nil {
+		return err
+	}
+	p.result, err = p.eval()
+	return err
+}
+
+// Result returns the circuit outputs that the player computed. The
+// function returns nil if the protocol has not completed.
+func (p *Player) Result() []*big.Int {
+	return p.result
+}
+
+// wait waits until the player has received count messages op from
+// its peers.
+func (p *Player) wait(op Operand, count int) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	for p.completions[op] < count {
+		if p.err != nil {
+			return p.err
+		}
+		p.c.Wait()
+	}
+	return nil
+}
+
+// complete records a received message op. The caller must hold the
+// player's mutex.
+func (p *Player) complete(op Operand) {
+	p.completions[op]++
+	p.c.Broadcast()
+}
+
+// fail terminates the protocol with the error err.
+func (p *Player) fail(err error) {
+	p.m.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.c.Broadcast()
+	p.m.Unlock()
+}
 
+// broadcast sends the message op with the argument arg and the data
+// to all peers.
+func (p *Player) broadcast(op Operand, arg int, data []byte) error {
+	for _, peer := range p.peers {
+		if peer == nil {
+			continue
+		}
+		if err := peer.to.SendByte(byte(op)); err != nil {
+			return err
+		}
+		if err := peer.to.SendUint32(arg); err != nil {
+			return err
+		}
+		if err := peer.to.SendData(data); err != nil {
+			return err
+		}
+		if err := peer.to.Flush(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -150,21 +317,19 @@ func (p *Player) offlinePhase() error {
 	// bits initially for all wires but later reset the output bits of
 	// XOR gates.
 	p.lambda, err = rand.Int(rand.Reader,
-		big.NewInt(int64((1<<p.circ.NumWires)-1)))
+		new(big.Int).Lsh(big.NewInt(1), uint(p.circ.NumWires)))
 	if err != nil {
 		return err
 	}
 
 	// Optimization for Step 6: set input wire lambdas to 0 for other
 	// peers' inputs.
-	var inputIndex int
-	for id, input := range p.circ.Inputs {
-		if id != p.id {
-			for i := 0; i < int(input.Type.Bits); i++ {
-				p.lambda.SetBit(p.lambda, inputIndex+i, 0)
+	for idx, l := range p.circ.Inputs.Layout() {
+		if p.parties[idx] != p.id {
+			for i := 0; i < l.Bits; i++ {
+				p.lambda.SetBit(p.lambda, l.Offset+i, 0)
 			}
 		}
-		inputIndex += int(input.Type.Bits)
 	}
 
 	wires := make([]Wire, p.circ.NumWires)
@@ -191,29 +356,43 @@ func (p *Player) offlinePhase() error {
 		lambda(p.lambda, len(wires)))
 
 	// Step 3: patch output wires and permutation bits for XOR output
-	// wires.
+	// wires. The XNOR and INV gates are XOR gates where the player 0
+	// negates the output permutation bit. The input v of INV gates is
+	// constant 0 with the 0-label.
 	for i := 0; i < p.circ.NumGates; i++ {
 		gate := p.circ.Gates[i]
-		if gate.Op != circuit.XOR {
+		var neg uint
+		switch gate.Op {
+		case circuit.XOR:
+		case circuit.XNOR, circuit.INV:
+			if p.id == 0 {
+				neg = 1
+			}
+		default:
 			continue
 		}
 		u := int(gate.Input0)
-		v := int(gate.Input1)
 		w := int(gate.Output)
 
 		// 3.a: set permutation bit: λ_w = λ_u ⊕ λ_v
 
 		lu := p.lambda.Bit(u)
-		lv := p.lambda.Bit(v)
+		var lv uint
+		var lv0 Label
+		if gate.Op != circuit.INV {
+			v := int(gate.Input1)
+			lv = p.lambda.Bit(v)
+			lv0 = wires[v].L0
+		}
 
-		lo := lu ^ lv
+		lo := lu ^ lv ^ neg
 		p.lambda.SetBit(p.lambda, w, lo)
 
 		p.Debugf("%c[%d]: %v ^ %v = %v\n", symbols.Lambda, w, lu, lv, lo)
 
 		// 3.b: set garbled label on wire 0: k_{w,0} = k_{u,0} ⊕ k_{v,0}
 		wires[w].L0 = wires[u].L0
-		wires[w].L0.Xor(wires[v].L0)
+		wires[w].L0.Xor(lv0)
 
 		// 3.b: set garbled label on wire 1: k_{w,1} = k_{w,0} ⊕ R^i
 		wires[w].L1 = wires[w].L0
@@ -227,11 +406,9 @@ func (p *Player) offlinePhase() error {
 	p.Debugf("%c%s:\t%v\n", symbols.Lambda, p.IDString(),
 		lambda(p.lambda, len(wires)))
 
-	return nil
-}
+	p.wires = wires
 
-func (p *Player) syncBarrier(nth int) int {
-	return p.circ.NumGates * (len(p.peers) - 1) * nth
+	return nil
 }
 
 // fgc computes the multiparty garbled circuit (3.1.2 The Protocol for
@@ -244,7 +421,7 @@ func (p *Player) fgc() (err error) {
 	for i := 0; i < p.circ.NumGates; i++ {
 		gate := p.circ.Gates[i]
 		switch gate.Op {
-		case circuit.AND:
+		case circuit.AND, circuit.OR:
 			lu := p.lambda.Bit(int(gate.Input0))
 			lv := p.lambda.Bit(int(gate.Input1))
 
@@ -271,60 +448,82 @@ func (p *Player) fgc() (err error) {
 				uv ^= r
 			}
 			luv.SetBit(luv, i, uv)
-
-		default:
-			return fmt.Errorf("gate %v not implemented yet", gate.Op)
 		}
 	}
 
 	p.m.Lock()
 	p.luv.Xor(p.luv, luv)
-	for p.completions < p.syncBarrier(1) {
-		p.c.Wait()
-	}
 	p.m.Unlock()
 
-	fmt.Printf("Player%s: %cuv =%v\n", p.IDString(), symbols.Lambda,
+	err = p.wait(OpFxLambda, p.numGarbled*(p.numPlayers-1))
+	if err != nil {
+		return err
+	}
+
+	p.Debugf("Player%s: %cuv =%v\n", p.IDString(), symbols.Lambda,
 		lambda(p.luv, p.circ.NumGates))
 
-	// Step 2.
+	// Step 2: compute the XOR shares of the garbled rows
+	// λuvw{0,1,2,3}. The row α,β has the value f(λu⊕α, λv⊕β) ⊕ λw
+	// and the player 0 adds the constant terms of the shares.
+	p.m.Lock()
 	for i := 0; i < p.circ.NumGates; i++ {
 		gate := p.circ.Gates[i]
 		switch gate.Op {
-		case circuit.AND:
+		case circuit.AND, circuit.OR:
 			lu := p.lambda.Bit(int(gate.Input0))
 			lv := p.lambda.Bit(int(gate.Input1))
 			lw := p.lambda.Bit(int(gate.Output))
 
 			luv := p.luv.Bit(i)
 
-			// λuvw = λuv ⊕ λw
-			p.luvw0.SetBit(p.luvw0, i, luv^lw)
-
-			// λuv̄w = λuv ⊕ λu ⊕ λw
-			p.luvw1.SetBit(p.luvw1, i, luv^lu&lw)
+			for row := 0; row < 4; row++ {
+				alpha := uint(row >> 1)
+				beta := uint(row & 1)
 
-			// λūvw = λuv ⊕ λv ⊕ λw
-			p.luvw2.SetBit(p.luvw2, i, luv^lv&lw)
-
-			// λūv̄w = λuv ⊕ λu ⊕ λv ⊕ λw
-			p.luvw3.SetBit(p.luvw3, i, luv^lu^lv&lw)
-
-		default:
-			return fmt.Errorf("gate %v not implemented yet", gate.Op)
+				// (λu⊕α)(λv⊕β) = λuv ⊕ βλu ⊕ αλv ⊕ αβ
+				v := luv ^ beta&lu ^ alpha&lv ^ lw
+				if p.id == 0 {
+					v ^= alpha & beta
+				}
+				if gate.Op == circuit.OR {
+					// a∨b = a⊕b⊕ab
+					v ^= lu ^ lv
+					if p.id == 0 {
+						v ^= alpha ^ beta
+					}
+				}
+				p.luvw[row].SetBit(p.luvw[row], i, v)
+			}
 		}
 	}
-	fmt.Printf("Player%s: %cuvw=%v\n", p.IDString(), symbols.Lambda,
-		lambda(p.luvw0, p.circ.NumGates))
-	fmt.Printf("Player%s: %cuv̄w=%v\n", p.IDString(), symbols.Lambda,
-		lambda(p.luvw1, p.circ.NumGates))
-	fmt.Printf("Player%s: %cūvw=%v\n", p.IDString(), symbols.Lambda,
-		lambda(p.luvw2, p.circ.NumGates))
-	fmt.Printf("Player%s: %cūv̄w=%v\n", p.IDString(), symbols.Lambda,
-		lambda(p.luvw3, p.circ.NumGates))
+	p.luvwReady = true
+	p.c.Broadcast()
+	p.m.Unlock()
 
-	// Step 3: for i!=j, run Fxk(R,luvw)
+	p.Debugf("Player%s: %cuvw=%v\n", p.IDString(), symbols.Lambda,
+		lambda(p.luvw[0], p.circ.NumGates))
+	p.Debugf("Player%s: %cuv̄w=%v\n", p.IDString(), symbols.Lambda,
+		lambda(p.luvw[1], p.circ.NumGates))
+	p.Debugf("Player%s: %cūvw=%v\n", p.IDString(), symbols.Lambda,
+		lambda(p.luvw[2], p.circ.NumGates))
+	p.Debugf("Player%s: %cūv̄w=%v\n", p.IDString(), symbols.Lambda,
+		lambda(p.luvw[3], p.circ.NumGates))
+
+	// Step 3: for i!=j, run Fxk(R,luvw). Our own share of
+	// Ri·λuvw is computed locally.
 	for gid := 0; gid < p.circ.NumGates; gid++ {
+		if p.rj[gid][0] == nil {
+			continue
+		}
+		p.m.Lock()
+		for row := 0; row < 4; row++ {
+			if p.luvw[row].Bit(gid) == 1 {
+				p.rj[gid][row][p.id].Xor(p.r)
+			}
+		}
+		p.m.Unlock()
+
 		for _, peer := range p.peers {
 			if peer == nil {
 				continue
@@ -337,35 +536,241 @@ func (p *Player) fgc() (err error) {
 			if err != nil {
 				return err
 			}
-			for n := 0; n < len(p.rj[gid]); n++ {
+			for row := 0; row < 4; row++ {
 				r, err := FxkSend(peer.otSender, p.r)
 				if err != nil {
 					return err
 				}
 				p.m.Lock()
-				p.rj[gid][n].Xor(r)
+				p.rj[gid][row][p.id].Xor(r)
 				p.m.Unlock()
 			}
 		}
 	}
+	err = p.wait(OpFxR, p.numGarbled*(p.numPlayers-1))
+	if err != nil {
+		return err
+	}
+
+	for gid := 0; gid < p.circ.NumGates; gid++ {
+		if p.rj[gid][0] == nil {
+			continue
+		}
+		var labels []string
+		for _, l := range p.rj[gid] {
+			labels = append(labels, fmt.Sprintf("%v", l))
+		}
+		p.Debugf("Player%s: rj[%v]:\t%s\n", p.IDString(), gid,
+			strings.Join(labels, " "))
+	}
+
+	return nil
+}
+
+// garble computes the player's shares of the garbled gates and
+// exchanges them with the peers. The share of the row α,β for the
+// player j is:
+//
+//	F(k^i_{u,α}, g|j) ⊕ F(k^i_{v,β}, g|j) ⊕ (Rj·λuvw)^i [⊕ k^i_{w,0}]
+//
+// where the 0-label is added to the player's own entry. Combined, the
+// shares of all players encrypt the label k^j_{w,λuvw} with the
+// input wire labels of all players.
+func (p *Player) garble() error {
+	for gid := 0; gid < p.circ.NumGates; gid++ {
+		if p.rj[gid][0] == nil {
+			continue
+		}
+		gate := p.circ.Gates[gid]
+		u := p.wires[gate.Input0]
+		v := p.wires[gate.Input1]
+		ku := [2]cipher.Block{newPRF(u.L0), newPRF(u.L1)}
+		kv := [2]cipher.Block{newPRF(v.L0), newPRF(v.L1)}
+
+		data := make([]byte, 0, 4*p.numPlayers*len(Label{}))
+		p.m.Lock()
+		for row := 0; row < 4; row++ {
+			for j := 0; j < p.numPlayers; j++ {
+				l := prf(ku[row>>1], gid, j, 0)
+				l.Xor(prf(kv[row&1], gid, j, 1))
+				l.Xor(p.rj[gid][row][j])
+				if j == p.id {
+					l.Xor(p.wires[gate.Output].L0)
+				}
+				p.tables[gid][row][j].Xor(l)
+				data = append(data, l[:]...)
+			}
+		}
+		p.m.Unlock()
+
+		err := p.broadcast(OpGarble, gid, data)
+		if err != nil {
+			return err
+		}
+	}
+	return p.wait(OpGarble, p.numGarbled*(p.numPlayers-1))
+}
+
+// labelsPerMessage specifies how many input wire labels are sent in
+// one message.
+const labelsPerMessage = 1024
+
+// onlinePhase implements the BMR Online Phase (BMR Figure 3 - Page
+// 9). The players publish the values Λ of their input wires and then
+// their labels of all input wires. The permutation bits of the output
+// wires are published so that the players can decode the outputs.
+func (p *Player) onlinePhase() error {
+	// Step 1: send Λw = xw ⊕ λw for our input wires. The other
+	// players' permutation bits of our input wires are 0.
+	masked := big.NewInt(0)
+	for idx, l := range p.circ.Inputs.Layout() {
+		if p.parties[idx] != p.id {
+			continue
+		}
+		for i := 0; i < l.Bits; i++ {
+			w := l.Offset + i
+			masked.SetBit(masked, w, p.input.Bit(w)^p.lambda.Bit(w))
+		}
+	}
 	p.m.Lock()
-	for p.completions < p.syncBarrier(2) {
-		p.c.Wait()
+	p.masked.Xor(p.masked, masked)
+	p.m.Unlock()
+
+	err := p.broadcast(OpInput, 0, masked.Bytes())
+	if err != nil {
+		return err
+	}
+	err = p.wait(OpInput, p.numPlayers-1)
+	if err != nil {
+		return err
 	}
+
+	// Step 2: send our labels k^i_{w,Λw} of all input wires.
+	numInputs := p.circ.Inputs.Size()
+	var messages int
+	for offset := 0; offset < numInputs; offset += labelsPerMessage {
+		end := min(offset+labelsPerMessage, numInputs)
+		var data []byte
+
+		p.m.Lock()
+		for w := offset; w < end; w++ {
+			l := p.wires[w].L0
+			if p.masked.Bit(w) == 1 {
+				l = p.wires[w].L1
+			}
+			p.inputLabels[w][p.id] = l
+			data = append(data, l[:]...)
+		}
+		p.m.Unlock()
+
+		err = p.broadcast(OpInputLabels, offset, data)
+		if err != nil {
+			return err
+		}
+		messages++
+	}
+
+	// Send the permutation bits of the output wires.
+	numOutputs := p.circ.Outputs.Size()
+	outLambda := new(big.Int).Rsh(p.lambda,
+		uint(p.circ.NumWires-numOutputs))
+	p.m.Lock()
+	p.outLambda.Xor(p.outLambda, outLambda)
 	p.m.Unlock()
 
-	for gid := 0; gid < p.circ.NumGates; gid++ {
-		p.Debugf("Player%s: rj[%v]:\t", p.IDString(), gid)
-		for idx, l := range p.rj[gid] {
-			if idx > 0 {
-				p.Debugf(" ")
+	err = p.broadcast(OpOutputLambda, 0, outLambda.Bytes())
+	if err != nil {
+		return err
+	}
+
+	err = p.wait(OpInputLabels, messages*(p.numPlayers-1))
+	if err != nil {
+		return err
+	}
+	return p.wait(OpOutputLambda, p.numPlayers-1)
+}
+
+// eval evaluates the garbled circuit and returns the circuit
+// outputs. The player learns the public value Λ of each gate output
+// from its own label of the output wire.
+func (p *Player) eval() ([]*big.Int, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	ext := new(big.Int).Set(p.masked)
+	labels := make([][]Label, p.circ.NumWires)
+	copy(labels, p.inputLabels)
+
+	for gid, gate := range p.circ.Gates {
+		u := int(gate.Input0)
+		v := int(gate.Input1)
+		w := int(gate.Output)
+		labels[w] = make([]Label, p.numPlayers)
+
+		switch gate.Op {
+		case circuit.XOR, circuit.XNOR:
+			ext.SetBit(ext, w, ext.Bit(u)^ext.Bit(v))
+			for j := 0; j < p.numPlayers; j++ {
+				labels[w][j] = labels[u][j]
+				labels[w][j].Xor(labels[v][j])
+			}
+
+		case circuit.INV:
+			ext.SetBit(ext, w, ext.Bit(u))
+			copy(labels[w], labels[u])
+
+		case circuit.AND, circuit.OR:
+			row := ext.Bit(u)<<1 | ext.Bit(v)
+			copy(labels[w], p.tables[gid][row])
+			for i := 0; i < p.numPlayers; i++ {
+				ku := newPRF(labels[u][i])
+				kv := newPRF(labels[v][i])
+				for j := 0; j < p.numPlayers; j++ {
+					labels[w][j].Xor(prf(ku, gid, j, 0))
+					labels[w][j].Xor(prf(kv, gid, j, 1))
+				}
+			}
+			own := labels[w][p.id]
+			if own.Equal(p.wires[w].L0) {
+				ext.SetBit(ext, w, 0)
+			} else if own.Equal(p.wires[w].L1) {
+				ext.SetBit(ext, w, 1)
+			} else {
+				return nil, fmt.Errorf("gate %d: invalid label %v", gid, own)
 			}
-			p.Debugf("%v", l)
 		}
-		p.Debugf("\n")
 	}
 
-	return nil
+	// The outputs are the public values Λ of the output wires
+	// XORed with their permutation bits.
+	numOutputs := p.circ.Outputs.Size()
+	result := new(big.Int).Rsh(ext, uint(p.circ.NumWires-numOutputs))
+	result.Xor(result, p.outLambda)
+	mask := new(big.Int).Lsh(big.NewInt(1), uint(numOutputs))
+	result.And(result, mask.Sub(mask, big.NewInt(1)))
+
+	return p.circ.Outputs.Split(result), nil
+}
+
+// newPRF creates the pseudorandom function F keyed with the label
+// key.
+func newPRF(key Label) cipher.Block {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err)
+	}
+	return block
+}
+
+// prf computes the pseudorandom function F(k, g|j|pos) for the gate
+// gid, the player j, and the gate input pos.
+func prf(k cipher.Block, gid, j int, pos byte) Label {
+	var in, out Label
+	binary.BigEndian.PutUint32(in[0:], uint32(gid))
+	binary.BigEndian.PutUint32(in[4:], uint32(j))
+	in[8] = pos
+	k.Encrypt(out[:], in[:])
+	return out
 }
 
 func lambda(v *big.Int, w int) string {
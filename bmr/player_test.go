@@ -0,0 +1,260 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package bmr
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// play runs the circuit with the players connected directly over
+// pipes. The inputs are the combined input values of the players.
+// The function returns the circuit outputs of each player.
+func play(t *testing.T, circ *circuit.Circuit, inputs []*big.Int) [][]*big.Int {
+	var results [][]*big.Int
+	for _, p := range playPlayers(t, circ, inputs) {
+		results = append(results, p.Result())
+	}
+	return results
+}
+
+// playPlayers runs the circuit like play and returns the players.
+func playPlayers(t *testing.T, circ *circuit.Circuit,
+	inputs []*big.Int) []*Player {
+
+	n := len(inputs)
+	players := make([]*Player, n)
+	for i := range players {
+		p, err := NewPlayer(i, n)
+		if err != nil {
+			t.Fatalf("failed to create player: %v", err)
+		}
+		if err := p.SetCircuit(circ); err != nil {
+			t.Fatalf("failed to set circuit: %v", err)
+		}
+		p.SetInput(inputs[i])
+		players[i] = p
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			clientFrom, clientTo := ot.NewPipe()
+			serverFrom, serverTo := ot.NewPipe()
+
+			players[i].AddPeer(j, clientFrom, serverTo)
+			players[j].AddPeer(i, serverFrom, clientTo)
+		}
+	}
+
+	errs := make(chan error, n)
+	for _, p := range players {
+		go func(p *Player) {
+			errs <- p.Play()
+		}(p)
+	}
+	for range players {
+		if err := <-errs; err != nil {
+			t.Fatalf("Play: %v", err)
+		}
+	}
+	return players
+}
+
+func parseCircuit(t *testing.T, data string) *circuit.Circuit {
+	circ, err := circuit.ParseBristol(bytes.NewReader([]byte(data)))
+	if err != nil {
+		t.Fatalf("failed to parse circuit: %v", err)
+	}
+	return circ
+}
+
+var gateTests = []struct {
+	gate string
+	f    func(a, b int64) int64
+}{
+	{
+		gate: "2 1 0 1 2 AND",
+		f:    func(a, b int64) int64 { return a & b },
+	},
+	{
+		gate: "2 1 0 1 2 OR",
+		f:    func(a, b int64) int64 { return a | b },
+	},
+	{
+		gate: "2 1 0 1 2 XOR",
+		f:    func(a, b int64) int64 { return a ^ b },
+	},
+	{
+		gate: "2 1 0 1 2 XNOR",
+		f:    func(a, b int64) int64 { return 1 ^ a ^ b },
+	},
+	{
+		gate: "1 1 0 2 INV",
+		f:    func(a, b int64) int64 { return 1 ^ a },
+	},
+}
+
+func TestGates(t *testing.T) {
+	for _, test := range gateTests {
+		circ := parseCircuit(t, "1 3\n2 1 1\n1 1\n\n"+test.gate+"\n")
+		for a := int64(0); a < 2; a++ {
+			for b := int64(0); b < 2; b++ {
+				expected := test.f(a, b)
+				results := play(t, circ, []*big.Int{
+					big.NewInt(a),
+					big.NewInt(b << 1),
+				})
+				for i, result := range results {
+					if len(result) != 1 || result[0].Int64() != expected {
+						t.Errorf("%s: player %d: f(%v,%v)=%v, expected %v",
+							test.gate, i, a, b, result, expected)
+					}
+				}
+			}
+		}
+	}
+}
+
+// playersCircuit has four 2-bit inputs a, b, c, d and one 2-bit
+// output. The gates chain the results of all gate types.
+const playersCircuit = `8 16
+4 2 2 2 2
+1 2
+
+2 1 0 2 8 AND
+2 1 1 4 9 OR
+2 1 3 6 10 XNOR
+2 1 5 7 11 XOR
+1 1 10 12 INV
+2 1 8 9 13 OR
+2 1 11 12 14 AND
+2 1 13 11 15 XOR
+`
+
+func playersExpected(a, b, c, d int64) int64 {
+	w8 := a & b & 1
+	w9 := (a>>1 | c) & 1
+	w10 := 1 ^ (b>>1^d)&1
+	w11 := (c>>1 ^ d>>1) & 1
+	w12 := 1 ^ w10
+	w13 := w8 | w9
+	return w11&w12 | (w13^w11)<<1
+}
+
+func TestPlayers(t *testing.T) {
+	circ := parseCircuit(t, playersCircuit)
+	layout := circ.Inputs.Layout()
+	rnd := rand.New(rand.NewSource(4))
+
+	for n := 2; n <= 4; n++ {
+		// The players provide the inputs round-robin.
+		for idx := range circ.Inputs {
+			circ.Inputs[idx].Party = idx % n
+			circ.Inputs[idx].HasParty = true
+		}
+		for i := 0; i < 8; i++ {
+			var values [4]int64
+			inputs := make([]*big.Int, n)
+			for j := range inputs {
+				inputs[j] = big.NewInt(0)
+			}
+			for idx, l := range layout {
+				values[idx] = rnd.Int63n(4)
+				in := inputs[idx%n]
+				in.Or(in, big.NewInt(values[idx]<<l.Offset))
+			}
+			expected := playersExpected(values[0], values[1], values[2],
+				values[3])
+
+			for j, result := range play(t, circ, inputs) {
+				if len(result) != 1 || result[0].Int64() != expected {
+					t.Errorf("%d players: player %d: f(%v)=%v, expected %v",
+						n, j, values, result, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestLabelBits(t *testing.T) {
+	if k != 128 {
+		t.Fatalf("k=%d, expected 128", k)
+	}
+	circ := parseCircuit(t, playersCircuit)
+	players := playPlayers(t, circ, []*big.Int{
+		big.NewInt(3), big.NewInt(2 << 2), big.NewInt(1 << 4), big.NewInt(3 << 6),
+	})
+	expected := playersExpected(3, 2, 1, 3)
+	for _, p := range players {
+		if r := p.Result(); len(r) != 1 || r[0].Int64() != expected {
+			t.Errorf("player %d: result %v, expected %v", p.id, r, expected)
+		}
+
+		// The labels are random over all k bits. With 32-bit labels,
+		// the high bits would be 0.
+		var high Label
+		for _, wire := range p.wires {
+			for _, l := range []Label{wire.L0, wire.L1} {
+				for i := 4; i < len(l); i++ {
+					high[i] |= l[i]
+				}
+			}
+		}
+		var zero Label
+		if high.Equal(zero) {
+			t.Errorf("player %d: labels use only 32 bits", p.id)
+		}
+	}
+}
+
+func TestPlayErrors(t *testing.T) {
+	circ := parseCircuit(t, "1 3\n2 1 1\n1 1\n\n2 1 0 1 2 AND\n")
+
+	p, err := NewPlayer(0, 2)
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	if err := p.SetCircuit(circ); err != nil {
+		t.Fatalf("failed to set circuit: %v", err)
+	}
+	if err := p.Play(); err == nil {
+		t.Errorf("Play succeeded without peers")
+	}
+	if p.Result() != nil {
+		t.Errorf("Result returned outputs for a failed protocol")
+	}
+}
+
+func TestVerbose(t *testing.T) {
+	p, err := NewPlayer(0, 2)
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	p.Verbose = true
+	p.Play()
+	if !p.logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("Verbose did not enable debug logging")
+	}
+
+	p, err = NewPlayer(0, 2)
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	p.Verbose = true
+	p.SetLogger(p2p.NopLogger())
+	p.Play()
+	if p.logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("Verbose replaced the logger set with SetLogger")
+	}
+}
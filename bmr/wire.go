@@ -9,7 +9,6 @@ package bmr
 import (
 	"bytes"
 	"crypto/rand"
-	"encoding/binary"
 	"fmt"
 
 	"github.com/markkurossi/mpc/ot"
@@ -65,11 +64,12 @@ func (l *Label) Mul(b uint) {
 // ToOT converts the label to ot.Label.
 func (l *Label) ToOT() ot.Label {
 	var label ot.Label
-	label.D0 = uint64(binary.BigEndian.Uint32(l[:]))
+	label.SetBytes(l[:])
 	return label
 }
 
 // FromOT sets the label to the ot.Label.
 func (l *Label) FromOT(label ot.Label) {
-	binary.BigEndian.PutUint32(l[:], uint32(label.D0))
+	var data ot.LabelData
+	copy(l[:], label.Bytes(&data))
 }
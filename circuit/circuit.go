@@ -7,6 +7,7 @@
 package circuit
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -29,6 +30,22 @@ const (
 	MaxWidth
 )
 
+// Errors returned by the circuit functions. The functions wrap the
+// errors with context so they must be tested with errors.Is.
+var (
+	// ErrCorruptCircuit is returned for malformed circuits and
+	// garbled tables.
+	ErrCorruptCircuit = errors.New("corrupted circuit")
+
+	// ErrUnassignedWire is returned for circuits that use or leave
+	// wires without values.
+	ErrUnassignedWire = errors.New("wire not assigned")
+
+	// ErrInvalidOperation is returned for gates with unknown
+	// operations.
+	ErrInvalidOperation = errors.New("invalid operation")
+)
+
 // Known multi-party computation roles.
 const (
 	IDGarbler int = iota
@@ -7,8 +7,13 @@
 package circuit
 
 import (
+	"bytes"
+	"errors"
+	"math/big"
 	"testing"
 	"unsafe"
+
+	"github.com/markkurossi/mpc/ot"
 )
 
 func TestSize(t *testing.T) {
@@ -17,3 +22,81 @@ func TestSize(t *testing.T) {
 		t.Errorf("unexpected gate size: got %v, expected 20", unsafe.Sizeof(g))
 	}
 }
+
+var parseErrorTests = []struct {
+	data string
+	err  error
+}{
+	{
+		// Input 3 of the AND gate is not set.
+		data: `1 4
+2 1 1
+1 1
+
+2 1 0 3 2 AND
+`,
+		err: ErrUnassignedWire,
+	},
+	{
+		data: `1 3
+2 1 1
+1 1
+
+2 1 0 1 2 NAND
+`,
+		err: ErrInvalidOperation,
+	},
+	{
+		// Missing gate.
+		data: `2 3
+2 1 1
+1 1
+
+2 1 0 1 2 AND
+`,
+		err: ErrCorruptCircuit,
+	},
+}
+
+func TestErrors(t *testing.T) {
+	for idx, test := range parseErrorTests {
+		_, err := ParseBristol(bytes.NewReader([]byte(test.data)))
+		if !errors.Is(err, test.err) {
+			t.Errorf("ParseBristol %d: got %v, expected %v", idx, err, test.err)
+		}
+	}
+
+	circ := newAdder(4)
+	key := make([]byte, 32)
+	garbled, err := circ.Garble(key)
+	if err != nil {
+		t.Fatalf("Garble failed: %v", err)
+	}
+	wires := make([]ot.Label, circ.NumWires)
+
+	// Truncated garbled tables.
+	tables := make([][]ot.Label, len(garbled.Gates))
+	for i, g := range garbled.Gates {
+		if len(g) > 0 {
+			tables[i] = g[:len(g)-1]
+		}
+	}
+	err = circ.Eval(key, wires, tables)
+	if !errors.Is(err, ErrCorruptCircuit) {
+		t.Errorf("Eval: got %v, expected %v", err, ErrCorruptCircuit)
+	}
+
+	circ.Gates[0].Op = Count
+	_, err = circ.Garble(key)
+	if !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("Garble: got %v, expected %v", err, ErrInvalidOperation)
+	}
+	err = circ.Eval(key, wires, garbled.Gates)
+	if !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("Eval: got %v, expected %v", err, ErrInvalidOperation)
+	}
+	_, err = circ.Compute([]*big.Int{big.NewInt(1), big.NewInt(2)})
+	if !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("Compute: got %v, expected %v", err, ErrInvalidOperation)
+	}
+}
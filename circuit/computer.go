@@ -11,8 +11,34 @@ import (
 	"math/big"
 )
 
-// Compute evaluates the circuit with the given input values.
+// Compute evaluates the circuit with the given input values. The
+// function returns the full-width values of the circuit outputs.
 func (c *Circuit) Compute(inputs []*big.Int) ([]*big.Int, error) {
+	wires, err := c.simulate(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Construct outputs
+	w := c.NumWires - c.Outputs.Size()
+	var result []*big.Int
+	for _, io := range c.Outputs {
+		r := new(big.Int)
+		for bit := 0; bit < int(io.Type.Bits); bit++ {
+			if wires[w] != 0 {
+				r.SetBit(r, bit, 1)
+			}
+			w++
+		}
+		result = append(result, r)
+	}
+
+	return result, nil
+}
+
+// simulate evaluates the circuit in plaintext with the given input
+// values. The function returns the values of all circuit wires.
+func (c *Circuit) simulate(inputs []*big.Int) ([]byte, error) {
 	// Flatten circuit arguments.
 	var args IO
 	for _, io := range c.Inputs {
@@ -67,25 +93,11 @@ func (c *Circuit) Compute(inputs []*big.Int) ([]*big.Int, error) {
 			}
 
 		default:
-			return nil, fmt.Errorf("invalid gate %s", gate.Op)
+			return nil, fmt.Errorf("%w %s", ErrInvalidOperation, gate.Op)
 		}
 
 		wires[gate.Output] = result
 	}
 
-	// Construct outputs
-	w = c.NumWires - c.Outputs.Size()
-	var result []*big.Int
-	for _, io := range c.Outputs {
-		r := new(big.Int)
-		for bit := 0; bit < int(io.Type.Bits); bit++ {
-			if wires[w] != 0 {
-				r.SetBit(r, bit, 1)
-			}
-			w++
-		}
-		result = append(result, r)
-	}
-
-	return result, nil
+	return wires, nil
 }
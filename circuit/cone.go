@@ -0,0 +1,94 @@
+//
+// cone.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+// Cone returns the subcircuit that computes the output argument
+// outputIndex, that is, the transitive fan-in cone of its output
+// wires. The input arguments that the cone depends on are kept as
+// the inputs of the subcircuit and the other inputs are dropped. The
+// function returns nil if outputIndex is not a valid output index.
+func (c *Circuit) Cone(outputIndex int) *Circuit {
+	if outputIndex < 0 || outputIndex >= len(c.Outputs) {
+		return nil
+	}
+	layout := c.Outputs.Layout()[outputIndex]
+	base := c.NumWires - c.Outputs.Size() + layout.Offset
+
+	// Mark the wires and gates of the cone, from outputs to inputs.
+	needed := make([]bool, c.NumWires)
+	for i := 0; i < layout.Bits; i++ {
+		needed[base+i] = true
+	}
+	inCone := make([]bool, len(c.Gates))
+	var numGates int
+	for i := len(c.Gates) - 1; i >= 0; i-- {
+		g := c.Gates[i]
+		if !needed[g.Output] {
+			continue
+		}
+		inCone[i] = true
+		numGates++
+		for _, in := range g.Inputs() {
+			needed[in] = true
+		}
+	}
+
+	// Keep the input arguments that the cone depends on.
+	wireMap := make([]Wire, c.NumWires)
+	var inputs IO
+	var next Wire
+	for idx, l := range c.Inputs.Layout() {
+		var used bool
+		for i := 0; i < l.Bits; i++ {
+			if needed[l.Offset+i] {
+				used = true
+				break
+			}
+		}
+		if !used {
+			continue
+		}
+		inputs = append(inputs, c.Inputs[idx])
+		for i := 0; i < l.Bits; i++ {
+			wireMap[l.Offset+i] = next
+			next++
+		}
+	}
+
+	// The output wires are the last wires of the subcircuit.
+	numWires := int(next) + numGates
+	outBase := numWires - layout.Bits
+	for i := 0; i < layout.Bits; i++ {
+		needed[base+i] = false
+		wireMap[base+i] = Wire(outBase + i)
+	}
+
+	result := &Circuit{
+		NumGates: numGates,
+		NumWires: numWires,
+		Inputs:   inputs,
+		Outputs:  IO{c.Outputs[outputIndex]},
+		Gates:    make([]Gate, 0, numGates),
+	}
+	for i, g := range c.Gates {
+		if !inCone[i] {
+			continue
+		}
+		if needed[g.Output] {
+			wireMap[g.Output] = next
+			next++
+		}
+		g.Input0 = wireMap[g.Input0]
+		g.Input1 = wireMap[g.Input1]
+		g.Output = wireMap[g.Output]
+		result.Gates = append(result.Gates, g)
+		result.Stats[g.Op]++
+	}
+	return result
+}
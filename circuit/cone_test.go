@@ -0,0 +1,145 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// newConeCircuit creates a circuit with inputs a, b, and c and
+// outputs x=a^b and y=(b&c)^(c>>>1) of bits bits.
+func newConeCircuit(bits int) *Circuit {
+	arg := func(name string) IOArg {
+		return IOArg{
+			Name: name,
+			Type: types.Info{
+				Type:       types.TUint,
+				IsConcrete: true,
+				Bits:       types.Size(bits),
+			},
+		}
+	}
+	var gates []Gate
+	next := Wire(3 * bits)
+	gate := func(op Operation, a, b Wire) Wire {
+		gates = append(gates, Gate{
+			Input0: a,
+			Input1: b,
+			Output: next,
+			Op:     op,
+		})
+		next++
+		return next - 1
+	}
+	a := func(i int) Wire { return Wire(i) }
+	b := func(i int) Wire { return Wire(bits + i) }
+	c := func(i int) Wire { return Wire(2*bits + i) }
+
+	and := make([]Wire, bits)
+	for i := 0; i < bits; i++ {
+		and[i] = gate(AND, b(i), c(i))
+	}
+	for i := 0; i < bits; i++ {
+		gate(XOR, a(i), b(i))
+	}
+	for i := 0; i < bits; i++ {
+		gate(XOR, and[i], c((i+1)%bits))
+	}
+	return &Circuit{
+		NumGates: len(gates),
+		NumWires: int(next),
+		Inputs:   IO{arg("a"), arg("b"), arg("c")},
+		Outputs:  IO{arg("x"), arg("y")},
+		Gates:    gates,
+	}
+}
+
+func TestCone(t *testing.T) {
+	const bits = 8
+
+	circ := newConeCircuit(bits)
+	if err := circ.Validate(); err != nil {
+		t.Fatalf("invalid test circuit: %v", err)
+	}
+	expectedInputs := [][]string{
+		{"a", "b"},
+		{"b", "c"},
+	}
+	expectedGates := []int{bits, 2 * bits}
+	r := rand.New(rand.NewSource(1))
+
+	for out := range circ.Outputs {
+		cone := circ.Cone(out)
+		if err := cone.Validate(); err != nil {
+			t.Fatalf("Cone(%d): %v", out, err)
+		}
+		if cone.NumGates != expectedGates[out] {
+			t.Errorf("Cone(%d): got %d gates, expected %d",
+				out, cone.NumGates, expectedGates[out])
+		}
+		if len(cone.Inputs) != len(expectedInputs[out]) {
+			t.Fatalf("Cone(%d): got inputs %v, expected %v",
+				out, cone.Inputs, expectedInputs[out])
+		}
+		for idx, name := range expectedInputs[out] {
+			if cone.Inputs[idx].Name != name {
+				t.Errorf("Cone(%d): input %d is %s, expected %s",
+					out, idx, cone.Inputs[idx].Name, name)
+			}
+		}
+
+		for i := 0; i < 10; i++ {
+			values := map[string]*big.Int{
+				"a": big.NewInt(r.Int63n(1 << bits)),
+				"b": big.NewInt(r.Int63n(1 << bits)),
+				"c": big.NewInt(r.Int63n(1 << bits)),
+			}
+			var inputs []*big.Int
+			for _, arg := range circ.Inputs {
+				inputs = append(inputs, values[arg.Name])
+			}
+			full, err := circ.Compute(inputs)
+			if err != nil {
+				t.Fatalf("Compute failed: %v", err)
+			}
+			inputs = nil
+			for _, arg := range cone.Inputs {
+				inputs = append(inputs, values[arg.Name])
+			}
+			result, err := cone.Compute(inputs)
+			if err != nil {
+				t.Fatalf("Cone(%d): Compute failed: %v", out, err)
+			}
+			if len(result) != 1 || result[0].Cmp(full[out]) != 0 {
+				t.Errorf("Cone(%d)%v=%v, expected %v",
+					out, inputs, result, full[out])
+			}
+			garbled, err := EvalLocal(cone, inputs[0], inputs[1])
+			if err != nil {
+				t.Fatalf("Cone(%d): EvalLocal failed: %v", out, err)
+			}
+			if garbled[0].Cmp(full[out]) != 0 {
+				t.Errorf("Cone(%d): EvalLocal%v=%v, expected %v",
+					out, inputs, garbled, full[out])
+			}
+		}
+	}
+
+	adder := newAdder(bits)
+	cone := adder.Cone(0)
+	if cone.NumGates != adder.NumGates || len(cone.Inputs) != 2 {
+		t.Errorf("adder Cone(0): %d gates and %d inputs, expected %d and 2",
+			cone.NumGates, len(cone.Inputs), adder.NumGates)
+	}
+	if circ.Cone(-1) != nil || circ.Cone(len(circ.Outputs)) != nil {
+		t.Errorf("Cone accepted invalid output index")
+	}
+}
@@ -0,0 +1,188 @@
+//
+// decode.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// Decode reinterprets the raw circuit value as a Go value of the
+// type t. The integer and boolean types are decoded to the smallest
+// Go type holding the value; integers wider than 64 bits are
+// returned as *big.Int. Signed integers are decoded from their
+// two's-complement representation. Strings are decoded from their
+// UTF-8 bytes to Go strings; the non-printable characters are escaped
+// as \uXXXX and the invalid UTF-8 bytes as \xXX. Arrays of scalar
+// elements are decoded to slices of the element's Go type, e.g. byte
+// arrays to []byte, and the other arrays to []interface{}. Structs
+// are decoded to []interface{} holding the field values.
+func Decode(value *big.Int, t types.Info) (interface{}, error) {
+	switch t.Type {
+	case types.TString:
+		data := decodeBytes(value, t)
+
+		var str string
+		for len(data) > 0 {
+			r, size := utf8.DecodeRune(data)
+			if r == utf8.RuneError && size == 1 {
+				str += fmt.Sprintf("\\x%02x", data[0])
+			} else if unicode.IsPrint(r) {
+				str += string(r)
+			} else {
+				str += fmt.Sprintf("\\u%04x", r)
+			}
+			data = data[size:]
+		}
+		return str, nil
+
+	case types.TUint:
+		if t.Bits <= 8 {
+			return uint8(value.Uint64()), nil
+		} else if t.Bits <= 16 {
+			return uint16(value.Uint64()), nil
+		} else if t.Bits <= 32 {
+			return uint32(value.Uint64()), nil
+		} else if t.Bits <= 64 {
+			return value.Uint64(), nil
+		}
+		return new(big.Int).Set(value), nil
+
+	case types.TInt:
+		if t.Bits == 0 {
+			return nil, fmt.Errorf("invalid type %v: zero size", t)
+		}
+		v := new(big.Int).Set(value)
+		bits := int(t.Bits)
+		if v.Bit(bits-1) == 1 {
+			// Negative number.
+			tmp := new(big.Int)
+			tmp.SetBit(tmp, bits, 1)
+			v.Sub(v, tmp)
+		}
+		if t.Bits <= 8 {
+			return int8(v.Int64()), nil
+		} else if t.Bits <= 16 {
+			return int16(v.Int64()), nil
+		} else if t.Bits <= 32 {
+			return int32(v.Int64()), nil
+		} else if t.Bits <= 64 {
+			return v.Int64(), nil
+		}
+		return v, nil
+
+	case types.TBool:
+		return value.Sign() != 0, nil
+
+	case types.TArray:
+		if t.ElementType == nil {
+			return nil, fmt.Errorf("invalid type %v: no element type", t)
+		}
+		count := int(t.ArraySize)
+		elType := *t.ElementType
+		elSize := int(elType.Bits)
+
+		var elements []interface{}
+		for i := 0; i < count; i++ {
+			v, err := Decode(decodeBits(value, i*elSize, elSize), elType)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, v)
+		}
+		goType := decodeGoType(elType)
+		if goType == nil {
+			return elements, nil
+		}
+		slice := reflect.MakeSlice(reflect.SliceOf(goType), 0, count)
+		for _, v := range elements {
+			slice = reflect.Append(slice, reflect.ValueOf(v))
+		}
+		return slice.Interface(), nil
+
+	case types.TStruct:
+		var fields []interface{}
+		for _, f := range t.Struct {
+			v, err := Decode(decodeBits(value, int(f.Type.Offset),
+				int(f.Type.Bits)), f.Type)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, v)
+		}
+		return fields, nil
+
+	default:
+		return nil, fmt.Errorf("can't decode type %v", t)
+	}
+}
+
+// decodeBits returns the size bits of the value starting from the
+// bit offset.
+func decodeBits(value *big.Int, offset, size int) *big.Int {
+	mask := new(big.Int).Lsh(big.NewInt(1), uint(size))
+	mask.Sub(mask, big.NewInt(1))
+
+	r := new(big.Int).Rsh(value, uint(offset))
+	return r.And(r, mask)
+}
+
+// decodeBytes returns the bytes of the string or byte array value of
+// the type t.
+func decodeBytes(value *big.Int, t types.Info) []byte {
+	data := make([]byte, int(t.Bits)/8)
+	for i := range data {
+		data[i] = byte(decodeBits(value, i*8, 8).Uint64())
+	}
+	return data
+}
+
+// decodeGoType returns the Go type that Decode returns for values of
+// the scalar type t. The function returns nil for composite types.
+func decodeGoType(t types.Info) reflect.Type {
+	switch t.Type {
+	case types.TString:
+		return reflect.TypeOf("")
+
+	case types.TUint:
+		if t.Bits <= 8 {
+			return reflect.TypeOf(uint8(0))
+		} else if t.Bits <= 16 {
+			return reflect.TypeOf(uint16(0))
+		} else if t.Bits <= 32 {
+			return reflect.TypeOf(uint32(0))
+		} else if t.Bits <= 64 {
+			return reflect.TypeOf(uint64(0))
+		}
+		return reflect.TypeOf((*big.Int)(nil))
+
+	case types.TInt:
+		if t.Bits <= 8 {
+			return reflect.TypeOf(int8(0))
+		} else if t.Bits <= 16 {
+			return reflect.TypeOf(int16(0))
+		} else if t.Bits <= 32 {
+			return reflect.TypeOf(int32(0))
+		} else if t.Bits <= 64 {
+			return reflect.TypeOf(int64(0))
+		}
+		return reflect.TypeOf((*big.Int)(nil))
+
+	case types.TBool:
+		return reflect.TypeOf(true)
+
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,260 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+func decodeType(t types.Type, bits types.Size) types.Info {
+	return types.Info{
+		Type:       t,
+		IsConcrete: true,
+		Bits:       bits,
+	}
+}
+
+func decodeArray(el types.Info, count types.Size) types.Info {
+	return types.Info{
+		Type:        types.TArray,
+		IsConcrete:  true,
+		Bits:        el.Bits * count,
+		ArraySize:   count,
+		ElementType: &el,
+	}
+}
+
+var decodeTests = []struct {
+	value    string
+	t        types.Info
+	expected interface{}
+}{
+	{"ff", decodeType(types.TUint, 8), uint8(255)},
+	{"ff", decodeType(types.TInt, 8), int8(-1)},
+	{"80", decodeType(types.TInt, 8), int8(-128)},
+	{"7f", decodeType(types.TInt, 8), int8(127)},
+	{"fffe", decodeType(types.TInt, 16), int16(-2)},
+	{"ffffffff", decodeType(types.TInt, 32), int32(-1)},
+	{"fffffffffffffffd", decodeType(types.TInt, 64), int64(-3)},
+	{"1f", decodeType(types.TInt, 5), int8(-1)},
+	{"0f", decodeType(types.TInt, 5), int8(15)},
+	{"ffffffff", decodeType(types.TUint, 32), uint32(0xffffffff)},
+	{"1", decodeType(types.TBool, 1), true},
+	{"0", decodeType(types.TBool, 1), false},
+	{"6948", decodeType(types.TString, 16), "Hi"},
+	{"a9c361", decodeType(types.TString, 24), "a\u00e9"},
+	{"ac82e2", decodeType(types.TString, 24), "\u20ac"},
+	{
+		"03020100",
+		decodeArray(decodeType(types.TUint, 8), 4),
+		[]byte{0, 1, 2, 3},
+	},
+	{
+		"ff01",
+		decodeArray(decodeType(types.TInt, 8), 2),
+		[]int8{1, -1},
+	},
+	{
+		"0403020100",
+		decodeArray(decodeArray(decodeType(types.TUint, 4), 2), 2),
+		[]interface{}{
+			[]uint8{0, 0},
+			[]uint8{1, 0},
+		},
+	},
+	{
+		"ff0102",
+		types.Info{
+			Type:       types.TStruct,
+			IsConcrete: true,
+			Bits:       24,
+			Struct: []types.StructField{
+				{
+					Name: "A",
+					Type: types.Info{
+						Type:       types.TUint,
+						IsConcrete: true,
+						Bits:       16,
+					},
+				},
+				{
+					Name: "B",
+					Type: types.Info{
+						Type:       types.TInt,
+						IsConcrete: true,
+						Bits:       8,
+						Offset:     16,
+					},
+				},
+			},
+		},
+		[]interface{}{uint16(0x0102), int8(-1)},
+	},
+}
+
+func TestDecode(t *testing.T) {
+	for idx, test := range decodeTests {
+		value, ok := new(big.Int).SetString(test.value, 16)
+		if !ok {
+			t.Fatalf("test %d: invalid value %s", idx, test.value)
+		}
+		orig := new(big.Int).Set(value)
+
+		v, err := Decode(value, test.t)
+		if err != nil {
+			t.Errorf("test %d: Decode failed: %v", idx, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, test.expected) {
+			t.Errorf("test %d: Decode(%s, %v)=%#v, expected %#v",
+				idx, test.value, test.t, v, test.expected)
+		}
+		if value.Cmp(orig) != 0 {
+			t.Errorf("test %d: Decode modified its argument", idx)
+		}
+	}
+}
+
+func TestDecodeBig(t *testing.T) {
+	value := new(big.Int).Lsh(big.NewInt(1), 127)
+	v, err := Decode(value, decodeType(types.TInt, 128))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	expected := new(big.Int).Neg(value)
+	if i, ok := v.(*big.Int); !ok || i.Cmp(expected) != 0 {
+		t.Errorf("Decode(2^127, int128)=%v, expected %v", v, expected)
+	}
+
+	_, err = Decode(value, decodeType(types.TPtr, 32))
+	if err == nil {
+		t.Errorf("Decode of pointer succeeded")
+	}
+}
+
+func TestDecodeString(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected string
+	}{
+		{"0001", "\\u0001\\u0000"},
+		{"61ff", "\\xffa"},
+		{"61c3", "\\xc3a"},
+		{"82e2", "\\xe2\\x82"},
+		{"a9c3", "\u00e9"},
+	} {
+		value, ok := new(big.Int).SetString(test.value, 16)
+		if !ok {
+			t.Fatalf("invalid value %s", test.value)
+		}
+		v, err := Decode(value, decodeType(types.TString, 16))
+		if err != nil {
+			t.Errorf("Decode(%s) failed: %v", test.value, err)
+			continue
+		}
+		if v != test.expected {
+			t.Errorf("Decode(%s)=%q, expected %q", test.value, v,
+				test.expected)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for idx, test := range decodeTests {
+		value, ok := new(big.Int).SetString(test.value, 16)
+		if !ok {
+			t.Fatalf("test %d: invalid value %s", idx, test.value)
+		}
+		// Decode ignores the bits above the type size.
+		mask := new(big.Int).Lsh(big.NewInt(1), uint(test.t.Bits))
+		mask.Sub(mask, big.NewInt(1))
+		value.And(value, mask)
+
+		encoded, err := Encode(test.expected, test.t)
+		if err != nil {
+			t.Errorf("test %d: Encode failed: %v", idx, err)
+			continue
+		}
+		if encoded.Cmp(value) != 0 {
+			t.Errorf("test %d: Encode(%#v, %v)=%x, expected %x",
+				idx, test.expected, test.t, encoded, value)
+		}
+		decoded, err := Decode(encoded, test.t)
+		if err != nil {
+			t.Errorf("test %d: Decode failed: %v", idx, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, test.expected) {
+			t.Errorf("test %d: Decode(Encode(%#v))=%#v",
+				idx, test.expected, decoded)
+		}
+	}
+}
+
+var encodeErrorTests = []struct {
+	v interface{}
+	t types.Info
+}{
+	{256, decodeType(types.TUint, 8)},
+	{-1, decodeType(types.TUint, 8)},
+	{128, decodeType(types.TInt, 8)},
+	{-129, decodeType(types.TInt, 8)},
+	{"1", decodeType(types.TUint, 8)},
+	{1, decodeType(types.TBool, 1)},
+	{"Hello", decodeType(types.TString, 16)},
+	{[]byte{1, 2, 3}, decodeArray(decodeType(types.TUint, 8), 4)},
+	{[]int{1, 2, 256}, decodeArray(decodeType(types.TUint, 8), 3)},
+	{true, decodeType(types.TPtr, 32)},
+}
+
+func TestEncodeErrors(t *testing.T) {
+	for idx, test := range encodeErrorTests {
+		_, err := Encode(test.v, test.t)
+		if err == nil {
+			t.Errorf("test %d: Encode(%#v, %v) succeeded", idx, test.v, test.t)
+		}
+	}
+}
+
+func TestEncodeStruct(t *testing.T) {
+	st := types.Info{
+		Type:       types.TStruct,
+		IsConcrete: true,
+		Bits:       9,
+		Struct: []types.StructField{
+			{
+				Name: "A",
+				Type: decodeType(types.TBool, 1),
+			},
+			{
+				Name: "B",
+				Type: types.Info{
+					Type:       types.TInt,
+					IsConcrete: true,
+					Bits:       8,
+					Offset:     1,
+				},
+			},
+		},
+	}
+	value := struct {
+		A bool
+		B int8
+	}{true, -1}
+
+	encoded, err := Encode(value, st)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if encoded.Int64() != 0x1ff {
+		t.Errorf("Encode(%v)=%x, expected 1ff", value, encoded)
+	}
+}
@@ -0,0 +1,76 @@
+//
+// depth.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+// ANDLevels returns the AND-depth of each gate, that is, the number
+// of AND and OR gates on the longest path from the input wires to
+// the gate's output, including the gate itself. The XOR, XNOR, and
+// INV gates do not increase the depth.
+func (c *Circuit) ANDLevels() []Level {
+	levels, _ := c.andLevels()
+	return levels
+}
+
+// CriticalPath returns the IDs of the AND and OR gates along the
+// longest AND-dependency chain of the circuit, ordered from the
+// inputs to the outputs. The length of the path is the AND-depth of
+// the circuit.
+func (c *Circuit) CriticalPath() []int {
+	levels, prev := c.andLevels()
+
+	last := -1
+	var max Level
+	for idx, level := range levels {
+		if level > max {
+			max = level
+			last = idx
+		}
+	}
+
+	result := make([]int, max)
+	for i := len(result) - 1; i >= 0; i-- {
+		result[i] = last
+		last = prev[last]
+	}
+	return result
+}
+
+// andLevels computes the AND-depths of the gates. The function
+// returns also the IDs of the previous AND gates on the critical
+// paths of the gates, or -1 if the gate has no AND gate on its input
+// paths.
+func (c *Circuit) andLevels() ([]Level, []int) {
+	depth := make([]Level, c.NumWires)
+	lastAND := make([]int, c.NumWires)
+	for i := range lastAND {
+		lastAND[i] = -1
+	}
+	levels := make([]Level, len(c.Gates))
+	prev := make([]int, len(c.Gates))
+
+	for idx, gate := range c.Gates {
+		in := gate.Input0
+		if gate.Op != INV && depth[gate.Input1] > depth[in] {
+			in = gate.Input1
+		}
+		level := depth[in]
+		last := lastAND[in]
+		prev[idx] = last
+
+		switch gate.Op {
+		case AND, OR:
+			level++
+			last = idx
+		}
+		levels[idx] = level
+		depth[gate.Output] = level
+		lastAND[gate.Output] = last
+	}
+	return levels, prev
+}
@@ -0,0 +1,61 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"testing"
+)
+
+func TestCriticalPath(t *testing.T) {
+	for _, bits := range []int{2, 4, 8, 16, 32} {
+		circ := newAdder(bits)
+
+		// Each carry adds an AND and an OR gate to the carry
+		// chain. The first carry is a single AND and the last sum
+		// bit does not need a carry out.
+		expected := 2*bits - 3
+
+		path := circ.CriticalPath()
+		if len(path) != expected {
+			t.Errorf("%d-bit adder: critical path length %d, expected %d",
+				bits, len(path), expected)
+		}
+		levels := circ.ANDLevels()
+		for i, id := range path {
+			op := circ.Gates[id].Op
+			if op != AND && op != OR {
+				t.Errorf("%d-bit adder: path gate %d is %s", bits, id, op)
+			}
+			if levels[id] != Level(i+1) {
+				t.Errorf("%d-bit adder: path gate %d has AND-depth %d, "+
+					"expected %d", bits, id, levels[id], i+1)
+			}
+			if i > 0 && id <= path[i-1] {
+				t.Errorf("%d-bit adder: path gates not ordered: %v",
+					bits, path)
+			}
+		}
+		if summary := circ.Summary(0); summary.ANDDepth != expected {
+			t.Errorf("%d-bit adder: summary AND-depth %d, expected %d",
+				bits, summary.ANDDepth, expected)
+		}
+	}
+}
+
+func TestCriticalPathXOR(t *testing.T) {
+	circ := &Circuit{
+		NumGates: 2,
+		NumWires: 4,
+		Gates: []Gate{
+			{Input0: 0, Input1: 1, Output: 2, Op: XOR},
+			{Input0: 2, Output: 3, Op: INV},
+		},
+	}
+	if path := circ.CriticalPath(); len(path) != 0 {
+		t.Errorf("XOR circuit has critical path %v", path)
+	}
+}
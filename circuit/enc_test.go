@@ -42,6 +42,35 @@ func TestEnc(t *testing.T) {
 	}
 }
 
+func TestEncHalf4(t *testing.T) {
+	var key [32]byte
+
+	cipher, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %s", err)
+	}
+
+	var x [4]ot.Label
+	for i := range x {
+		x[i], err = ot.NewLabel(rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to create label: %s", err)
+		}
+	}
+	tweaks := [4]uint32{1, 1, 2, 0xffffffff}
+
+	var batch halfBatch
+	var data ot.LabelData
+	h := encryptHalf4(cipher, &x, &tweaks, &batch)
+	for i := range h {
+		expected := encryptHalfReference(cipher, x[i], tweaks[i], &data)
+		if !h[i].Equal(expected) {
+			t.Errorf("encryptHalf4[%d]: got %v, expected %v",
+				i, h[i], expected)
+		}
+	}
+}
+
 func BenchmarkEnc(b *testing.B) {
 	var key [32]byte
 
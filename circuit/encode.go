@@ -0,0 +1,192 @@
+//
+// encode.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// Encode encodes the Go value v as a raw circuit value of the type
+// t. This is the inverse of Decode. The integer types accept all Go
+// integer types and *big.Int, and the values must fit in the type;
+// signed values are encoded in their two's-complement
+// representation. Booleans accept bool and strings accept string
+// values whose length matches the type. Arrays accept slices and
+// arrays with the type's number of elements, for example []byte for
+// byte arrays. Structs accept slices and arrays holding the field
+// values, and Go structs with the fields in the same order.
+func Encode(v interface{}, t types.Info) (*big.Int, error) {
+	switch t.Type {
+	case types.TBool:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, encodeError(v, t)
+		}
+		if b {
+			return big.NewInt(1), nil
+		}
+		return new(big.Int), nil
+
+	case types.TInt, types.TUint:
+		i, ok := encodeInt(v)
+		if !ok {
+			return nil, encodeError(v, t)
+		}
+		if t.Bits == 0 {
+			return nil, fmt.Errorf("invalid type %v: zero size", t)
+		}
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Bits))
+		if t.Type == types.TInt {
+			// Valid range is [-limit/2, limit/2[.
+			half := new(big.Int).Rsh(limit, 1)
+			if i.Cmp(half) >= 0 || i.Cmp(new(big.Int).Neg(half)) < 0 {
+				return nil, fmt.Errorf("value %v overflows %v", v, t)
+			}
+			if i.Sign() < 0 {
+				i.Add(i, limit)
+			}
+		} else if i.Sign() < 0 || i.Cmp(limit) >= 0 {
+			return nil, fmt.Errorf("value %v overflows %v", v, t)
+		}
+		return i, nil
+
+	case types.TString:
+		str, ok := v.(string)
+		if !ok {
+			return nil, encodeError(v, t)
+		}
+		data := []byte(str)
+		if len(data)*8 != int(t.Bits) {
+			return nil, fmt.Errorf("invalid string length %d for %v",
+				len(data), t)
+		}
+		result := new(big.Int)
+		for i := len(data) - 1; i >= 0; i-- {
+			result.Lsh(result, 8)
+			result.Or(result, big.NewInt(int64(data[i])))
+		}
+		return result, nil
+
+	case types.TArray:
+		if t.ElementType == nil {
+			return nil, fmt.Errorf("invalid type %v: no element type", t)
+		}
+		values, ok := encodeElements(v)
+		if !ok {
+			return nil, encodeError(v, t)
+		}
+		if len(values) != int(t.ArraySize) {
+			return nil, fmt.Errorf("invalid array length %d for %v",
+				len(values), t)
+		}
+		elSize := t.ElementType.Bits
+
+		result := new(big.Int)
+		for i, el := range values {
+			e, err := Encode(el, *t.ElementType)
+			if err != nil {
+				return nil, err
+			}
+			result.Or(result, e.Lsh(e, uint(types.Size(i)*elSize)))
+		}
+		return result, nil
+
+	case types.TStruct:
+		values, ok := encodeElements(v)
+		if !ok {
+			values, ok = encodeFields(v)
+		}
+		if !ok {
+			return nil, encodeError(v, t)
+		}
+		if len(values) != len(t.Struct) {
+			return nil, fmt.Errorf("invalid number of fields %d for %v",
+				len(values), t)
+		}
+		result := new(big.Int)
+		for i, f := range t.Struct {
+			e, err := Encode(values[i], f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", f.Name, err)
+			}
+			result.Or(result, e.Lsh(e, uint(f.Type.Offset)))
+		}
+		return result, nil
+
+	default:
+		return nil, fmt.Errorf("can't encode type %v", t)
+	}
+}
+
+func encodeError(v interface{}, t types.Info) error {
+	return fmt.Errorf("can't encode %T as %v", v, t)
+}
+
+// encodeInt returns the integer value of v as a new big.Int. The
+// function returns false if v is not an integer.
+func encodeInt(v interface{}) (*big.Int, bool) {
+	if i, ok := v.(*big.Int); ok {
+		if i == nil {
+			return nil, false
+		}
+		return new(big.Int).Set(i), true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return big.NewInt(rv.Int()), true
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return new(big.Int).SetUint64(rv.Uint()), true
+
+	default:
+		return nil, false
+	}
+}
+
+// encodeElements returns the elements of the slice or array v. The
+// function returns false if v is not a slice or array.
+func encodeElements(v interface{}) ([]interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		result := make([]interface{}, rv.Len())
+		for i := range result {
+			result[i] = rv.Index(i).Interface()
+		}
+		return result, true
+
+	default:
+		return nil, false
+	}
+}
+
+// encodeFields returns the field values of the Go struct v. The
+// function returns false if v is not a struct or if it has
+// unexported fields.
+func encodeFields(v interface{}) ([]interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Struct {
+		return nil, false
+	}
+	result := make([]interface{}, rv.NumField())
+	for i := range result {
+		if !rv.Type().Field(i).IsExported() {
+			return nil, false
+		}
+		result[i] = rv.Field(i).Interface()
+	}
+	return result, true
+}
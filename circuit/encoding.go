@@ -0,0 +1,188 @@
+//
+// encoding.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// Encoding specifies the textual encoding of I/O values.
+type Encoding int
+
+// Value encodings.
+const (
+	EncodingDefault Encoding = iota
+	EncodingHex
+	EncodingBase64
+	EncodingRaw
+)
+
+var encodingNames = map[Encoding]string{
+	EncodingDefault: "default",
+	EncodingHex:     "hex",
+	EncodingBase64:  "base64",
+	EncodingRaw:     "raw",
+}
+
+func (e Encoding) String() string {
+	name, ok := encodingNames[e]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{Encoding %d}", e)
+}
+
+// ParseEncoding parses the encoding name. The empty name specifies
+// the default encoding.
+func ParseEncoding(name string) (Encoding, error) {
+	if len(name) == 0 {
+		return EncodingDefault, nil
+	}
+	for enc, n := range encodingNames {
+		if n == name {
+			return enc, nil
+		}
+	}
+	return EncodingDefault, fmt.Errorf("unknown encoding: %s", name)
+}
+
+const base64Prefix = "base64:"
+
+// parseBase64 decodes the base64: prefixed input. The function
+// returns false if the input does not have the base64: prefix.
+func parseBase64(input string) ([]byte, bool, error) {
+	if !strings.HasPrefix(input, base64Prefix) {
+		return nil, false, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(input[len(base64Prefix):])
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid base64 input '%s': %v",
+			input, err)
+	}
+	return data, true, nil
+}
+
+// parseStringInput decodes the string input. The 0x and base64:
+// prefixed inputs are decoded from hex and base64, and the other
+// inputs are returned as such.
+func parseStringInput(input string) ([]byte, error) {
+	data, ok, err := parseBase64(input)
+	if err != nil || ok {
+		return data, err
+	}
+	if strings.HasPrefix(input, "0x") {
+		data, err = hex.DecodeString(input[2:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex input '%s': %v", input, err)
+		}
+		return data, nil
+	}
+	return []byte(input), nil
+}
+
+// Format formats the value of the I/O argument with the encoding
+// enc. The hex and base64 encodings apply to integers, strings, and
+// arrays of integers, and they produce the 0x and base64: prefixed
+// values that Parse accepts. The array elements and the string
+// characters are encoded in their index order. The other values are
+// formatted with the default encoding that prints the value decoded
+// with Decode, showing byte arrays in hex. The raw encoding prints the
+// bytes of strings and byte arrays as-is without escaping.
+func (io IOArg) Format(value *big.Int, enc Encoding) string {
+	if enc == EncodingRaw {
+		data, ok := rawBytes(value, io.Type)
+		if ok {
+			return string(data)
+		}
+	} else if enc != EncodingDefault {
+		v, bits, ok := encodingValue(value, io.Type)
+		if ok {
+			switch enc {
+			case EncodingHex:
+				return fmt.Sprintf("0x%0*x", (bits+3)/4, v)
+
+			case EncodingBase64:
+				data := v.FillBytes(make([]byte, (bits+7)/8))
+				return base64Prefix + base64.StdEncoding.EncodeToString(data)
+			}
+		}
+	}
+	v, err := Decode(value, io.Type)
+	if err != nil {
+		return fmt.Sprintf("%v (%s)", value, io.Type)
+	}
+	if data, ok := v.([]byte); ok {
+		return fmt.Sprintf("%x", data)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// rawBytes returns the bytes of the string and byte array values. The
+// function returns false if the type t is not a string or a byte
+// array.
+func rawBytes(value *big.Int, t types.Info) ([]byte, bool) {
+	switch t.Type {
+	case types.TString:
+		return decodeBytes(value, t), true
+
+	case types.TArray:
+		el := t.ElementType
+		if el == nil || el.Type != types.TUint || el.Bits != 8 {
+			return nil, false
+		}
+		return decodeBytes(value, t), true
+
+	default:
+		return nil, false
+	}
+}
+
+// encodingValue returns the value of the type t as a big-endian
+// integer where the array elements and the string characters are in
+// their index order. The function returns also the bit size of the
+// integer, and false if the type can't be encoded.
+func encodingValue(value *big.Int, t types.Info) (*big.Int, int, bool) {
+	switch t.Type {
+	case types.TInt, types.TUint:
+		return value, int(t.Bits), true
+
+	case types.TString:
+		return concatElements(value, int(t.Bits)/8, 8), int(t.Bits), true
+
+	case types.TArray:
+		el := t.ElementType
+		if el == nil || (el.Type != types.TInt && el.Type != types.TUint) ||
+			el.Bits == 0 {
+			return nil, 0, false
+		}
+		count := int(t.ArraySize)
+		elSize := int(el.Bits)
+		return concatElements(value, count, elSize), count * elSize, true
+
+	default:
+		return nil, 0, false
+	}
+}
+
+// concatElements concatenates the count elements of the value so that
+// the first element is the most significant.
+func concatElements(value *big.Int, count, elSize int) *big.Int {
+	result := new(big.Int)
+	for i := 0; i < count; i++ {
+		result.Lsh(result, uint(elSize))
+		result.Or(result, decodeBits(value, i*elSize, elSize))
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+func TestEncodingRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i*7 + 1)
+	}
+	b64 := "base64:" + base64.StdEncoding.EncodeToString(key)
+
+	arg := IOArg{
+		Type: types.Info{
+			Type:        types.TArray,
+			IsConcrete:  true,
+			Bits:        256,
+			ArraySize:   32,
+			ElementType: &types.Byte,
+		},
+	}
+	value, err := arg.Parse([]string{b64})
+	if err != nil {
+		t.Fatalf("Parse(%s) failed: %v", b64, err)
+	}
+	v, err := Decode(value, arg.Type)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !bytes.Equal(v.([]byte), key) {
+		t.Errorf("Parse(%s)=%x, expected %x", b64, v, key)
+	}
+	if s := arg.Format(value, EncodingBase64); s != b64 {
+		t.Errorf("Format(base64)=%s, expected %s", s, b64)
+	}
+	hex := arg.Format(value, EncodingHex)
+	if s := arg.Format(value, EncodingDefault); "0x"+s != hex {
+		t.Errorf("Format(hex)=%s, Format(default)=%s", hex, s)
+	}
+	parsed, err := arg.Parse([]string{hex})
+	if err != nil {
+		t.Fatalf("Parse(%s) failed: %v", hex, err)
+	}
+	if parsed.Cmp(value) != 0 {
+		t.Errorf("Parse(%s)=%x, expected %x", hex, parsed, value)
+	}
+
+	for _, test := range []struct {
+		typ    types.Info
+		input  string
+		enc    Encoding
+		output string
+	}{
+		{types.Uint32, "0xcafe", EncodingHex, "0x0000cafe"},
+		{types.Uint32, "base64:AAABAg==", EncodingDefault, "258"},
+		{types.Uint32, "258", EncodingBase64, "base64:AAABAg=="},
+		{types.Info{Type: types.TString, IsConcrete: true, Bits: 40},
+			"hello", EncodingHex, "0x68656c6c6f"},
+		{types.Info{Type: types.TString, IsConcrete: true, Bits: 40},
+			"0x68656c6c6f", EncodingDefault, "hello"},
+		{types.Info{Type: types.TString, IsConcrete: true, Bits: 40},
+			"base64:aGk=", EncodingBase64, "base64:aGkAAAA="},
+		{types.Info{Type: types.TString, IsConcrete: true, Bits: 40},
+			"0x0168c3a900", EncodingRaw, "\x01h\u00e9\x00"},
+		{types.Info{Type: types.TString, IsConcrete: true, Bits: 40},
+			"0x0168c3a900", EncodingDefault, "\\u0001h\u00e9\\u0000"},
+		{types.Info{Type: types.TString, IsConcrete: true, Bits: 40},
+			"0x68ff", EncodingDefault, "h\\xff\\u0000\\u0000\\u0000"},
+		{types.Bool, "true", EncodingHex, "true"},
+		{types.Bool, "true", EncodingRaw, "true"},
+	} {
+		arg := IOArg{
+			Type: test.typ,
+		}
+		value, err := arg.Parse([]string{test.input})
+		if err != nil {
+			t.Errorf("Parse(%s) failed: %v", test.input, err)
+			continue
+		}
+		if s := arg.Format(value, test.enc); s != test.output {
+			t.Errorf("%s: Format(%s, %s)=%s, expected %s",
+				test.typ, test.input, test.enc, s, test.output)
+		}
+	}
+
+	for _, input := range []string{"base64:!!", "0x6869zz", "toolong"} {
+		arg := IOArg{
+			Type: types.Info{Type: types.TString, IsConcrete: true, Bits: 40},
+		}
+		if _, err := arg.Parse([]string{input}); err == nil {
+			t.Errorf("Parse(%s) succeeded", input)
+		}
+	}
+}
@@ -8,6 +8,7 @@ package circuit
 
 import (
 	"crypto/aes"
+	"crypto/cipher"
 	"fmt"
 
 	"github.com/markkurossi/mpc/ot"
@@ -27,89 +28,104 @@ func (c *Circuit) Eval(key []byte, wires []ot.Label,
 
 	for i := 0; i < len(c.Gates); i++ {
 		gate := &c.Gates[i]
+		output, err := evalGate(alg, gate, id, wires, garbled[i], &data)
+		if err != nil {
+			return err
+		}
+		id += gate.Op.tweaks()
+		wires[gate.Output] = output
+	}
 
-		var a, b, c ot.Label
+	return nil
+}
 
-		switch gate.Op {
-		case XOR, XNOR, AND, OR:
-			a = wires[gate.Input0]
-			b = wires[gate.Input1]
+// tweaks returns the number of tweak IDs the garbled gate of the
+// operation consumes.
+func (op Operation) tweaks() uint32 {
+	switch op {
+	case AND:
+		return 2
+	case OR, INV:
+		return 1
+	default:
+		return 0
+	}
+}
 
-		case INV:
-			a = wires[gate.Input0]
+// evalGate evaluates the gate with the tweak id and the garbled table
+// row, and returns the label of the gate output wire.
+func evalGate(alg cipher.Block, gate *Gate, id uint32, wires []ot.Label,
+	row []ot.Label, data *ot.LabelData) (ot.Label, error) {
 
-		default:
-			return fmt.Errorf("invalid operation %s", gate.Op)
-		}
+	var a, b, c ot.Label
 
-		var output ot.Label
+	switch gate.Op {
+	case XOR, XNOR, AND, OR:
+		a = wires[gate.Input0]
+		b = wires[gate.Input1]
 
-		switch gate.Op {
-		case XOR, XNOR:
-			a.Xor(b)
-			output = a
+	case INV:
+		a = wires[gate.Input0]
 
-		case AND:
-			row := garbled[i]
-			if len(row) != 2 {
-				return fmt.Errorf("corrupted ciruit: AND row length: %d",
-					len(row))
-			}
-			sa := a.S()
-			sb := b.S()
+	default:
+		return c, fmt.Errorf("%w %s", ErrInvalidOperation, gate.Op)
+	}
 
-			j0 := id
-			j1 := id + 1
-			id += 2
+	var output ot.Label
 
-			tg := row[0]
-			te := row[1]
+	switch gate.Op {
+	case XOR, XNOR:
+		a.Xor(b)
+		output = a
 
-			wg := encryptHalf(alg, a, j0, &data)
-			if sa {
-				wg.Xor(tg)
-			}
-			we := encryptHalf(alg, b, j1, &data)
-			if sb {
-				we.Xor(te)
-				we.Xor(a)
-			}
-			output = wg
-			output.Xor(we)
-
-		case OR:
-			row := garbled[i]
-			index := idx(a, b)
-			if index > 0 {
-				// First row is zero and not transmitted.
-				index--
-				if index >= len(row) {
-					return fmt.Errorf("corrupted circuit: index %d >= row %d",
-						index, len(row))
-				}
-				c = row[index]
-			}
+	case AND:
+		if len(row) != 2 {
+			return c, fmt.Errorf("%w: AND row length: %d",
+				ErrCorruptCircuit, len(row))
+		}
+		sa := a.S()
+		sb := b.S()
 
-			output = decrypt(alg, a, b, id, c, &data)
-			id++
-
-		case INV:
-			row := garbled[i]
-			index := idxUnary(a)
-			if index > 0 {
-				// First row is zero and not transmitted.
-				index--
-				if index >= len(row) {
-					return fmt.Errorf("corrupted circuit: index %d >= row %d",
-						index, len(row))
-				}
-				c = row[index]
+		tg := row[0]
+		te := row[1]
+
+		wg := encryptHalf(alg, a, id, data)
+		if sa {
+			wg.Xor(tg)
+		}
+		we := encryptHalf(alg, b, id+1, data)
+		if sb {
+			we.Xor(te)
+			we.Xor(a)
+		}
+		output = wg
+		output.Xor(we)
+
+	case OR:
+		index := idx(a, b)
+		if index > 0 {
+			// First row is zero and not transmitted.
+			index--
+			if index >= len(row) {
+				return c, fmt.Errorf("%w: index %d >= row %d",
+					ErrCorruptCircuit, index, len(row))
 			}
-			output = decrypt(alg, a, ot.Label{}, id, c, &data)
-			id++
+			c = row[index]
 		}
-		wires[gate.Output] = output
+		output = decrypt(alg, a, b, id, c, data)
+
+	case INV:
+		index := idxUnary(a)
+		if index > 0 {
+			// First row is zero and not transmitted.
+			index--
+			if index >= len(row) {
+				return c, fmt.Errorf("%w: index %d >= row %d",
+					ErrCorruptCircuit, index, len(row))
+			}
+			c = row[index]
+		}
+		output = decrypt(alg, a, ot.Label{}, id, c, data)
 	}
-
-	return nil
+	return output, nil
 }
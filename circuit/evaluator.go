@@ -1,7 +1,7 @@
 //
 // evaluator.go
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -20,10 +20,48 @@ var (
 	debug = false
 )
 
+// maxTableSize specifies the maximum number of labels in a garbled
+// gate table.
+const maxTableSize = 4
+
+// ErrTruncated is returned by the evaluator when the garbled table
+// stream ends before all gates have been received, for example
+// because the garbler disconnected. The Err field holds the
+// underlying I/O error.
+type ErrTruncated struct {
+	Received int
+	Expected int
+	Err      error
+}
+
+func (e *ErrTruncated) Error() string {
+	return fmt.Sprintf(
+		"garbled tables truncated: received %d of %d gates: %v",
+		e.Received, e.Expected, e.Err)
+}
+
+// Unwrap returns the underlying I/O error.
+func (e *ErrTruncated) Unwrap() error {
+	return e.Err
+}
+
 // Evaluator runs the evaluator on the P2P network.
 func Evaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	verbose bool) ([]*big.Int, error) {
+	return EvaluatorWithOptions(conn, oti, circ, inputs, &Options{
+		Verbose: verbose,
+	})
+}
+
+// EvaluatorWithOptions runs the evaluator on the P2P network with the
+// options.
+func EvaluatorWithOptions(conn *p2p.Conn, oti ot.OT, circ *Circuit,
+	inputs *big.Int, opts *Options) ([]*big.Int, error) {
 
+	if err := circ.Inputs.CheckTwoParty(); err != nil {
+		return nil, err
+	}
+	verbose := opts.Verbose
 	timing := NewTiming()
 
 	garbled := make([][]ot.Label, circ.NumGates)
@@ -32,10 +70,25 @@ func Evaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	if verbose {
 		fmt.Printf(" - Waiting for circuit info...\n")
 	}
+	if err := circ.receiveIOHeader(conn); err != nil {
+		return nil, err
+	}
 	key, err := conn.ReceiveData()
 	if err != nil {
 		return nil, err
 	}
+	var tm *tableMAC
+	if opts.TableChecksum {
+		macKey, err := conn.ReceiveData()
+		if err != nil {
+			return nil, err
+		}
+		if len(macKey) != macKeySize {
+			return nil, fmt.Errorf("invalid table checksum key size: %d",
+				len(macKey))
+		}
+		tm = newTableMAC(macKey)
+	}
 
 	// Receive garbled tables.
 	timing.Sample("Wait", nil)
@@ -47,27 +100,57 @@ func Evaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 		return nil, err
 	}
 	if count != circ.NumGates {
-		return nil, fmt.Errorf("wrong number of gates: got %d, expected %d",
-			count, circ.NumGates)
+		return nil, fmt.Errorf("%w: got %d gates, expected %d",
+			ErrCorruptCircuit, count, circ.NumGates)
+	}
+	if tm != nil {
+		tm.count(count)
 	}
 	var label ot.Label
 	var labelData ot.LabelData
 	for i := 0; i < circ.NumGates; i++ {
 		count, err := conn.ReceiveUint32()
 		if err != nil {
-			return nil, err
+			return nil, &ErrTruncated{
+				Received: i,
+				Expected: circ.NumGates,
+				Err:      err,
+			}
+		}
+		if count > maxTableSize {
+			return nil, fmt.Errorf("%w: garbled table size %d",
+				ErrCorruptCircuit, count)
+		}
+		if tm != nil {
+			tm.count(count)
 		}
 
 		values := make([]ot.Label, count)
 		for j := 0; j < count; j++ {
 			err := conn.ReceiveLabel(&label, &labelData)
 			if err != nil {
-				return nil, err
+				return nil, &ErrTruncated{
+					Received: i,
+					Expected: circ.NumGates,
+					Err:      err,
+				}
+			}
+			if tm != nil {
+				tm.label(&labelData)
 			}
 			values[j] = label
 		}
 		garbled[i] = values
 	}
+	if tm != nil {
+		tag, err := conn.ReceiveData()
+		if err != nil {
+			return nil, err
+		}
+		if err := tm.verify(tag); err != nil {
+			return nil, err
+		}
+	}
 
 	wires := make([]ot.Label, circ.NumWires)
 
@@ -92,39 +175,49 @@ func Evaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	if verbose {
 		fmt.Printf(" - Querying our inputs...\n")
 	}
-	// Wire offset.
-	if err := conn.SendUint32(int(circ.Inputs[0].Type.Bits)); err != nil {
-		return nil, err
-	}
-	// Wire count.
-	if err := conn.SendUint32(int(circ.Inputs[1].Type.Bits)); err != nil {
-		return nil, err
-	}
-	if err := conn.Flush(); err != nil {
-		return nil, err
-	}
-	flags := make([]bool, int(circ.Inputs[1].Type.Bits))
-	for i := 0; i < int(circ.Inputs[1].Type.Bits); i++ {
+	offset := int(circ.Inputs[0].Type.Bits)
+	count = int(circ.Inputs[1].Type.Bits)
+	flags := make([]bool, count)
+	for i := 0; i < count; i++ {
 		if inputs.Bit(i) == 1 {
 			flags[i] = true
 		}
 	}
-	if err := oti.Receive(flags, wires[circ.Inputs[0].Type.Bits:]); err != nil {
-		return nil, err
-	}
-	xfer := conn.Stats.Sum() - ioStats
-	ioStats = conn.Stats.Sum()
-	timing.Sample("Inputs", []string{FileSize(xfer).String()})
+	public := circ.Inputs[1].PublicBits()
 
-	// Evaluate gates.
-	if verbose {
-		fmt.Printf(" - Evaluating circuit...\n")
-	}
-	err = circ.Eval(key[:], wires, garbled)
-	if err != nil {
-		return nil, err
+	batch := opts.OTBatchSize
+	if !opts.Incremental || batch <= 0 || batch >= count {
+		err = receiveInputBatches(conn, oti, offset, flags, public,
+			wires[offset:offset+count], batch, nil)
+		if err != nil {
+			return nil, err
+		}
+		xfer := conn.Stats.Sum() - ioStats
+		ioStats = conn.Stats.Sum()
+		timing.Sample("Inputs", []string{FileSize(xfer).String()})
+
+		// Evaluate gates.
+		if verbose {
+			fmt.Printf(" - Evaluating circuit...\n")
+		}
+		err = circ.Eval(key[:], wires, garbled)
+		if err != nil {
+			return nil, err
+		}
+		timing.Sample("Eval", nil)
+	} else {
+		if verbose {
+			fmt.Printf(" - Evaluating circuit incrementally...\n")
+		}
+		err = circ.evalIncremental(conn, oti, key[:], wires, garbled,
+			offset, flags, public, batch)
+		if err != nil {
+			return nil, err
+		}
+		xfer := conn.Stats.Sum() - ioStats
+		ioStats = conn.Stats.Sum()
+		timing.Sample("Inputs+Eval", []string{FileSize(xfer).String()})
 	}
-	timing.Sample("Eval", nil)
 
 	// Resolve result values.
 
@@ -149,11 +242,117 @@ func Evaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	}
 	raw := big.NewInt(0).SetBytes(result)
 
-	xfer = conn.Stats.Sum() - ioStats
+	xfer := conn.Stats.Sum() - ioStats
 	timing.Sample("Result", []string{FileSize(xfer).String()})
+	if opts.Profile != nil {
+		*opts.Profile = *NewProfile(RoleEvaluator, timing, circ.gateStats(),
+			otCount(circ.Inputs[1]), conn.Stats)
+	}
 	if verbose {
 		timing.Print(conn.Stats)
 	}
 
 	return circ.Outputs.Split(raw), nil
 }
+
+// receiveInputBatches queries the labels of the evaluator's input
+// wires [offset, offset+len(flags)) from the garbler in batches of
+// batch wires. The batch size 0 queries all wires in one batch. The
+// function ready is called after each batch if it is not nil.
+func receiveInputBatches(conn *p2p.Conn, oti ot.OT, offset int, flags,
+	public []bool, labels []ot.Label, batch int, ready func()) error {
+
+	if batch <= 0 || batch > len(flags) {
+		batch = len(flags)
+	}
+	for start := 0; ; {
+		end := start + batch
+		if end > len(flags) {
+			end = len(flags)
+		}
+		var p []bool
+		if public != nil {
+			p = public[start:end]
+		}
+		err := receiveInputs(conn, oti, offset+start, flags[start:end], p,
+			labels[start:end])
+		if err != nil {
+			return err
+		}
+		if ready != nil {
+			ready()
+		}
+		start = end
+		if start >= len(flags) {
+			return nil
+		}
+	}
+}
+
+// receiveInputs queries the labels of the evaluator's input wires
+// [offset, offset+len(flags)) from the garbler. The flags specify the
+// input bit values and public the input bits that are public. The
+// private inputs are queried with OT and the received labels are
+// stored in labels.
+func receiveInputs(conn *p2p.Conn, oti ot.OT, offset int, flags,
+	public []bool, labels []ot.Label) error {
+
+	// Wire offset.
+	if err := conn.SendUint32(offset); err != nil {
+		return err
+	}
+	// Wire count.
+	if err := conn.SendUint32(len(flags)); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	if public == nil {
+		if len(flags) == 0 {
+			return nil
+		}
+		return oti.Receive(flags, labels)
+	}
+
+	// Send our public input values in plain and receive their
+	// labels. The private inputs are queried with OT.
+	values := new(big.Int)
+	for i, p := range public {
+		if p && flags[i] {
+			values.SetBit(values, i, 1)
+		}
+	}
+	if err := conn.SendData(values.Bytes()); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	var label ot.Label
+	var labelData ot.LabelData
+	var privateFlags []bool
+	var private []int
+	for i, p := range public {
+		if !p {
+			privateFlags = append(privateFlags, flags[i])
+			private = append(private, i)
+			continue
+		}
+		err := conn.ReceiveLabel(&label, &labelData)
+		if err != nil {
+			return err
+		}
+		labels[i] = label
+	}
+	if len(private) > 0 {
+		result := make([]ot.Label, len(private))
+		if err := oti.Receive(privateFlags, result); err != nil {
+			return err
+		}
+		for i, idx := range private {
+			labels[idx] = result[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,468 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+	"github.com/markkurossi/mpc/types"
+)
+
+// truncator returns io.EOF after limit bytes have been read from the
+// underlying connection.
+type truncator struct {
+	io.ReadWriter
+	limit int
+}
+
+func (t *truncator) Read(p []byte) (int, error) {
+	if t.limit <= 0 {
+		return 0, io.EOF
+	}
+	if len(p) > t.limit {
+		p = p[:t.limit]
+	}
+	n, err := t.ReadWriter.Read(p)
+	t.limit -= n
+	return n, err
+}
+
+func TestEvaluatorTruncated(t *testing.T) {
+	circ := newAdder(8)
+
+	garbled, err := circ.Garble(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("Garble failed: %v", err)
+	}
+
+	for _, gates := range []int{0, 1, 5, circ.NumGates - 1} {
+		// The circuit header, the garbling key, and the number of
+		// gates, followed by the label counts and labels of the
+		// received gates.
+		limit := ioHeaderSize(t, circ) + 4 + 32 + 4
+		for i := 0; i < gates; i++ {
+			limit += 4 + len(garbled.Gates[i])*ot.LabelSize
+		}
+
+		gPipe, ePipe := ot.NewPipe()
+		gerr := make(chan error, 1)
+		go func() {
+			conn := p2p.NewConn(gPipe)
+			_, err := Garbler(conn, ot.NewCO(), circ, big.NewInt(1),
+				false)
+			gPipe.Close()
+			gerr <- err
+		}()
+
+		conn := p2p.NewConn(&truncator{
+			ReadWriter: ePipe,
+			limit:      limit,
+		})
+		_, err := Evaluator(conn, ot.NewCO(), circ, big.NewInt(2),
+			false)
+		ePipe.Close()
+		ePipe.Drain()
+		<-gerr
+
+		var truncated *ErrTruncated
+		if !errors.As(err, &truncated) {
+			t.Errorf("gates=%d: got error %v, expected ErrTruncated",
+				gates, err)
+			continue
+		}
+		if truncated.Received != gates ||
+			truncated.Expected != circ.NumGates {
+			t.Errorf("gates=%d: got %d of %d gates", gates,
+				truncated.Received, truncated.Expected)
+		}
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("gates=%d: error %v does not wrap io.EOF", gates, err)
+		}
+	}
+}
+
+// newStaggered creates a circuit where each bit of the evaluator
+// input b feeds its own chain of depth AND gates with the garbler
+// input a. The gates of the low bits can be evaluated as soon as
+// their inputs have been transferred.
+func newStaggered(bits, depth int) *Circuit {
+	arg := func(name string) IOArg {
+		return IOArg{
+			Name: name,
+			Type: types.Info{
+				Type:       types.TUint,
+				IsConcrete: true,
+				Bits:       types.Size(bits),
+			},
+		}
+	}
+	var gates []Gate
+	next := Wire(2 * bits)
+	gate := func(op Operation, a, b Wire) Wire {
+		gates = append(gates, Gate{
+			Input0: a,
+			Input1: b,
+			Output: next,
+			Op:     op,
+		})
+		next++
+		return next - 1
+	}
+
+	chains := make([]Wire, bits)
+	for i := 0; i < bits; i++ {
+		w := gate(XOR, Wire(i), Wire(bits+i))
+		for j := 1; j < depth; j++ {
+			w = gate(OR, gate(AND, w, Wire((i+j)%bits)), Wire(bits+i))
+		}
+		chains[i] = w
+	}
+	// The output wires are the last wires of the circuit.
+	for i := 0; i < bits; i++ {
+		gate(XNOR, chains[i], Wire(i))
+	}
+
+	return &Circuit{
+		NumGates: len(gates),
+		NumWires: int(next),
+		Inputs:   IO{arg("a"), arg("b")},
+		Outputs:  IO{arg("r")},
+		Gates:    gates,
+	}
+}
+
+// latency delivers the writes to the underlying connection after the
+// delay to simulate the network latency. The writes do not block so
+// the latency does not limit the bandwidth.
+type latency struct {
+	io.ReadWriter
+	delay   time.Duration
+	packets chan packet
+	done    chan struct{}
+}
+
+type packet struct {
+	deliver time.Time
+	data    []byte
+}
+
+func newLatency(conn io.ReadWriter, delay time.Duration) *latency {
+	l := &latency{
+		ReadWriter: conn,
+		delay:      delay,
+		packets:    make(chan packet, 1024),
+		done:       make(chan struct{}),
+	}
+	go func() {
+		for p := range l.packets {
+			time.Sleep(time.Until(p.deliver))
+			l.ReadWriter.Write(p.data)
+		}
+		close(l.done)
+	}()
+	return l
+}
+
+func (l *latency) Write(p []byte) (int, error) {
+	l.packets <- packet{
+		deliver: time.Now().Add(l.delay),
+		data:    append([]byte(nil), p...),
+	}
+	return len(p), nil
+}
+
+func (l *latency) Close() error {
+	close(l.packets)
+	<-l.done
+	if closer, ok := l.ReadWriter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// evalIncremental evaluates the circuit with the incremental
+// evaluator using the batch size batch. The delay specifies the
+// simulated network latency between the peers.
+func evalIncremental(circ *Circuit, a, b *big.Int, batch int,
+	delay time.Duration) ([]*big.Int, error) {
+	return evalOptions(circ, a, b, &Options{
+		OTBatchSize: batch,
+		Incremental: true,
+	}, delay)
+}
+
+// evalOptions evaluates the circuit with the evaluator options opts.
+// The delay specifies the simulated network latency between the
+// peers.
+func evalOptions(circ *Circuit, a, b *big.Int, opts *Options,
+	delay time.Duration) ([]*big.Int, error) {
+
+	gPipe, ePipe := ot.NewPipe()
+
+	gerr := make(chan error, 1)
+	go func() {
+		conn := p2p.NewConn(newLatency(gPipe, delay))
+		_, err := Garbler(conn, ot.NewCO(), circ, a, false)
+		if err != nil {
+			gPipe.Close()
+		} else {
+			err = conn.Close()
+		}
+		gerr <- err
+	}()
+
+	conn := p2p.NewConn(newLatency(ePipe, delay))
+	result, err := EvaluatorWithOptions(conn, ot.NewCO(), circ, b, opts)
+	conn.Close()
+	if err != nil {
+		ePipe.Drain()
+		<-gerr
+		return nil, err
+	}
+	return result, <-gerr
+}
+
+func TestIncrementalEvaluator(t *testing.T) {
+	const bits = 16
+
+	public := newAdder(bits)
+	public.Inputs[1].Public = true
+
+	for _, circ := range []*Circuit{
+		newAdder(bits), newStaggered(bits, 8), public,
+	} {
+		if err := circ.Validate(); err != nil {
+			t.Fatalf("invalid circuit: %v", err)
+		}
+		a := big.NewInt(0xa5c3)
+		b := big.NewInt(0x3c5a)
+		expected, err := circ.Compute([]*big.Int{a, b})
+		if err != nil {
+			t.Fatalf("Compute failed: %v", err)
+		}
+		for _, batch := range []int{0, 1, 3, 8, bits} {
+			result, err := evalIncremental(circ, a, b, batch, 0)
+			if err != nil {
+				t.Fatalf("batch %d: evaluation failed: %v", batch, err)
+			}
+			if result[0].Cmp(expected[0]) != 0 {
+				t.Errorf("batch %d: got %x, expected %x", batch,
+					result[0], expected[0])
+			}
+		}
+	}
+}
+
+func TestPipeTransport(t *testing.T) {
+	const bits = 16
+
+	circ := newAdder(bits)
+	a := big.NewInt(0x1234)
+	b := big.NewInt(0x4321)
+
+	for _, test := range []struct {
+		checksum    bool
+		incremental bool
+	}{
+		{false, false},
+		{true, false},
+		{false, true},
+	} {
+		// The roles run over any io.ReadWriter, here over a pair of
+		// io.Pipe streams without network connections.
+		gStream, eStream := p2p.Pipe()
+
+		gerr := make(chan error, 1)
+		go func() {
+			conn := p2p.NewConn(gStream)
+			_, err := GarblerWithOptions(conn, ot.NewCO(), circ, a, &Options{
+				TableChecksum: test.checksum,
+			})
+			if err != nil {
+				gStream.Close()
+			} else {
+				err = conn.Close()
+			}
+			gerr <- err
+		}()
+
+		conn := p2p.NewConn(eStream)
+		opts := &Options{
+			TableChecksum: test.checksum,
+		}
+		if test.incremental {
+			opts.OTBatchSize = 3
+			opts.Incremental = true
+		}
+		result, err := EvaluatorWithOptions(conn, ot.NewCO(), circ, b, opts)
+		if err != nil {
+			eStream.Close()
+			t.Fatalf("%+v: evaluator failed: %v", test, err)
+		}
+		// Close flushes the evaluator's reply to the circuit header
+		// and closes the stream.
+		if err := conn.Close(); err != nil {
+			t.Errorf("%+v: evaluator close failed: %v", test, err)
+		}
+		if err := <-gerr; err != nil {
+			t.Fatalf("%+v: garbler failed: %v", test, err)
+		}
+		if result[0].Int64() != 0x5555 {
+			t.Errorf("%+v: got %x, expected 5555", test, result[0])
+		}
+		if _, err := eStream.Write([]byte{0}); err != io.ErrClosedPipe {
+			t.Errorf("%+v: write to closed stream: %v", test, err)
+		}
+	}
+}
+
+func BenchmarkIncrementalEvaluator(b *testing.B) {
+	// The evaluation overlaps the OT round trips over a link with
+	// 2ms latency.
+	circ := newStaggered(64, 10000)
+	x := big.NewInt(0x12345678)
+	y := big.NewInt(0x7654321)
+
+	for _, batch := range []int{0, 8, 32} {
+		name := "all-inputs-first"
+		if batch > 0 {
+			name = fmt.Sprintf("batch-%d", batch)
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := evalIncremental(circ, x, y, batch,
+					time.Millisecond)
+				if err != nil {
+					b.Fatalf("evaluation failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// transferInputs transfers the labels of the wires with OT in batches
+// of batch wires and returns the labels that the evaluator received.
+func transferInputs(t *testing.T, offset int, wires []ot.Wire, flags,
+	public []bool, batch int) []ot.Label {
+
+	gPipe, ePipe := ot.NewPipe()
+
+	gerr := make(chan error, 1)
+	go func() {
+		conn := p2p.NewConn(gPipe)
+		oti := ot.NewCO()
+		err := oti.InitSender(conn)
+		if err == nil {
+			err = sendInputBatches(conn, oti, offset, wires, public)
+		}
+		if err != nil {
+			gPipe.Close()
+		} else {
+			err = conn.Close()
+		}
+		gerr <- err
+	}()
+
+	conn := p2p.NewConn(ePipe)
+	oti := ot.NewCO()
+	labels := make([]ot.Label, len(flags))
+	var batches int
+	err := oti.InitReceiver(conn)
+	if err == nil {
+		err = receiveInputBatches(conn, oti, offset, flags, public, labels,
+			batch, func() {
+				batches++
+			})
+	}
+	conn.Close()
+	if err != nil {
+		ePipe.Drain()
+	}
+	if gerr := <-gerr; gerr != nil {
+		t.Fatalf("batch %d: garbler failed: %v", batch, gerr)
+	}
+	if err != nil {
+		t.Fatalf("batch %d: evaluator failed: %v", batch, err)
+	}
+	expected := 1
+	if batch > 0 {
+		expected = (len(flags) + batch - 1) / batch
+	}
+	if batches != expected {
+		t.Errorf("batch %d: got %d batches, expected %d", batch, batches,
+			expected)
+	}
+	return labels
+}
+
+func TestOTBatchSize(t *testing.T) {
+	const count = 1000
+
+	r := rand.New(rand.NewSource(684))
+	wires := make([]ot.Wire, count)
+	flags := make([]bool, count)
+	public := make([]bool, count)
+	for i := range wires {
+		l0, err := ot.NewLabel(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l1, err := ot.NewLabel(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wires[i] = ot.Wire{
+			L0: l0,
+			L1: l1,
+		}
+		flags[i] = r.Intn(2) == 1
+		public[i] = r.Intn(4) == 0
+	}
+
+	for _, p := range [][]bool{nil, public} {
+		single := transferInputs(t, 16, wires, flags, p, 0)
+		for i, label := range single {
+			expected := wires[i].L0
+			if flags[i] {
+				expected = wires[i].L1
+			}
+			if !label.Equal(expected) {
+				t.Fatalf("label %d: got %v, expected %v", i, label, expected)
+			}
+		}
+		for _, batch := range []int{1000, 300, 64} {
+			labels := transferInputs(t, 16, wires, flags, p, batch)
+			for i, label := range labels {
+				if !label.Equal(single[i]) {
+					t.Fatalf("batch %d: label %d: got %v, expected %v",
+						batch, i, label, single[i])
+				}
+			}
+		}
+	}
+
+	// The evaluator batches the inputs of the whole protocol.
+	circ := newAdder(16)
+	result, err := evalOptions(circ, big.NewInt(1234), big.NewInt(4321),
+		&Options{
+			OTBatchSize: 5,
+		}, 0)
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	if result[0].Int64() != 5555 {
+		t.Errorf("got %v, expected 5555", result[0])
+	}
+}
@@ -0,0 +1,204 @@
+//
+// explain.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// MaxExplainGates specifies the maximum number of gates in
+	// circuits that Explain accepts.
+	MaxExplainGates = 256
+
+	// maxFormulaLen specifies the maximum length of an output bit
+	// formula.
+	maxFormulaLen = 4096
+)
+
+// formula implements a boolean formula over the circuit input bits.
+type formula struct {
+	op   Operation
+	str  string
+	x, y *formula
+}
+
+var (
+	formulaZero = &formula{str: "0"}
+	formulaOne  = &formula{str: "1"}
+)
+
+func (f *formula) isConst() bool {
+	return f == formulaZero || f == formulaOne
+}
+
+func (f *formula) leaf() bool {
+	return f.x == nil
+}
+
+// equal tests if the formulas are syntactically equal.
+func (f *formula) equal(o *formula) bool {
+	return f == o || f.str == o.str
+}
+
+// complement tests if the formula is the negation of the argument
+// formula.
+func (f *formula) complement(o *formula) bool {
+	return (f.op == INV && !f.leaf() && f.x.equal(o)) ||
+		(o.op == INV && !o.leaf() && o.x.equal(f))
+}
+
+func (f *formula) operand() string {
+	if f.leaf() || f.op == INV {
+		return f.str
+	}
+	return "(" + f.str + ")"
+}
+
+func newNot(x *formula) *formula {
+	switch {
+	case x == formulaZero:
+		return formulaOne
+	case x == formulaOne:
+		return formulaZero
+	case x.op == INV && !x.leaf():
+		return x.x
+	}
+	return &formula{
+		op:  INV,
+		str: "!" + x.operand(),
+		x:   x,
+	}
+}
+
+func newBinary(op Operation, x, y *formula) *formula {
+	if y.isConst() {
+		x, y = y, x
+	}
+	switch op {
+	case XOR:
+		switch {
+		case x == formulaZero:
+			return y
+		case x == formulaOne:
+			return newNot(y)
+		case x.equal(y):
+			return formulaZero
+		case x.complement(y):
+			return formulaOne
+		}
+		return newOp(op, "^", x, y)
+
+	case XNOR:
+		return newNot(newBinary(XOR, x, y))
+
+	case AND:
+		switch {
+		case x == formulaZero:
+			return formulaZero
+		case x == formulaOne, x.equal(y):
+			return y
+		case x.complement(y):
+			return formulaZero
+		}
+		return newOp(op, "&", x, y)
+
+	case OR:
+		switch {
+		case x == formulaOne:
+			return formulaOne
+		case x == formulaZero, x.equal(y):
+			return y
+		case x.complement(y):
+			return formulaOne
+		}
+		return newOp(op, "|", x, y)
+
+	default:
+		panic(fmt.Sprintf("invalid binary operation %s", op))
+	}
+}
+
+func newOp(op Operation, sym string, x, y *formula) *formula {
+	return &formula{
+		op:  op,
+		str: x.operand() + " " + sym + " " + y.operand(),
+		x:   x,
+		y:   y,
+	}
+}
+
+// Explain prints the boolean formula of each output bit in terms of
+// the circuit's input bits. The input bits are named after the input
+// arguments and the bits are numbered from the least significant
+// bit. The formulas are simplified by folding constants and
+// complementary operands. Explain is meant for small circuits and it
+// refuses circuits with more than MaxExplainGates gates.
+func (c *Circuit) Explain(out io.Writer) error {
+	if c.NumGates > MaxExplainGates {
+		return fmt.Errorf("circuit has %d gates, explain supports at most %d",
+			c.NumGates, MaxExplainGates)
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	formulas := make([]*formula, c.NumWires)
+
+	var w int
+	for idx, arg := range c.Inputs {
+		name := explainName(arg, "in", idx)
+		for bit := 0; bit < int(arg.Type.Bits); bit++ {
+			formulas[w] = &formula{
+				str: fmt.Sprintf("%s[%d]", name, bit),
+			}
+			w++
+		}
+	}
+
+	for _, g := range c.Gates {
+		var f *formula
+		switch g.Op {
+		case INV:
+			f = newNot(formulas[g.Input0])
+		default:
+			f = newBinary(g.Op, formulas[g.Input0], formulas[g.Input1])
+		}
+		if len(f.str) > maxFormulaLen {
+			return fmt.Errorf("formula of wire %v is too large to explain",
+				g.Output)
+		}
+		formulas[g.Output] = f
+	}
+
+	w = c.NumWires - c.Outputs.Size()
+	for idx, arg := range c.Outputs {
+		name := explainName(arg, "out", idx)
+		for bit := 0; bit < int(arg.Type.Bits); bit++ {
+			_, err := fmt.Fprintf(out, "%s[%d] = %s\n",
+				name, bit, formulas[w].str)
+			if err != nil {
+				return err
+			}
+			w++
+		}
+	}
+	return nil
+}
+
+// explainName returns the name of the argument. The unnamed and
+// compiler generated arguments are named by their position.
+func explainName(arg IOArg, prefix string, idx int) string {
+	if len(arg.Name) == 0 || strings.HasPrefix(arg.Name, "%") {
+		return fmt.Sprintf("%s%d", prefix, idx)
+	}
+	return arg.Name
+}
@@ -0,0 +1,51 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	var sb strings.Builder
+	if err := newAdder(2).Explain(&sb); err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	expected := `r[0] = a[0] ^ b[0]
+r[1] = (a[1] ^ b[1]) ^ (a[0] & b[0])
+`
+	if sb.String() != expected {
+		t.Errorf("Explain:\n%s\nexpected:\n%s", sb.String(), expected)
+	}
+}
+
+func TestExplainSimplify(t *testing.T) {
+	// r = (a & !a) | !(a XNOR b)
+	circ := newTestCircuit(7, []Gate{
+		{Input0: 0, Output: 2, Op: INV},
+		{Input0: 0, Input1: 2, Output: 3, Op: AND},
+		{Input0: 0, Input1: 1, Output: 4, Op: XNOR},
+		{Input0: 4, Output: 5, Op: INV},
+		{Input0: 3, Input1: 5, Output: 6, Op: OR},
+	})
+	var sb strings.Builder
+	if err := circ.Explain(&sb); err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	expected := "r[0] = a[0] ^ b[0]\n"
+	if sb.String() != expected {
+		t.Errorf("Explain: got %q, expected %q", sb.String(), expected)
+	}
+}
+
+func TestExplainLimit(t *testing.T) {
+	err := newAdder(64).Explain(&strings.Builder{})
+	if err == nil {
+		t.Fatalf("Explain succeeded for %d gates", newAdder(64).NumGates)
+	}
+}
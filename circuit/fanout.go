@@ -0,0 +1,90 @@
+//
+// fanout.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"sort"
+)
+
+// WireFanOut holds the fan-out of a wire.
+type WireFanOut struct {
+	Wire   Wire   `json:"wire"`
+	FanOut uint32 `json:"fanout"`
+}
+
+// FanOut returns the fan-out of each circuit wire, that is, the number
+// of gate inputs the wire is connected to.
+func (c *Circuit) FanOut() []uint32 {
+	result := make([]uint32, c.NumWires)
+	for _, g := range c.Gates {
+		result[g.Input0]++
+		if g.Op != INV {
+			result[g.Input1]++
+		}
+	}
+	return result
+}
+
+// TopFanOut returns the n wires with the highest fan-out. The wires
+// are sorted by their fan-out in descending order and the wires with
+// equal fan-out by their wire IDs.
+func (c *Circuit) TopFanOut(n int) []WireFanOut {
+	var result []WireFanOut
+	for w, count := range c.FanOut() {
+		if count > 0 {
+			result = append(result, WireFanOut{
+				Wire:   Wire(w),
+				FanOut: count,
+			})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].FanOut > result[j].FanOut
+	})
+	if n < len(result) {
+		result = result[:n]
+	}
+	return result
+}
+
+// Summary holds the statistics of a circuit in a form suitable for
+// JSON encoding.
+type Summary struct {
+	Gates  uint64       `json:"gates"`
+	Wires  int          `json:"wires"`
+	XOR    uint64       `json:"xor"`
+	XNOR   uint64       `json:"xnor"`
+	AND    uint64       `json:"and"`
+	OR     uint64       `json:"or"`
+	INV    uint64       `json:"inv"`
+	Cost   uint64       `json:"cost"`
+	FanOut []WireFanOut `json:"fanout"`
+	// ANDDepth is the length of the critical path.
+	ANDDepth     int   `json:"and_depth"`
+	CriticalPath []int `json:"critical_path"`
+}
+
+// Summary returns the circuit statistics with the n highest fan-out
+// wires and the critical path of AND gates.
+func (c *Circuit) Summary(n int) Summary {
+	path := c.CriticalPath()
+	return Summary{
+		Gates:        c.Stats.Count(),
+		Wires:        c.NumWires,
+		XOR:          c.Stats[XOR],
+		XNOR:         c.Stats[XNOR],
+		AND:          c.Stats[AND],
+		OR:           c.Stats[OR],
+		INV:          c.Stats[INV],
+		Cost:         c.Cost(),
+		FanOut:       c.TopFanOut(n),
+		ANDDepth:     len(path),
+		CriticalPath: path,
+	}
+}
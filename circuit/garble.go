@@ -7,11 +7,13 @@
 package circuit
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"io"
 
 	"github.com/markkurossi/mpc/ot"
 )
@@ -138,6 +140,36 @@ func encryptHalf(alg cipher.Block, x ot.Label, i uint32,
 	return pi
 }
 
+// halfBatch is the buffer for the half gate hashes of an AND gate.
+type halfBatch [4]ot.LabelData
+
+// encryptHalf4 computes the half gate hashes Hπ(x[n], i[n]) for the
+// four labels like encryptHalf. The keys are encrypted in one batch
+// from the batch buffer so that the garbler computes each of the
+// AND gate's four hashes once.
+func encryptHalf4(alg cipher.Block, x *[4]ot.Label, i *[4]uint32,
+	batch *halfBatch) [4]ot.Label {
+
+	var k [4]ot.Label
+	for n := range k {
+		// k := makeKHalf(x, i)
+		k[n].D0 = x[n].D0<<1 | x[n].D1>>63
+		k[n].D1 = x[n].D1<<1 ^ uint64(i[n])
+
+		binary.BigEndian.PutUint64(batch[n][0:8], k[n].D0)
+		binary.BigEndian.PutUint64(batch[n][8:16], k[n].D1)
+	}
+	for n := range batch {
+		alg.Encrypt(batch[n][:], batch[n][:])
+	}
+	var pi [4]ot.Label
+	for n := range pi {
+		pi[n].D0 = binary.BigEndian.Uint64(batch[n][0:8]) ^ k[n].D0
+		pi[n].D1 = binary.BigEndian.Uint64(batch[n][8:16]) ^ k[n].D1
+	}
+	return pi
+}
+
 // K = 2x ⊕ i
 func makeKHalf(x ot.Label, i uint32) ot.Label {
 	x.Mul2()
@@ -145,18 +177,27 @@ func makeKHalf(x ot.Label, i uint32) ot.Label {
 	return x
 }
 
-func makeLabels(r ot.Label) (ot.Wire, error) {
-	l0, err := ot.NewLabel(rand.Reader)
-	if err != nil {
-		return ot.Wire{}, err
-	}
+// makeLabels creates random labels for a wire. The labels are
+// expanded with the PRG prg.
+func makeLabels(prg ot.PRG, r ot.Label) ot.Wire {
+	l0 := prg.Label()
 	l1 := l0
 	l1.Xor(r)
 
 	return ot.Wire{
 		L0: l0,
 		L1: l1,
-	}, nil
+	}
+}
+
+// newPRG creates a PRG for the wire labels. The PRG seed is read from
+// rnd.
+func newPRG(rnd io.Reader) (ot.PRG, error) {
+	seed, err := ot.NewLabel(rnd)
+	if err != nil {
+		return nil, err
+	}
+	return ot.NewPRG(seed), nil
 }
 
 // Garbled contains garbled circuit information.
@@ -164,6 +205,20 @@ type Garbled struct {
 	R     ot.Label
 	Wires []ot.Wire
 	Gates [][]ot.Label
+	// tables holds the garbled tables of all gates. The Gates
+	// slices point to it.
+	tables []ot.Label
+	// key and alg hold the fixed-key cipher and its round keys so
+	// that garbling again with the same key does not expand the key
+	// schedule again.
+	key []byte
+	alg cipher.Block
+}
+
+// Key returns the fixed-key cipher key the circuit was garbled with.
+// The evaluator needs the key to evaluate the garbled tables.
+func (g *Garbled) Key() []byte {
+	return g.key
 }
 
 // Lambda returns the lambda value of the wire.
@@ -185,58 +240,132 @@ func (g *Garbled) SetLambda(wire Wire, val uint) {
 	g.Wires[wire] = w
 }
 
-// Garble garbles the circuit.
+// Garble garbles the circuit. A garbled circuit must be evaluated
+// only once: evaluating it with different inputs reveals the wire
+// values to the evaluator. Use GarbleInto to garble circuits
+// repeatedly without allocating new garbled circuits.
 func (c *Circuit) Garble(key []byte) (*Garbled, error) {
+	return c.GarbleWithRand(key, rand.Reader)
+}
+
+// GarbleWithRand garbles the circuit like Garble but it reads the
+// random offset R and the seed of the wire label PRG, see ot.PRG,
+// from rnd. The deterministic sources, see ot.NewSeededReader, make
+// the garbled circuits reproducible but they break the security of
+// the computation so they must be used only for tests, demos, and
+// debugging.
+func (c *Circuit) GarbleWithRand(key []byte, rnd io.Reader) (
+	*Garbled, error) {
+
+	garbled := new(Garbled)
+	if err := c.garbleInto(garbled, key, rnd); err != nil {
+		return nil, err
+	}
+	return garbled, nil
+}
+
+// GarbleInto garbles the circuit into g with fresh wire labels. The
+// function reuses the wire label and garbled table allocations of g
+// when they are large enough so garbling the same circuit again does
+// not allocate them. The previous content of g is overwritten,
+// including the garbled table slices of g.Gates.
+func (c *Circuit) GarbleInto(g *Garbled, key []byte) error {
+	return c.garbleInto(g, key, rand.Reader)
+}
+
+func (c *Circuit) garbleInto(g *Garbled, key []byte, rnd io.Reader) error {
 	// Create R.
-	r, err := ot.NewLabel(rand.Reader)
+	r, err := ot.NewLabel(rnd)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	r.SetS(true)
 
-	garbled := make([][]ot.Label, c.NumGates)
-
-	alg, err := aes.NewCipher(key)
+	prg, err := newPRG(rnd)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if g.alg == nil || !bytes.Equal(g.key, key) {
+		alg, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		g.key = append(g.key[:0], key...)
+		g.alg = alg
 	}
+	alg := g.alg
 
 	// Wire labels.
-	wires := make([]ot.Wire, c.NumWires)
+	if cap(g.Wires) < c.NumWires {
+		g.Wires = make([]ot.Wire, c.NumWires)
+	} else {
+		g.Wires = g.Wires[:c.NumWires]
+		clear(g.Wires)
+	}
+	wires := g.Wires
+
+	// Garbled tables.
+	var rows int
+	for i := 0; i < len(c.Gates); i++ {
+		rows += c.Gates[i].Op.garbledRows()
+	}
+	if cap(g.tables) < rows {
+		g.tables = make([]ot.Label, rows)
+	} else {
+		g.tables = g.tables[:rows]
+	}
+	if cap(g.Gates) < c.NumGates {
+		g.Gates = make([][]ot.Label, c.NumGates)
+	} else {
+		g.Gates = g.Gates[:c.NumGates]
+	}
 
 	// Assing all input wires.
+	var batch halfBatch
 	for i := 0; i < c.Inputs.Size(); i++ {
-		w, err := makeLabels(r)
-		if err != nil {
-			return nil, err
-		}
-		wires[i] = w
+		wires[i] = makeLabels(prg, r)
 	}
 
 	// Garble gates.
-	var data ot.LabelData
 	var id uint32
+	var pos int
 	for i := 0; i < len(c.Gates); i++ {
 		gate := &c.Gates[i]
-		data, err := gate.garble(wires, alg, r, &id, &data)
+		count, err := gate.garble(wires, alg, r, &id, &batch, g.tables[pos:])
 		if err != nil {
-			return nil, err
+			return err
 		}
-		garbled[i] = data
+		g.Gates[i] = g.tables[pos : pos+count : pos+count]
+		pos += count
 	}
+	g.R = r
 
-	return &Garbled{
-		R:     r,
-		Wires: wires,
-		Gates: garbled,
-	}, nil
+	return nil
 }
 
-// Garble garbles the gate and returns it labels.
+// garbledRows returns the number of garbled table rows of the gate
+// operation.
+func (op Operation) garbledRows() int {
+	switch op {
+	case AND:
+		return 2
+	case OR:
+		return 3
+	case INV:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Garble garbles the gate into the garbled table rows and returns the
+// number of rows.
 func (g *Gate) garble(wires []ot.Wire, enc cipher.Block, r ot.Label,
-	idp *uint32, data *ot.LabelData) ([]ot.Label, error) {
+	idp *uint32, batch *halfBatch, rows []ot.Label) (int, error) {
 
 	var a, b, c ot.Wire
+	data := &batch[0]
 
 	var table [4]ot.Label
 	var start, count int
@@ -251,7 +380,7 @@ func (g *Gate) garble(wires []ot.Wire, enc cipher.Block, r ot.Label,
 		a = wires[g.Input0]
 
 	default:
-		return nil, fmt.Errorf("invalid gate type %s", g.Op)
+		return 0, fmt.Errorf("%w %s", ErrInvalidOperation, g.Op)
 	}
 
 	// Output.
@@ -286,22 +415,25 @@ func (g *Gate) garble(wires []ot.Wire, enc cipher.Block, r ot.Label,
 		j1 := *idp + 1
 		*idp = *idp + 2
 
+		h := encryptHalf4(enc, &[4]ot.Label{a.L0, a.L1, b.L0, b.L1},
+			&[4]uint32{j0, j0, j1, j1}, batch)
+
 		// First half gate.
-		tg := encryptHalf(enc, a.L0, j0, data)
-		tg.Xor(encryptHalf(enc, a.L1, j0, data))
+		tg := h[0]
+		tg.Xor(h[1])
 		if pb {
 			tg.Xor(r)
 		}
-		wg0 := encryptHalf(enc, a.L0, j0, data)
+		wg0 := h[0]
 		if pa {
 			wg0.Xor(tg)
 		}
 
 		// Second half gate.
-		te := encryptHalf(enc, b.L0, j1, data)
-		te.Xor(encryptHalf(enc, b.L1, j1, data))
+		te := h[2]
+		te.Xor(h[3])
 		te.Xor(a.L0)
-		we0 := encryptHalf(enc, b.L0, j1, data)
+		we0 := h[2]
 		if pb {
 			we0.Xor(te)
 			we0.Xor(a.L0)
@@ -402,9 +534,9 @@ func (g *Gate) garble(wires []ot.Wire, enc cipher.Block, r ot.Label,
 		count = 1
 
 	default:
-		return nil, fmt.Errorf("invalid operand %s", g.Op)
+		return 0, fmt.Errorf("%w %s", ErrInvalidOperation, g.Op)
 	}
 	wires[g.Output] = c
 
-	return table[start : start+count], nil
+	return copy(rows, table[start:start+count]), nil
 }
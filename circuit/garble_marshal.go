@@ -0,0 +1,210 @@
+//
+// garble_marshal.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bufio"
+	"crypto/aes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/markkurossi/mpc/ot"
+)
+
+// GARBLED is a magic number for the garbled circuit format. The
+// format is SECRET: it holds both labels of every wire so anyone
+// holding the marshaled data can decode all inputs and outputs of
+// the circuit evaluation. Only the garbler may store it.
+const GARBLED = 0x67736563 // gsec
+
+type garbledHeader struct {
+	Magic    uint32
+	KeyLen   uint32
+	NumWires uint32
+	NumGates uint32
+	NumRows  uint32
+}
+
+// garbledPrealloc specifies the maximum number of wires, gates, and
+// garbled rows that UnmarshalGarbled allocates based on the header
+// values before it has read the data.
+const garbledPrealloc = 1 << 16
+
+// Marshal marshals the garbled circuit so that it can be garbled
+// offline and evaluated later. The data holds the cipher key, the
+// global offset R, the label pairs of all wires, including the
+// input wire labels for the oblivious transfers and the output wire
+// labels for decoding the result, and the garbled tables. The data
+// ends with a CRC-32 checksum computed over all preceding bytes.
+//
+// The marshaled data is SECRET and it must never be sent to the
+// evaluator. Send the evaluator only the key and the garbled tables
+// as the Garbler does.
+func (g *Garbled) Marshal(w io.Writer) error {
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(w)
+	out := io.MultiWriter(bw, crc)
+
+	header := garbledHeader{
+		Magic:    GARBLED,
+		KeyLen:   uint32(len(g.key)),
+		NumWires: uint32(len(g.Wires)),
+		NumGates: uint32(len(g.Gates)),
+	}
+	for _, table := range g.Gates {
+		header.NumRows += uint32(len(table))
+	}
+	if err := binary.Write(out, bo, &header); err != nil {
+		return err
+	}
+	if _, err := out.Write(g.key); err != nil {
+		return err
+	}
+
+	var data ot.LabelData
+	writeLabel := func(l ot.Label) error {
+		_, err := out.Write(l.Bytes(&data))
+		return err
+	}
+	if err := writeLabel(g.R); err != nil {
+		return err
+	}
+	for _, wire := range g.Wires {
+		if err := writeLabel(wire.L0); err != nil {
+			return err
+		}
+		if err := writeLabel(wire.L1); err != nil {
+			return err
+		}
+	}
+	for _, table := range g.Gates {
+		if _, err := out.Write([]byte{byte(len(table))}); err != nil {
+			return err
+		}
+		for _, l := range table {
+			if err := writeLabel(l); err != nil {
+				return err
+			}
+		}
+	}
+	if err := binary.Write(bw, bo, crc.Sum32()); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// UnmarshalGarbled unmarshals the garbled circuit marshaled with
+// Garbled.Marshal. The function returns an error wrapping
+// ErrCorruptCircuit if the data is malformed and ErrChecksum if the
+// data checksum does not match.
+func UnmarshalGarbled(r io.Reader) (*Garbled, error) {
+	crc := crc32.NewIEEE()
+	br := bufio.NewReader(r)
+	in := io.TeeReader(br, crc)
+
+	var header garbledHeader
+	if err := binary.Read(in, bo, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != GARBLED {
+		return nil, fmt.Errorf("invalid garbled circuit magic 0x%08x",
+			header.Magic)
+	}
+	switch header.KeyLen {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("%w: invalid key length %d",
+			ErrCorruptCircuit, header.KeyLen)
+	}
+	if uint64(header.NumRows) > uint64(header.NumGates)*3 {
+		return nil, fmt.Errorf("%w: %d garbled rows for %d gates",
+			ErrCorruptCircuit, header.NumRows, header.NumGates)
+	}
+
+	// The header values are not trusted before the checksum is
+	// verified so the wires, gates, and rows are allocated as they
+	// are read.
+	g := &Garbled{
+		key:    make([]byte, header.KeyLen),
+		Wires:  make([]ot.Wire, 0, min(header.NumWires, garbledPrealloc)),
+		tables: make([]ot.Label, 0, min(header.NumRows, garbledPrealloc)),
+	}
+	if _, err := io.ReadFull(in, g.key); err != nil {
+		return nil, err
+	}
+	alg, err := aes.NewCipher(g.key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptCircuit, err)
+	}
+	g.alg = alg
+
+	var data ot.LabelData
+	readLabel := func(l *ot.Label) error {
+		if _, err := io.ReadFull(in, data[:]); err != nil {
+			return err
+		}
+		l.SetData(&data)
+		return nil
+	}
+	if err := readLabel(&g.R); err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < header.NumWires; i++ {
+		var wire ot.Wire
+		if err := readLabel(&wire.L0); err != nil {
+			return nil, err
+		}
+		if err := readLabel(&wire.L1); err != nil {
+			return nil, err
+		}
+		g.Wires = append(g.Wires, wire)
+	}
+	counts := make([]byte, 0, min(header.NumGates, garbledPrealloc))
+	var count [1]byte
+	var label ot.Label
+	for i := uint32(0); i < header.NumGates; i++ {
+		if _, err := io.ReadFull(in, count[:]); err != nil {
+			return nil, err
+		}
+		n := int(count[0])
+		if n > 3 || len(g.tables)+n > int(header.NumRows) {
+			return nil, fmt.Errorf("%w: gate %d: invalid number of rows %d",
+				ErrCorruptCircuit, i, n)
+		}
+		for j := 0; j < n; j++ {
+			if err := readLabel(&label); err != nil {
+				return nil, err
+			}
+			g.tables = append(g.tables, label)
+		}
+		counts = append(counts, count[0])
+	}
+	if len(g.tables) != int(header.NumRows) {
+		return nil, fmt.Errorf("%w: read %d garbled rows, expected %d",
+			ErrCorruptCircuit, len(g.tables), header.NumRows)
+	}
+	g.Gates = make([][]ot.Label, len(counts))
+	var pos int
+	for i, c := range counts {
+		n := int(c)
+		g.Gates[i] = g.tables[pos : pos+n : pos+n]
+		pos += n
+	}
+
+	var checksum uint32
+	if err := binary.Read(br, bo, &checksum); err != nil {
+		return nil, err
+	}
+	if checksum != crc.Sum32() {
+		return nil, ErrChecksum
+	}
+	return g, nil
+}
@@ -0,0 +1,103 @@
+//
+// garble_marshal_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestGarbledMarshal(t *testing.T) {
+	const bits = 16
+
+	circ := newAdder(bits)
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	g, err := circ.Garble(key)
+	if err != nil {
+		t.Fatalf("Garble failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := g.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	u, err := UnmarshalGarbled(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("UnmarshalGarbled failed: %v", err)
+	}
+	if !bytes.Equal(u.Key(), key) || !u.R.Equal(g.R) {
+		t.Errorf("unmarshaled key or R differs")
+	}
+	if len(u.Wires) != len(g.Wires) || len(u.Gates) != len(g.Gates) {
+		t.Fatalf("unmarshaled %d wires and %d gates, expected %d and %d",
+			len(u.Wires), len(u.Gates), len(g.Wires), len(g.Gates))
+	}
+	for i := range g.Wires {
+		if u.Wires[i] != g.Wires[i] {
+			t.Fatalf("wire %d: labels differ", i)
+		}
+	}
+
+	for _, input := range [][2]int64{{1, 2}, {0xffff, 1}, {0x1234, 0x4321}} {
+		expected := evalGarbled(t, circ, g, key, input[0], input[1])
+		result := evalGarbled(t, circ, u, u.Key(), input[0], input[1])
+		if result != expected {
+			t.Errorf("%d+%d: got %d, expected %d", input[0], input[1],
+				result, expected)
+		}
+		if expected != (input[0]+input[1])&(1<<bits-1) {
+			t.Errorf("%d+%d: got %d", input[0], input[1], expected)
+		}
+	}
+
+	corrupted := bytes.Clone(data)
+	corrupted[len(corrupted)/2] ^= 1
+	_, err = UnmarshalGarbled(bytes.NewReader(corrupted))
+	if !errors.Is(err, ErrChecksum) {
+		t.Errorf("corrupted data: got %v, expected %v", err, ErrChecksum)
+	}
+	_, err = UnmarshalGarbled(bytes.NewReader(data[:len(data)-10]))
+	if err == nil {
+		t.Errorf("truncated data: unmarshal succeeded")
+	}
+	buf.Reset()
+	if err := circ.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if _, err = UnmarshalGarbled(&buf); err == nil {
+		t.Errorf("circuit data: unmarshal succeeded")
+	}
+}
+
+func TestGarbledMarshalHeader(t *testing.T) {
+	for idx, header := range []garbledHeader{
+		{KeyLen: 0xffffffff},
+		{KeyLen: 20},
+		{KeyLen: 16, NumWires: 0xffffffff},
+		{KeyLen: 32, NumGates: 0xffffffff, NumRows: 0xffffffff},
+	} {
+		header.Magic = GARBLED
+		var buf bytes.Buffer
+		if err := binary.Write(&buf, bo, &header); err != nil {
+			t.Fatalf("binary.Write failed: %v", err)
+		}
+		buf.Write(make([]byte, 64))
+		_, err := UnmarshalGarbled(&buf)
+		if err == nil {
+			t.Errorf("test %d: unmarshal succeeded", idx)
+		}
+	}
+}
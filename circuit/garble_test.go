@@ -0,0 +1,180 @@
+//
+// garble_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+)
+
+// evalGarbled evaluates the garbled circuit with the input values a
+// and b and decodes the result with the garbler's wire labels.
+func evalGarbled(t *testing.T, circ *Circuit, g *Garbled, key []byte,
+	a, b int64) int64 {
+
+	inputs := new(big.Int).Lsh(big.NewInt(b), uint(circ.Inputs[0].Type.Bits))
+	inputs.Or(inputs, big.NewInt(a))
+
+	wires := make([]ot.Label, circ.NumWires)
+	for i := 0; i < circ.Inputs.Size(); i++ {
+		if inputs.Bit(i) == 1 {
+			wires[i] = g.Wires[i].L1
+		} else {
+			wires[i] = g.Wires[i].L0
+		}
+	}
+	if err := circ.Eval(key, wires, g.Gates); err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	var result int64
+	for i := 0; i < circ.Outputs.Size(); i++ {
+		w := Wire(circ.NumWires - circ.Outputs.Size() + i)
+		switch {
+		case wires[w].Equal(g.Wires[w].L0):
+		case wires[w].Equal(g.Wires[w].L1):
+			result |= 1 << i
+		default:
+			t.Fatalf("invalid label for output wire %d", w)
+		}
+	}
+	return result
+}
+
+func TestGarbleInto(t *testing.T) {
+	const bits = 16
+
+	circ := newAdder(bits)
+	key := make([]byte, 32)
+	mask := int64(1<<bits - 1)
+
+	g, err := circ.Garble(key)
+	if err != nil {
+		t.Fatalf("Garble failed: %v", err)
+	}
+	wires := &g.Wires[0]
+	r := g.R
+
+	for i, input := range [][2]int64{{1, 2}, {0xffff, 1}, {0x1234, 0x4321}} {
+		if err := circ.GarbleInto(g, key); err != nil {
+			t.Fatalf("GarbleInto failed: %v", err)
+		}
+		if &g.Wires[0] != wires {
+			t.Errorf("GarbleInto %d did not reuse wire labels", i)
+		}
+		if g.R.Equal(r) {
+			t.Errorf("GarbleInto %d did not create fresh labels", i)
+		}
+		r = g.R
+
+		result := evalGarbled(t, circ, g, key, input[0], input[1])
+		expected := (input[0] + input[1]) & mask
+		if result != expected {
+			t.Errorf("GarbleInto %d: %x+%x=%x, expected %x",
+				i, input[0], input[1], result, expected)
+		}
+	}
+
+	// A larger circuit reallocates.
+	large := newAdder(2 * bits)
+	if err := large.GarbleInto(g, key); err != nil {
+		t.Fatalf("GarbleInto failed: %v", err)
+	}
+	if len(g.Wires) != large.NumWires || len(g.Gates) != large.NumGates {
+		t.Fatalf("GarbleInto: got %d wires and %d gates, expected %d and %d",
+			len(g.Wires), len(g.Gates), large.NumWires, large.NumGates)
+	}
+	result := evalGarbled(t, large, g, key, 0x10000, 0x20000)
+	if result != 0x30000 {
+		t.Errorf("GarbleInto: got %x, expected %x", result, 0x30000)
+	}
+}
+
+func TestGarbleSeeded(t *testing.T) {
+	circ := newAdder(8)
+	key := make([]byte, 32)
+
+	garble := func(seed string) *Garbled {
+		rnd := rand.Reader
+		if len(seed) > 0 {
+			rnd = ot.NewSeededReader([]byte(seed), "garble")
+		}
+		g, err := circ.GarbleWithRand(key, rnd)
+		if err != nil {
+			t.Fatalf("Garble failed: %v", err)
+		}
+		return g
+	}
+
+	g0 := garble("seed")
+	g1 := garble("seed")
+	if !g0.R.Equal(g1.R) {
+		t.Errorf("seeded garblings have different R")
+	}
+	for i := range g0.Wires {
+		if !g0.Wires[i].L0.Equal(g1.Wires[i].L0) {
+			t.Fatalf("seeded garblings have different labels for wire %d", i)
+		}
+	}
+	if garble("other").R.Equal(g0.R) {
+		t.Errorf("garblings with different seeds have equal R")
+	}
+	if garble("").R.Equal(g0.R) {
+		t.Errorf("default garbling uses the seeded source")
+	}
+	if result := evalGarbled(t, circ, g0, key, 100, 27); result != 127 {
+		t.Errorf("seeded garbling: got %d, expected 127", result)
+	}
+}
+
+func BenchmarkGarble(b *testing.B) {
+	circ := newAdder(1024)
+	key := make([]byte, 32)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := circ.Garble(key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGarbleInto(b *testing.B) {
+	circ := newAdder(1024)
+	key := make([]byte, 32)
+	g := new(Garbled)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := circ.GarbleInto(g, key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGarbleMultiplier(b *testing.B) {
+	circ, err := Parse("../pkg/math/mul64.circ")
+	if err != nil {
+		b.Fatal(err)
+	}
+	key := make([]byte, 32)
+	g := new(Garbled)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := circ.GarbleInto(g, key); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(circ.NumGates)*float64(b.N)/b.Elapsed().Seconds(),
+		"gates/s")
+}
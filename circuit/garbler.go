@@ -1,7 +1,7 @@
 //
 // garbler.go
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -9,8 +9,8 @@
 package circuit
 
 import (
-	"crypto/rand"
 	"fmt"
+	"io"
 	"math/big"
 
 	"github.com/markkurossi/mpc/ot"
@@ -37,19 +37,33 @@ func (s FileSize) String() string {
 // Garbler runs the garbler on the P2P network.
 func Garbler(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	verbose bool) ([]*big.Int, error) {
+	return GarblerWithOptions(conn, oti, circ, inputs, &Options{
+		Verbose: verbose,
+	})
+}
+
+// GarblerWithOptions runs the garbler on the P2P network with the
+// options.
+func GarblerWithOptions(conn *p2p.Conn, oti ot.OT, circ *Circuit,
+	inputs *big.Int, opts *Options) ([]*big.Int, error) {
 
+	if err := circ.Inputs.CheckTwoParty(); err != nil {
+		return nil, err
+	}
+	verbose := opts.Verbose
+	rnd := opts.random()
 	timing := NewTiming()
 	if verbose {
 		fmt.Printf(" - Garbling...\n")
 	}
 
 	var key [32]byte
-	_, err := rand.Read(key[:])
+	_, err := io.ReadFull(rnd, key[:])
 	if err != nil {
 		return nil, err
 	}
 
-	garbled, err := circ.Garble(key[:])
+	garbled, err := circ.GarbleWithRand(key[:], rnd)
 	if err != nil {
 		return nil, err
 	}
@@ -60,23 +74,52 @@ func Garbler(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	if verbose {
 		fmt.Printf(" - Sending garbled circuit...\n")
 	}
+	if err := circ.sendIOHeader(conn); err != nil {
+		return nil, err
+	}
 	if err := conn.SendData(key[:]); err != nil {
 		return nil, err
 	}
+	var tm *tableMAC
+	if opts.TableChecksum {
+		var macKey [macKeySize]byte
+		_, err := io.ReadFull(rnd, macKey[:])
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.SendData(macKey[:]); err != nil {
+			return nil, err
+		}
+		tm = newTableMAC(macKey[:])
+	}
 
 	// Send garbled tables.
 	if err := conn.SendUint32(len(garbled.Gates)); err != nil {
 		return nil, err
 	}
+	if tm != nil {
+		tm.count(len(garbled.Gates))
+	}
 	var labelData ot.LabelData
 	for _, data := range garbled.Gates {
 		if err := conn.SendUint32(len(data)); err != nil {
 			return nil, err
 		}
+		if tm != nil {
+			tm.count(len(data))
+		}
 		for _, d := range data {
 			if err := conn.SendLabel(d, &labelData); err != nil {
 				return nil, err
 			}
+			if tm != nil {
+				tm.label(&labelData)
+			}
+		}
+	}
+	if tm != nil {
+		if err := conn.SendData(tm.sum()); err != nil {
+			return nil, err
 		}
 	}
 
@@ -120,20 +163,10 @@ func Garbler(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	timing.Sample("OT Init", []string{FileSize(xfer).String()})
 
 	// Peer OTs its inputs.
-	offset, err := conn.ReceiveUint32()
-	if err != nil {
-		return nil, err
-	}
-	count, err := conn.ReceiveUint32()
-	if err != nil {
-		return nil, err
-	}
-	if offset != int(circ.Inputs[0].Type.Bits) ||
-		count != int(circ.Inputs[1].Type.Bits) {
-		return nil, fmt.Errorf("peer can't OT wires [%d...%d[",
-			offset, offset+count)
-	}
-	err = oti.Send(garbled.Wires[offset : offset+count])
+	offset := int(circ.Inputs[0].Type.Bits)
+	count := int(circ.Inputs[1].Type.Bits)
+	err = sendInputBatches(conn, oti, offset,
+		garbled.Wires[offset:offset+count], circ.Inputs[1].PublicBits())
 	if err != nil {
 		return nil, err
 	}
@@ -176,9 +209,91 @@ func Garbler(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 
 	xfer = conn.Stats.Sum() - ioStats
 	timing.Sample("Result", []string{FileSize(xfer).String()})
+	if opts.Profile != nil {
+		*opts.Profile = *NewProfile(RoleGarbler, timing, circ.gateStats(),
+			otCount(circ.Inputs[1]), conn.Stats)
+	}
 	if verbose {
 		timing.Print(conn.Stats)
 	}
 
 	return circ.Outputs.Split(result), nil
 }
+
+// sendInputBatches sends the labels of the evaluator's input wires
+// [offset, offset+len(wires)) in the consecutive batches that the
+// evaluator requests. The public specifies the input bits that are
+// public.
+func sendInputBatches(conn *p2p.Conn, oti ot.OT, offset int, wires []ot.Wire,
+	public []bool) error {
+
+	end := offset + len(wires)
+	next := offset
+	for {
+		start, err := conn.ReceiveUint32()
+		if err != nil {
+			return err
+		}
+		count, err := conn.ReceiveUint32()
+		if err != nil {
+			return err
+		}
+		if start != next || count < 0 || start+count > end ||
+			(count == 0 && start < end) {
+			return fmt.Errorf("peer can't OT wires [%d...%d[",
+				start, start+count)
+		}
+		var p []bool
+		if public != nil {
+			p = public[start-offset : start-offset+count]
+		}
+		err = sendInputs(conn, oti, wires[start-offset:start-offset+count], p)
+		if err != nil {
+			return err
+		}
+		next += count
+		if next >= end {
+			return nil
+		}
+	}
+}
+
+// sendInputs sends the labels of the evaluator's input wires. The
+// public specifies the input bits that are public. The evaluator
+// sends the values of the public bits in plain and they are replied
+// with their labels. The private inputs are transferred with OT.
+func sendInputs(conn *p2p.Conn, oti ot.OT, wires []ot.Wire,
+	public []bool) error {
+
+	if public != nil {
+		data, err := conn.ReceiveData()
+		if err != nil {
+			return err
+		}
+		values := new(big.Int).SetBytes(data)
+
+		var labelData ot.LabelData
+		var private []ot.Wire
+		for i, wire := range wires {
+			if !public[i] {
+				private = append(private, wire)
+				continue
+			}
+			n := wire.L0
+			if values.Bit(i) == 1 {
+				n = wire.L1
+			}
+			if err := conn.SendLabel(n, &labelData); err != nil {
+				return err
+			}
+		}
+		if err := conn.Flush(); err != nil {
+			return err
+		}
+		wires = private
+	}
+	if len(wires) > 0 {
+		return oti.Send(wires)
+	}
+	return nil
+}
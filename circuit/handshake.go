@@ -0,0 +1,175 @@
+//
+// handshake.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// ErrIOMismatch is returned when the garbler and the evaluator do not
+// agree on the circuit that they compute.
+var ErrIOMismatch = errors.New("circuit mismatch")
+
+// ioHeader returns the circuit header of the MPCL circuit format. The
+// header describes the circuit size and its inputs and outputs.
+func (c *Circuit) ioHeader() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := NewGateWriter(&buf, c.NumGates, c.NumWires, c.Inputs, c.Outputs)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type circuitHeader struct {
+	numGates int
+	numWires int
+	inputs   IO
+	outputs  IO
+}
+
+func parseIOHeader(data []byte) (*circuitHeader, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+
+	var header mpclcHeader
+	if err := binary.Read(r, bo, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != MAGIC2 {
+		return nil, fmt.Errorf("invalid circuit header magic 0x%08x",
+			header.Magic)
+	}
+	result := &circuitHeader{
+		numGates: int(header.NumGates),
+		numWires: int(header.NumWires),
+	}
+	for i := 0; i < int(header.NumInputs); i++ {
+		arg, err := parseIOArg(r, header.Magic)
+		if err != nil {
+			return nil, err
+		}
+		result.inputs = append(result.inputs, arg)
+	}
+	for i := 0; i < int(header.NumOutputs); i++ {
+		arg, err := parseIOArg(r, header.Magic)
+		if err != nil {
+			return nil, err
+		}
+		result.outputs = append(result.outputs, arg)
+	}
+	return result, nil
+}
+
+// checkIOHeader checks that the circuit matches the peer's circuit
+// header. The argument names are not compared since they do not
+// affect the computation.
+func (c *Circuit) checkIOHeader(data []byte) error {
+	peer, err := parseIOHeader(data)
+	if err != nil {
+		return err
+	}
+	// Our header is parsed the same way so that the argument types
+	// are compared in their serialized form.
+	ourData, err := c.ioHeader()
+	if err != nil {
+		return err
+	}
+	our, err := parseIOHeader(ourData)
+	if err != nil {
+		return err
+	}
+
+	check := func(kind string, peer, our IO) error {
+		if len(peer) != len(our) {
+			return fmt.Errorf("%w: garbler has %d %ss, evaluator has %d",
+				ErrIOMismatch, len(peer), kind, len(our))
+		}
+		for idx := range peer {
+			if peer[idx].Type.String() != our[idx].Type.String() ||
+				peer[idx].Type.Bits != our[idx].Type.Bits {
+				return fmt.Errorf("%w: %s %d: garbler has %s, evaluator has %s",
+					ErrIOMismatch, kind, idx, peer[idx], our[idx])
+			}
+			// The public bits are transferred without OT so both
+			// parties must agree on them.
+			if !slices.Equal(peer[idx].PublicBits(), our[idx].PublicBits()) {
+				return fmt.Errorf("%w: %s %d: public bits of %s differ",
+					ErrIOMismatch, kind, idx, our[idx])
+			}
+		}
+		return nil
+	}
+	if err := check("input", peer.inputs, our.inputs); err != nil {
+		return err
+	}
+	if err := check("output", peer.outputs, our.outputs); err != nil {
+		return err
+	}
+	if peer.numGates != our.numGates || peer.numWires != our.numWires {
+		return fmt.Errorf(
+			"%w: garbler has %d gates and %d wires, evaluator has %d and %d",
+			ErrIOMismatch, peer.numGates, peer.numWires,
+			our.numGates, our.numWires)
+	}
+	return nil
+}
+
+// sendIOHeader sends the circuit header to the evaluator and waits
+// for its verdict. The evaluator rejects the computation if its
+// circuit does not match the header.
+func (c *Circuit) sendIOHeader(conn *p2p.Conn) error {
+	header, err := c.ioHeader()
+	if err != nil {
+		return err
+	}
+	if err := conn.SendData(header); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	reply, err := conn.ReceiveString()
+	if err != nil {
+		return err
+	}
+	if len(reply) > 0 {
+		return fmt.Errorf("%w: evaluator rejected circuit: %s",
+			ErrIOMismatch, reply)
+	}
+	return nil
+}
+
+// receiveIOHeader receives the garbler's circuit header and checks
+// that it matches the circuit. The result of the check is sent to the
+// garbler.
+func (c *Circuit) receiveIOHeader(conn *p2p.Conn) error {
+	header, err := conn.ReceiveData()
+	if err != nil {
+		return err
+	}
+	var reply string
+	checkErr := c.checkIOHeader(header)
+	if checkErr != nil {
+		reply = checkErr.Error()
+	}
+	if err := conn.SendString(reply); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	return checkErr
+}
@@ -0,0 +1,114 @@
+//
+// handshake_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+	"github.com/markkurossi/mpc/types"
+)
+
+// evalPair runs the garbler with the circuit gc and the evaluator
+// with the circuit ec.
+func evalPair(gc, ec *Circuit, a, b *big.Int) ([]*big.Int, error, error) {
+	return evalPairOptions(gc, ec, a, b, &Options{}, &Options{})
+}
+
+// evalPairOptions runs the garbler with the circuit gc and the
+// options gopts and the evaluator with the circuit ec and the options
+// eopts.
+func evalPairOptions(gc, ec *Circuit, a, b *big.Int, gopts,
+	eopts *Options) ([]*big.Int, error, error) {
+
+	gPipe, ePipe := ot.NewPipe()
+
+	gerr := make(chan error, 1)
+	go func() {
+		conn := p2p.NewConn(gPipe)
+		_, err := GarblerWithOptions(conn, ot.NewCO(), gc, a, gopts)
+		if err != nil {
+			gPipe.Close()
+		} else {
+			err = conn.Close()
+		}
+		gerr <- err
+	}()
+
+	conn := p2p.NewConn(ePipe)
+	result, err := EvaluatorWithOptions(conn, ot.NewCO(), ec, b, eopts)
+	// Close flushes the evaluator's reply to the circuit header.
+	conn.Close()
+	if err != nil {
+		ePipe.Drain()
+	}
+	return result, <-gerr, err
+}
+
+func TestIOMismatch(t *testing.T) {
+	circ := newAdder(8)
+
+	// The argument names do not affect the computation.
+	renamed := newAdder(8)
+	renamed.Inputs[0].Name = "x"
+	result, gerr, eerr := evalPair(circ, renamed, big.NewInt(100),
+		big.NewInt(27))
+	if gerr != nil || eerr != nil {
+		t.Fatalf("evaluation failed: garbler=%v, evaluator=%v", gerr, eerr)
+	}
+	if len(result) != 1 || result[0].Int64() != 127 {
+		t.Errorf("evaluation returned %v, expected 127", result)
+	}
+
+	wide := newAdder(16)
+	signed := newAdder(8)
+	signed.Inputs[1].Type.Type = types.TInt
+	public := newAdder(8)
+	public.Inputs[1].Public = true
+	gates := newAdder(8)
+	gates.Gates = append(gates.Gates, Gate{
+		Input0: 0,
+		Input1: 1,
+		Output: Wire(gates.NumWires),
+		Op:     XOR,
+	})
+	gates.NumGates++
+	gates.NumWires++
+
+	for idx, test := range []struct {
+		circ   *Circuit
+		reason string
+	}{
+		{wide, "input 0: garbler has a:uint8, evaluator has a:uint16"},
+		{signed, "input 1: garbler has b:uint8, evaluator has b:int8"},
+		{public, "input 1: public bits of b:uint8 differ"},
+		{gates, "garbler has 35 gates"},
+	} {
+		_, gerr, eerr := evalPair(circ, test.circ, big.NewInt(1),
+			big.NewInt(2))
+		if !errors.Is(eerr, ErrIOMismatch) {
+			t.Errorf("test %d: evaluator: got %v, expected %v",
+				idx, eerr, ErrIOMismatch)
+		} else if !strings.Contains(eerr.Error(), test.reason) {
+			t.Errorf("test %d: evaluator: got %v, expected %v",
+				idx, eerr, test.reason)
+		}
+		if !errors.Is(gerr, ErrIOMismatch) {
+			t.Errorf("test %d: garbler: got %v, expected %v",
+				idx, gerr, ErrIOMismatch)
+		} else if !strings.Contains(gerr.Error(), test.reason) {
+			t.Errorf("test %d: garbler: got %v, expected %v",
+				idx, gerr, test.reason)
+		}
+	}
+}
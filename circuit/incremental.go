@@ -0,0 +1,122 @@
+//
+// incremental.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"crypto/aes"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// inputSchedule orders the gates by the evaluator input batch after
+// which they can be evaluated. The evaluator inputs are the count
+// wires starting from offset and they are transferred in batches of
+// batch wires. The function returns the gate indices and the start
+// offsets of the gate groups in the order. The group 0 holds the
+// gates that do not depend on the evaluator inputs and the group k
+// holds the gates whose inputs are ready after the batch k-1. The
+// gates of each group are in their topological order. The function
+// returns also the tweak IDs of the gates.
+func (c *Circuit) inputSchedule(offset, count, batch int) (
+	order, groups []int32, ids []uint32) {
+
+	numGroups := (count+batch-1)/batch + 1
+	ready := make([]int32, c.NumWires)
+	for i := 0; i < count; i++ {
+		ready[offset+i] = int32(i/batch + 1)
+	}
+
+	// Count the gates of each group and sort the gates by their
+	// groups with a stable counting sort.
+	gateGroups := make([]int32, len(c.Gates))
+	groups = make([]int32, numGroups+1)
+	ids = make([]uint32, len(c.Gates))
+	var id uint32
+
+	for i := 0; i < len(c.Gates); i++ {
+		gate := &c.Gates[i]
+		ids[i] = id
+		id += gate.Op.tweaks()
+
+		group := ready[gate.Input0]
+		if gate.Op != INV && ready[gate.Input1] > group {
+			group = ready[gate.Input1]
+		}
+		ready[gate.Output] = group
+		gateGroups[i] = group
+		groups[group+1]++
+	}
+	for i := 1; i < len(groups); i++ {
+		groups[i] += groups[i-1]
+	}
+	order = make([]int32, len(c.Gates))
+	next := make([]int32, numGroups)
+	copy(next, groups)
+	for i, group := range gateGroups {
+		order[next[group]] = int32(i)
+		next[group]++
+	}
+	return order, groups, ids
+}
+
+// evalIncremental transfers the evaluator's input labels with OT in
+// batches of batch wires and evaluates the circuit. The gates are
+// evaluated in a separate goroutine as soon as their input batches
+// have been transferred.
+func (c *Circuit) evalIncremental(conn *p2p.Conn, oti ot.OT, key []byte,
+	wires []ot.Label, garbled [][]ot.Label, offset int, flags,
+	public []bool, batch int) error {
+
+	alg, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	numBatches := (len(flags) + batch - 1) / batch
+	ready := make(chan struct{}, numBatches)
+	done := make(chan error, 1)
+
+	// The gates are scheduled and evaluated while the inputs are
+	// transferred.
+	go func() {
+		order, groups, ids := c.inputSchedule(offset, len(flags), batch)
+
+		var data ot.LabelData
+		for group := 0; group+1 < len(groups); group++ {
+			if group > 0 {
+				if _, ok := <-ready; !ok {
+					done <- nil
+					return
+				}
+			}
+			for _, i := range order[groups[group]:groups[group+1]] {
+				gate := &c.Gates[i]
+				output, err := evalGate(alg, gate, ids[i], wires, garbled[i],
+					&data)
+				if err != nil {
+					done <- err
+					return
+				}
+				wires[gate.Output] = output
+			}
+		}
+		done <- nil
+	}()
+
+	err = receiveInputBatches(conn, oti, offset, flags, public,
+		wires[offset:offset+len(flags)], batch, func() {
+			ready <- struct{}{}
+		})
+	if err != nil {
+		close(ready)
+		<-done
+		return err
+	}
+	return <-done
+}
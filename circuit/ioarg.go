@@ -9,6 +9,7 @@ package circuit
 import (
 	"fmt"
 	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/markkurossi/mpc/types"
@@ -41,28 +42,159 @@ func (io IO) String() string {
 	return str
 }
 
+// IOLayout describes the position of an I/O argument in the combined
+// input or output value of the arguments.
+type IOLayout struct {
+	Name   string
+	Offset int
+	Bits   int
+}
+
+// Layout returns the layout of the I/O arguments. The arguments are
+// laid out in order, starting from bit 0 of the combined value. For
+// multi-party circuits, the layout of the circuit inputs gives the
+// input bits of each party.
+func (io IO) Layout() []IOLayout {
+	result := make([]IOLayout, len(io))
+	var offset int
+	for idx, arg := range io {
+		result[idx] = IOLayout{
+			Name:   arg.Name,
+			Offset: offset,
+			Bits:   int(arg.Type.Bits),
+		}
+		offset += int(arg.Type.Bits)
+	}
+	return result
+}
+
+// Parties returns the party of each argument. If none of the
+// arguments have a party assignment, the argument i is provided by
+// the party i. This positional fallback is deliberate: it keeps the
+// circuits without party annotations working as before. Otherwise all
+// arguments must have a party assignment.
+func (io IO) Parties() ([]int, error) {
+	result := make([]int, len(io))
+	var assigned int
+	for idx, arg := range io {
+		if arg.HasParty {
+			if arg.Party < 0 {
+				return nil, fmt.Errorf("invalid party %d for argument %s",
+					arg.Party, arg.Name)
+			}
+			result[idx] = arg.Party
+			assigned++
+		} else {
+			result[idx] = idx
+		}
+	}
+	if assigned > 0 && assigned != len(io) {
+		for _, arg := range io {
+			if !arg.HasParty {
+				return nil, fmt.Errorf("argument %s has no party", arg.Name)
+			}
+		}
+	}
+	return result, nil
+}
+
+// CheckTwoParty checks that the arguments can be used in the
+// two-party protocol. The protocol takes the garbler's input from the
+// argument 0 and the evaluator's input from the argument 1 so the
+// party annotations must match the argument positions.
+func (io IO) CheckTwoParty() error {
+	if len(io) != 2 {
+		return fmt.Errorf("invalid circuit for 2-party MPC: %d parties",
+			len(io))
+	}
+	parties, err := io.Parties()
+	if err != nil {
+		return fmt.Errorf("invalid circuit: %v", err)
+	}
+	for idx, party := range parties {
+		if party != idx {
+			return fmt.Errorf(
+				"invalid circuit for 2-party MPC: input %s has party %d, "+
+					"expected %d", io[idx].Name, party, idx)
+		}
+	}
+	return nil
+}
+
 // Split splits the value into separate I/O arguments.
 func (io IO) Split(in *big.Int) []*big.Int {
 	var result []*big.Int
-	var bit int
-	for _, arg := range io {
+	for _, l := range io.Layout() {
 		r := big.NewInt(0)
-		for i := 0; i < int(arg.Type.Bits); i++ {
-			if in.Bit(bit) == 1 {
+		for i := 0; i < l.Bits; i++ {
+			if in.Bit(l.Offset+i) == 1 {
 				r = big.NewInt(0).SetBit(r, i, 1)
 			}
-			bit++
 		}
 		result = append(result, r)
 	}
 	return result
 }
 
+// AbortOutput is the name of the reserved boolean output that holds
+// the abort status of the computation. MPCL programs set the status
+// with result.Abort and the output follows the return values of main.
+const AbortOutput = "$abort"
+
+// SplitAbort splits the abort status from the output values
+// results. The function returns the outputs and their values without
+// the abort status output, and the abort status. If the outputs do
+// not have the abort status output, the function returns its
+// arguments and false.
+func (io IO) SplitAbort(results []*big.Int) (IO, []*big.Int, bool) {
+	last := len(io) - 1
+	if last < 0 || io[last].Name != AbortOutput || len(results) != len(io) {
+		return io, results, false
+	}
+	return io[:last], results[:last], results[last].Sign() != 0
+}
+
 // IOArg describes circuit input argument.
 type IOArg struct {
 	Name     string
 	Type     types.Info
 	Compound IO
+	// Public specifies that the argument value is known to both
+	// parties and its wire labels are transferred without oblivious
+	// transfer.
+	Public bool
+	// Party specifies the party that provides the argument value in
+	// multi-party computation if HasParty is set. The parties are
+	// numbered from 0.
+	Party    int
+	HasParty bool
+}
+
+// PublicBits returns the public flags of the argument bits. The
+// function returns nil if none of the argument bits are public.
+func (io IOArg) PublicBits() []bool {
+	if io.Public {
+		result := make([]bool, io.Type.Bits)
+		for i := range result {
+			result[i] = true
+		}
+		return result
+	}
+	var result []bool
+	var public bool
+	for _, arg := range io.Compound {
+		bits := arg.PublicBits()
+		if bits == nil {
+			bits = make([]bool, arg.Type.Bits)
+		} else {
+			public = true
+		}
+		result = append(result, bits...)
+	}
+	if !public {
+		return nil
+	}
+	return result
 }
 
 func (io IOArg) String() string {
@@ -76,8 +208,21 @@ func (io IOArg) String() string {
 	return io.Type.String()
 }
 
-// Parse parses the I/O argument from the input string values.
+// Parse parses the I/O argument from the input string values. The
+// integer and array values can be given in hex with the 0x prefix or
+// in base64 with the base64: prefix. The signed integers can be
+// negative and they are encoded in two's complement; their values
+// must fit in the type's width. The string values are taken as
+// such unless they have the 0x or base64: prefix. The struct
+// arguments take either one input value for each field, or a single
+// composite value {name=value,...} or the equivalent JSON object
+// {"name":value,...} that specifies all struct fields by name.
 func (io IOArg) Parse(inputs []string) (*big.Int, error) {
+	if io.Type.Type == types.TStruct && len(inputs) == 1 &&
+		strings.HasPrefix(strings.TrimSpace(inputs[0]), "{") {
+		return parseStruct(io.Type, inputs[0])
+	}
+
 	result := new(big.Int)
 
 	if len(io.Compound) == 0 {
@@ -88,13 +233,42 @@ func (io IOArg) Parse(inputs []string) (*big.Int, error) {
 		}
 
 		switch io.Type.Type {
-		case types.TInt, types.TUint:
-			_, ok := result.SetString(inputs[0], 0)
+		case types.TInt:
+			v, err := parseSigned(io.Type, inputs[0])
+			if err != nil {
+				return nil, err
+			}
+			result = v
+
+		case types.TUint:
+			data, ok, err := parseBase64(inputs[0])
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result.SetBytes(data)
+				break
+			}
+			_, ok = result.SetString(inputs[0], 0)
 			if !ok {
 				return nil, fmt.Errorf("invalid input '%s' for %s",
 					inputs[0], io.Type)
 			}
 
+		case types.TString:
+			data, err := parseStringInput(inputs[0])
+			if err != nil {
+				return nil, err
+			}
+			if len(data) > int(io.Type.Bits)/8 {
+				return nil, fmt.Errorf("too many bytes for input: %s",
+					inputs[0])
+			}
+			for i, b := range data {
+				result.Or(result, new(big.Int).Lsh(big.NewInt(int64(b)),
+					uint(i*8)))
+			}
+
 		case types.TBool:
 			switch inputs[0] {
 			case "0", "f", "false":
@@ -112,16 +286,25 @@ func (io IOArg) Parse(inputs []string) (*big.Int, error) {
 			}
 
 			val := new(big.Int)
-			_, ok := val.SetString(inputs[0], 0)
-			if !ok {
-				return nil, fmt.Errorf("invalid input '%s' for %s",
-					inputs[0], io.Type)
-			}
 			var bitLen int
-			if strings.HasPrefix(inputs[0], "0x") {
-				bitLen = (len(inputs[0]) - 2) * 4
+			data, ok, err := parseBase64(inputs[0])
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				val.SetBytes(data)
+				bitLen = len(data) * 8
 			} else {
-				bitLen = val.BitLen()
+				_, ok = val.SetString(inputs[0], 0)
+				if !ok {
+					return nil, fmt.Errorf("invalid input '%s' for %s",
+						inputs[0], io.Type)
+				}
+				if strings.HasPrefix(inputs[0], "0x") {
+					bitLen = (len(inputs[0]) - 2) * 4
+				} else {
+					bitLen = val.BitLen()
+				}
 			}
 
 			valElCount := bitLen / elSize
@@ -176,13 +359,244 @@ func (io IOArg) Parse(inputs []string) (*big.Int, error) {
 	return result, nil
 }
 
+// parseSigned parses the signed integer input of the type t and
+// returns its two's-complement representation. The decimal values
+// must be in the range of t. The 0x, 0o, 0b, and base64 prefixed
+// values specify the bit pattern of the value so they can also set
+// the sign bit, e.g. 0xff is -1 for int8.
+func parseSigned(t types.Info, input string) (*big.Int, error) {
+	bits := int(t.Bits)
+	if bits == 0 {
+		return nil, fmt.Errorf("invalid type %v: zero size", t)
+	}
+	data, ok, err := parseBase64(input)
+	if err != nil {
+		return nil, err
+	}
+	var pattern bool
+	v := new(big.Int)
+	if ok {
+		v.SetBytes(data)
+		pattern = true
+	} else {
+		_, ok = v.SetString(input, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid input '%s' for %s", input, t)
+		}
+		digits := strings.TrimPrefix(input, "+")
+		pattern = len(digits) > 2 && digits[0] == '0' &&
+			strings.ContainsRune("xXoObB", rune(digits[1]))
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if pattern {
+		if v.Cmp(limit) >= 0 {
+			return nil, fmt.Errorf("input '%s' overflows %s", input, t)
+		}
+		return v, nil
+	}
+	limit.Rsh(limit, 1)
+	if v.Cmp(limit) >= 0 || v.Cmp(new(big.Int).Neg(limit)) < 0 {
+		return nil, fmt.Errorf("input '%s' overflows %s", input, t)
+	}
+	if v.Sign() < 0 {
+		v.Add(v, limit.Lsh(limit, 1))
+	}
+	return v, nil
+}
+
+// parseStruct parses the composite struct input and packs the field
+// values at their offsets. All struct fields must be specified
+// exactly once.
+func parseStruct(t types.Info, input string) (*big.Int, error) {
+	fields, err := parseStructInput(input)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, f := range fields {
+		if _, ok := values[f.name]; ok {
+			return nil, fmt.Errorf("duplicate value for field %s", f.name)
+		}
+		values[f.name] = f.value
+	}
+
+	result := new(big.Int)
+	for _, f := range t.Struct {
+		value, ok := values[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing value for field %s of %s",
+				f.Name, t)
+		}
+		delete(values, f.Name)
+
+		arg := IOArg{
+			Name: f.Name,
+			Type: f.Type,
+		}
+		v, err := arg.Parse([]string{value})
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", f.Name, err)
+		}
+		v.Lsh(v, uint(f.Type.Offset))
+		result.Or(result, v)
+	}
+	for _, f := range fields {
+		if _, ok := values[f.name]; ok {
+			return nil, fmt.Errorf("unknown field %s for %s", f.name, t)
+		}
+	}
+	return result, nil
+}
+
+type structInput struct {
+	name  string
+	value string
+}
+
+// parseStructInput parses the composite struct input {name=value,...}
+// or {"name":value,...} into its fields. The fields are returned in
+// the input order and the field values are not validated.
+func parseStructInput(input string) ([]structInput, error) {
+	input = strings.TrimSpace(input)
+	if len(input) < 2 || input[0] != '{' || input[len(input)-1] != '}' {
+		return nil, fmt.Errorf("invalid struct input: %s", input)
+	}
+	body := strings.TrimSpace(input[1 : len(input)-1])
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var result []structInput
+	for _, field := range SplitInputs(body) {
+		idx := strings.IndexAny(field, "=:")
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid struct field: %s", field)
+		}
+		name, err := unquoteInput(field[:idx])
+		if err != nil {
+			return nil, fmt.Errorf("invalid struct field: %s", field)
+		}
+		value, err := unquoteInput(field[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid struct field: %s", field)
+		}
+		if len(name) == 0 {
+			return nil, fmt.Errorf("invalid struct field: %s", field)
+		}
+		result = append(result, structInput{
+			name:  name,
+			value: value,
+		})
+	}
+	return result, nil
+}
+
+func unquoteInput(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, `"`) {
+		return strconv.Unquote(input)
+	}
+	return input, nil
+}
+
+// SplitInputs splits the comma-separated list of input values. The
+// commas inside composite {...} values and quoted strings do not
+// separate values.
+func SplitInputs(value string) []string {
+	var result []string
+	var depth int
+	var quoted, escaped bool
+	var start int
+
+	for i := 0; i < len(value); i++ {
+		if quoted {
+			switch {
+			case escaped:
+				escaped = false
+			case value[i] == '\\':
+				escaped = true
+			case value[i] == '"':
+				quoted = false
+			}
+			continue
+		}
+		switch value[i] {
+		case '"':
+			quoted = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				result = append(result, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, value[start:])
+}
+
+// Encode encodes the I/O argument from the Go value v. The compound
+// arguments take their values from a slice or array with one value
+// for each argument. The values are encoded with the Encode function.
+func (io IOArg) Encode(v interface{}) (*big.Int, error) {
+	if len(io.Compound) == 0 {
+		result, err := Encode(v, io.Type)
+		if err != nil && len(io.Name) > 0 {
+			return nil, fmt.Errorf("%s: %v", io.Name, err)
+		}
+		return result, err
+	}
+	values, ok := encodeElements(v)
+	if !ok {
+		return nil, fmt.Errorf("can't encode %T as %s", v, io)
+	}
+	if len(values) != len(io.Compound) {
+		return nil,
+			fmt.Errorf("invalid amount of arguments, got %d, expected %d",
+				len(values), len(io.Compound))
+	}
+
+	result := new(big.Int)
+	var offset int
+
+	for idx, arg := range io.Compound {
+		input, err := arg.Encode(values[idx])
+		if err != nil {
+			return nil, err
+		}
+		input.Lsh(input, uint(offset))
+		result.Or(result, input)
+
+		offset += int(arg.Type.Bits)
+	}
+	return result, nil
+}
+
 // InputSizes computes the bit sizes of the input arguments. This is
 // used for parametrized main() when the program is instantiated based
-// on input sizes.
+// on input sizes. The composite struct inputs contribute the sizes of
+// their field values in the input order.
 func InputSizes(inputs []string) ([]int, error) {
 	var result []int
 
 	for _, input := range inputs {
+		if strings.HasPrefix(strings.TrimSpace(input), "{") {
+			fields, err := parseStructInput(input)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range fields {
+				sizes, err := InputSizes([]string{f.value})
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, sizes...)
+			}
+			continue
+		}
 		switch input {
 		case "_":
 			result = append(result, 0)
@@ -191,7 +605,13 @@ func InputSizes(inputs []string) ([]int, error) {
 			result = append(result, 1)
 
 		default:
-			if strings.HasPrefix(input, "0x") {
+			data, ok, err := parseBase64(input)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result = append(result, len(data)*8)
+			} else if strings.HasPrefix(input, "0x") {
 				result = append(result, (len(input)-2)*4)
 			} else {
 				val := new(big.Int)
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2023 Markku Rossi
+// Copyright (c) 2023-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -7,7 +7,11 @@
 package circuit
 
 import (
+	"bytes"
+	"math/big"
 	"testing"
+
+	"github.com/markkurossi/mpc/types"
 )
 
 var inputSizeTests = []struct {
@@ -38,6 +42,14 @@ var inputSizeTests = []struct {
 			4, 8, 12, 16,
 		},
 	},
+	{
+		inputs: []string{
+			"base64:AQI=", "base64:",
+		},
+		sizes: []int{
+			16, 0,
+		},
+	},
 }
 
 func TestInputSizes(t *testing.T) {
@@ -60,3 +72,353 @@ func TestInputSizes(t *testing.T) {
 		}
 	}
 }
+
+func TestPublicBits(t *testing.T) {
+	arg := IOArg{
+		Type: types.Uint32,
+	}
+	if arg.PublicBits() != nil {
+		t.Errorf("private argument has public bits")
+	}
+	arg.Public = true
+	bits := arg.PublicBits()
+	if len(bits) != 32 || !bits[0] || !bits[31] {
+		t.Errorf("invalid public bits: %v", bits)
+	}
+
+	compound := IOArg{
+		Type: types.Uint64,
+		Compound: IO{
+			{
+				Type: types.Uint32,
+			},
+			{
+				Type:   types.Uint32,
+				Public: true,
+			},
+		},
+	}
+	bits = compound.PublicBits()
+	if len(bits) != 64 {
+		t.Fatalf("invalid public bits: got %d, expected 64", len(bits))
+	}
+	for i, public := range bits {
+		if public != (i >= 32) {
+			t.Errorf("bit %d: got public=%v", i, public)
+		}
+	}
+}
+
+func TestIOArgEncode(t *testing.T) {
+	arg := IOArg{
+		Compound: IO{
+			{
+				Name: "a",
+				Type: types.Info{
+					Type:       types.TUint,
+					IsConcrete: true,
+					Bits:       8,
+				},
+			},
+			{
+				Name: "b",
+				Type: types.Info{
+					Type:       types.TBool,
+					IsConcrete: true,
+					Bits:       1,
+				},
+			},
+		},
+	}
+	v, err := arg.Encode([]interface{}{uint8(0xab), true})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	parsed, err := arg.Parse([]string{"0xab", "true"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if v.Cmp(parsed) != 0 {
+		t.Errorf("Encode=%x, Parse=%x", v, parsed)
+	}
+
+	_, err = arg.Encode([]interface{}{1})
+	if err == nil {
+		t.Errorf("Encode succeeded with too few values")
+	}
+	_, err = arg.Encode([]interface{}{1, 2})
+	if err == nil {
+		t.Errorf("Encode succeeded with invalid bool value")
+	}
+}
+
+func TestIOArgParseStruct(t *testing.T) {
+	a := types.Info{
+		Type:       types.TInt,
+		IsConcrete: true,
+		Bits:       16,
+	}
+	b := types.Info{
+		Type:       types.TBool,
+		IsConcrete: true,
+		Bits:       1,
+		Offset:     16,
+	}
+	c := types.Info{
+		Type:        types.TArray,
+		IsConcrete:  true,
+		Bits:        24,
+		Offset:      17,
+		ElementType: &types.Byte,
+		ArraySize:   3,
+	}
+	arg := IOArg{
+		Name: "s",
+		Type: types.Info{
+			Type:       types.TStruct,
+			IsConcrete: true,
+			Bits:       41,
+			Struct: []types.StructField{
+				{Name: "A", Type: a},
+				{Name: "B", Type: b},
+				{Name: "C", Type: c},
+			},
+		},
+		Compound: IO{
+			{Name: "A", Type: a},
+			{Name: "B", Type: b},
+			{Name: "C", Type: c},
+		},
+	}
+	expected, err := arg.Parse([]string{"0x1234", "true", "0x010203"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	for _, input := range []string{
+		"{A=0x1234,B=true,C=0x010203}",
+		"{ C=0x010203, B=1, A=4660 }",
+		`{"A": 4660, "B": true, "C": "0x010203"}`,
+	} {
+		v, err := arg.Parse(SplitInputs(input))
+		if err != nil {
+			t.Errorf("Parse(%s) failed: %v", input, err)
+			continue
+		}
+		if v.Cmp(expected) != 0 {
+			t.Errorf("Parse(%s)=%x, expected %x", input, v, expected)
+		}
+	}
+
+	for _, input := range []string{
+		"{A=1,B=true}",
+		"{A=1,B=true,C=0x01,D=2}",
+		"{A=1,A=2,B=true,C=0x01}",
+		"{A=1,B=2,C=0x01}",
+		"{A=1,B=true,C=0x01",
+		"{A,B=true,C=0x01}",
+	} {
+		_, err := arg.Parse([]string{input})
+		if err == nil {
+			t.Errorf("Parse(%s) succeeded", input)
+		}
+	}
+
+	sizes, err := InputSizes(SplitInputs("{A=0x1234,B=true,C=0x010203},8"))
+	if err != nil {
+		t.Fatalf("InputSizes failed: %v", err)
+	}
+	if len(sizes) != 4 || sizes[0] != 16 || sizes[1] != 1 || sizes[2] != 24 ||
+		sizes[3] != 4 {
+		t.Errorf("unexpected input sizes: %v", sizes)
+	}
+}
+
+func TestParseSigned(t *testing.T) {
+	int8Type := types.Info{Type: types.TInt, IsConcrete: true, Bits: 8}
+	int4Type := types.Info{Type: types.TInt, IsConcrete: true, Bits: 4}
+
+	for _, test := range []struct {
+		t        types.Info
+		input    string
+		expected int64
+	}{
+		{int8Type, "-1", 0xff},
+		{int8Type, "-5", 0xfb},
+		{int8Type, "-128", 0x80},
+		{int8Type, "127", 0x7f},
+		{int8Type, "+3", 0x03},
+		{int8Type, "0", 0},
+		{int8Type, "0xff", 0xff},
+		{int8Type, "0x80", 0x80},
+		{int8Type, "-0x80", 0x80},
+		{int8Type, "0b10000001", 0x81},
+		{int8Type, "0o377", 0xff},
+		{int8Type, "base64:/w==", 0xff},
+		{int4Type, "-8", 0x8},
+		{int4Type, "0xf", 0xf},
+	} {
+		arg := IOArg{
+			Type: test.t,
+		}
+		v, err := arg.Parse([]string{test.input})
+		if err != nil {
+			t.Errorf("Parse(%s) for %s failed: %v", test.input, test.t, err)
+			continue
+		}
+		if v.Cmp(big.NewInt(test.expected)) != 0 {
+			t.Errorf("Parse(%s) for %s=%x, expected %x", test.input, test.t,
+				v, test.expected)
+		}
+		d, err := Decode(v, test.t)
+		if err != nil {
+			t.Errorf("Decode(%x) failed: %v", v, err)
+		}
+		if test.t.Bits == 8 && int64(d.(int8)) != int64(int8(test.expected)) {
+			t.Errorf("Decode(Parse(%s))=%v", test.input, d)
+		}
+	}
+
+	for _, test := range []struct {
+		t     types.Info
+		input string
+	}{
+		{int8Type, "128"},
+		{int8Type, "-129"},
+		{int8Type, "0x100"},
+		{int8Type, "-0x81"},
+		{int8Type, "0b111111111"},
+		{int8Type, "base64:AQA="},
+		{int8Type, "1.5"},
+		{int4Type, "8"},
+		{int4Type, "-9"},
+	} {
+		arg := IOArg{
+			Type: test.t,
+		}
+		if v, err := arg.Parse([]string{test.input}); err == nil {
+			t.Errorf("Parse(%s) for %s succeeded: %x", test.input, test.t, v)
+		}
+	}
+
+	// Compound arguments pack the two's-complement values.
+	arg := IOArg{
+		Compound: []IOArg{
+			{Type: int8Type},
+			{Type: int8Type},
+		},
+	}
+	v, err := arg.Parse([]string{"-2", "-1"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if v.Cmp(big.NewInt(0xfffe)) != 0 {
+		t.Errorf("Parse(-2,-1)=%x, expected fffe", v)
+	}
+}
+
+// layoutCircuit is a Bristol circuit with three inputs of 2, 3, and 1
+// bits.
+var layoutCircuit = `1 7
+3 2 3 1
+1 1
+
+2 1 0 5 6 AND
+`
+
+func TestIOLayout(t *testing.T) {
+	circ, err := ParseBristol(bytes.NewReader([]byte(layoutCircuit)))
+	if err != nil {
+		t.Fatalf("ParseBristol failed: %s", err)
+	}
+	expected := []IOLayout{
+		{Name: "NI1", Offset: 0, Bits: 2},
+		{Name: "NI2", Offset: 2, Bits: 3},
+		{Name: "NI3", Offset: 5, Bits: 1},
+	}
+	values := []int64{2, 5, 1}
+	layout := circ.Inputs.Layout()
+	if len(layout) != len(expected) {
+		t.Fatalf("got %d arguments, expected %d", len(layout), len(expected))
+	}
+	combined := new(big.Int)
+	for idx, l := range layout {
+		if l != expected[idx] {
+			t.Errorf("argument %d: got %v, expected %v", idx, l, expected[idx])
+		}
+		v := big.NewInt(values[idx])
+		combined.Or(combined, new(big.Int).Lsh(v, uint(l.Offset)))
+	}
+	for idx, v := range circ.Inputs.Split(combined) {
+		if v.Int64() != values[idx] {
+			t.Errorf("Split: argument %d: got %v, expected %v",
+				idx, v, values[idx])
+		}
+	}
+	out := circ.Outputs.Layout()
+	if len(out) != 1 || out[0].Offset != 0 || out[0].Bits != 1 {
+		t.Errorf("unexpected output layout: %v", out)
+	}
+}
+
+func TestIOParties(t *testing.T) {
+	io := IO{
+		{Name: "a"},
+		{Name: "b"},
+		{Name: "c"},
+	}
+	parties, err := io.Parties()
+	if err != nil {
+		t.Fatalf("Parties failed: %v", err)
+	}
+	for idx, party := range parties {
+		if party != idx {
+			t.Errorf("input %d: got party %d, expected %d", idx, party, idx)
+		}
+	}
+
+	io[0].Party, io[0].HasParty = 1, true
+	io[1].Party, io[1].HasParty = 0, true
+	if _, err := io.Parties(); err == nil {
+		t.Errorf("Parties succeeded with unassigned input")
+	}
+
+	io[2].Party, io[2].HasParty = 1, true
+	parties, err = io.Parties()
+	if err != nil {
+		t.Fatalf("Parties failed: %v", err)
+	}
+	expected := []int{1, 0, 1}
+	for idx, party := range parties {
+		if party != expected[idx] {
+			t.Errorf("input %d: got party %d, expected %d",
+				idx, party, expected[idx])
+		}
+	}
+}
+
+func TestCheckTwoParty(t *testing.T) {
+	io := IO{
+		{Name: "a"},
+		{Name: "b"},
+	}
+	if err := io.CheckTwoParty(); err != nil {
+		t.Errorf("CheckTwoParty failed: %v", err)
+	}
+	io[0].Party, io[0].HasParty = 0, true
+	io[1].Party, io[1].HasParty = 1, true
+	if err := io.CheckTwoParty(); err != nil {
+		t.Errorf("CheckTwoParty failed: %v", err)
+	}
+	io[0].Party, io[1].Party = 1, 0
+	if err := io.CheckTwoParty(); err == nil {
+		t.Errorf("CheckTwoParty succeeded with swapped parties")
+	}
+	io[0].Party, io[1].Party = 0, 0
+	if err := io.CheckTwoParty(); err == nil {
+		t.Errorf("CheckTwoParty succeeded with one party")
+	}
+	if err := io[:1].CheckTwoParty(); err == nil {
+		t.Errorf("CheckTwoParty succeeded with one input")
+	}
+}
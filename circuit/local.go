@@ -0,0 +1,58 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"math/big"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// EvalLocal evaluates the circuit with both parties running in the
+// current process. Unlike Compute, the function runs the real
+// garbling, evaluation, and oblivious transfer protocols. The parties
+// communicate over an in-memory pipe. The function returns the
+// evaluator's result.
+func EvalLocal(circ *Circuit, garblerInput, evaluatorInput *big.Int) (
+	[]*big.Int, error) {
+
+	gPipe, ePipe := ot.NewPipe()
+
+	gerr := make(chan error, 1)
+	go func() {
+		conn := p2p.NewConn(gPipe)
+		_, err := Garbler(conn, ot.NewCO(), circ, garblerInput, false)
+		if err != nil {
+			// Unblock the evaluator.
+			gPipe.Close()
+		} else {
+			err = conn.Close()
+		}
+		gerr <- err
+	}()
+
+	conn := p2p.NewConn(ePipe)
+	result, err := Evaluator(conn, ot.NewCO(), circ, evaluatorInput, false)
+	if err != nil {
+		// Unblock the garbler and report its error if it failed
+		// first.
+		ePipe.Close()
+		ePipe.Drain()
+		if gErr := <-gerr; gErr != nil {
+			return nil, gErr
+		}
+		return nil, err
+	}
+	if err := conn.Close(); err != nil {
+		return nil, err
+	}
+	if err := <-gerr; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
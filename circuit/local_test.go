@@ -0,0 +1,116 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// newAdder creates a ripple-carry adder computing the sum of two
+// bits-sized unsigned integers.
+func newAdder(bits int) *Circuit {
+	arg := func(name string) IOArg {
+		return IOArg{
+			Name: name,
+			Type: types.Info{
+				Type:       types.TUint,
+				IsConcrete: true,
+				Bits:       types.Size(bits),
+			},
+		}
+	}
+	var gates []Gate
+	next := Wire(2 * bits)
+	gate := func(op Operation, a, b Wire) Wire {
+		gates = append(gates, Gate{
+			Input0: a,
+			Input1: b,
+			Output: next,
+			Op:     op,
+		})
+		next++
+		return next - 1
+	}
+
+	// Propagate and carry wires of all bits.
+	propagate := make([]Wire, bits)
+	carry := make([]Wire, bits)
+	for i := 0; i < bits; i++ {
+		a := Wire(i)
+		b := Wire(bits + i)
+		propagate[i] = gate(XOR, a, b)
+		if i+1 < bits {
+			c := gate(AND, a, b)
+			if i > 0 {
+				c = gate(OR, c, gate(AND, carry[i-1], propagate[i]))
+			}
+			carry[i] = c
+		}
+	}
+
+	// The sum bits are the output wires.
+	for i := 0; i < bits; i++ {
+		if i == 0 {
+			gates = append(gates, Gate{
+				Input0: propagate[i],
+				Input1: propagate[i],
+				Output: next,
+				Op:     OR,
+			})
+			next++
+		} else {
+			gate(XOR, propagate[i], carry[i-1])
+		}
+	}
+
+	return &Circuit{
+		NumGates: len(gates),
+		NumWires: int(next),
+		Inputs:   IO{arg("a"), arg("b")},
+		Outputs:  IO{arg("r")},
+		Gates:    gates,
+	}
+}
+
+func TestEvalLocal(t *testing.T) {
+	const bits = 16
+
+	circ := newAdder(bits)
+	if err := circ.Validate(); err != nil {
+		t.Fatalf("invalid adder circuit: %v", err)
+	}
+	mask := int64(1<<bits - 1)
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 4; i++ {
+		a := big.NewInt(rnd.Int63() & mask)
+		b := big.NewInt(rnd.Int63() & mask)
+		expected := (a.Int64() + b.Int64()) & mask
+
+		computed, err := circ.Compute([]*big.Int{a, b})
+		if err != nil {
+			t.Fatalf("Compute failed: %v", err)
+		}
+		if computed[0].Int64() != expected {
+			t.Fatalf("Compute(%v, %v)=%v, expected %v",
+				a, b, computed[0], expected)
+		}
+
+		result, err := EvalLocal(circ, a, b)
+		if err != nil {
+			t.Fatalf("EvalLocal failed: %v", err)
+		}
+		if len(result) != 1 || result[0].Int64() != expected {
+			t.Errorf("EvalLocal(%v, %v)=%v, expected %v",
+				a, b, result, expected)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+//
+// mac.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+
+	"github.com/markkurossi/mpc/ot"
+)
+
+// ErrTableChecksum is returned by the evaluator when the garbled
+// tables do not match their transport checksum.
+var ErrTableChecksum = errors.New("garbled table checksum mismatch")
+
+// macKeySize specifies the size of the garbled table checksum key in
+// bytes.
+const macKeySize = 32
+
+// tableMAC computes the HMAC-SHA256 over the garbled tables in their
+// transfer order. The MAC key is sent in the clear by the garbler so
+// the MAC detects corrupted transport but it does not protect
+// against a malicious garbler.
+type tableMAC struct {
+	h   hash.Hash
+	buf [4]byte
+}
+
+func newTableMAC(key []byte) *tableMAC {
+	return &tableMAC{
+		h: hmac.New(sha256.New, key),
+	}
+}
+
+// count adds the table or label count to the MAC.
+func (mac *tableMAC) count(n int) {
+	binary.BigEndian.PutUint32(mac.buf[:], uint32(n))
+	mac.h.Write(mac.buf[:])
+}
+
+// label adds the label data to the MAC.
+func (mac *tableMAC) label(data *ot.LabelData) {
+	mac.h.Write(data[:])
+}
+
+// sum returns the MAC of the tables.
+func (mac *tableMAC) sum() []byte {
+	return mac.h.Sum(nil)
+}
+
+// verify verifies the MAC of the tables.
+func (mac *tableMAC) verify(tag []byte) error {
+	if !hmac.Equal(mac.sum(), tag) {
+		return ErrTableChecksum
+	}
+	return nil
+}
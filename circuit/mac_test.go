@@ -0,0 +1,144 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"errors"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// firstLabelOffset returns the offset of the first garbled table
+// label of the adder circuit in the garbler's messages: the circuit
+// header, the garbling key, the checksum key, the number of gates, the
+// label count of the first XOR gate, and the label count of the first
+// AND gate.
+func firstLabelOffset(t *testing.T, circ *Circuit) int {
+	return ioHeaderSize(t, circ) + 4 + 32 + 4 + macKeySize + 4 + 4 + 4
+}
+
+// ioHeaderSize returns the size of the circuit header message.
+func ioHeaderSize(t *testing.T, circ *Circuit) int {
+	header, err := circ.ioHeader()
+	if err != nil {
+		t.Fatalf("ioHeader failed: %v", err)
+	}
+	return 4 + len(header)
+}
+
+// corrupter flips a bit of the data read from the underlying
+// connection at the offset. The negative offsets disable the
+// corruption.
+type corrupter struct {
+	io.ReadWriter
+	offset int
+	pos    int
+}
+
+func (c *corrupter) Read(p []byte) (int, error) {
+	n, err := c.ReadWriter.Read(p)
+	if c.offset >= c.pos && c.offset < c.pos+n {
+		p[c.offset-c.pos] ^= 0x01
+	}
+	c.pos += n
+	return n, err
+}
+
+func evalChecksum(circ *Circuit, a, b *big.Int, checksum bool,
+	corrupt int) ([]*big.Int, error) {
+
+	gPipe, ePipe := ot.NewPipe()
+
+	gerr := make(chan error, 1)
+	go func() {
+		conn := p2p.NewConn(gPipe)
+		_, err := GarblerWithOptions(conn, ot.NewCO(), circ, a, &Options{
+			TableChecksum: checksum,
+		})
+		if err != nil {
+			gPipe.Close()
+		} else {
+			err = conn.Close()
+		}
+		gerr <- err
+	}()
+
+	conn := p2p.NewConn(&corrupter{
+		ReadWriter: ePipe,
+		offset:     corrupt,
+	})
+	result, err := EvaluatorWithOptions(conn, ot.NewCO(), circ, b, &Options{
+		TableChecksum: checksum,
+	})
+	if err != nil {
+		ePipe.Close()
+		ePipe.Drain()
+		<-gerr
+		return nil, err
+	}
+	conn.Close()
+	if err := <-gerr; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func TestTableChecksum(t *testing.T) {
+	circ := newAdder(8)
+	a := big.NewInt(100)
+	b := big.NewInt(27)
+
+	result, err := evalChecksum(circ, a, b, true, -1)
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	if len(result) != 1 || result[0].Int64() != 127 {
+		t.Errorf("evaluation returned %v, expected 127", result)
+	}
+
+	_, err = evalChecksum(circ, a, b, true, firstLabelOffset(t, circ)+3)
+	if !errors.Is(err, ErrTableChecksum) {
+		t.Errorf("corrupted tables: got error %v, expected %v",
+			err, ErrTableChecksum)
+	}
+}
+
+func benchmarkTableChecksum(b *testing.B, checksum bool) {
+	circ := newAdder(1024)
+	x := big.NewInt(1)
+	y := big.NewInt(2)
+
+	for i := 0; i < b.N; i++ {
+		_, err := evalChecksum(circ, x, y, checksum, -1)
+		if err != nil {
+			b.Fatalf("evaluation failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkTableNoChecksum(b *testing.B) {
+	benchmarkTableChecksum(b, false)
+}
+
+func BenchmarkTableChecksum(b *testing.B) {
+	benchmarkTableChecksum(b, true)
+}
+
+func BenchmarkTableChecksumLabels(b *testing.B) {
+	mac := newTableMAC(make([]byte, macKeySize))
+	var data ot.LabelData
+
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		mac.label(&data)
+	}
+	mac.sum()
+}
@@ -9,12 +9,28 @@ package circuit
 import (
 	"encoding/binary"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 )
 
 const (
 	// MAGIC is a magic number for the MPCL circuit format version 0.
 	MAGIC = 0x63726300 // crc0
+	// MAGIC1 is a magic number for the MPCL circuit format version
+	// 1. The version 1 files end with a CRC-32 checksum computed over
+	// all preceding bytes of the file.
+	MAGIC1 = 0x63726301 // crc1
+	// MAGIC2 is a magic number for the MPCL circuit format version
+	// 2. The version 2 files extend version 1 with the flags and the
+	// party of each I/O argument.
+	MAGIC2 = 0x63726302 // crc2
+)
+
+// I/O argument flags of the MPCL circuit format version 2.
+const (
+	ioArgPublic   = 0x01
+	ioArgHasParty = 0x02
 )
 
 var (
@@ -28,59 +44,114 @@ func (c *Circuit) MarshalFormat(out io.Writer, format string) error {
 		return c.Marshal(out)
 	case "bristol":
 		return c.MarshalBristol(out)
+	case "verilog":
+		return c.EmitVerilog(out)
 	default:
 		return fmt.Errorf("unsupported circuit format: %s", format)
 	}
 }
 
 // Marshal marshals circuit in the MPCL circuit format.
-func (c *Circuit) Marshal(out io.Writer) error {
+func (c *Circuit) Marshal(w io.Writer) error {
+	gw, err := NewGateWriter(w, c.NumGates, c.NumWires, c.Inputs, c.Outputs)
+	if err != nil {
+		return err
+	}
+	for _, g := range c.Gates {
+		if err := gw.Write(g); err != nil {
+			return err
+		}
+	}
+	return gw.Close()
+}
+
+// GateWriter writes a circuit in the MPCL circuit format one gate at
+// a time. The writer produces the same output as Circuit.Marshal
+// without holding the circuit gates in memory.
+type GateWriter struct {
+	w        io.Writer
+	out      io.Writer
+	crc      hash.Hash32
+	numGates int
+	count    int
+	buf      [13]byte
+}
+
+// NewGateWriter creates a new gate writer for a circuit with numGates
+// gates and numWires wires, and writes the circuit header to w.
+func NewGateWriter(w io.Writer, numGates, numWires int, inputs, outputs IO) (
+	*GateWriter, error) {
+
+	crc := crc32.NewIEEE()
+	gw := &GateWriter{
+		w:        w,
+		out:      io.MultiWriter(w, crc),
+		crc:      crc,
+		numGates: numGates,
+	}
+
 	var data = []interface{}{
-		uint32(MAGIC),
-		uint32(c.NumGates),
-		uint32(c.NumWires),
-		uint32(len(c.Inputs)),
-		uint32(len(c.Outputs)),
+		uint32(MAGIC2),
+		uint32(numGates),
+		uint32(numWires),
+		uint32(len(inputs)),
+		uint32(len(outputs)),
 	}
 	for _, v := range data {
-		if err := binary.Write(out, bo, v); err != nil {
-			return err
+		if err := binary.Write(gw.out, bo, v); err != nil {
+			return nil, err
 		}
 	}
-	for _, input := range c.Inputs {
-		if err := marshalIOArg(out, input); err != nil {
-			return err
+	for _, input := range inputs {
+		if err := marshalIOArg(gw.out, input); err != nil {
+			return nil, err
 		}
 	}
-	for _, output := range c.Outputs {
-		if err := marshalIOArg(out, output); err != nil {
-			return err
+	for _, output := range outputs {
+		if err := marshalIOArg(gw.out, output); err != nil {
+			return nil, err
 		}
 	}
+	return gw, nil
+}
 
-	for _, g := range c.Gates {
-		switch g.Op {
-		case XOR, XNOR, AND, OR:
-			data = []interface{}{
-				byte(g.Op),
-				uint32(g.Input0), uint32(g.Input1), uint32(g.Output),
-			}
-
-		case INV:
-			data = []interface{}{
-				byte(g.Op),
-				uint32(g.Input0), uint32(g.Output),
-			}
-		default:
-			return fmt.Errorf("unsupported gate type %s", g.Op)
-		}
-		for _, v := range data {
-			if err := binary.Write(out, bo, v); err != nil {
-				return err
-			}
-		}
+// Write writes the gate g.
+func (gw *GateWriter) Write(g Gate) error {
+	if gw.count >= gw.numGates {
+		return fmt.Errorf("too many gates: expected %d", gw.numGates)
 	}
-	return nil
+	gw.count++
+
+	var n int
+	switch g.Op {
+	case XOR, XNOR, AND, OR:
+		gw.buf[0] = byte(g.Op)
+		bo.PutUint32(gw.buf[1:], uint32(g.Input0))
+		bo.PutUint32(gw.buf[5:], uint32(g.Input1))
+		bo.PutUint32(gw.buf[9:], uint32(g.Output))
+		n = 13
+
+	case INV:
+		gw.buf[0] = byte(g.Op)
+		bo.PutUint32(gw.buf[1:], uint32(g.Input0))
+		bo.PutUint32(gw.buf[5:], uint32(g.Output))
+		n = 9
+
+	default:
+		return fmt.Errorf("unsupported gate type %s", g.Op)
+	}
+	_, err := gw.out.Write(gw.buf[:n])
+	return err
+}
+
+// Close writes the circuit checksum. The function returns an error
+// if the number of written gates does not match the header.
+func (gw *GateWriter) Close() error {
+	if gw.count != gw.numGates {
+		return fmt.Errorf("wrote %d gates, expected %d",
+			gw.count, gw.numGates)
+	}
+	return binary.Write(gw.w, bo, gw.crc.Sum32())
 }
 
 func marshalIOArg(out io.Writer, arg IOArg) error {
@@ -93,6 +164,19 @@ func marshalIOArg(out io.Writer, arg IOArg) error {
 	if err := binary.Write(out, bo, uint32(arg.Type.Bits)); err != nil {
 		return err
 	}
+	var flags uint32
+	if arg.Public {
+		flags |= ioArgPublic
+	}
+	if arg.HasParty {
+		flags |= ioArgHasParty
+	}
+	if err := binary.Write(out, bo, flags); err != nil {
+		return err
+	}
+	if err := binary.Write(out, bo, uint32(arg.Party)); err != nil {
+		return err
+	}
 	if err := binary.Write(out, bo, uint32(len(arg.Compound))); err != nil {
 		return err
 	}
@@ -0,0 +1,148 @@
+//
+// marshal_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+func TestMarshal(t *testing.T) {
+	circ, err := ParseBristol(bytes.NewReader([]byte(data)))
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := circ.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	parsed, err := Unmarshal(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	if parsed.NumGates != circ.NumGates || parsed.NumWires != circ.NumWires {
+		t.Errorf("circuit mismatch: got %v, expected %v", parsed, circ)
+	}
+	if !reflect.DeepEqual(parsed.Gates, circ.Gates) {
+		t.Errorf("gates mismatch: got %v, expected %v",
+			parsed.Gates, circ.Gates)
+	}
+	if parsed.Inputs.Size() != circ.Inputs.Size() ||
+		parsed.Outputs.Size() != circ.Outputs.Size() {
+		t.Errorf("I/O mismatch: got %v/%v, expected %v/%v",
+			parsed.Inputs, parsed.Outputs, circ.Inputs, circ.Outputs)
+	}
+}
+
+func TestMarshalPublic(t *testing.T) {
+	circ := newAdder(8)
+	circ.Inputs[1].Public = true
+	circ.Outputs[0].Compound = IO{
+		{
+			Name: "lo",
+			Type: types.Info{
+				Type:       types.TUint,
+				IsConcrete: true,
+				Bits:       4,
+			},
+			Public: true,
+		},
+		{
+			Name: "hi",
+			Type: types.Info{
+				Type:       types.TUint,
+				IsConcrete: true,
+				Bits:       4,
+			},
+		},
+	}
+	var buf bytes.Buffer
+	if err := circ.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	parsed, err := Unmarshal(&buf)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	for _, io := range [][2]IO{
+		{parsed.Inputs, circ.Inputs},
+		{parsed.Outputs, circ.Outputs},
+	} {
+		for idx := range io[1] {
+			got := io[0][idx].PublicBits()
+			expected := io[1][idx].PublicBits()
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s: got public bits %v, expected %v",
+					io[1][idx], got, expected)
+			}
+		}
+	}
+	if parsed.Inputs[0].Public || !parsed.Inputs[1].Public {
+		t.Errorf("public flags mismatch: got %v/%v, expected false/true",
+			parsed.Inputs[0].Public, parsed.Inputs[1].Public)
+	}
+}
+
+func TestMarshalParty(t *testing.T) {
+	circ := newAdder(8)
+	circ.Inputs[0].Party, circ.Inputs[0].HasParty = 2, true
+	circ.Inputs[1].Party, circ.Inputs[1].HasParty = 0, true
+
+	var buf bytes.Buffer
+	if err := circ.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	parsed, err := Unmarshal(&buf)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	for idx, arg := range circ.Inputs {
+		got := parsed.Inputs[idx]
+		if got.HasParty != arg.HasParty || got.Party != arg.Party {
+			t.Errorf("%s: got party %v/%d, expected %v/%d", arg,
+				got.HasParty, got.Party, arg.HasParty, arg.Party)
+		}
+	}
+	if parsed.Outputs[0].HasParty {
+		t.Errorf("output has a party after unmarshal")
+	}
+}
+
+func TestMarshalChecksum(t *testing.T) {
+	circ, err := ParseBristol(bytes.NewReader([]byte(data)))
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := circ.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	encoded := buf.Bytes()
+
+	for i := 4; i < len(encoded); i++ {
+		corrupted := make([]byte, len(encoded))
+		copy(corrupted, encoded)
+		corrupted[i] ^= 0x01
+
+		_, err = Unmarshal(bytes.NewReader(corrupted))
+		if !errors.Is(err, ErrChecksum) {
+			t.Errorf("byte %d: expected checksum error, got %v", i, err)
+		}
+	}
+
+	encoded[0] ^= 0xff
+	_, err = Unmarshal(bytes.NewReader(encoded))
+	if err == nil {
+		t.Errorf("invalid magic not detected")
+	}
+}
@@ -0,0 +1,66 @@
+//
+// options.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"crypto/rand"
+	"io"
+)
+
+// Options specify the optional parameters of the garbler and the
+// evaluator. The zero value selects the defaults.
+type Options struct {
+	// Verbose prints the protocol progress and timing.
+	Verbose bool
+
+	// Rand specifies the random source of the garbler's garbling key
+	// and wire labels. If nil, crypto/rand.Reader is used. The
+	// deterministic sources, see ot.NewSeededReader, make the
+	// protocol runs reproducible but they break the security of the
+	// computation so they must be used only for tests, demos, and
+	// debugging.
+	Rand io.Reader
+
+	// TableChecksum sends an HMAC-SHA256 checksum over the garbled
+	// tables and the evaluator rejects the tables with
+	// ErrTableChecksum if they do not match it. The checksum key is
+	// sent in the clear so the checksum detects corrupted transport
+	// but it does not authenticate the garbler. Both parties must
+	// enable the option.
+	TableChecksum bool
+
+	// OTBatchSize specifies the maximum number of input wires that
+	// the evaluator transfers with one OT. The value 0 transfers all
+	// input wires in one batch. The smaller batches bound the memory
+	// of the OT messages of wide inputs. The garbler follows the
+	// evaluator's batches so only the evaluator uses the option.
+	OTBatchSize int
+
+	// Incremental evaluates the gates that depend only on the
+	// already transferred inputs while the next OT batches are being
+	// transferred so the OT round trips overlap with the evaluation.
+	// Each batch adds an OT round trip so the batches should be large
+	// enough that evaluating their gates takes longer than the round
+	// trip. The option has effect only if OTBatchSize splits the
+	// evaluator's inputs into several batches. Only the evaluator
+	// uses the option.
+	Incremental bool
+
+	// Profile receives the protocol profile of the computation when
+	// the protocol completes. If nil, the profile is not collected.
+	Profile *Profile
+}
+
+// random returns the random source of the options.
+func (opts *Options) random() io.Reader {
+	if opts.Rand != nil {
+		return opts.Rand
+	}
+	return rand.Reader
+}
@@ -8,9 +8,11 @@ package circuit
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
 	"os"
@@ -29,7 +31,8 @@ type Seen []bool
 // Get gets the wire seen flag.
 func (s Seen) Get(index Wire) (bool, error) {
 	if index >= Wire(len(s)) {
-		return false, fmt.Errorf("invalid wire %d [0...%d[", index, len(s))
+		return false, fmt.Errorf("%w: wire %d [0...%d[",
+			ErrCorruptCircuit, index, len(s))
 	}
 	return s[index], nil
 }
@@ -37,7 +40,8 @@ func (s Seen) Get(index Wire) (bool, error) {
 // Set marks the wire seen.
 func (s Seen) Set(index Wire) error {
 	if index >= Wire(len(s)) {
-		return fmt.Errorf("invalid wire %d [0...%d[", index, len(s))
+		return fmt.Errorf("%w: wire %d [0...%d[",
+			ErrCorruptCircuit, index, len(s))
 	}
 	s[index] = true
 	return nil
@@ -67,27 +71,77 @@ func Parse(file string) (*Circuit, error) {
 	return nil, fmt.Errorf("unsupported circuit format")
 }
 
+// ErrChecksum is returned when the MPCL circuit file checksum does
+// not match the file contents.
+var ErrChecksum = errors.New("circuit checksum mismatch")
+
+// Unmarshal unmarshals a circuit from the MPCL circuit format. This is
+// the inverse of Circuit.Marshal.
+func Unmarshal(in io.Reader) (*Circuit, error) {
+	return ParseMPCLC(in)
+}
+
+type mpclcHeader struct {
+	Magic      uint32
+	NumGates   uint32
+	NumWires   uint32
+	NumInputs  uint32
+	NumOutputs uint32
+}
+
 // ParseMPCLC parses an MPCL circuit file.
 func ParseMPCLC(in io.Reader) (*Circuit, error) {
 	r := bufio.NewReader(in)
 
-	var header struct {
-		Magic      uint32
-		NumGates   uint32
-		NumWires   uint32
-		NumInputs  uint32
-		NumOutputs uint32
-	}
+	var header mpclcHeader
 	if err := binary.Read(r, bo, &header); err != nil {
 		return nil, err
 	}
+	switch header.Magic {
+	case MAGIC:
+		return parseMPCLC(header, r)
+
+	case MAGIC1, MAGIC2:
+		// Verify checksum before parsing so that corrupted files
+		// are reported as such and not as invalid circuits.
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 4 {
+			return nil, fmt.Errorf("%w: truncated circuit file",
+				ErrCorruptCircuit)
+		}
+		payload := data[:len(data)-4]
+		checksum := bo.Uint32(data[len(data)-4:])
+
+		crc := crc32.NewIEEE()
+		if err := binary.Write(crc, bo, &header); err != nil {
+			return nil, err
+		}
+		crc.Write(payload)
+		if crc.Sum32() != checksum {
+			return nil, ErrChecksum
+		}
+		return parseMPCLC(header, bufio.NewReader(bytes.NewReader(payload)))
+
+	default:
+		if header.Magic&0xffffff00 == MAGIC {
+			return nil, fmt.Errorf("unsupported circuit format version %d",
+				header.Magic&0xff)
+		}
+		return nil, fmt.Errorf("invalid circuit magic 0x%08x", header.Magic)
+	}
+}
+
+func parseMPCLC(header mpclcHeader, r *bufio.Reader) (*Circuit, error) {
 	var inputs, outputs IO
 	var inputWires, outputWires int
 
 	wiresSeen := make(Seen, header.NumWires)
 
 	for i := 0; i < int(header.NumInputs); i++ {
-		arg, err := parseIOArg(r)
+		arg, err := parseIOArg(r, header.Magic)
 		if err != nil {
 			return nil, err
 		}
@@ -95,7 +149,7 @@ func ParseMPCLC(in io.Reader) (*Circuit, error) {
 		inputWires += int(arg.Type.Bits)
 	}
 	for i := 0; i < int(header.NumOutputs); i++ {
-		out, err := parseIOArg(r)
+		out, err := parseIOArg(r, header.Magic)
 		if err != nil {
 			return nil, err
 		}
@@ -136,16 +190,16 @@ func ParseMPCLC(in io.Reader) (*Circuit, error) {
 				return nil, err
 			}
 			if !seen {
-				return nil, fmt.Errorf("input %d of gate %d not set",
-					bin.Input0, gate)
+				return nil, fmt.Errorf("%w: input %d of gate %d",
+					ErrUnassignedWire, bin.Input0, gate)
 			}
 			seen, err = wiresSeen.Get(Wire(bin.Input1))
 			if err != nil {
 				return nil, err
 			}
 			if !seen {
-				return nil, fmt.Errorf("input %d of gate %d not set",
-					bin.Input1, gate)
+				return nil, fmt.Errorf("%w: input %d of gate %d",
+					ErrUnassignedWire, bin.Input1, gate)
 			}
 			if err := wiresSeen.Set(Wire(bin.Output)); err != nil {
 				return nil, err
@@ -170,8 +224,8 @@ func ParseMPCLC(in io.Reader) (*Circuit, error) {
 				return nil, err
 			}
 			if !seen {
-				return nil, fmt.Errorf("input %d of gate %d not set",
-					unary.Input0, gate)
+				return nil, fmt.Errorf("%w: input %d of gate %d",
+					ErrUnassignedWire, unary.Input0, gate)
 			}
 			if err := wiresSeen.Set(Wire(unary.Output)); err != nil {
 				return nil, err
@@ -183,20 +237,21 @@ func ParseMPCLC(in io.Reader) (*Circuit, error) {
 			}
 
 		default:
-			return nil, fmt.Errorf("unsupported gate type %s", Operation(op))
+			return nil, fmt.Errorf("%w %s", ErrInvalidOperation,
+				Operation(op))
 		}
 		stats[Operation(op)]++
 	}
 
 	if uint32(gate) != header.NumGates {
-		return nil, fmt.Errorf("not enough gates: got %d, expected %d",
-			gate, header.NumGates)
+		return nil, fmt.Errorf("%w: got %d gates, expected %d",
+			ErrCorruptCircuit, gate, header.NumGates)
 	}
 
 	// Check that all wires are seen.
 	for i := 0; i < len(wiresSeen); i++ {
 		if !wiresSeen[i] {
-			return nil, fmt.Errorf("wire %d not assigned", i)
+			return nil, fmt.Errorf("%w: %d", ErrUnassignedWire, i)
 		}
 	}
 
@@ -210,7 +265,9 @@ func ParseMPCLC(in io.Reader) (*Circuit, error) {
 	}, nil
 }
 
-func parseIOArg(r *bufio.Reader) (arg IOArg, err error) {
+// parseIOArg parses an I/O argument of the circuit format identified
+// by its magic number.
+func parseIOArg(r *bufio.Reader, magic uint32) (arg IOArg, err error) {
 	name, err := parseString(r)
 	if err != nil {
 		return arg, err
@@ -230,12 +287,27 @@ func parseIOArg(r *bufio.Reader) (arg IOArg, err error) {
 	}
 	arg.Type.Bits = types.Size(ui32)
 
+	if magic == MAGIC2 {
+		var flags struct {
+			Flags uint32
+			Party uint32
+		}
+		if err := binary.Read(r, bo, &flags); err != nil {
+			return arg, err
+		}
+		arg.Public = flags.Flags&ioArgPublic != 0
+		if flags.Flags&ioArgHasParty != 0 {
+			arg.Party = int(flags.Party)
+			arg.HasParty = true
+		}
+	}
+
 	// Compound
 	if err := binary.Read(r, bo, &ui32); err != nil {
 		return arg, err
 	}
 	for i := 0; i < int(ui32); i++ {
-		c, err := parseIOArg(r)
+		c, err := parseIOArg(r, magic)
 		if err != nil {
 			return arg, err
 		}
@@ -254,7 +326,7 @@ func parseString(r *bufio.Reader) (string, error) {
 		return "", nil
 	}
 	buf := make([]byte, ui32)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
 		return "", err
 	}
@@ -410,7 +482,8 @@ func ParseBristol(in io.Reader) (*Circuit, error) {
 				return nil, err
 			}
 			if !seen {
-				return nil, fmt.Errorf("input %d of gate %d not set", v, gate)
+				return nil, fmt.Errorf("%w: input %d of gate %d",
+					ErrUnassignedWire, v, gate)
 			}
 			inputs = append(inputs, Wire(v))
 		}
@@ -446,7 +519,8 @@ func ParseBristol(in io.Reader) (*Circuit, error) {
 			op = INV
 			numInputs = 1
 		default:
-			return nil, fmt.Errorf("invalid operation '%s'", line[len(line)-1])
+			return nil, fmt.Errorf("%w '%s'", ErrInvalidOperation,
+				line[len(line)-1])
 		}
 
 		if len(inputs) != numInputs {
@@ -472,14 +546,14 @@ func ParseBristol(in io.Reader) (*Circuit, error) {
 		stats[op]++
 	}
 	if gate != numGates {
-		return nil, fmt.Errorf("not enough gates: got %d, expected %d",
-			gate, numGates)
+		return nil, fmt.Errorf("%w: got %d gates, expected %d",
+			ErrCorruptCircuit, gate, numGates)
 	}
 
 	// Check that all wires are seen.
 	for i := 0; i < len(wiresSeen); i++ {
 		if !wiresSeen[i] {
-			return nil, fmt.Errorf("wire %d not assigned", i)
+			return nil, fmt.Errorf("%w: %d", ErrUnassignedWire, i)
 		}
 	}
 
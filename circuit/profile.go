@@ -0,0 +1,120 @@
+//
+// profile.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"time"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// Profile holds the protocol metrics of one garbling or evaluation in
+// a form suitable for JSON encoding. The times are in nanoseconds.
+type Profile struct {
+	Role string `json:"role"`
+	// OTs is the number of oblivious transfers i.e. the number of
+	// the evaluator's private input bits.
+	OTs int `json:"ots"`
+	// TableBytes is the size of the garbled tables.
+	TableBytes uint64 `json:"table_bytes"`
+	XOR        uint64 `json:"xor"`
+	XNOR       uint64 `json:"xnor"`
+	AND        uint64 `json:"and"`
+	OR         uint64 `json:"or"`
+	INV        uint64 `json:"inv"`
+	Sent       uint64 `json:"sent"`
+	Received   uint64 `json:"received"`
+
+	OTTime     time.Duration `json:"ot_time"`
+	GarbleTime time.Duration `json:"garble_time"`
+	EvalTime   time.Duration `json:"eval_time"`
+	IOTime     time.Duration `json:"io_time"`
+	Total      time.Duration `json:"total_time"`
+}
+
+// Profile roles.
+const (
+	RoleGarbler   = "garbler"
+	RoleEvaluator = "evaluator"
+)
+
+// profileTimes maps the timing sample labels to the profile times.
+// The other samples are I/O.
+var profileTimes = map[string]func(p *Profile) *time.Duration{
+	"OT Init":     func(p *Profile) *time.Duration { return &p.OTTime },
+	"OT":          func(p *Profile) *time.Duration { return &p.OTTime },
+	"Inputs":      func(p *Profile) *time.Duration { return &p.OTTime },
+	"Peer Inputs": func(p *Profile) *time.Duration { return &p.OTTime },
+	"Compile":     func(p *Profile) *time.Duration { return &p.GarbleTime },
+	"Garble":      func(p *Profile) *time.Duration { return &p.GarbleTime },
+	"Stream":      func(p *Profile) *time.Duration { return &p.GarbleTime },
+	"Eval":        func(p *Profile) *time.Duration { return &p.EvalTime },
+	"Inputs+Eval": func(p *Profile) *time.Duration { return &p.EvalTime },
+}
+
+// NewProfile creates a profile for the role from the timing samples,
+// the gate statistics, and the connection I/O statistics. The
+// samples are split into the OT, garbling, evaluation, and I/O times
+// by their labels. The garbler's evaluation time is the time it waits
+// for the evaluator to evaluate the circuit and the incremental
+// evaluator's evaluation time includes its OTs.
+func NewProfile(role string, timing *Timing, stats Stats, ots int,
+	io p2p.IOStats) *Profile {
+
+	p := &Profile{
+		Role:     role,
+		OTs:      ots,
+		XOR:      stats[XOR],
+		XNOR:     stats[XNOR],
+		AND:      stats[AND],
+		OR:       stats[OR],
+		INV:      stats[INV],
+		Sent:     io.Sent.Load(),
+		Received: io.Recvd.Load(),
+	}
+	for op := XOR; op < Count; op++ {
+		p.TableBytes += stats[op] * uint64(op.garbledRows()*ot.LabelSize)
+	}
+	for _, sample := range timing.Samples {
+		d := sample.End.Sub(sample.Start)
+		if f, ok := profileTimes[sample.Label]; ok {
+			*f(p) += d
+		} else {
+			p.IOTime += d
+		}
+		p.Total += d
+	}
+	return p
+}
+
+// gateStats counts the circuit gates by their operations.
+func (c *Circuit) gateStats() Stats {
+	var stats Stats
+	for i := range c.Gates {
+		stats[c.Gates[i].Op]++
+	}
+	return stats
+}
+
+// otCount returns the number of the oblivious transfers of the input
+// argument.
+func otCount(arg IOArg) int {
+	public := arg.PublicBits()
+	if public == nil {
+		return int(arg.Type.Bits)
+	}
+	var count int
+	for _, p := range public {
+		if !p {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,94 @@
+//
+// profile_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+)
+
+func TestProfile(t *testing.T) {
+	const bits = 16
+
+	public := newAdder(bits)
+	public.Inputs[1].Public = true
+
+	for _, test := range []struct {
+		circ *Circuit
+		ots  int
+	}{
+		{newAdder(bits), bits},
+		{public, 0},
+	} {
+		circ := test.circ
+		g := new(Profile)
+		e := new(Profile)
+		result, gerr, eerr := evalPairOptions(circ, circ, big.NewInt(1234),
+			big.NewInt(4321), &Options{Profile: g}, &Options{Profile: e})
+		if gerr != nil || eerr != nil {
+			t.Fatalf("evaluation failed: garbler=%v, evaluator=%v", gerr, eerr)
+		}
+		if result[0].Int64() != 5555 {
+			t.Errorf("got %v, expected 5555", result[0])
+		}
+
+		stats := circ.gateStats()
+		var tableBytes uint64
+		for _, g := range circ.Gates {
+			tableBytes += uint64(g.Op.garbledRows() * ot.LabelSize)
+		}
+		if g.Role != RoleGarbler || e.Role != RoleEvaluator {
+			t.Fatalf("profile roles: %q, %q", g.Role, e.Role)
+		}
+		for _, p := range []*Profile{g, e} {
+			if p.OTs != test.ots {
+				t.Errorf("%s: OTs=%d, expected %d", p.Role, p.OTs, test.ots)
+			}
+			if p.AND != stats[AND] || p.OR != stats[OR] ||
+				p.XOR != stats[XOR] || p.AND == 0 || p.XOR == 0 {
+				t.Errorf("%s: gates AND=%d OR=%d XOR=%d, expected %d %d %d",
+					p.Role, p.AND, p.OR, p.XOR, stats[AND], stats[OR],
+					stats[XOR])
+			}
+			if p.TableBytes != tableBytes {
+				t.Errorf("%s: TableBytes=%d, expected %d", p.Role,
+					p.TableBytes, tableBytes)
+			}
+			sum := p.OTTime + p.GarbleTime + p.EvalTime + p.IOTime
+			if p.Total <= 0 || sum != p.Total {
+				t.Errorf("%s: times %v do not add up to %v", p.Role, sum,
+					p.Total)
+			}
+		}
+		if g.Sent != e.Received || g.Received != e.Sent ||
+			g.Sent < tableBytes {
+			t.Errorf("I/O: garbler %d/%d, evaluator %d/%d", g.Sent,
+				g.Received, e.Sent, e.Received)
+		}
+		if g.GarbleTime == 0 || e.GarbleTime != 0 {
+			t.Errorf("garble time: garbler %v, evaluator %v", g.GarbleTime,
+				e.GarbleTime)
+		}
+
+		data, err := json.Marshal(g)
+		if err != nil {
+			t.Fatalf("json.Marshal failed: %v", err)
+		}
+		var decoded Profile
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("json.Unmarshal failed: %v", err)
+		}
+		if decoded != *g {
+			t.Errorf("JSON round trip: %+v, expected %+v", decoded, *g)
+		}
+	}
+}
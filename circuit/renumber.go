@@ -0,0 +1,116 @@
+//
+// renumber.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+// Renumber returns a copy of the circuit whose gates and wires are
+// ordered for the memory locality of the evaluation. The gates are
+// scheduled greedily in the depth-first post-order of the output
+// wires so that each gate follows closely the gates that produce its
+// inputs. The intermediate wires are then numbered in the order their
+// gates produce them. The input and output wires keep their
+// positions so the renumbered circuit has the same inputs and outputs
+// as the original circuit. The gates that do not contribute to the
+// outputs are kept and scheduled after the output gates.
+func (c *Circuit) Renumber() *Circuit {
+	numInputs := c.Inputs.Size()
+	numOutputs := c.Outputs.Size()
+	outBase := c.NumWires - numOutputs
+
+	producer := make([]int32, c.NumWires)
+	for i := range producer {
+		producer[i] = -1
+	}
+	for i, g := range c.Gates {
+		producer[g.Output] = int32(i)
+	}
+
+	// Schedule the gates. The state of a gate is 0 for unvisited, 1
+	// for visited, and 2 for scheduled.
+	state := make([]byte, len(c.Gates))
+	order := make([]int32, 0, len(c.Gates))
+	var stack []int32
+
+	visit := func(root int32) {
+		if root < 0 || state[root] != 0 {
+			return
+		}
+		stack = append(stack[:0], root)
+		for len(stack) > 0 {
+			idx := stack[len(stack)-1]
+			switch state[idx] {
+			case 0:
+				state[idx] = 1
+				g := &c.Gates[idx]
+				// Push Input1 first so that Input0 is scheduled first.
+				if g.Op != INV {
+					if p := producer[g.Input1]; p >= 0 && state[p] == 0 {
+						stack = append(stack, p)
+					}
+				}
+				if p := producer[g.Input0]; p >= 0 && state[p] == 0 {
+					stack = append(stack, p)
+				}
+			case 1:
+				state[idx] = 2
+				order = append(order, idx)
+				stack = stack[:len(stack)-1]
+			default:
+				// Pushed by several consumers before it was visited.
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	for i := 0; i < numOutputs; i++ {
+		visit(producer[outBase+i])
+	}
+	for i := range c.Gates {
+		visit(int32(i))
+	}
+
+	// Number the wires.
+	var numIntermediate int
+	for _, g := range c.Gates {
+		if g.Output.Int() < outBase {
+			numIntermediate++
+		}
+	}
+	numWires := numInputs + numIntermediate + numOutputs
+
+	wireMap := make([]Wire, c.NumWires)
+	for i := 0; i < numInputs; i++ {
+		wireMap[i] = Wire(i)
+	}
+	for i := 0; i < numOutputs; i++ {
+		wireMap[outBase+i] = Wire(numWires - numOutputs + i)
+	}
+	next := Wire(numInputs)
+
+	result := &Circuit{
+		NumGates: c.NumGates,
+		NumWires: numWires,
+		Inputs:   c.Inputs,
+		Outputs:  c.Outputs,
+		Gates:    make([]Gate, 0, len(c.Gates)),
+		Stats:    c.Stats,
+	}
+	for _, idx := range order {
+		g := c.Gates[idx]
+		if g.Output.Int() < outBase {
+			wireMap[g.Output] = next
+			next++
+		}
+		g.Input0 = wireMap[g.Input0]
+		if g.Op != INV {
+			g.Input1 = wireMap[g.Input1]
+		}
+		g.Output = wireMap[g.Output]
+		result.Gates = append(result.Gates, g)
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+//
+// renumber_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+)
+
+// wireDistance returns the sum of the distances between the gate
+// input and output wire IDs.
+func wireDistance(c *Circuit) uint64 {
+	var sum uint64
+	for _, g := range c.Gates {
+		for _, in := range g.Inputs() {
+			if in > g.Output {
+				sum += uint64(in - g.Output)
+			} else {
+				sum += uint64(g.Output - in)
+			}
+		}
+	}
+	return sum
+}
+
+func TestRenumber(t *testing.T) {
+	sha, err := Parse("../pkg/crypto/sha256/sha256.circ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cone := newConeCircuit(8)
+	cone.Gates = append(cone.Gates, Gate{
+		Input0: 0,
+		Output: Wire(cone.NumWires),
+		Op:     INV,
+	})
+	cone.NumGates++
+	cone.NumWires++
+
+	// The renumbering brings the gate inputs closer to the outputs.
+	if d0, d1 := wireDistance(sha), wireDistance(sha.Renumber()); d1 >= d0 {
+		t.Errorf("wire distance grew from %d to %d", d0, d1)
+	}
+
+	rnd := rand.New(rand.NewSource(692))
+
+	for _, circ := range []*Circuit{newAdder(64), cone, sha} {
+		r := circ.Renumber()
+		if err := r.Validate(); err != nil {
+			t.Fatalf("%v: renumbered circuit: %v", circ, err)
+		}
+		if r.NumGates != circ.NumGates || len(r.Gates) != len(circ.Gates) {
+			t.Errorf("%v: renumbered circuit has %d gates", circ, r.NumGates)
+		}
+		for i := 0; i < 10; i++ {
+			var inputs []*big.Int
+			for _, arg := range circ.Inputs {
+				max := new(big.Int).Lsh(big.NewInt(1), uint(arg.Type.Bits))
+				inputs = append(inputs, new(big.Int).Rand(rnd, max))
+			}
+			expected, err := circ.Compute(inputs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := r.Compute(inputs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j := range expected {
+				if result[j].Cmp(expected[j]) != 0 {
+					t.Fatalf("%v: output %d: got %x, expected %x", circ, j,
+						result[j], expected[j])
+				}
+			}
+		}
+	}
+}
+
+func benchmarkEval(b *testing.B, circ *Circuit) {
+	key := make([]byte, 32)
+	g, err := circ.Garble(key)
+	if err != nil {
+		b.Fatal(err)
+	}
+	wires := make([]ot.Label, circ.NumWires)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < circ.Inputs.Size(); j++ {
+			wires[j] = g.Wires[j].L0
+		}
+		if err := circ.Eval(key, wires, g.Gates); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(circ.NumGates)*float64(b.N)/b.Elapsed().Seconds(),
+		"gates/s")
+}
+
+func BenchmarkEvalSHA256(b *testing.B) {
+	circ, err := Parse("../pkg/crypto/sha256/sha256.circ")
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkEval(b, circ)
+}
+
+func BenchmarkEvalSHA256Renumbered(b *testing.B) {
+	circ, err := Parse("../pkg/crypto/sha256/sha256.circ")
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkEval(b, circ.Renumber())
+}
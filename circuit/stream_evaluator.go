@@ -25,6 +25,13 @@ const (
 	OpReturn
 )
 
+// Stream option flags.
+const (
+	// StreamCompress specifies that the garbled gates are sent as
+	// compressed blocks.
+	StreamCompress = 1 << iota
+)
+
 // StreamEval is a streaming garbled circuit evaluator.
 type StreamEval struct {
 	key   []byte
@@ -89,7 +96,18 @@ func (stream *StreamEval) InitCircuit(numWires, numTmpWires int) {
 // StreamEvaluator runs the stream evaluator on the connection.
 func StreamEvaluator(conn *p2p.Conn, oti ot.OT, inputFlag []string,
 	verbose bool) (IO, []*big.Int, error) {
+	return StreamEvaluatorWithOptions(conn, oti, inputFlag, &Options{
+		Verbose: verbose,
+	})
+}
+
+// StreamEvaluatorWithOptions runs the stream evaluator on the
+// connection with the options. The stream evaluator supports only the
+// Verbose and Profile options.
+func StreamEvaluatorWithOptions(conn *p2p.Conn, oti ot.OT,
+	inputFlag []string, opts *Options) (IO, []*big.Int, error) {
 
+	verbose := opts.Verbose
 	timing := NewTiming()
 
 	// Receive program info.
@@ -104,6 +122,20 @@ func StreamEvaluator(conn *p2p.Conn, oti ot.OT, inputFlag []string,
 	if err != nil {
 		return nil, nil, err
 	}
+	options, err := conn.ReceiveUint32()
+	if err != nil {
+		return nil, nil, err
+	}
+	// If the gates are compressed, they are read through a
+	// connection that decompresses the blocks of conn.
+	gates := conn
+	if options&StreamCompress != 0 {
+		if verbose {
+			fmt.Printf(" - Receiving compressed gates\n")
+		}
+		gates = conn.CompressedConn()
+		defer gates.Close()
+	}
 	// Peer input.
 	in1, err := receiveArgument(conn)
 	if err != nil {
@@ -197,6 +229,7 @@ func StreamEvaluator(conn *p2p.Conn, oti ot.OT, inputFlag []string,
 		fmt.Printf(" - Evaluating program...\n")
 	}
 	var garbled [4]ot.Label
+	var stats Stats
 	var lastStep int
 
 	var rawResult *big.Int
@@ -249,7 +282,7 @@ loop:
 			streaming.InitCircuit(numWires, numTmpWires)
 			var id uint32
 			for i := 0; i < numGates; i++ {
-				gop, err := conn.ReceiveByte()
+				gop, err := gates.ReceiveByte()
 				if err != nil {
 					return nil, nil, err
 				}
@@ -265,9 +298,9 @@ loop:
 				}
 				var recvWire func() (int, error)
 				if gop&0b00010000 != 0 {
-					recvWire = conn.ReceiveUint16
+					recvWire = gates.ReceiveUint16
 				} else {
-					recvWire = conn.ReceiveUint32
+					recvWire = gates.ReceiveUint32
 				}
 
 				gop &^= 0b11110000
@@ -300,9 +333,10 @@ loop:
 						return nil, nil, err
 					}
 				default:
-					return nil, nil, fmt.Errorf("invalid operation %s",
-						Operation(gop))
+					return nil, nil, fmt.Errorf("%w %s",
+						ErrInvalidOperation, Operation(gop))
 				}
+				stats[gop]++
 				switch Operation(gop) {
 				case XOR, XNOR:
 					tableCount = 0
@@ -315,7 +349,7 @@ loop:
 				}
 
 				for c := 0; c < tableCount; c++ {
-					err = conn.ReceiveLabel(&label, &labelData)
+					err = gates.ReceiveLabel(&label, &labelData)
 					if err != nil {
 						return nil, nil, err
 					}
@@ -352,8 +386,8 @@ loop:
 				case AND:
 					if tableCount != 2 {
 						return nil, nil,
-							fmt.Errorf("corrupted ciruit: AND table size: %d",
-								tableCount)
+							fmt.Errorf("%w: AND table size: %d",
+								ErrCorruptCircuit, tableCount)
 					}
 					sa := a.S()
 					sb := b.S()
@@ -384,8 +418,8 @@ loop:
 						index--
 						if index >= tableCount {
 							return nil, nil,
-								fmt.Errorf("corrupted circuit: index %d >= %d",
-									index, tableCount)
+								fmt.Errorf("%w: index %d >= %d",
+									ErrCorruptCircuit, index, tableCount)
 						}
 						c = garbled[index]
 					}
@@ -399,8 +433,8 @@ loop:
 						index--
 						if index >= tableCount {
 							return nil, nil,
-								fmt.Errorf("corrupted circuit: index %d >= %d",
-									index, tableCount)
+								fmt.Errorf("%w: index %d >= %d",
+									ErrCorruptCircuit, index, tableCount)
 						}
 						c = garbled[index]
 					}
@@ -455,6 +489,10 @@ loop:
 	xfer = conn.Stats.Sum() - ioStats
 	timing.Sample("Result", []string{FileSize(xfer).String()})
 
+	if opts.Profile != nil {
+		*opts.Profile = *NewProfile(RoleEvaluator, timing, stats,
+			int(in2.Type.Bits), conn.Stats)
+	}
 	if verbose {
 		timing.Print(conn.Stats)
 	}
@@ -11,6 +11,7 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/markkurossi/mpc/ot"
@@ -21,6 +22,10 @@ const (
 	// StreamDebug controls the debugging output of the streaming
 	// garbling.
 	StreamDebug = false
+
+	// streamBlockSize specifies the size of the gate blocks when
+	// the garbled gates are compressed.
+	streamBlockSize = 64 * 1024
 )
 
 // Streaming is a streaming garbled circuit garbler.
@@ -35,13 +40,27 @@ type Streaming struct {
 	out      []Wire
 	firstTmp Wire
 	firstOut Wire
+
+	// Compress specifies if the garbled gates are batched into
+	// blocks that are sent with p2p.Conn.SendCompressed.
+	Compress bool
+	block    []byte
+	blockPos int
 }
 
 // NewStreaming creates a new streaming garbled circuit garbler.
 func NewStreaming(key []byte, inputs []Wire, conn *p2p.Conn) (
 	*Streaming, error) {
+	return NewStreamingWithRand(key, inputs, conn, rand.Reader)
+}
 
-	r, err := ot.NewLabel(rand.Reader)
+// NewStreamingWithRand creates a new streaming garbled circuit
+// garbler that reads the random offset R and the seed of the wire
+// label PRG from rnd.
+func NewStreamingWithRand(key []byte, inputs []Wire, conn *p2p.Conn,
+	rnd io.Reader) (*Streaming, error) {
+
+	r, err := ot.NewLabel(rnd)
 	if err != nil {
 		return nil, err
 	}
@@ -62,12 +81,12 @@ func NewStreaming(key []byte, inputs []Wire, conn *p2p.Conn) (
 	stream.ensureWires(maxWire(0, inputs))
 
 	// Assing all input wires.
+	prg, err := newPRG(rnd)
+	if err != nil {
+		return nil, err
+	}
 	for i := 0; i < len(inputs); i++ {
-		w, err := makeLabels(stream.r)
-		if err != nil {
-			return nil, err
-		}
-		stream.wires[inputs[i]] = w
+		stream.wires[inputs[i]] = makeLabels(prg, stream.r)
 	}
 
 	return stream, nil
@@ -161,7 +180,7 @@ func (stream *Streaming) Garble(c *Circuit, in, out []Wire) (
 
 	// Garble gates.
 
-	var data ot.LabelData
+	var batch halfBatch
 	var id uint32
 	var table [4]ot.Label
 
@@ -169,22 +188,58 @@ func (stream *Streaming) Garble(c *Circuit, in, out []Wire) (
 
 	for i := 0; i < len(c.Gates); i++ {
 		gate := &c.Gates[i]
-		err := stream.conn.NeedSpace(512)
+		var buf []byte
+		var pos *int
+		if stream.Compress {
+			if stream.blockPos+512 > len(stream.block) {
+				if err := stream.flushBlock(); err != nil {
+					return 0, 0, err
+				}
+			}
+			buf = stream.block
+			pos = &stream.blockPos
+		} else {
+			err := stream.conn.NeedSpace(512)
+			if err != nil {
+				return 0, 0, err
+			}
+			buf = stream.conn.WriteBuf
+			pos = &stream.conn.WritePos
+		}
+		err := stream.garbleGate(gate, &id, table[:], &batch, buf, pos)
 		if err != nil {
 			return 0, 0, err
 		}
-		err = stream.garbleGate(gate, &id, table[:], &data,
-			stream.conn.WriteBuf, &stream.conn.WritePos)
-		if err != nil {
+	}
+	if stream.Compress {
+		if err := stream.flushBlock(); err != nil {
 			return 0, 0, err
 		}
 	}
 	return mid.Sub(start), time.Now().Sub(mid), nil
 }
 
+// flushBlock sends the pending garbled gates as a compressed block.
+func (stream *Streaming) flushBlock() error {
+	if stream.block == nil {
+		stream.block = make([]byte, streamBlockSize)
+	}
+	if stream.blockPos == 0 {
+		return nil
+	}
+	err := stream.conn.SendCompressed(stream.block[:stream.blockPos])
+	if err != nil {
+		return err
+	}
+	stream.blockPos = 0
+	return nil
+}
+
 // GarbleGate garbles the gate and streams it to the stream.
 func (stream *Streaming) garbleGate(g *Gate, idp *uint32,
-	table []ot.Label, data *ot.LabelData, buf []byte, bufpos *int) error {
+	table []ot.Label, batch *halfBatch, buf []byte, bufpos *int) error {
+
+	data := &batch[0]
 
 	var a, b, c ot.Wire
 	var aIndex, bIndex, cIndex Wire
@@ -203,7 +258,7 @@ func (stream *Streaming) garbleGate(g *Gate, idp *uint32,
 		a, aIndex, aTmp = stream.Get(g.Input0)
 
 	default:
-		return fmt.Errorf("invalid gate type %s", g.Op)
+		return fmt.Errorf("%w %s", ErrInvalidOperation, g.Op)
 	}
 
 	// Output.
@@ -238,22 +293,25 @@ func (stream *Streaming) garbleGate(g *Gate, idp *uint32,
 		j1 := *idp + 1
 		*idp = *idp + 2
 
+		h := encryptHalf4(stream.alg, &[4]ot.Label{a.L0, a.L1, b.L0, b.L1},
+			&[4]uint32{j0, j0, j1, j1}, batch)
+
 		// First half gate.
-		tg := encryptHalf(stream.alg, a.L0, j0, data)
-		tg.Xor(encryptHalf(stream.alg, a.L1, j0, data))
+		tg := h[0]
+		tg.Xor(h[1])
 		if pb {
 			tg.Xor(stream.r)
 		}
-		wg0 := encryptHalf(stream.alg, a.L0, j0, data)
+		wg0 := h[0]
 		if pa {
 			wg0.Xor(tg)
 		}
 
 		// Second half gate.
-		te := encryptHalf(stream.alg, b.L0, j1, data)
-		te.Xor(encryptHalf(stream.alg, b.L1, j1, data))
+		te := h[2]
+		te.Xor(h[3])
 		te.Xor(a.L0)
-		we0 := encryptHalf(stream.alg, b.L0, j1, data)
+		we0 := h[2]
 		if pb {
 			we0.Xor(te)
 			we0.Xor(a.L0)
@@ -364,7 +422,7 @@ func (stream *Streaming) garbleGate(g *Gate, idp *uint32,
 		wireCount = 2
 
 	default:
-		return fmt.Errorf("invalid operand %s", g.Op)
+		return fmt.Errorf("%w %s", ErrInvalidOperation, g.Op)
 	}
 
 	if g.Output < stream.firstTmp {
@@ -58,7 +58,7 @@ func benchmarkGate(b *testing.B, g *Gate) {
 	stream.firstOut = 2
 
 	var id uint32
-	var data ot.LabelData
+	var batch halfBatch
 	var table [4]ot.Label
 
 	b.ResetTimer()
@@ -66,7 +66,7 @@ func benchmarkGate(b *testing.B, g *Gate) {
 		var buf [128]byte
 		var bufpos int
 
-		err = stream.garbleGate(g, &id, table[:], &data, buf[:], &bufpos)
+		err = stream.garbleGate(g, &id, table[:], &batch, buf[:], &bufpos)
 		if err != nil {
 			b.Fatalf("garble failed: %s", err)
 		}
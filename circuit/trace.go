@@ -0,0 +1,96 @@
+//
+// trace.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// TraceStep describes the evaluation of a gate in a circuit trace.
+type TraceStep struct {
+	// Gate is the index of the gate in the circuit.
+	Gate   int
+	Op     Operation
+	Input0 Wire
+	Input1 Wire
+	Output Wire
+	// The wire values of the gate evaluation. The In1 is unset for
+	// INV gates.
+	In0 bool
+	In1 bool
+	Out bool
+}
+
+func (s TraceStep) String() string {
+	b := func(v bool) int {
+		if v {
+			return 1
+		}
+		return 0
+	}
+	if s.Op == INV {
+		return fmt.Sprintf("g%d: %s w%d=%d -> w%d=%d",
+			s.Gate, s.Op, s.Input0, b(s.In0), s.Output, b(s.Out))
+	}
+	return fmt.Sprintf("g%d: w%d=%d %s w%d=%d -> w%d=%d",
+		s.Gate, s.Input0, b(s.In0), s.Op, s.Input1, b(s.In1),
+		s.Output, b(s.Out))
+}
+
+// Trace evaluates the circuit in plaintext with the given input
+// values and returns the gates that computed the bit bit of the
+// output argument outputIndex. The steps form the transitive fan-in
+// cone of the output wire. They are ordered from the output gate
+// towards the circuit inputs so that each gate appears after all
+// gates that use its output.
+func (c *Circuit) Trace(inputs []*big.Int, outputIndex, bit int) (
+	[]TraceStep, error) {
+
+	if outputIndex < 0 || outputIndex >= len(c.Outputs) {
+		return nil, fmt.Errorf("invalid output index %d", outputIndex)
+	}
+	layout := c.Outputs.Layout()[outputIndex]
+	if bit < 0 || bit >= layout.Bits {
+		return nil, fmt.Errorf("invalid bit %d for output %s",
+			bit, layout.Name)
+	}
+	wires, err := c.simulate(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	needed := make([]bool, c.NumWires)
+	needed[c.NumWires-c.Outputs.Size()+layout.Offset+bit] = true
+
+	var result []TraceStep
+	for i := len(c.Gates) - 1; i >= 0; i-- {
+		g := c.Gates[i]
+		if !needed[g.Output] {
+			continue
+		}
+		step := TraceStep{
+			Gate:   i,
+			Op:     g.Op,
+			Input0: g.Input0,
+			In0:    wires[g.Input0] != 0,
+			Output: g.Output,
+			Out:    wires[g.Output] != 0,
+		}
+		if g.Op != INV {
+			step.Input1 = g.Input1
+			step.In1 = wires[g.Input1] != 0
+		}
+		for _, in := range g.Inputs() {
+			needed[in] = true
+		}
+		result = append(result, step)
+	}
+	return result, nil
+}
@@ -0,0 +1,87 @@
+//
+// trace_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	circ := newAdder(2)
+
+	// The bit 1 of the sum depends on the carry of the bit 0.
+	steps, err := circ.Trace([]*big.Int{big.NewInt(1), big.NewInt(1)}, 0, 1)
+	if err != nil {
+		t.Fatalf("Trace failed: %v", err)
+	}
+	expected := []TraceStep{
+		{
+			Gate:   4,
+			Op:     XOR,
+			Input0: 6,
+			Input1: 5,
+			Output: 8,
+			In1:    true,
+			Out:    true,
+		},
+		{
+			Gate:   2,
+			Op:     XOR,
+			Input0: 1,
+			Input1: 3,
+			Output: 6,
+		},
+		{
+			Gate:   1,
+			Op:     AND,
+			Input0: 0,
+			Input1: 2,
+			Output: 5,
+			In0:    true,
+			In1:    true,
+			Out:    true,
+		},
+	}
+	if len(steps) != len(expected) {
+		t.Fatalf("got %d steps, expected %d: %v",
+			len(steps), len(expected), steps)
+	}
+	for idx, step := range steps {
+		if step != expected[idx] {
+			t.Errorf("step %d: got %v, expected %v", idx, step, expected[idx])
+		}
+	}
+	if s := steps[2].String(); s != "g1: w0=1 AND w2=1 -> w5=1" {
+		t.Errorf("unexpected step string: %s", s)
+	}
+
+	// The bit 0 does not depend on the carry.
+	steps, err = circ.Trace([]*big.Int{big.NewInt(1), big.NewInt(2)}, 0, 0)
+	if err != nil {
+		t.Fatalf("Trace failed: %v", err)
+	}
+	if len(steps) != 2 || steps[0].Gate != 3 || steps[1].Gate != 0 {
+		t.Errorf("unexpected trace: %v", steps)
+	}
+	if !steps[0].Out {
+		t.Errorf("sum bit 0 of 1+2 is not set")
+	}
+
+	inputs := []*big.Int{big.NewInt(0), big.NewInt(0)}
+	if _, err := circ.Trace(inputs, 1, 0); err == nil {
+		t.Errorf("Trace succeeded with invalid output index")
+	}
+	if _, err := circ.Trace(inputs, 0, 2); err == nil {
+		t.Errorf("Trace succeeded with invalid bit")
+	}
+	if _, err := circ.Trace(inputs[:1], 0, 0); err == nil {
+		t.Errorf("Trace succeeded with invalid inputs")
+	}
+}
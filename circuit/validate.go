@@ -0,0 +1,119 @@
+//
+// validate.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validate checks the structural correctness of the circuit. It
+// verifies that all gate inputs are circuit inputs or outputs of
+// earlier gates, that all non-input wires are driven by exactly one
+// gate, and that all circuit outputs are produced. The returned error
+// lists the offending wire IDs.
+func (c *Circuit) Validate() error {
+	numInputs := c.Inputs.Size()
+	numOutputs := c.Outputs.Size()
+
+	if numInputs+numOutputs > c.NumWires {
+		return fmt.Errorf("circuit has %d wires but %d inputs and %d outputs",
+			c.NumWires, numInputs, numOutputs)
+	}
+	if len(c.Gates) != c.NumGates {
+		return fmt.Errorf("circuit has %d gates but NumGates is %d",
+			len(c.Gates), c.NumGates)
+	}
+
+	drivers := make([]int, c.NumWires)
+	for i := 0; i < numInputs; i++ {
+		drivers[i] = 1
+	}
+
+	var invalid, undriven, multiDriven, inputDriven, unproduced wireSet
+
+	for idx, g := range c.Gates {
+		switch g.Op {
+		case XOR, XNOR, AND, OR, INV:
+		default:
+			return fmt.Errorf("gate %d: invalid operation %s", idx, g.Op)
+		}
+		for _, in := range g.Inputs() {
+			if in.Int() >= c.NumWires {
+				invalid.add(in)
+			} else if drivers[in] == 0 {
+				undriven.add(in)
+			}
+		}
+		out := g.Output
+		if out.Int() >= c.NumWires {
+			invalid.add(out)
+			continue
+		}
+		if out.Int() < numInputs {
+			inputDriven.add(out)
+		} else if drivers[out] > 0 {
+			multiDriven.add(out)
+		}
+		drivers[out]++
+	}
+	for i := c.NumWires - numOutputs; i < c.NumWires; i++ {
+		if drivers[i] == 0 {
+			unproduced.add(Wire(i))
+		}
+	}
+
+	var errs []string
+	errs = invalid.report(errs, "invalid wire IDs")
+	errs = undriven.report(errs, "wires used before driven")
+	errs = inputDriven.report(errs, "input wires driven by gates")
+	errs = multiDriven.report(errs, "wires driven by multiple gates")
+	errs = unproduced.report(errs, "output wires not produced")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid circuit: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// wireSet collects unique wire IDs in the order they were added.
+type wireSet struct {
+	seen  map[Wire]bool
+	wires []Wire
+}
+
+func (set *wireSet) add(w Wire) {
+	if set.seen == nil {
+		set.seen = make(map[Wire]bool)
+	}
+	if !set.seen[w] {
+		set.seen[w] = true
+		set.wires = append(set.wires, w)
+	}
+}
+
+// report appends the description of the wire set to errs if the set
+// is not empty.
+func (set *wireSet) report(errs []string, what string) []string {
+	if len(set.wires) == 0 {
+		return errs
+	}
+	const maxWires = 10
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s:", what)
+	for i, w := range set.wires {
+		if i >= maxWires {
+			fmt.Fprintf(&sb, " ... (%d more)", len(set.wires)-maxWires)
+			break
+		}
+		fmt.Fprintf(&sb, " %v", w)
+	}
+	return append(errs, sb.String())
+}
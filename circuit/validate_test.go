@@ -0,0 +1,149 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// newTestCircuit creates a circuit with two 1-bit inputs and one
+// 1-bit output.
+func newTestCircuit(numWires int, gates []Gate) *Circuit {
+	arg := func(name string) IOArg {
+		return IOArg{
+			Name: name,
+			Type: types.Info{
+				Type: types.TUint,
+				Bits: 1,
+			},
+		}
+	}
+	return &Circuit{
+		NumGates: len(gates),
+		NumWires: numWires,
+		Inputs:   IO{arg("a"), arg("b")},
+		Outputs:  IO{arg("r")},
+		Gates:    gates,
+	}
+}
+
+var validateTests = []struct {
+	name  string
+	wires int
+	gates []Gate
+	err   []string
+}{
+	{
+		name:  "valid",
+		wires: 4,
+		gates: []Gate{
+			{Input0: 0, Input1: 1, Output: 2, Op: XOR},
+			{Input0: 2, Output: 3, Op: INV},
+		},
+	},
+	{
+		name:  "undriven",
+		wires: 4,
+		gates: []Gate{
+			{Input0: 0, Input1: 2, Output: 3, Op: AND},
+		},
+		err: []string{"wires used before driven: w2"},
+	},
+	{
+		name:  "topological order",
+		wires: 4,
+		gates: []Gate{
+			{Input0: 2, Output: 3, Op: INV},
+			{Input0: 0, Input1: 1, Output: 2, Op: XOR},
+		},
+		err: []string{"wires used before driven: w2"},
+	},
+	{
+		name:  "multiply driven",
+		wires: 4,
+		gates: []Gate{
+			{Input0: 0, Input1: 1, Output: 2, Op: XOR},
+			{Input0: 0, Input1: 1, Output: 2, Op: AND},
+			{Input0: 2, Output: 3, Op: INV},
+		},
+		err: []string{"wires driven by multiple gates: w2"},
+	},
+	{
+		name:  "input driven",
+		wires: 3,
+		gates: []Gate{
+			{Input0: 0, Output: 1, Op: INV},
+			{Input0: 0, Input1: 1, Output: 2, Op: OR},
+		},
+		err: []string{"input wires driven by gates: w1"},
+	},
+	{
+		name:  "output not produced",
+		wires: 4,
+		gates: []Gate{
+			{Input0: 0, Input1: 1, Output: 2, Op: XOR},
+		},
+		err: []string{"output wires not produced: w3"},
+	},
+	{
+		name:  "invalid wire",
+		wires: 3,
+		gates: []Gate{
+			{Input0: 0, Input1: 7, Output: 2, Op: XOR},
+		},
+		err: []string{"invalid wire IDs: w7"},
+	},
+	{
+		name:  "multiple errors",
+		wires: 5,
+		gates: []Gate{
+			{Input0: 0, Input1: 3, Output: 2, Op: XOR},
+			{Input0: 0, Input1: 1, Output: 2, Op: AND},
+		},
+		err: []string{
+			"wires used before driven: w3",
+			"wires driven by multiple gates: w2",
+			"output wires not produced: w4",
+		},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range validateTests {
+		err := newTestCircuit(test.wires, test.gates).Validate()
+		if len(test.err) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: Validate succeeded", test.name)
+			continue
+		}
+		for _, e := range test.err {
+			if !strings.Contains(err.Error(), e) {
+				t.Errorf("%s: error %q does not contain %q",
+					test.name, err, e)
+			}
+		}
+	}
+}
+
+func TestValidateParsed(t *testing.T) {
+	c, err := ParseBristol(bytes.NewReader([]byte(data)))
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+//
+// verilog.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// VerilogModule is the name of the module that EmitVerilog emits.
+const VerilogModule = "circuit"
+
+var reVerilogIdent = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// verilogKeywords lists the Verilog-2005 reserved words that are
+// valid MPCL identifiers.
+var verilogKeywords = map[string]bool{
+	"always": true, "and": true, "assign": true, "automatic": true,
+	"begin": true, "buf": true, "bufif0": true, "bufif1": true,
+	"case": true, "casex": true, "casez": true, "cell": true,
+	"cmos": true, "config": true, "deassign": true, "default": true,
+	"defparam": true, "design": true, "disable": true, "edge": true,
+	"else": true, "end": true, "endcase": true, "endconfig": true,
+	"endfunction": true, "endgenerate": true, "endmodule": true,
+	"endprimitive": true, "endspecify": true, "endtable": true,
+	"endtask": true, "event": true, "for": true, "force": true,
+	"forever": true, "fork": true, "function": true, "generate": true,
+	"genvar": true, "highz0": true, "highz1": true, "if": true,
+	"ifnone": true, "incdir": true, "include": true, "initial": true,
+	"inout": true, "input": true, "instance": true, "integer": true,
+	"join": true, "large": true, "liblist": true, "library": true,
+	"localparam": true, "macromodule": true, "medium": true,
+	"module": true, "nand": true, "negedge": true, "nmos": true,
+	"nor": true, "noshowcancelled": true, "not": true, "notif0": true,
+	"notif1": true, "or": true, "output": true, "parameter": true,
+	"pmos": true, "posedge": true, "primitive": true, "pull0": true,
+	"pull1": true, "pulldown": true, "pullup": true,
+	"pulsestyle_ondetect": true, "pulsestyle_onevent": true,
+	"rcmos": true, "real": true, "realtime": true, "reg": true,
+	"release": true, "repeat": true, "rnmos": true, "rpmos": true,
+	"rtran": true, "rtranif0": true, "rtranif1": true, "scalared": true,
+	"showcancelled": true, "signed": true, "small": true,
+	"specify": true, "specparam": true, "strong0": true,
+	"strong1": true, "supply0": true, "supply1": true, "table": true,
+	"task": true, "time": true, "tran": true, "tranif0": true,
+	"tranif1": true, "tri": true, "tri0": true, "tri1": true,
+	"triand": true, "trior": true, "trireg": true, "unsigned": true,
+	"use": true, "uwire": true, "vectored": true, "wait": true,
+	"wand": true, "weak0": true, "weak1": true, "while": true,
+	"wire": true, "wor": true, "xnor": true, "xor": true,
+}
+
+// EmitVerilog emits the circuit as a combinational Verilog
+// module. The module has one input port for each circuit input and
+// one output port for each circuit output. The ports are named after
+// the arguments when the names are valid Verilog identifiers, and
+// in<N> and out<N> otherwise. The circuit wires are bits of the
+// internal vector w and each gate is mapped to one continuous
+// assignment.
+func (c *Circuit) EmitVerilog(out io.Writer) error {
+	used := map[string]bool{
+		"w": true,
+	}
+	inputs, err := verilogPorts(c.Inputs, "in", used)
+	if err != nil {
+		return err
+	}
+	outputs, err := verilogPorts(c.Outputs, "out", used)
+	if err != nil {
+		return err
+	}
+
+	// The buffered writer keeps the first write error and returns
+	// it from Flush.
+	w := bufio.NewWriter(out)
+
+	fmt.Fprintf(w, "// Generated from MPCL circuit: #gates=%d, #wires=%d\n",
+		c.NumGates, c.NumWires)
+	fmt.Fprintf(w, "module %s(", VerilogModule)
+	for idx, name := range append(inputs, outputs...) {
+		if idx > 0 {
+			fmt.Fprintf(w, ",")
+		}
+		fmt.Fprintf(w, "\n  %s", name)
+	}
+	fmt.Fprintf(w, ");\n")
+
+	for idx, arg := range c.Inputs {
+		fmt.Fprintf(w, "  input  wire [%d:0] %s;\n",
+			arg.Type.Bits-1, inputs[idx])
+	}
+	for idx, arg := range c.Outputs {
+		fmt.Fprintf(w, "  output wire [%d:0] %s;\n",
+			arg.Type.Bits-1, outputs[idx])
+	}
+	fmt.Fprintf(w, "\n  wire [%d:0] w;\n\n", c.NumWires-1)
+
+	for idx, l := range c.Inputs.Layout() {
+		fmt.Fprintf(w, "  assign w[%d:%d] = %s;\n",
+			l.Offset+l.Bits-1, l.Offset, inputs[idx])
+	}
+
+	for _, g := range c.Gates {
+		var expr string
+		switch g.Op {
+		case XOR:
+			expr = fmt.Sprintf("w[%d] ^ w[%d]", g.Input0, g.Input1)
+		case XNOR:
+			expr = fmt.Sprintf("~(w[%d] ^ w[%d])", g.Input0, g.Input1)
+		case AND:
+			expr = fmt.Sprintf("w[%d] & w[%d]", g.Input0, g.Input1)
+		case OR:
+			expr = fmt.Sprintf("w[%d] | w[%d]", g.Input0, g.Input1)
+		case INV:
+			expr = fmt.Sprintf("~w[%d]", g.Input0)
+		default:
+			return fmt.Errorf("unsupported gate type %s", g.Op)
+		}
+		fmt.Fprintf(w, "  assign w[%d] = %s;\n", g.Output, expr)
+	}
+
+	base := c.NumWires - c.Outputs.Size()
+	for idx, l := range c.Outputs.Layout() {
+		fmt.Fprintf(w, "  assign %s = w[%d:%d];\n",
+			outputs[idx], base+l.Offset+l.Bits-1, base+l.Offset)
+	}
+	fmt.Fprintf(w, "endmodule\n")
+
+	return w.Flush()
+}
+
+// verilogPorts returns the Verilog port names for the I/O
+// arguments. The used map holds the names that are already taken.
+func verilogPorts(io IO, prefix string, used map[string]bool) (
+	[]string, error) {
+
+	var result []string
+	for idx, arg := range io {
+		if arg.Type.Bits == 0 {
+			return nil, fmt.Errorf("zero-width argument %s", arg)
+		}
+		name := arg.Name
+		if !reVerilogIdent.MatchString(name) || verilogKeywords[name] ||
+			used[name] {
+			name = fmt.Sprintf("%s%d", prefix, idx)
+			for i := 0; used[name]; i++ {
+				name = fmt.Sprintf("%s%d_%d", prefix, idx, i)
+			}
+		}
+		used[name] = true
+		result = append(result, name)
+	}
+	return result, nil
+}
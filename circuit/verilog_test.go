@@ -0,0 +1,158 @@
+//
+// verilog_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	reVerilogModule = regexp.MustCompile(`(?s)module circuit\(([^)]*)\);`)
+	reVerilogPort   = regexp.MustCompile(
+		`(?m)^  (input|output) +wire \[(\d+):0\] (\w+);$`)
+	reVerilogGate = regexp.MustCompile(
+		`(?m)^  assign w\[(\d+)\] = (~?)\(?w\[(\d+)\](?: ([&|^]) w\[(\d+)\])?\)?;$`)
+)
+
+func TestEmitVerilog(t *testing.T) {
+	const bits = 8
+
+	circ := newAdder(bits)
+	var buf bytes.Buffer
+	if err := circ.EmitVerilog(&buf); err != nil {
+		t.Fatalf("EmitVerilog failed: %v", err)
+	}
+	src := buf.String()
+
+	m := reVerilogModule.FindStringSubmatch(src)
+	if m == nil {
+		t.Fatalf("module header not found:\n%s", src)
+	}
+	var ports []string
+	for _, port := range strings.Split(m[1], ",") {
+		ports = append(ports, strings.TrimSpace(port))
+	}
+	if strings.Join(ports, ",") != "a,b,r" {
+		t.Errorf("unexpected ports: %v", ports)
+	}
+
+	decls := reVerilogPort.FindAllStringSubmatch(src, -1)
+	expected := [][]string{
+		{"input", "a"},
+		{"input", "b"},
+		{"output", "r"},
+	}
+	if len(decls) != len(expected) {
+		t.Fatalf("unexpected port declarations: %v", decls)
+	}
+	for idx, decl := range decls {
+		if decl[1] != expected[idx][0] || decl[3] != expected[idx][1] ||
+			decl[2] != strconv.Itoa(bits-1) {
+			t.Errorf("invalid port declaration: %s", decl[0])
+		}
+	}
+	if !strings.HasSuffix(src, "endmodule\n") {
+		t.Errorf("module not terminated")
+	}
+
+	// Evaluate the gate assignments and compare the result with the
+	// circuit computation.
+	gates := reVerilogGate.FindAllStringSubmatch(src, -1)
+	if len(gates) != circ.NumGates {
+		t.Fatalf("got %d gate assignments, expected %d",
+			len(gates), circ.NumGates)
+	}
+	const a, b = 0xa5, 0x7e
+	wires := make([]uint, circ.NumWires)
+	for i := 0; i < bits; i++ {
+		wires[i] = (a >> i) & 1
+		wires[bits+i] = (b >> i) & 1
+	}
+	wire := func(s string) int {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			t.Fatalf("invalid wire %s", s)
+		}
+		return v
+	}
+	for _, g := range gates {
+		v := wires[wire(g[3])]
+		switch g[4] {
+		case "&":
+			v &= wires[wire(g[5])]
+		case "|":
+			v |= wires[wire(g[5])]
+		case "^":
+			v ^= wires[wire(g[5])]
+		}
+		if g[2] == "~" {
+			v ^= 1
+		}
+		wires[wire(g[1])] = v
+	}
+	var r uint
+	for i := 0; i < bits; i++ {
+		r |= wires[circ.NumWires-bits+i] << i
+	}
+	if r != (a+b)&0xff {
+		t.Errorf("Verilog adder computed %x, expected %x", r, (a+b)&0xff)
+	}
+}
+
+// limitWriter fails the writes after n bytes.
+type limitWriter struct {
+	n int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, io.ErrShortWrite
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestEmitVerilogWriteError(t *testing.T) {
+	circ := newAdder(64)
+	for _, limit := range []int{0, 100, 10000} {
+		err := circ.EmitVerilog(&limitWriter{n: limit})
+		if !errors.Is(err, io.ErrShortWrite) {
+			t.Errorf("limit %d: got error %v, expected %v", limit, err,
+				io.ErrShortWrite)
+		}
+	}
+}
+
+func TestEmitVerilogPortNames(t *testing.T) {
+	circ := newAdder(4)
+	circ.Inputs[0].Name = "module"
+	circ.Inputs[1].Name = "%b"
+	circ.Outputs[0].Name = "w"
+
+	var buf bytes.Buffer
+	if err := circ.EmitVerilog(&buf); err != nil {
+		t.Fatalf("EmitVerilog failed: %v", err)
+	}
+	m := reVerilogModule.FindStringSubmatch(buf.String())
+	if m == nil {
+		t.Fatalf("module header not found:\n%s", buf.String())
+	}
+	ports := strings.Join(strings.Fields(m[1]), "")
+	if ports != "in0,in1,out0" {
+		t.Errorf("unexpected ports: %s", ports)
+	}
+}
@@ -26,6 +26,8 @@ var (
 	_ AST = &VariableDef{}
 	_ AST = &Assign{}
 	_ AST = &If{}
+	_ AST = &Switch{}
+	_ AST = &switchTag{}
 	_ AST = &Call{}
 	_ AST = &ArrayCast{}
 	_ AST = &Return{}
@@ -56,8 +58,19 @@ const (
 	TypeArray
 	TypeSlice
 	TypeStruct
+	TypeUnion
 	TypePointer
 	TypeAlias
+	TypeFunc
+)
+
+// Union field names and limits. The union values are structs with
+// the uint8 Tag field followed by the Payload field that is wide
+// enough to hold the largest variant.
+const (
+	UnionTag         = "Tag"
+	UnionPayload     = "Payload"
+	UnionMaxVariants = 255
 )
 
 // TypeInfo contains AST type information.
@@ -70,6 +83,8 @@ type TypeInfo struct {
 	TypeName     string
 	StructFields []StructField
 	AliasType    *TypeInfo
+	ArgTypes     []*TypeInfo
+	ReturnTypes  []*TypeInfo
 	Methods      map[string]*Func
 	Annotations  Annotations
 }
@@ -90,7 +105,7 @@ func (ti *TypeInfo) Equal(o *TypeInfo) bool {
 	case TypeSlice, TypePointer:
 		return ti.ElementType.Equal(o.ElementType)
 
-	case TypeStruct:
+	case TypeStruct, TypeUnion:
 		if len(ti.StructFields) != len(o.StructFields) {
 			return false
 		}
@@ -104,11 +119,27 @@ func (ti *TypeInfo) Equal(o *TypeInfo) bool {
 	case TypeAlias:
 		return ti.AliasType.Equal(o.AliasType)
 
+	case TypeFunc:
+		return typesEqual(ti.ArgTypes, o.ArgTypes) &&
+			typesEqual(ti.ReturnTypes, o.ReturnTypes)
+
 	default:
 		panic("unsupported type")
 	}
 }
 
+func typesEqual(a, b []*TypeInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx, t := range a {
+		if !t.Equal(b[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
 // StructField contains AST structure field information.
 type StructField struct {
 	utils.Point
@@ -142,8 +173,12 @@ func (ti *TypeInfo) format(pp bool) string {
 	case TypeSlice:
 		return fmt.Sprintf("%s[]%s", str, ti.ElementType)
 
-	case TypeStruct:
-		str = fmt.Sprintf("%sstruct {", str)
+	case TypeStruct, TypeUnion:
+		if ti.Type == TypeUnion {
+			str = fmt.Sprintf("%sunion {", str)
+		} else {
+			str = fmt.Sprintf("%sstruct {", str)
+		}
 		if pp {
 			var width int
 			for _, field := range ti.StructFields {
@@ -178,6 +213,31 @@ func (ti *TypeInfo) format(pp bool) string {
 	case TypePointer:
 		return fmt.Sprintf("%s*%s", str, ti.ElementType)
 
+	case TypeFunc:
+		str += "func("
+		for idx, arg := range ti.ArgTypes {
+			if idx > 0 {
+				str += ", "
+			}
+			str += arg.String()
+		}
+		str += ")"
+		switch len(ti.ReturnTypes) {
+		case 0:
+		case 1:
+			str += " " + ti.ReturnTypes[0].String()
+		default:
+			str += " ("
+			for idx, ret := range ti.ReturnTypes {
+				if idx > 0 {
+					str += ", "
+				}
+				str += ret.String()
+			}
+			str += ")"
+		}
+		return str
+
 	default:
 		return fmt.Sprintf("%s{TypeInfo %d}", str, ti.Type)
 	}
@@ -217,18 +277,12 @@ func (ti *TypeInfo) Resolve(env *Env, ctx *Codegen, gen *ssa.Generator) (
 		}
 		if !ok {
 			// Qualified names and package-local names.
-			var pkgName string
-			if len(ti.Name.Package) > 0 {
-				pkgName = ti.Name.Package
-			} else if ti.Name.Defined != ctx.Package.Name {
-				pkgName = ti.Name.Defined
-			}
-
-			if len(pkgName) > 0 {
-				pkg, ok = ctx.Packages[pkgName]
+			if len(ti.Name.Package) > 0 || (len(ti.Name.Defined) > 0 &&
+				ti.Name.Defined != ctx.Package.Path) {
+				pkg, ok = ctx.lookupPackage(ti.Name)
 				if !ok {
 					return result, ctx.Errorf(ti, "unknown package: %s",
-						pkgName)
+						ti.Name.PackageName())
 				}
 				b, ok = pkg.Bindings.Get(ti.Name.Name)
 			}
@@ -256,6 +310,10 @@ func (ti *TypeInfo) Resolve(env *Env, ctx *Codegen, gen *ssa.Generator) (
 			return result, ctx.Errorf(ti.ArrayLength,
 				"invalid array length: %s", err)
 		}
+		if length < 0 {
+			return result, ctx.Errorf(ti.ArrayLength,
+				"invalid array length %s (%d)", ti.ArrayLength, length)
+		}
 
 		// Element type.
 		elInfo, err := ti.ElementType.Resolve(env, ctx, gen)
@@ -298,6 +356,10 @@ func (ti *TypeInfo) Resolve(env *Env, ctx *Codegen, gen *ssa.Generator) (
 			ElementType: &elInfo,
 		}, nil
 
+	case TypeFunc:
+		return result, ctx.Errorf(ti,
+			"function type %s can only be used as an argument type", ti)
+
 	default:
 		return result, ctx.Errorf(ti, "can't resolve type %s", ti)
 	}
@@ -343,6 +405,15 @@ type Identifier struct {
 	Name    string
 }
 
+// PackageName returns the package qualifier of the identifier or the
+// package that defines it if the identifier is not qualified.
+func (i Identifier) PackageName() string {
+	if len(i.Package) > 0 {
+		return i.Package
+	}
+	return i.Defined
+}
+
 func (i Identifier) String() string {
 	if len(i.Package) == 0 {
 		return i.Name
@@ -426,7 +497,8 @@ type Variable struct {
 	Type *TypeInfo
 }
 
-// Func implements an AST function.
+// Func implements an AST function. The types of the return
+// variables without TypeInfo are inferred from the returned values.
 type Func struct {
 	utils.Point
 	Name         string
@@ -439,6 +511,8 @@ type Func struct {
 	End          utils.Point
 	NumInstances int
 	Annotations  Annotations
+	// Digest identifies the source code of the function.
+	Digest string
 }
 
 // ReturnInfo provide information about function return values.
@@ -492,6 +566,21 @@ func NewFunc(loc utils.Point, name string, args []*Variable, ret []*Variable,
 	}
 }
 
+// Signature returns the function type of the function.
+func (ast *Func) Signature() *TypeInfo {
+	result := &TypeInfo{
+		Point: ast.Point,
+		Type:  TypeFunc,
+	}
+	for _, arg := range ast.Args {
+		result.ArgTypes = append(result.ArgTypes, arg.Type)
+	}
+	for _, ret := range ast.Return {
+		result.ReturnTypes = append(result.ReturnTypes, ret.Type)
+	}
+	return result
+}
+
 func (ast *Func) String() string {
 	var str string
 	if ast.This != nil {
@@ -594,6 +683,60 @@ func (ast *If) String() string {
 	return fmt.Sprintf("if %s", ast.Expr)
 }
 
+// Switch implements an AST switch statement. The Expr is nil for
+// switch statements without a tag expression.
+type Switch struct {
+	utils.Point
+	Expr  AST
+	Cases []*Case
+}
+
+func (ast *Switch) String() string {
+	if ast.Expr == nil {
+		return "switch"
+	}
+	return fmt.Sprintf("switch %s", ast.Expr)
+}
+
+// Case implements a case clause of a switch statement. The default
+// clause has no expressions.
+type Case struct {
+	utils.Point
+	Exprs []AST
+	Body  List
+}
+
+func (ast *Case) String() string {
+	if len(ast.Exprs) == 0 {
+		return "default"
+	}
+	str := "case "
+	for idx, expr := range ast.Exprs {
+		if idx > 0 {
+			str += ", "
+		}
+		str += fmt.Sprintf("%v", expr)
+	}
+	return str
+}
+
+// switchTag holds the value of a switch statement's tag
+// expression. It lets the case comparisons use the tag value without
+// evaluating the tag expression again.
+type switchTag struct {
+	Expr  AST
+	Value ssa.Value
+}
+
+// Location implements utils.Locator.Location.
+func (ast *switchTag) Location() utils.Point {
+	return ast.Expr.Location()
+}
+
+func (ast *switchTag) String() string {
+	return ast.Expr.String()
+}
+
 // Call implements an AST call expression.
 type Call struct {
 	utils.Point
@@ -634,6 +777,55 @@ func (ast *Return) String() string {
 	return fmt.Sprintf("return %v", ast.Exprs)
 }
 
+// Break implements an AST break statement. The Label is empty for
+// break statements without a label.
+type Break struct {
+	utils.Point
+	Label string
+}
+
+func (ast *Break) String() string {
+	if len(ast.Label) == 0 {
+		return "break"
+	}
+	return fmt.Sprintf("break %s", ast.Label)
+}
+
+// Continue implements an AST continue statement. The Label is empty
+// for continue statements without a label.
+type Continue struct {
+	utils.Point
+	Label string
+}
+
+func (ast *Continue) String() string {
+	if len(ast.Label) == 0 {
+		return "continue"
+	}
+	return fmt.Sprintf("continue %s", ast.Label)
+}
+
+// Goto implements an AST goto statement.
+type Goto struct {
+	utils.Point
+	Label string
+}
+
+func (ast *Goto) String() string {
+	return fmt.Sprintf("goto %s", ast.Label)
+}
+
+// LabeledStmt implements an AST labeled statement.
+type LabeledStmt struct {
+	utils.Point
+	Label string
+	Stmt  AST
+}
+
+func (ast *LabeledStmt) String() string {
+	return fmt.Sprintf("%s: %s", ast.Label, ast.Stmt)
+}
+
 // For implements an AST for statement.
 type For struct {
 	utils.Point
@@ -826,6 +1018,11 @@ func (ast *VariableRef) String() string {
 	return ast.Name.String()
 }
 
+// IsBlank tests if the variable reference is the blank identifier _.
+func (ast *VariableRef) IsBlank() bool {
+	return len(ast.Name.Package) == 0 && ast.Name.Name == "_"
+}
+
 // BasicLit implements an AST basic literal value.
 type BasicLit struct {
 	utils.Point
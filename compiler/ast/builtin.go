@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -8,10 +8,12 @@ package ast
 
 import (
 	"fmt"
+	"math/big"
 	"path"
 
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler/circuits"
+	"github.com/markkurossi/mpc/compiler/mpa"
 	"github.com/markkurossi/mpc/compiler/ssa"
 	"github.com/markkurossi/mpc/compiler/utils"
 	"github.com/markkurossi/mpc/types"
@@ -36,6 +38,9 @@ var builtins = map[string]Builtin{
 	"copy": {
 		SSA: copySSA,
 	},
+	"divmod": {
+		SSA: divmodSSA,
+	},
 	"floorPow2": {
 		SSA:  floorPow2SSA,
 		Eval: floorPow2Eval,
@@ -44,6 +49,14 @@ var builtins = map[string]Builtin{
 		SSA:  lenSSA,
 		Eval: lenEval,
 	},
+	"max": {
+		SSA:  maxSSA,
+		Eval: maxEval,
+	},
+	"min": {
+		SSA:  minSSA,
+		Eval: minEval,
+	},
 	"native": {
 		SSA: nativeSSA,
 	},
@@ -51,6 +64,70 @@ var builtins = map[string]Builtin{
 		SSA:  sizeSSA,
 		Eval: sizeEval,
 	},
+	"static_assert": {
+		SSA:  staticAssertSSA,
+		Eval: staticAssertEval,
+	},
+}
+
+// Package intrinsics. The intrinsics are keyed by the import paths of
+// their packages and they accept arguments of any type.
+var intrinsics = map[string]Builtin{
+	"math/bits.Reverse": {
+		SSA:  bitsReverseSSA,
+		Eval: bitsReverseEval,
+	},
+	"math/bits.ReverseBytes": {
+		SSA:  bitsReverseBytesSSA,
+		Eval: bitsReverseBytesEval,
+	},
+	"bytes.Reverse": {
+		SSA: bytesReverseSSA,
+	},
+	"cmp.Compare": {
+		SSA: cmpCompareSSA,
+	},
+	"cond.Select": {
+		SSA:  condSelectSSA,
+		Eval: condSelectEval,
+	},
+	"math.Abs": {
+		SSA:  mathAbsSSA,
+		Eval: mathAbsEval,
+	},
+	"math.Dot": {
+		SSA: mathDotSSA,
+	},
+	"math.Sum": {
+		SSA: mathSumSSA,
+	},
+	"psi.IntersectionSize": {
+		SSA: psiIntersectionSizeSSA,
+	},
+	"result.Abort": {
+		SSA: resultAbortSSA,
+	},
+	"sort.CompareSwap": {
+		SSA: sortCompareSwapSSA,
+	},
+}
+
+// lookupBuiltin returns the builtin function or the package intrinsic
+// for the function reference. The package qualifier is resolved to
+// its import path so the intrinsics can be called through the import
+// aliases.
+func lookupBuiltin(ctx *Codegen, ref *VariableRef) (Builtin, bool) {
+	if len(ref.Name.Package) > 0 {
+		pkg, ok := ctx.lookupPackage(ref.Name)
+		if ok {
+			bi, ok := intrinsics[pkg.Path+"."+ref.Name.Name]
+			if ok {
+				return bi, true
+			}
+		}
+	}
+	bi, ok := builtins[ref.Name.Name]
+	return bi, ok
 }
 
 func copySSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
@@ -194,6 +271,80 @@ func floorPow2Eval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
 	return gen.Constant(int64(i), types.Undefined), true, nil
 }
 
+func staticAssertSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+
+	// The constant arguments are already evaluated so the assertion
+	// only checks their values and it does not emit any instructions.
+	if err := staticAssert(ctx, args, loc); err != nil {
+		return nil, nil, err
+	}
+	for _, arg := range args {
+		gen.RemoveConstant(arg)
+	}
+	return block, nil, nil
+}
+
+func staticAssertEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
+	loc utils.Point) (ssa.Value, bool, error) {
+
+	var values []ssa.Value
+	for _, arg := range args {
+		v, ok, err := arg.Eval(env, ctx, gen)
+		if err != nil {
+			return ssa.Undefined, false, err
+		}
+		if !ok {
+			return ssa.Undefined, false, ctx.Errorf(arg,
+				"non-constant argument %s in call to static_assert", arg)
+		}
+		values = append(values, v)
+	}
+	if err := staticAssert(ctx, values, loc); err != nil {
+		return ssa.Undefined, false, err
+	}
+	// The assertion does not have a value.
+	return ssa.Undefined, false, nil
+}
+
+// staticAssert checks the arguments of the static_assert call. The
+// arguments are the constant condition and an optional constant
+// message string.
+func staticAssert(ctx *Codegen, args []ssa.Value, loc utils.Point) error {
+	if len(args) != 1 && len(args) != 2 {
+		return ctx.Errorf(loc,
+			"invalid amount of arguments in call to static_assert")
+	}
+	for _, arg := range args {
+		if !arg.Const {
+			return ctx.Errorf(loc,
+				"non-constant argument %s in call to static_assert", arg)
+		}
+	}
+	cond, ok := args[0].ConstValue.(bool)
+	if !ok {
+		return ctx.Errorf(loc,
+			"non-bool condition (type %s) in call to static_assert",
+			args[0].Type)
+	}
+	var msg string
+	if len(args) == 2 {
+		msg, ok = args[1].ConstValue.(string)
+		if !ok {
+			return ctx.Errorf(loc,
+				"non-string message (type %s) in call to static_assert",
+				args[1].Type)
+		}
+	}
+	if cond {
+		return nil
+	}
+	if len(msg) > 0 {
+		return ctx.Errorf(loc, "static assertion failed: %s", msg)
+	}
+	return ctx.Errorf(loc, "static assertion failed")
+}
+
 func lenSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
 	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
 
@@ -258,7 +409,7 @@ func lenEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
 				}
 			} else {
 				// Resolve name from the package.
-				pkg, ok := ctx.Packages[arg.Name.Package]
+				pkg, ok := ctx.lookupPackage(arg.Name)
 				if !ok {
 					return ssa.Undefined, false, ctx.Errorf(loc,
 						"package '%s' not found", arg.Name.Package)
@@ -303,6 +454,154 @@ func lenEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
 	}
 }
 
+func minSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+	return minMaxSSA(block, ctx, gen, args, loc, "min", -1)
+}
+
+func minEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
+	loc utils.Point) (ssa.Value, bool, error) {
+	return minMaxEval(args, env, ctx, gen, loc, "min", -1)
+}
+
+func maxSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+	return minMaxSSA(block, ctx, gen, args, loc, "max", 1)
+}
+
+func maxEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
+	loc utils.Point) (ssa.Value, bool, error) {
+	return minMaxEval(args, env, ctx, gen, loc, "max", 1)
+}
+
+// minMaxSSA implements the min (cmp=-1) and max (cmp=1) builtins.
+// The arguments must be integers of the same type and the untyped
+// constants take the type of the other arguments. The gadget is built
+// for the argument width at the call site and the arguments are
+// reduced pairwise.
+func minMaxSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point, name string, cmp int) (
+	*ssa.Block, []ssa.Value, error) {
+
+	if len(args) == 0 {
+		return nil, nil, ctx.Errorf(loc,
+			"not enough arguments in call to %s", name)
+	}
+	var typeInfo types.Info
+	var typed bool
+	for _, arg := range args {
+		if !arg.Const {
+			typeInfo = arg.Type
+			typed = true
+			break
+		}
+	}
+	if !typed {
+		v, err := minMaxConst(ctx, gen, args, loc, name, cmp)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, arg := range args {
+			gen.RemoveConstant(arg)
+		}
+		gen.AddConstant(v)
+		return block, []ssa.Value{v}, nil
+	}
+	if (typeInfo.Type != types.TInt && typeInfo.Type != types.TUint) ||
+		!typeInfo.Concrete() {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid argument type %s in call to %s", typeInfo, name)
+	}
+	for _, arg := range args {
+		if arg.Const && arg.Type.Untyped &&
+			(arg.Type.Type == types.TInt || arg.Type.Type == types.TUint) {
+			if !ssa.LValueFor(typeInfo, arg) {
+				return nil, nil, ctx.Errorf(loc,
+					"constant %v overflows %s in call to %s",
+					arg.ConstValue, typeInfo, name)
+			}
+		} else if !typeInfo.Equal(arg.Type) {
+			return nil, nil, ctx.Errorf(loc,
+				"mismatched types %s and %s in call to %s",
+				typeInfo, arg.Type, name)
+		}
+	}
+	signed := typeInfo.Type == types.TInt
+	gadget := circuits.NewMin
+	if cmp > 0 {
+		gadget = circuits.NewMax
+	}
+
+	result := args[0]
+	for _, arg := range args[1:] {
+		v := gen.AnonVal(typeInfo)
+		block.AddInstr(ssa.NewBuiltinInstr(
+			func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+				return gadget(cc, signed, a, b, r)
+			}, result, arg, v))
+		result = v
+	}
+	return block, []ssa.Value{result}, nil
+}
+
+// minMaxEval constant folds the min (cmp=-1) and max (cmp=1)
+// builtins.
+func minMaxEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
+	loc utils.Point, name string, cmp int) (ssa.Value, bool, error) {
+
+	if len(args) == 0 {
+		return ssa.Undefined, false, ctx.Errorf(loc,
+			"not enough arguments in call to %s", name)
+	}
+	var values []ssa.Value
+	for _, arg := range args {
+		v, ok, err := arg.Eval(env, ctx, gen)
+		if err != nil || !ok {
+			return ssa.Undefined, false, err
+		}
+		values = append(values, v)
+	}
+	v, err := minMaxConst(ctx, gen, values, loc, name, cmp)
+	if err != nil {
+		return ssa.Undefined, false, err
+	}
+	return v, true, nil
+}
+
+// minMaxConst returns the constant argument that compares as cmp with
+// all other arguments. The typed arguments must have the same type
+// and the untyped result takes their type.
+func minMaxConst(ctx *Codegen, gen *ssa.Generator, args []ssa.Value,
+	loc utils.Point, name string, cmp int) (ssa.Value, error) {
+
+	var typeInfo *types.Info
+	var result ssa.Value
+	var resultVal *mpa.Int
+	for idx, arg := range args {
+		val, ok := arg.ConstValue.(*mpa.Int)
+		if !ok {
+			return ssa.Undefined, ctx.Errorf(loc,
+				"invalid argument type %s in call to %s", arg.Type, name)
+		}
+		if !arg.Type.Untyped {
+			if typeInfo != nil && !typeInfo.Equal(arg.Type) {
+				return ssa.Undefined, ctx.Errorf(loc,
+					"mismatched types %s and %s in call to %s",
+					*typeInfo, arg.Type, name)
+			}
+			typeInfo = &args[idx].Type
+		}
+		if idx == 0 || val.Cmp(resultVal) == cmp {
+			result = arg
+			resultVal = val
+		}
+	}
+	if typeInfo != nil && result.Type.Untyped {
+		return gen.Constant(resultVal, *typeInfo), nil
+	}
+	return result, nil
+}
+
 func nativeSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
 	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
 
@@ -339,6 +638,206 @@ func nativeSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
 
 		return block, []ssa.Value{v}, nil
 
+	case "sort":
+		if len(args) != 1 {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid amount of arguments in call to '%s'", name)
+		}
+		typeInfo := args[0].Type
+		if typeInfo.Type != types.TArray ||
+			(typeInfo.ElementType.Type != types.TInt &&
+				typeInfo.ElementType.Type != types.TUint) {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid argument for '%s': %s", name, typeInfo)
+		}
+		signed := typeInfo.ElementType.Type == types.TInt
+		bits := typeInfo.ElementType.Bits
+
+		v := gen.AnonVal(typeInfo)
+		block.AddInstr(ssa.NewBuiltinInstr(
+			func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+				return circuits.NewSort(cc, signed, bits, a, r)
+			}, args[0], args[0], v))
+
+		return block, []ssa.Value{v}, nil
+
+	case "rotateLeft":
+		if len(args) != 2 {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid amount of arguments in call to '%s'", name)
+		}
+		typeInfo := args[0].Type
+		if typeInfo.Type != types.TInt && typeInfo.Type != types.TUint {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid argument for '%s': %s", name, typeInfo)
+		}
+		v := gen.AnonVal(typeInfo)
+
+		if args[1].Const {
+			k, err := args[1].ConstInt()
+			if err != nil {
+				return nil, nil, ctx.Errorf(loc, "%s", err)
+			}
+			gen.RemoveConstant(args[1])
+
+			// Constant rotation is a wire permutation:
+			// v[s:n] = x[0:n-s], v[0:s] = x[n-s:n]
+			n := int64(typeInfo.Bits)
+			s := int64(k) % n
+			if s < 0 {
+				s += n
+			}
+			if s == 0 {
+				block.AddInstr(ssa.NewMovInstr(args[0], v))
+				return block, []ssa.Value{v}, nil
+			}
+			lo := gen.AnonVal(types.Info{
+				Type:       types.TUint,
+				IsConcrete: true,
+				Bits:       types.Size(n - s),
+				MinBits:    types.Size(n - s),
+			})
+			block.AddInstr(ssa.NewSliceInstr(args[0],
+				gen.Constant(int64(0), types.Undefined),
+				gen.Constant(n-s, types.Undefined), lo))
+			hi := gen.AnonVal(types.Info{
+				Type:       types.TUint,
+				IsConcrete: true,
+				Bits:       types.Size(s),
+				MinBits:    types.Size(s),
+			})
+			block.AddInstr(ssa.NewSliceInstr(args[0],
+				gen.Constant(n-s, types.Undefined),
+				gen.Constant(n, types.Undefined), hi))
+			t := gen.AnonVal(typeInfo)
+			block.AddInstr(ssa.NewAmovInstr(hi, args[0],
+				gen.Constant(int64(0), types.Undefined),
+				gen.Constant(s, types.Undefined), t))
+			block.AddInstr(ssa.NewAmovInstr(lo, t,
+				gen.Constant(s, types.Undefined),
+				gen.Constant(n, types.Undefined), v))
+
+			return block, []ssa.Value{v}, nil
+		}
+		signed := args[1].Type.Type == types.TInt
+		block.AddInstr(ssa.NewBuiltinInstr(
+			func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+				return circuits.NewBarrelRotateLeft(cc, a, b, signed, r)
+			}, args[0], args[1], v))
+
+		return block, []ssa.Value{v}, nil
+
+	case "modexp":
+		if len(args) != 3 {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid amount of arguments in call to '%s'", name)
+		}
+		typeInfo := args[0].Type
+		for _, arg := range args {
+			if arg.Type.Type != types.TUint || !arg.Type.Concrete() ||
+				arg.Type.Bits != typeInfo.Bits {
+				return nil, nil, ctx.Errorf(loc,
+					"invalid arguments for '%s': %s, %s, %s", name,
+					args[0].Type, args[1].Type, args[2].Type)
+			}
+		}
+		n := int64(typeInfo.Bits)
+
+		// Builtin instructions take two inputs so the exponent and
+		// the modulus are passed as one value em = m<<n | e.
+		emType := types.Info{
+			Type:       types.TUint,
+			IsConcrete: true,
+			Bits:       types.Size(2 * n),
+			MinBits:    types.Size(2 * n),
+		}
+		zero := gen.Constant(int64(0), emType)
+		gen.AddConstant(zero)
+		t := gen.AnonVal(emType)
+		block.AddInstr(ssa.NewAmovInstr(args[1], zero,
+			gen.Constant(int64(0), types.Undefined),
+			gen.Constant(n, types.Undefined), t))
+		em := gen.AnonVal(emType)
+		block.AddInstr(ssa.NewAmovInstr(args[2], t,
+			gen.Constant(n, types.Undefined),
+			gen.Constant(2*n, types.Undefined), em))
+
+		v := gen.AnonVal(typeInfo)
+		block.AddInstr(ssa.NewBuiltinInstr(
+			func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+				return circuits.NewModExp(cc, a, b[:n], b[n:], r)
+			}, args[0], em, v))
+
+		return block, []ssa.Value{v}, nil
+
+	case "modinverse":
+		if len(args) != 2 {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid amount of arguments in call to '%s'", name)
+		}
+		typeInfo := args[1].Type
+		for _, arg := range args {
+			if arg.Type.Type != types.TUint || !arg.Type.Concrete() ||
+				arg.Type.Bits != typeInfo.Bits {
+				return nil, nil, ctx.Errorf(loc,
+					"invalid arguments for '%s': %s, %s", name,
+					args[0].Type, args[1].Type)
+			}
+		}
+
+		v := gen.AnonVal(typeInfo)
+		block.AddInstr(ssa.NewBuiltinInstr(
+			func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+				return circuits.NewModInverse(cc, a, b, r)
+			}, args[0], args[1], v))
+
+		return block, []ssa.Value{v}, nil
+
+	case "isqrt":
+		if len(args) != 1 {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid amount of arguments in call to '%s'", name)
+		}
+		typeInfo := args[0].Type
+		if typeInfo.Type != types.TUint || !typeInfo.Concrete() ||
+			typeInfo.Bits == 0 {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid argument for '%s': %s", name, typeInfo)
+		}
+		bits := (typeInfo.Bits + 1) / 2
+
+		v := gen.AnonVal(types.Info{
+			Type:       types.TUint,
+			IsConcrete: true,
+			Bits:       bits,
+			MinBits:    bits,
+		})
+		block.AddInstr(ssa.NewBuiltinInstr(
+			func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+				return circuits.NewIsqrt(cc, a, r)
+			}, args[0], args[0], v))
+
+		return block, []ssa.Value{v}, nil
+
+	case "keccakf1600":
+		if len(args) != 1 {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid amount of arguments in call to '%s'", name)
+		}
+		typeInfo := args[0].Type
+		if typeInfo.Type != types.TUint || typeInfo.Bits != 1600 {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid argument for '%s': %s", name, typeInfo)
+		}
+
+		v := gen.AnonVal(typeInfo)
+		block.AddInstr(ssa.NewBuiltinInstr(
+			func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+				return circuits.NewKeccakF1600(cc, a, r)
+			}, args[0], args[0], v))
+
+		return block, []ssa.Value{v}, nil
+
 	default:
 		if circuit.IsFilename(name) {
 			return nativeCircuit(name, block, ctx, gen, args, loc)
@@ -432,7 +931,7 @@ func sizeEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
 
 		if len(arg.Name.Package) > 0 {
 			var pkg *Package
-			pkg, ok = ctx.Packages[arg.Name.Package]
+			pkg, ok = ctx.lookupPackage(arg.Name)
 			if !ok {
 				return ssa.Undefined, false, ctx.Errorf(loc,
 					"package '%s' not found", arg.Name.Package)
@@ -452,3 +951,601 @@ func sizeEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
 			"size(%v/%T) is not constant", arg, arg)
 	}
 }
+
+func cmpCompareSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+
+	if len(args) != 2 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid amount of arguments in call to cmp.Compare")
+	}
+	a, b := args[0], args[1]
+
+	// The untyped constants take the type of the other argument.
+	typeInfo := a.Type
+	if a.Const && !b.Const {
+		typeInfo = b.Type
+	}
+	if typeInfo.Type != types.TInt && typeInfo.Type != types.TUint {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid argument type %s in call to cmp.Compare", typeInfo)
+	}
+	if !ssa.LValueFor(typeInfo, a) || !ssa.LValueFor(typeInfo, b) {
+		return nil, nil, ctx.Errorf(loc,
+			"mismatched types %s and %s in call to cmp.Compare",
+			a.Type, b.Type)
+	}
+	signed := typeInfo.Type == types.TInt
+
+	v := gen.AnonVal(types.Int32)
+	block.AddInstr(ssa.NewBuiltinInstr(
+		func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+			return circuits.NewCompare(cc, signed, a, b, r)
+		}, a, b, v))
+
+	return block, []ssa.Value{v}, nil
+}
+
+func condSelectSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+
+	if len(args) != 3 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid amount of arguments in call to cond.Select")
+	}
+	c, a, b := args[0], args[1], args[2]
+	if c.Type.Type != types.TBool {
+		return nil, nil, ctx.Errorf(loc,
+			"non-bool condition (type %s) in call to cond.Select",
+			c.Type)
+	}
+	if c.Const {
+		gen.RemoveConstant(c)
+		if c.ConstValue.(bool) {
+			return block, []ssa.Value{a}, nil
+		}
+		return block, []ssa.Value{b}, nil
+	}
+
+	// The untyped constants take the type of the other argument.
+	typeInfo := a.Type
+	if a.Const && !b.Const {
+		typeInfo = b.Type
+	}
+	if !ssa.LValueFor(typeInfo, a) || !ssa.LValueFor(typeInfo, b) {
+		return nil, nil, ctx.Errorf(loc,
+			"mismatched types %s and %s in call to cond.Select",
+			a.Type, b.Type)
+	}
+
+	v := gen.AnonVal(typeInfo)
+	block.AddInstr(ssa.NewPhiInstr(c, a, b, v))
+
+	return block, []ssa.Value{v}, nil
+}
+
+func condSelectEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
+	loc utils.Point) (ssa.Value, bool, error) {
+
+	if len(args) != 3 {
+		return ssa.Undefined, false, ctx.Errorf(loc,
+			"invalid amount of arguments in call to cond.Select")
+	}
+	c, ok, err := args[0].Eval(env, ctx, gen)
+	if err != nil || !ok {
+		return ssa.Undefined, false, err
+	}
+	selected, ok := c.ConstValue.(bool)
+	if !ok {
+		return ssa.Undefined, false, ctx.Errorf(loc,
+			"non-bool condition (type %s) in call to cond.Select",
+			c.Type)
+	}
+	if selected {
+		return args[1].Eval(env, ctx, gen)
+	}
+	return args[2].Eval(env, ctx, gen)
+}
+
+func resultAbortSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+
+	if len(args) != 0 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid amount of arguments in call to result.Abort")
+	}
+	status, ok := block.Bindings.Get(circuit.AbortOutput)
+	if !ok {
+		return nil, nil, ctx.Errorf(loc, "undefined abort status")
+	}
+	t := gen.Constant(true, types.Bool)
+	gen.AddConstant(t)
+	v := gen.NewVal(circuit.AbortOutput, types.Bool, status.Scope)
+	err := block.Bindings.Set(v, &t)
+	if err != nil {
+		return nil, nil, ctx.Error(loc, err.Error())
+	}
+	return block, nil, nil
+}
+
+func mathSumSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+
+	if len(args) != 1 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid amount of arguments in call to math.Sum")
+	}
+	typeInfo := args[0].Type
+	if typeInfo.Type != types.TArray ||
+		(typeInfo.ElementType.Type != types.TInt &&
+			typeInfo.ElementType.Type != types.TUint) ||
+		!typeInfo.ElementType.Concrete() {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid argument type %s in call to math.Sum", typeInfo)
+	}
+	elementType := *typeInfo.ElementType
+	signed := elementType.Type == types.TInt
+	elementBits := int(elementType.Bits)
+
+	// The result is widened by ceil(log2(N)) bits so that the sum of
+	// the N elements can't overflow.
+	bits := elementType.Bits
+	for n := types.Size(1); n < typeInfo.ArraySize; n <<= 1 {
+		bits++
+	}
+	v := gen.AnonVal(types.Info{
+		Type:       elementType.Type,
+		IsConcrete: true,
+		Bits:       bits,
+		MinBits:    bits,
+	})
+	block.AddInstr(ssa.NewBuiltinInstr(
+		func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+			return circuits.NewSum(cc, signed, elementBits, a, r)
+		}, args[0], args[0], v))
+
+	return block, []ssa.Value{v}, nil
+}
+
+func mathDotSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+
+	if len(args) != 2 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid amount of arguments in call to math.Dot")
+	}
+	a, b := args[0], args[1]
+	for _, arg := range args {
+		if arg.Type.Type != types.TArray ||
+			(arg.Type.ElementType.Type != types.TInt &&
+				arg.Type.ElementType.Type != types.TUint) ||
+			!arg.Type.ElementType.Concrete() {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid argument type %s in call to math.Dot", arg.Type)
+		}
+	}
+	if a.Type.ArraySize != b.Type.ArraySize ||
+		!a.Type.ElementType.Equal(*b.Type.ElementType) {
+		return nil, nil, ctx.Errorf(loc,
+			"mismatched types %s and %s in call to math.Dot",
+			a.Type, b.Type)
+	}
+	elementType := *a.Type.ElementType
+	signed := elementType.Type == types.TInt
+	elementBits := int(elementType.Bits)
+
+	// The products have 2*T.Bits bits and their sum is widened by
+	// ceil(log2(N)) bits so that the dot product can't overflow.
+	bits := 2 * elementType.Bits
+	for n := types.Size(1); n < a.Type.ArraySize; n <<= 1 {
+		bits++
+	}
+	v := gen.AnonVal(types.Info{
+		Type:       elementType.Type,
+		IsConcrete: true,
+		Bits:       bits,
+		MinBits:    bits,
+	})
+	block.AddInstr(ssa.NewBuiltinInstr(
+		func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+			return circuits.NewDot(cc, signed, elementBits, a, b, r)
+		}, a, b, v))
+
+	return block, []ssa.Value{v}, nil
+}
+
+// absType returns the result type of math.Abs for the argument type
+// t. The result is an unsigned integer of the argument width.
+func absType(ctx *Codegen, loc utils.Point, t types.Info) (types.Info,
+	error) {
+
+	if t.Type != types.TInt || !t.Concrete() {
+		return types.Undefined, ctx.Errorf(loc,
+			"invalid argument type %s in call to math.Abs", t)
+	}
+	return types.Info{
+		Type:       types.TUint,
+		IsConcrete: true,
+		Bits:       t.Bits,
+		MinBits:    t.Bits,
+	}, nil
+}
+
+func mathAbsSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+
+	if len(args) != 1 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid amount of arguments in call to math.Abs")
+	}
+	if args[0].Const {
+		v, err := mathAbsConst(ctx, gen, args[0], loc)
+		if err != nil {
+			return nil, nil, err
+		}
+		gen.RemoveConstant(args[0])
+		gen.AddConstant(v)
+		return block, []ssa.Value{v}, nil
+	}
+	typeInfo, err := absType(ctx, loc, args[0].Type)
+	if err != nil {
+		return nil, nil, err
+	}
+	v := gen.AnonVal(typeInfo)
+	block.AddInstr(ssa.NewBuiltinInstr(
+		func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+			return circuits.NewAbs(cc, a, r)
+		}, args[0], args[0], v))
+
+	return block, []ssa.Value{v}, nil
+}
+
+func mathAbsEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
+	loc utils.Point) (ssa.Value, bool, error) {
+
+	if len(args) != 1 {
+		return ssa.Undefined, false, ctx.Errorf(loc,
+			"invalid amount of arguments in call to math.Abs")
+	}
+	x, ok, err := args[0].Eval(env, ctx, gen)
+	if err != nil || !ok {
+		return ssa.Undefined, false, err
+	}
+	v, err := mathAbsConst(ctx, gen, x, loc)
+	if err != nil {
+		return ssa.Undefined, false, err
+	}
+	return v, true, nil
+}
+
+// mathAbsConst returns the absolute value of the constant x. The
+// constant is interpreted as a two's complement value of its type
+// width and an untyped constant gives an untyped result.
+func mathAbsConst(ctx *Codegen, gen *ssa.Generator, x ssa.Value,
+	loc utils.Point) (ssa.Value, error) {
+
+	typeInfo, err := absType(ctx, loc, x.Type)
+	if err != nil {
+		return ssa.Undefined, err
+	}
+	val, ok := x.ConstValue.(*mpa.Int)
+	if !ok {
+		return ssa.Undefined, ctx.Errorf(loc,
+			"non-integer (%T) argument in call to math.Abs", x.ConstValue)
+	}
+	abs := new(big.Int)
+	n := int(x.Type.Bits)
+	for i := 0; i < n; i++ {
+		abs.SetBit(abs, i, val.Bit(i))
+	}
+	if abs.Bit(n-1) != 0 {
+		abs.Sub(new(big.Int).Lsh(big.NewInt(1), uint(n)), abs)
+	}
+	if x.Type.Untyped {
+		typeInfo = types.Undefined
+	}
+	result, ok := mpa.Parse(abs.Text(16), 16)
+	if !ok {
+		return ssa.Undefined, ctx.Errorf(loc,
+			"invalid argument %v in call to math.Abs", val)
+	}
+	return gen.Constant(result, typeInfo), nil
+}
+
+func psiIntersectionSizeSSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator, args []ssa.Value, loc utils.Point) (
+	*ssa.Block, []ssa.Value, error) {
+
+	if len(args) != 2 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid amount of arguments in call to psi.IntersectionSize")
+	}
+	a, b := args[0], args[1]
+	for _, arg := range args {
+		if arg.Type.Type != types.TArray || !arg.Type.Concrete() ||
+			arg.Type.ElementType.Bits == 0 {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid argument type %s in call to psi.IntersectionSize",
+				arg.Type)
+		}
+	}
+	if !a.Type.ElementType.Equal(*b.Type.ElementType) {
+		return nil, nil, ctx.Errorf(loc,
+			"mismatched types %s and %s in call to psi.IntersectionSize",
+			a.Type, b.Type)
+	}
+	elementBits := int(a.Type.ElementType.Bits)
+
+	// The result holds the values 0...N.
+	var bits types.Size = 1
+	for n := types.Size(2); n <= a.Type.ArraySize; n <<= 1 {
+		bits++
+	}
+	v := gen.AnonVal(types.Info{
+		Type:       types.TUint,
+		IsConcrete: true,
+		Bits:       bits,
+		MinBits:    bits,
+	})
+	block.AddInstr(ssa.NewBuiltinInstr(
+		func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+			return circuits.NewIntersectionSize(cc, elementBits, a, b, r)
+		}, a, b, v))
+
+	return block, []ssa.Value{v}, nil
+}
+
+func sortCompareSwapSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+
+	if len(args) != 2 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid amount of arguments in call to sort.CompareSwap")
+	}
+	a, b := args[0], args[1]
+
+	// The untyped constants take the type of the other argument.
+	typeInfo := a.Type
+	if a.Const && !b.Const {
+		typeInfo = b.Type
+	}
+	if typeInfo.Type != types.TInt && typeInfo.Type != types.TUint {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid argument type %s in call to sort.CompareSwap", typeInfo)
+	}
+	if !ssa.LValueFor(typeInfo, a) || !ssa.LValueFor(typeInfo, b) {
+		return nil, nil, ctx.Errorf(loc,
+			"mismatched types %s and %s in call to sort.CompareSwap",
+			a.Type, b.Type)
+	}
+	signed := typeInfo.Type == types.TInt
+	n := int64(typeInfo.Bits)
+
+	// Builtin instructions have one output so the circuit returns
+	// the pair as one value r = hi<<n | lo.
+	r := gen.AnonVal(types.Info{
+		Type:       types.TUint,
+		IsConcrete: true,
+		Bits:       types.Size(2 * n),
+		MinBits:    types.Size(2 * n),
+	})
+	block.AddInstr(ssa.NewBuiltinInstr(
+		func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+			return circuits.NewCompareSwap(cc, signed, a, b, r[:n], r[n:])
+		}, a, b, r))
+
+	lo := gen.AnonVal(typeInfo)
+	block.AddInstr(ssa.NewSliceInstr(r,
+		gen.Constant(int64(0), types.Undefined),
+		gen.Constant(n, types.Undefined), lo))
+	hi := gen.AnonVal(typeInfo)
+	block.AddInstr(ssa.NewSliceInstr(r,
+		gen.Constant(n, types.Undefined),
+		gen.Constant(2*n, types.Undefined), hi))
+
+	return block, []ssa.Value{lo, hi}, nil
+}
+
+func divmodSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+
+	if len(args) != 2 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid amount of arguments in call to divmod")
+	}
+	a, b := args[0], args[1]
+
+	// The untyped constants take the type of the other argument.
+	typeInfo := a.Type
+	if a.Const && !b.Const {
+		typeInfo = b.Type
+	}
+	if typeInfo.Type != types.TInt && typeInfo.Type != types.TUint {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid argument type %s in call to divmod", typeInfo)
+	}
+	if !ssa.LValueFor(typeInfo, a) || !ssa.LValueFor(typeInfo, b) {
+		return nil, nil, ctx.Errorf(loc,
+			"mismatched types %s and %s in call to divmod", a.Type, b.Type)
+	}
+	if b.Const {
+		if v, ok := b.ConstValue.(*mpa.Int); ok && v.Sign() == 0 {
+			return nil, nil, ctx.Errorf(loc,
+				"invalid operation: division by zero")
+		}
+	}
+	n := int64(typeInfo.Bits)
+
+	// The divider computes the quotient and the remainder at the
+	// same time. Builtin instructions have one output so the circuit
+	// returns the pair as one value r = rem<<n | quo.
+	r := gen.AnonVal(types.Info{
+		Type:       types.TUint,
+		IsConcrete: true,
+		Bits:       types.Size(2 * n),
+		MinBits:    types.Size(2 * n),
+	})
+	block.AddInstr(ssa.NewBuiltinInstr(
+		func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+			return circuits.NewDivider(cc, a, b, r[:n], r[n:])
+		}, a, b, r))
+
+	quo := gen.AnonVal(typeInfo)
+	block.AddInstr(ssa.NewSliceInstr(r,
+		gen.Constant(int64(0), types.Undefined),
+		gen.Constant(n, types.Undefined), quo))
+	rem := gen.AnonVal(typeInfo)
+	block.AddInstr(ssa.NewSliceInstr(r,
+		gen.Constant(n, types.Undefined),
+		gen.Constant(2*n, types.Undefined), rem))
+
+	return block, []ssa.Value{quo, rem}, nil
+}
+
+// reverseBits returns the index of the bit i of an n-bit value after
+// its bits are reversed.
+func reverseBits(i, n int) int {
+	return n - 1 - i
+}
+
+// reverseBytes returns the index of the bit i of an n-bit value after
+// its bytes are reversed.
+func reverseBytes(i, n int) int {
+	return reverseElements(types.ByteBits)(i, n)
+}
+
+func bitsReverseSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+	return reverseSSA(block, ctx, gen, args, loc, "bits.Reverse", reverseBits)
+}
+
+func bitsReverseEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
+	loc utils.Point) (ssa.Value, bool, error) {
+	return reverseEval(args, env, ctx, gen, loc, "bits.Reverse", reverseBits)
+}
+
+func bitsReverseBytesSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+	return reverseSSA(block, ctx, gen, args, loc, "bits.ReverseBytes",
+		reverseBytes)
+}
+
+func bitsReverseBytesEval(args []AST, env *Env, ctx *Codegen,
+	gen *ssa.Generator, loc utils.Point) (ssa.Value, bool, error) {
+	return reverseEval(args, env, ctx, gen, loc, "bits.ReverseBytes",
+		reverseBytes)
+}
+
+// checkReverse checks that the type t is a valid argument type for
+// the reverse function name.
+func checkReverse(ctx *Codegen, loc utils.Point, name string, t types.Info,
+	perm func(i, n int) int) error {
+
+	if t.Type != types.TUint || !t.Concrete() {
+		return ctx.Errorf(loc, "invalid argument type %s in call to %s",
+			t, name)
+	}
+	// The byte reversal is defined only for whole bytes.
+	n := int(t.Bits)
+	for i := 0; i < n; i++ {
+		if j := perm(i, n); j < 0 || j >= n {
+			return ctx.Errorf(loc, "invalid argument type %s in call to %s",
+				t, name)
+		}
+	}
+	return nil
+}
+
+// reverseSSA implements the bit permutation perm of the reverse
+// function name. The permutation only rewires the argument bits and
+// it does not create any gates.
+func reverseSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point, name string,
+	perm func(i, n int) int) (*ssa.Block, []ssa.Value, error) {
+
+	if len(args) != 1 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid amount of arguments in call to %s", name)
+	}
+	x := args[0]
+	if err := checkReverse(ctx, loc, name, x.Type, perm); err != nil {
+		return nil, nil, err
+	}
+	return permuteSSA(block, gen, x, perm)
+}
+
+// permuteSSA moves the bit i of the value x to the bit perm(i, n) of
+// the result. The permutation only rewires the bits and it does not
+// create any gates.
+func permuteSSA(block *ssa.Block, gen *ssa.Generator, x ssa.Value,
+	perm func(i, n int) int) (*ssa.Block, []ssa.Value, error) {
+
+	v := gen.AnonVal(x.Type)
+	block.AddInstr(ssa.NewBuiltinInstr(
+		func(cc *circuits.Compiler, a, b, r []*circuits.Wire) error {
+			for i := 0; i < len(r); i++ {
+				cc.ID(a[i], r[perm(i, len(r))])
+			}
+			return nil
+		}, x, x, v))
+
+	return block, []ssa.Value{v}, nil
+}
+
+// reverseElements returns a permutation that reverses the order of
+// the elementBits wide elements of a value.
+func reverseElements(elementBits int) func(i, n int) int {
+	return func(i, n int) int {
+		return n - elementBits - i/elementBits*elementBits + i%elementBits
+	}
+}
+
+func bytesReverseSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Value, loc utils.Point) (*ssa.Block, []ssa.Value, error) {
+
+	if len(args) != 1 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid amount of arguments in call to bytes.Reverse")
+	}
+	x := args[0]
+	if x.Type.Type != types.TArray || !x.Type.Concrete() ||
+		x.Type.ElementType == nil || x.Type.ElementType.Bits == 0 {
+		return nil, nil, ctx.Errorf(loc,
+			"invalid argument type %s in call to bytes.Reverse", x.Type)
+	}
+	return permuteSSA(block, gen, x,
+		reverseElements(int(x.Type.ElementType.Bits)))
+}
+
+// reverseEval constant folds the reverse function name.
+func reverseEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
+	loc utils.Point, name string, perm func(i, n int) int) (
+	ssa.Value, bool, error) {
+
+	if len(args) != 1 {
+		return ssa.Undefined, false, ctx.Errorf(loc,
+			"invalid amount of arguments in call to %s", name)
+	}
+	x, ok, err := args[0].Eval(env, ctx, gen)
+	if err != nil || !ok {
+		return ssa.Undefined, false, err
+	}
+	if err := checkReverse(ctx, loc, name, x.Type, perm); err != nil {
+		return ssa.Undefined, false, err
+	}
+	val, ok := x.ConstValue.(*mpa.Int)
+	if !ok {
+		return ssa.Undefined, false, ctx.Errorf(loc,
+			"non-integer (%T) argument in call to %s", x.ConstValue, name)
+	}
+	n := int(x.Type.Bits)
+	one := mpa.NewInt(1, x.Type.Bits)
+	result := mpa.New(x.Type.Bits)
+	for i := 0; i < n; i++ {
+		if val.Bit(i) != 0 {
+			bit := mpa.New(x.Type.Bits).Lsh(one, uint(perm(i, n)))
+			result = mpa.New(x.Type.Bits).Or(result, bit)
+		}
+	}
+	return gen.Constant(result, x.Type), true, nil
+}
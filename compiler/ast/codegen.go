@@ -9,6 +9,7 @@
 package ast
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 
@@ -30,6 +31,10 @@ type Codegen struct {
 	Types          map[types.ID]*TypeInfo
 	Native         map[string]*circuit.Circuit
 	HeapID         int
+	Cache          *FuncCache
+	Context        context.Context
+	usage          *usage
+	records        []*funcRecord
 }
 
 // NewCodegen creates a new compilation.
@@ -46,6 +51,7 @@ func NewCodegen(logger *utils.Logger, pkg *Package,
 		MainInputSizes: mainInputSizes,
 		Types:          make(map[types.ID]*TypeInfo),
 		Native:         make(map[string]*circuit.Circuit),
+		usage:          newUsage(),
 	}
 }
 
@@ -76,6 +82,15 @@ func (ctx *Codegen) Errorf(locator utils.Locator, format string,
 func (ctx *Codegen) Warningf(locator utils.Locator, format string,
 	a ...interface{}) {
 	ctx.logger.Warningf(locator.Location(), format, a...)
+	if len(ctx.records) > 0 {
+		w := cachedWarning{
+			loc: locator.Location(),
+			msg: fmt.Sprintf(format, a...),
+		}
+		for _, rec := range ctx.records {
+			rec.warnings = append(rec.warnings, w)
+		}
+	}
 }
 
 // DefineType defines the argument type and assigns it an unique type
@@ -86,59 +101,100 @@ func (ctx *Codegen) DefineType(t *TypeInfo) types.ID {
 	return id
 }
 
+// receiver resolves the receiver of the method call ref. The method
+// calls name their receiver values in the package part of the
+// reference. The function returns false if ref is not a method call.
+func (ctx *Codegen) receiver(bindings *ssa.Bindings, ref *VariableRef) (
+	ssa.Binding, bool) {
+
+	if len(ref.Name.Package) == 0 {
+		return ssa.Binding{}, false
+	}
+	// Check if package name is bound to a value.
+	b, ok := bindings.Get(ref.Name.Package)
+	if !ok {
+		// Check names in the current package.
+		b, ok = ctx.Package.Bindings.Get(ref.Name.Package)
+	}
+	return b, ok
+}
+
 // LookupFunc resolves the named function from the context.
 func (ctx *Codegen) LookupFunc(block *ssa.Block, ref *VariableRef) (
 	*Func, error) {
 
 	// First, check method calls.
-	if len(ref.Name.Package) > 0 {
-		// Check if package name is bound to a value.
-		var b ssa.Binding
-		var ok bool
+	b, ok := ctx.receiver(block.Bindings, ref)
+	if ok {
+		var typeInfo types.Info
+		if b.Type.Type == types.TPtr {
+			typeInfo = *b.Type.ElementType
+		} else {
+			typeInfo = b.Type
+		}
 
-		b, ok = block.Bindings.Get(ref.Name.Package)
+		info, ok := ctx.Types[typeInfo.ID]
 		if !ok {
-			// Check names in the current package.
-			b, ok = ctx.Package.Bindings.Get(ref.Name.Package)
+			return nil, ctx.Errorf(ref, "%s undefined", ref)
 		}
-		if ok {
-			var typeInfo types.Info
-			if b.Type.Type == types.TPtr {
-				typeInfo = *b.Type.ElementType
-			} else {
-				typeInfo = b.Type
-			}
-
-			info, ok := ctx.Types[typeInfo.ID]
-			if !ok {
-				return nil, ctx.Errorf(ref, "%s undefined", ref)
-			}
-			method, ok := info.Methods[ref.Name.Name]
-			if !ok {
-				return nil, ctx.Errorf(ref, "%s undefined", ref)
-			}
-			return method, nil
+		method, ok := info.Methods[ref.Name.Name]
+		if !ok {
+			return nil, ctx.Errorf(ref, "%s undefined", ref)
 		}
+		return method, nil
 	}
 
-	// Next, check function calls.
-	var pkgName string
-	if len(ref.Name.Package) > 0 {
-		pkgName = ref.Name.Package
-	} else {
-		pkgName = ref.Name.Defined
+	// Next, check function values.
+	called := ctx.LookupFuncValue(ref)
+	if called != nil {
+		return called, nil
 	}
-	pkg, ok := ctx.Packages[pkgName]
+
+	// Next, check function calls.
+	pkg, ok := ctx.lookupPackage(ref.Name)
 	if !ok {
-		return nil, ctx.Errorf(ref, "package '%s' not found", pkgName)
+		return nil, ctx.Errorf(ref, "package '%s' not found",
+			ref.Name.PackageName())
 	}
-	called, ok := pkg.Functions[ref.Name.Name]
+	called, ok = pkg.Functions[ref.Name.Name]
 	if !ok {
 		return nil, nil
 	}
 	return called, nil
 }
 
+// lookupPackage returns the package of the name. The package
+// qualifiers are resolved with the imports of the package that
+// defines the name so the import aliases are local to the importing
+// package. The names without qualifiers resolve to their defining
+// package.
+func (ctx *Codegen) lookupPackage(name Identifier) (*Package, bool) {
+	if len(name.Package) == 0 {
+		pkg, ok := ctx.Packages[name.Defined]
+		return pkg, ok
+	}
+	from, ok := ctx.Packages[name.Defined]
+	if !ok {
+		from = ctx.Package
+	}
+	path, ok := from.Imports[name.Package]
+	if !ok {
+		return nil, false
+	}
+	pkg, ok := ctx.Packages[path]
+	return pkg, ok
+}
+
+// LookupFuncValue resolves the named function-typed argument of the
+// current compilation. The function returns nil if the name is not a
+// function value.
+func (ctx *Codegen) LookupFuncValue(ref *VariableRef) *Func {
+	if len(ref.Name.Package) > 0 || len(ctx.Stack) == 0 {
+		return nil
+	}
+	return ctx.Stack[len(ctx.Stack)-1].Funcs[ref.Name.Name]
+}
+
 // Func returns the current function in the current compilation.
 func (ctx *Codegen) Func() *Func {
 	if len(ctx.Stack) == 0 {
@@ -167,6 +223,76 @@ func (ctx *Codegen) PushCompilation(start, ret, caller *ssa.Block,
 	})
 }
 
+// checkContext returns a utils.CanceledError if the compilation
+// context is set and it is canceled or its deadline has expired.
+func (ctx *Codegen) checkContext(locator utils.Locator) error {
+	if ctx.Context == nil {
+		return nil
+	}
+	err := ctx.Context.Err()
+	if err == nil {
+		return nil
+	}
+	loc := locator.Location()
+	ctx.logger.Errorf(loc, "compilation canceled: %s", err)
+	return &utils.CanceledError{
+		Loc: loc,
+		Err: err,
+	}
+}
+
+// MaxRecursionDepth specifies the maximum number of active instances
+// of a recursive function.
+const MaxRecursionDepth = 1024
+
+// checkRecursion checks that the call to the function called with
+// the argument values args does not recurse unboundedly. Since the
+// called functions are instantiated at compile time, a recursive
+// call can terminate only through compile-time constant conditions.
+// Recursive calls are therefore accepted only if they have constant
+// arguments and their recursion depth stays below MaxRecursionDepth.
+func (ctx *Codegen) checkRecursion(loc utils.Locator, called *Func,
+	args []ssa.Value) error {
+
+	var depth int
+	for _, c := range ctx.Stack {
+		if c.Called == called {
+			depth++
+		}
+	}
+	if depth == 0 {
+		return nil
+	}
+	var constArgs bool
+	for _, arg := range args {
+		if arg.Const {
+			constArgs = true
+			break
+		}
+	}
+	if !constArgs {
+		return ctx.Errorf(loc,
+			"recursive call to %s not supported (circuits must be finite)",
+			called.Name)
+	}
+	if depth >= MaxRecursionDepth {
+		return ctx.Errorf(loc,
+			"recursive call to %s not supported (circuits must be finite): "+
+				"recursion depth exceeds %d", called.Name, MaxRecursionDepth)
+	}
+	return nil
+}
+
+// BindFuncValue binds the function-typed argument name to the
+// function f in the current compilation.
+func (ctx *Codegen) BindFuncValue(name string, f *Func) {
+	c := &ctx.Stack[len(ctx.Stack)-1]
+	if c.Funcs == nil {
+		c.Funcs = make(map[string]*Func)
+	}
+	c.Funcs[name] = f
+}
+
 // PopCompilation pops the topmost compilation from the compilation
 // stack.
 func (ctx *Codegen) PopCompilation() {
@@ -206,6 +332,174 @@ type Compilation struct {
 	Return *ssa.Block
 	Caller *ssa.Block
 	Called *Func
+	// Funcs binds the function-typed arguments of the called
+	// function to the functions they were given at the call site.
+	Funcs map[string]*Func
+	// Loops is the stack of the enclosing loop and switch statements.
+	Loops []*Loop
+	// Gotos holds the goto targets of the labeled statements.
+	Gotos map[string]*GotoTarget
+	// label is the label of the next loop or switch statement.
+	label string
+	// constIf is the latest if statement whose condition was
+	// constant.
+	constIf *If
 	// XXX Bindings
 	// XXX Parent scope.
 }
+
+// Loop defines the break and continue targets of a loop or switch
+// statement. The target blocks are created when the first break or
+// continue statement branches to them.
+type Loop struct {
+	Label  string
+	Switch bool
+	// Exit is the target of the break statements.
+	Exit *ssa.Block
+	// Cont is the target of the continue statements in the current
+	// iteration.
+	Cont *ssa.Block
+}
+
+// GotoTarget defines the target of the goto statements to a labeled
+// statement. The target is defined when the statement list
+// containing the labeled statement is compiled, and the goto
+// statements can only jump forward to it. The target blocks are
+// created when the first goto statement branches to them.
+type GotoTarget struct {
+	Label string
+	// Start is the block that precedes the statement containing the
+	// first goto statement to the target. It dominates all paths to
+	// the labeled statement.
+	Start *ssa.Block
+	// Exit is the target of the goto statements.
+	Exit *ssa.Block
+	// Reached is set when the labeled statement is compiled.
+	Reached bool
+	// Closed is set when the statement list of the labeled statement
+	// is compiled.
+	Closed bool
+}
+
+// PushGotoTargets defines the goto targets of the labeled statements
+// of the statement list. The function returns the targets by their
+// labeled statements.
+func (ctx *Codegen) PushGotoTargets(list List) (
+	map[*LabeledStmt]*GotoTarget, error) {
+
+	var result map[*LabeledStmt]*GotoTarget
+	c := &ctx.Stack[len(ctx.Stack)-1]
+	for _, stmt := range list {
+		labeled, ok := stmt.(*LabeledStmt)
+		if !ok {
+			continue
+		}
+		if c.Gotos == nil {
+			c.Gotos = make(map[string]*GotoTarget)
+		}
+		if prev, ok := c.Gotos[labeled.Label]; ok && !prev.Closed {
+			return nil, ctx.Errorf(labeled, "label %s already defined",
+				labeled.Label)
+		}
+		if result == nil {
+			result = make(map[*LabeledStmt]*GotoTarget)
+		}
+		target := &GotoTarget{
+			Label: labeled.Label,
+		}
+		c.Gotos[labeled.Label] = target
+		result[labeled] = target
+	}
+	return result, nil
+}
+
+// LookupGoto finds the goto target with the label in the current
+// compilation.
+func (ctx *Codegen) LookupGoto(label string) *GotoTarget {
+	if len(ctx.Stack) == 0 {
+		return nil
+	}
+	return ctx.Stack[len(ctx.Stack)-1].Gotos[label]
+}
+
+// PushLoop pushes a new loop or switch statement to the loop stack of
+// the current compilation. The loop gets the label of the enclosing
+// labeled statement.
+func (ctx *Codegen) PushLoop(isSwitch bool) *Loop {
+	c := &ctx.Stack[len(ctx.Stack)-1]
+	loop := &Loop{
+		Label:  c.label,
+		Switch: isSwitch,
+	}
+	c.label = ""
+	c.Loops = append(c.Loops, loop)
+	return loop
+}
+
+// PopLoop pops the topmost loop from the loop stack of the current
+// compilation.
+func (ctx *Codegen) PopLoop() {
+	c := &ctx.Stack[len(ctx.Stack)-1]
+	if len(c.Loops) == 0 {
+		panic("loop stack underflow")
+	}
+	c.Loops = c.Loops[:len(c.Loops)-1]
+}
+
+// setConstIf records that the condition of the if statement ast was
+// constant in the current compilation.
+func (ctx *Codegen) setConstIf(ast *If) {
+	if len(ctx.Stack) > 0 {
+		ctx.Stack[len(ctx.Stack)-1].constIf = ast
+	}
+}
+
+// loopConstIf tests if the if statement ast had a constant condition
+// inside a loop of the current compilation. The loop iterations are
+// unrolled so the condition can select a different branch in the
+// other iterations.
+func (ctx *Codegen) loopConstIf(ast AST) bool {
+	if len(ctx.Stack) == 0 {
+		return false
+	}
+	c := ctx.Stack[len(ctx.Stack)-1]
+	for _, loop := range c.Loops {
+		if !loop.Switch {
+			return c.constIf != nil && AST(c.constIf) == ast
+		}
+	}
+	return false
+}
+
+// SetLabel sets the label of the next loop or switch statement in the
+// current compilation.
+func (ctx *Codegen) SetLabel(label string) {
+	ctx.Stack[len(ctx.Stack)-1].label = label
+}
+
+// LookupLoop finds the innermost loop with the label. If the label is
+// empty, the function returns the innermost loop. The continue
+// statements can't target switch statements.
+func (ctx *Codegen) LookupLoop(label string, isContinue bool) *Loop {
+	if len(ctx.Stack) == 0 {
+		return nil
+	}
+	loops := ctx.Stack[len(ctx.Stack)-1].Loops
+	for i := len(loops) - 1; i >= 0; i-- {
+		loop := loops[i]
+		if len(label) > 0 {
+			if loop.Label != label {
+				continue
+			}
+			if isContinue && loop.Switch {
+				return nil
+			}
+			return loop
+		}
+		if isContinue && loop.Switch {
+			continue
+		}
+		return loop
+	}
+	return nil
+}
@@ -74,6 +74,9 @@ func (ast *Assign) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 				return ssa.Undefined, false,
 					ctx.Errorf(ast, "cannot assign to %s", lv)
 			}
+			if ref.IsBlank() {
+				continue
+			}
 			// XXX package.name below
 
 			lValue := gen.NewVal(ref.Name.Name, constVal.Type, ctx.Scope())
@@ -86,6 +89,9 @@ func (ast *Assign) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 				return ssa.Undefined, false,
 					ctx.Errorf(ast, "cannot assign to %s", lv)
 			}
+			if ref.IsBlank() {
+				continue
+			}
 			// XXX package.name below
 
 			b, ok := env.Get(ref.Name.Name)
@@ -112,6 +118,21 @@ func (ast *If) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	return ssa.Undefined, false, nil
 }
 
+// Eval implements the compiler.ast.AST.Eval for switch statements.
+func (ast *Switch) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	ssa.Value, bool, error) {
+	return ssa.Undefined, false, nil
+}
+
+// Eval implements the compiler.ast.AST.Eval for switch tag values.
+func (ast *switchTag) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	ssa.Value, bool, error) {
+	if ast.Value.Const {
+		return ast.Value, true, nil
+	}
+	return ssa.Undefined, false, nil
+}
+
 // Eval implements the compiler.ast.AST.Eval for call expressions.
 func (ast *Call) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	ssa.Value, bool, error) {
@@ -128,24 +149,28 @@ func (ast *Call) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	}
 
 	// Resolve called.
-	var pkgName string
-	if len(ast.Ref.Name.Package) > 0 {
-		pkgName = ast.Ref.Name.Package
-	} else {
-		pkgName = ast.Ref.Name.Defined
+	if ctx.LookupFuncValue(ast.Ref) != nil {
+		return ssa.Undefined, false, nil
+	}
+	if _, ok := ctx.receiver(env.Bindings, ast.Ref); ok {
+		// Method calls are not constant.
+		return ssa.Undefined, false, nil
 	}
-	pkg, ok := ctx.Packages[pkgName]
+	pkg, ok := ctx.lookupPackage(ast.Ref.Name)
 	if !ok {
-		return ssa.Undefined, false,
-			ctx.Errorf(ast, "package '%s' not found", pkgName)
+		return ssa.Undefined, false, ctx.Errorf(ast,
+			"package '%s' not found", ast.Ref.Name.PackageName())
 	}
 	_, ok = pkg.Functions[ast.Ref.Name.Name]
 	if ok {
 		return ssa.Undefined, false, nil
 	}
 	// Check builtin functions.
-	bi, ok := builtins[ast.Ref.Name.Name]
-	if ok && bi.Eval != nil {
+	bi, ok := lookupBuiltin(ctx, ast.Ref)
+	if ok {
+		if bi.Eval == nil {
+			return ssa.Undefined, false, nil
+		}
 		return bi.Eval(ast.Exprs, env, ctx, gen, ast.Location())
 	}
 
@@ -268,6 +293,30 @@ func (ast *Return) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	return ssa.Undefined, false, nil
 }
 
+// Eval implements the compiler.ast.AST.Eval for break statements.
+func (ast *Break) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	ssa.Value, bool, error) {
+	return ssa.Undefined, false, nil
+}
+
+// Eval implements the compiler.ast.AST.Eval for continue statements.
+func (ast *Continue) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	ssa.Value, bool, error) {
+	return ssa.Undefined, false, nil
+}
+
+// Eval implements the compiler.ast.AST.Eval for goto statements.
+func (ast *Goto) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	ssa.Value, bool, error) {
+	return ssa.Undefined, false, nil
+}
+
+// Eval implements the compiler.ast.AST.Eval for labeled statements.
+func (ast *LabeledStmt) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	ssa.Value, bool, error) {
+	return ssa.Undefined, false, nil
+}
+
 // Eval implements the compiler.ast.AST.Eval for for statements.
 func (ast *For) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	ssa.Value, bool, error) {
@@ -577,6 +626,10 @@ func (ast *Index) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 func (ast *VariableRef) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	ssa.Value, bool, error) {
 
+	if ast.IsBlank() {
+		return ssa.Undefined, false, ctx.Errorf(ast, "cannot use _ as value")
+	}
+
 	lrv, ok, _, err := ctx.LookupVar(nil, gen, env.Bindings, ast)
 	if err != nil {
 		return ssa.Undefined, false, ctx.Error(ast, err.Error())
@@ -607,43 +660,176 @@ func (ast *CompositeLit) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	}
 	switch typeInfo.Type {
 	case types.TStruct:
-		// Check if all elements are constants.
-		var values []interface{}
-		for _, el := range ast.Value {
-			// XXX check if el.Key is specified
-
-			v, ok, err := el.Element.Eval(env, ctx, gen)
-			if err != nil || !ok {
-				return ssa.Undefined, ok, err
+		return ast.evalStruct(env, ctx, gen, typeInfo)
+
+	case types.TArray:
+		return ast.evalArray(env, ctx, gen, typeInfo)
+
+	default:
+		fmt.Printf("CompositeLit.Eval: not implemented yet: %v, Value: %v\n",
+			typeInfo, ast.Value)
+		return ssa.Undefined, false, nil
+	}
+}
+
+// evalStruct evaluates the constant struct literal. The keyed
+// elements set the named fields in any order and the fields missing
+// from the literal have the zero value of their type. The unkeyed
+// elements set all fields in their declaration order.
+func (ast *CompositeLit) evalStruct(env *Env, ctx *Codegen,
+	gen *ssa.Generator, typeInfo types.Info) (ssa.Value, bool, error) {
+
+	var keyed int
+	for _, el := range ast.Value {
+		if el.Key != nil {
+			keyed++
+		}
+	}
+	if keyed > 0 && keyed != len(ast.Value) {
+		return ssa.Undefined, false, ctx.Errorf(ast,
+			"mixture of field:value and value elements in struct literal")
+	}
+	if keyed == 0 && len(ast.Value) > 0 &&
+		len(ast.Value) != len(typeInfo.Struct) {
+		return ssa.Undefined, false, ctx.Errorf(ast,
+			"wrong number of values in struct literal of type %s: "+
+				"got %d, expected %d", typeInfo, len(ast.Value),
+			len(typeInfo.Struct))
+	}
+
+	values := make([]interface{}, len(typeInfo.Struct))
+	for idx, el := range ast.Value {
+		field := idx
+		if el.Key != nil {
+			ref, ok := el.Key.(*VariableRef)
+			if !ok || len(ref.Name.Package) > 0 {
+				return ssa.Undefined, false, ctx.Errorf(el.Key,
+					"invalid field name %s in struct literal", el.Key)
+			}
+			field = -1
+			for i, f := range typeInfo.Struct {
+				if f.Name == ref.Name.Name {
+					field = i
+					break
+				}
 			}
-			// XXX check that v is assignment compatible with typeInfo.Struct[i]
-			values = append(values, v)
+			if field < 0 {
+				return ssa.Undefined, false, ctx.Errorf(el.Key,
+					"unknown field %s in struct literal of type %s",
+					ref.Name.Name, typeInfo)
+			}
+			if values[field] != nil {
+				return ssa.Undefined, false, ctx.Errorf(el.Key,
+					"duplicate field name %s in struct literal",
+					ref.Name.Name)
+			}
+		}
+		v, ok, err := el.Element.Eval(env, ctx, gen)
+		if err != nil || !ok {
+			return ssa.Undefined, ok, err
+		}
+		values[field] = v
+	}
+	for idx, f := range typeInfo.Struct {
+		if values[idx] != nil {
+			continue
+		}
+		init, err := initValue(f.Type)
+		if err != nil {
+			return ssa.Undefined, false, ctx.Error(ast, err.Error())
 		}
-		return gen.Constant(values, typeInfo), true, nil
+		values[idx] = init
+	}
+	return gen.Constant(values, typeInfo), true, nil
+}
 
-	case types.TArray:
-		// Check if all elements are constants.
-		var values []interface{}
-		for _, el := range ast.Value {
-			// XXX check if el.Key is specified
-
-			v, ok, err := el.Element.Eval(env, ctx, gen)
-			if err != nil || !ok {
-				return ssa.Undefined, ok, err
+// evalArray evaluates the constant array literal. The unkeyed
+// elements follow the previous element and the keyed elements are set
+// at their constant indices. The elements missing from the literal
+// have the zero value of the element type. If the literal type
+// specifies the array length, the literal [N]T{v} with a single
+// unkeyed element sets all elements to v.
+func (ast *CompositeLit) evalArray(env *Env, ctx *Codegen,
+	gen *ssa.Generator, typeInfo types.Info) (ssa.Value, bool, error) {
+
+	sized := typeInfo.Concrete()
+
+	var values []interface{}
+	var index types.Size
+	for _, el := range ast.Value {
+		if el.Key != nil {
+			key, ok, err := el.Key.Eval(env, ctx, gen)
+			if err != nil {
+				return ssa.Undefined, false, err
+			}
+			if !ok {
+				return ssa.Undefined, false, ctx.Errorf(el.Key,
+					"array index %s must be constant", el.Key)
+			}
+			index, err = key.ConstInt()
+			if err != nil {
+				return ssa.Undefined, false, ctx.Errorf(el.Key,
+					"invalid array index %s: %s", el.Key, err)
+			}
+			if index < 0 {
+				return ssa.Undefined, false, ctx.Errorf(el.Key,
+					"invalid array index %s (%d)", el.Key, index)
+			}
+		}
+		if sized && index >= typeInfo.ArraySize {
+			return ssa.Undefined, false, ctx.Errorf(el.Element,
+				"array index %d out of bounds [0:%d]",
+				index, typeInfo.ArraySize)
+		}
+
+		v, ok, err := el.Element.Eval(env, ctx, gen)
+		if err != nil || !ok {
+			return ssa.Undefined, ok, err
+		}
+		// XXX check that v is assignment compatible with array.
+		for types.Size(len(values)) <= index {
+			values = append(values, nil)
+		}
+		if values[index] != nil {
+			return ssa.Undefined, false, ctx.Errorf(el.Element,
+				"duplicate index %d in array literal", index)
+		}
+		values[index] = v
+		index++
+	}
+
+	if sized {
+		if len(ast.Value) == 1 && ast.Value[0].Key == nil {
+			// Fill all elements with the value.
+			for types.Size(len(values)) < typeInfo.ArraySize {
+				values = append(values, values[0])
 			}
-			// XXX check that v is assignment compatible with array.
-			values = append(values, v)
 		}
+	} else {
 		typeInfo.ArraySize = types.Size(len(values))
 		typeInfo.Bits = typeInfo.ArraySize * typeInfo.ElementType.Bits
 		typeInfo.MinBits = typeInfo.Bits
-		return gen.Constant(values, typeInfo), true, nil
+	}
 
-	default:
-		fmt.Printf("CompositeLit.Eval: not implemented yet: %v, Value: %v\n",
-			typeInfo, ast.Value)
-		return ssa.Undefined, false, nil
+	var zero interface{}
+	for i := types.Size(0); i < typeInfo.ArraySize; i++ {
+		if i < types.Size(len(values)) && values[i] != nil {
+			continue
+		}
+		if zero == nil {
+			init, err := initValue(*typeInfo.ElementType)
+			if err != nil {
+				return ssa.Undefined, false, ctx.Error(ast, err.Error())
+			}
+			zero = gen.Constant(init, *typeInfo.ElementType)
+		}
+		if i < types.Size(len(values)) {
+			values[i] = zero
+		} else {
+			values = append(values, zero)
+		}
 	}
+	return gen.Constant(values, typeInfo), true, nil
 }
 
 // Eval implements the compiler.ast.AST.Eval for the builtin function make.
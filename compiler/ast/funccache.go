@@ -0,0 +1,330 @@
+//
+// funccache.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ast
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/markkurossi/mpc/compiler/ssa"
+	"github.com/markkurossi/mpc/compiler/utils"
+	"github.com/markkurossi/mpc/types"
+)
+
+// FuncCache caches the SSA code of function instances between
+// compilations. Functions are instantiated for each call so the
+// instances are keyed by the digest of the function's source code
+// and by the types and constant values of the call arguments. A
+// cached instance is reused if the functions it called and the
+// package-level declarations of all packages are unchanged.
+//
+// Only instances whose code depends solely on their arguments are
+// cached. The instances that access package variables, take pointer
+// arguments, or use native circuits are always lowered. The warnings
+// of the reused instances are reported again but the unused variables
+// are checked only when the instance is lowered.
+type FuncCache struct {
+	Stats   FuncCacheStats
+	entries map[string]*funcCacheEntry
+	used    map[string]bool
+	digests map[string]bool
+	decls   string
+}
+
+// FuncCacheStats provides statistics about the function cache.
+type FuncCacheStats struct {
+	Hits   int
+	Misses int
+}
+
+func (stats FuncCacheStats) String() string {
+	return fmt.Sprintf("%d hits, %d misses", stats.Hits, stats.Misses)
+}
+
+// NewFuncCache creates a new function cache.
+func NewFuncCache() *FuncCache {
+	return &FuncCache{
+		entries: make(map[string]*funcCacheEntry),
+	}
+}
+
+// funcCacheEntry holds the SSA code of a function instance. The args
+// are the argument values of the call and params the parameter
+// values of the instance.
+type funcCacheEntry struct {
+	decls    string
+	deps     []string
+	args     []ssa.Value
+	params   []ssa.Value
+	steps    []ssa.Instr
+	returns  []ssa.Value
+	warnings []cachedWarning
+}
+
+type cachedWarning struct {
+	loc utils.Point
+	msg string
+}
+
+// funcRecord records the information about a function instance
+// during its lowering.
+type funcRecord struct {
+	key      string
+	impure   bool
+	deps     map[string]bool
+	warnings []cachedWarning
+}
+
+// begin starts a new compilation of the argument packages.
+func (cache *FuncCache) begin(packages map[string]*Package) {
+	cache.used = make(map[string]bool)
+	cache.digests = make(map[string]bool)
+
+	var pkgs []*Package
+	seen := make(map[*Package]bool)
+	for _, pkg := range packages {
+		if seen[pkg] {
+			// Imported with an alias.
+			continue
+		}
+		seen[pkg] = true
+		pkgs = append(pkgs, pkg)
+
+		for _, f := range pkg.Functions {
+			cache.digests[f.Digest] = true
+		}
+		for _, t := range pkg.Types {
+			for _, m := range t.Methods {
+				cache.digests[m.Digest] = true
+			}
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].Name < pkgs[j].Name
+	})
+	h := sha256.New()
+	for _, pkg := range pkgs {
+		fmt.Fprintf(h, "%s %s\n", pkg.Name, pkg.Digest)
+	}
+	cache.decls = fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// end ends the compilation. The entries that were not used by the
+// compilation are removed from the cache.
+func (cache *FuncCache) end() {
+	for key := range cache.entries {
+		if !cache.used[key] {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// lookup returns the valid cache entry for the key.
+func (cache *FuncCache) lookup(key string) *funcCacheEntry {
+	entry, ok := cache.entries[key]
+	if !ok || entry.decls != cache.decls {
+		return nil
+	}
+	for _, dep := range entry.deps {
+		if !cache.digests[dep] {
+			return nil
+		}
+	}
+	return entry
+}
+
+// cacheKey returns the cache key for the instance of the function
+// called with the argument values. The function returns false if the
+// instance can't be cached.
+func (ctx *Codegen) cacheKey(called *Func, args []ssa.Value) (string, bool) {
+	if ctx.Cache == nil || ctx.Params.DebugNames || len(called.Digest) == 0 {
+		return "", false
+	}
+	var sb strings.Builder
+	sb.WriteString(called.Digest)
+	for idx, arg := range args {
+		if arg.PtrInfo != nil {
+			return "", false
+		}
+		sb.WriteRune(';')
+		writeTypeKey(&sb, arg.Type)
+		if arg.Const {
+			fmt.Fprintf(&sb, "=%v", arg.ConstValue)
+			continue
+		}
+		// The instance code refers to the argument values so the
+		// same value passed in many arguments must match.
+		for i := 0; i < idx; i++ {
+			if arg.Equal(&args[i]) {
+				fmt.Fprintf(&sb, "=#%d", i)
+				break
+			}
+		}
+	}
+	return sb.String(), true
+}
+
+func writeTypeKey(sb *strings.Builder, t types.Info) {
+	fmt.Fprintf(sb, "%d/%d/%v/%d/%d/%d/%d", t.ID, t.Type, t.IsConcrete,
+		t.Bits, t.MinBits, t.ArraySize, t.Offset)
+	if t.ElementType != nil {
+		sb.WriteRune('[')
+		writeTypeKey(sb, *t.ElementType)
+		sb.WriteRune(']')
+	}
+	if len(t.Struct) > 0 {
+		sb.WriteRune('{')
+		for _, f := range t.Struct {
+			fmt.Fprintf(sb, "%s:", f.Name)
+			writeTypeKey(sb, f.Type)
+			sb.WriteRune(',')
+		}
+		sb.WriteRune('}')
+	}
+}
+
+// cacheDepend records that the lowered instances depend on the
+// function with the digest and on the dependencies deps of its
+// instance.
+func (ctx *Codegen) cacheDepend(digest string, deps []string) {
+	for _, rec := range ctx.records {
+		rec.deps[digest] = true
+		for _, dep := range deps {
+			rec.deps[dep] = true
+		}
+	}
+}
+
+// uncacheable marks the lowered instances uncacheable.
+func (ctx *Codegen) uncacheable() {
+	for _, rec := range ctx.records {
+		rec.impure = true
+	}
+}
+
+// globalAccess marks the lowered instances uncacheable if the name is
+// a variable of the package pkg.
+func (ctx *Codegen) globalAccess(pkg *Package, name string) {
+	if len(ctx.records) == 0 {
+		return
+	}
+	for _, def := range pkg.Constants {
+		if def.Name == name {
+			return
+		}
+	}
+	for _, def := range pkg.Types {
+		if def.TypeName == name {
+			return
+		}
+	}
+	ctx.uncacheable()
+}
+
+// beginInstance starts recording the lowering of the instance key.
+func (ctx *Codegen) beginInstance(key string) *funcRecord {
+	rec := &funcRecord{
+		key:  key,
+		deps: make(map[string]bool),
+	}
+	ctx.records = append(ctx.records, rec)
+	ctx.Cache.Stats.Misses++
+	return rec
+}
+
+// endInstance ends the recording of the instance and stores it in the
+// cache if the instance depends only on its arguments.
+func (ctx *Codegen) endInstance(rec *funcRecord, args, params,
+	returns []ssa.Value) {
+
+	ctx.records = ctx.records[:len(ctx.records)-1]
+	if rec.impure {
+		return
+	}
+
+	var steps []ssa.Instr
+	for _, step := range ctx.Start().Serialize() {
+		if step.Instr.Circ != nil {
+			return
+		}
+		steps = append(steps, step.Instr)
+	}
+
+	// The return values are the inputs of a pseudo instruction
+	// following the instance code.
+	code := append(steps[:len(steps):len(steps)], ssa.Instr{
+		In: returns,
+	})
+	for _, in := range ssa.Inputs(code) {
+		var found bool
+		for _, arg := range append(args[:len(args):len(args)], params...) {
+			if in.Equal(&arg) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+
+	var deps []string
+	for dep := range rec.deps {
+		deps = append(deps, dep)
+	}
+	ctx.Cache.entries[rec.key] = &funcCacheEntry{
+		decls:    ctx.Cache.decls,
+		deps:     deps,
+		args:     args,
+		params:   params,
+		steps:    steps,
+		returns:  returns,
+		warnings: rec.warnings,
+	}
+	ctx.Cache.used[rec.key] = true
+}
+
+// reuseInstance instantiates the called function from the cache
+// entry. The args are the argument values of the call and params the
+// parameter values of the instance.
+func (ctx *Codegen) reuseInstance(key string, entry *funcCacheEntry,
+	called *Func, args, params []ssa.Value, gen *ssa.Generator) []ssa.Value {
+
+	ctx.Cache.Stats.Hits++
+	ctx.Cache.used[key] = true
+	ctx.cacheDepend(called.Digest, entry.deps)
+
+	ctx.Start().Name = fmt.Sprintf("%s#%d", called.Name, called.NumInstances)
+	ctx.Return().Name = fmt.Sprintf("%s.ret#%d", called.Name,
+		called.NumInstances)
+	called.NumInstances++
+
+	imp := gen.NewImporter()
+	for idx, arg := range entry.args {
+		if !arg.Const {
+			imp.Map(arg, args[idx])
+		}
+		imp.Map(entry.params[idx], params[idx])
+	}
+	for _, instr := range imp.Instrs(entry.steps) {
+		ctx.Start().AddInstr(instr)
+	}
+	ctx.Start().SetNext(ctx.Return())
+
+	var returns []ssa.Value
+	for _, ret := range entry.returns {
+		returns = append(returns, imp.Value(ret))
+	}
+	for _, w := range entry.warnings {
+		ctx.Warningf(w.loc, "%s", w.msg)
+	}
+	return returns
+}
@@ -29,6 +29,7 @@ import (
 //   - baseInfo points to the containing variable
 //   - baseValue is the Struct
 //   - structField defines the structure field
+//   - variant is the union variant tag or 0 for struct fields
 //   - valueType is the type of the Struct.Field
 //   - value is nil
 //
@@ -55,6 +56,7 @@ type LRValue struct {
 	valueType   types.Info
 	value       ssa.Value
 	structField *types.StructField
+	variant     int
 }
 
 func (lrv LRValue) String() string {
@@ -85,8 +87,16 @@ func (lrv LRValue) Set(rv ssa.Value) error {
 		return fmt.Errorf("cannot assing %v to variable of type %v",
 			rv.Type, lrv.valueType)
 	}
+	if lrv.baseInfo.Bindings.ReadOnly() {
+		return fmt.Errorf("cannot assign to package variable %s",
+			lrv.baseInfo.Name)
+	}
 	lValue := lrv.LValue()
 
+	if lrv.variant > 0 {
+		return lrv.setVariant(rv, lValue)
+	}
+
 	if lrv.structField != nil {
 		fromConst := lrv.gen.Constant(int64(lrv.structField.Type.Offset),
 			types.Undefined)
@@ -109,14 +119,55 @@ func (lrv LRValue) Set(rv ssa.Value) error {
 	return lrv.block.Bindings.Set(lValue, &rv)
 }
 
+// setVariant sets the union variant to rv. The variant value is
+// stored at the start of the payload, the rest of the payload is
+// cleared, and the union tag is set to the variant.
+func (lrv LRValue) setVariant(rv, lValue ssa.Value) error {
+	unionType := lrv.baseValue.Type
+	payloadType := unionType.Struct[1].Type
+
+	// Clear payload.
+	zeroType := payloadType
+	zeroType.Offset = 0
+	zero := lrv.gen.Constant(int64(0), zeroType)
+	lrv.gen.AddConstant(zero)
+	cleared := lrv.gen.AnonVal(unionType)
+	lrv.amov(zero, lrv.baseValue, payloadType.Offset, payloadType.Bits,
+		cleared)
+
+	// Set value.
+	value := lrv.gen.AnonVal(unionType)
+	lrv.amov(rv, cleared, lrv.valueType.Offset, lrv.valueType.Bits, value)
+
+	// Set tag.
+	tag := lrv.gen.Constant(int64(lrv.variant), types.Byte)
+	lrv.gen.AddConstant(tag)
+	lrv.amov(tag, value, 0, types.ByteBits, lValue)
+
+	return lrv.baseInfo.Bindings.Set(lValue, nil)
+}
+
+// amov adds an instruction that sets the bits bits of base, starting
+// from the offset, to v.
+func (lrv LRValue) amov(v, base ssa.Value, offset, bits types.Size,
+	o ssa.Value) {
+	fromConst := lrv.gen.Constant(int64(offset), types.Undefined)
+	toConst := lrv.gen.Constant(int64(offset+bits), types.Undefined)
+	lrv.block.AddInstr(ssa.NewAmovInstr(v, base, fromConst, toConst, o))
+}
+
 // LValue returns the l-value of the LRValue.
 func (lrv *LRValue) LValue() ssa.Value {
 	return lrv.gen.NewVal(lrv.baseInfo.Name, lrv.baseInfo.ContainerType,
 		lrv.baseInfo.Scope)
 }
 
-// RValue returns the r-value of the LRValue.
-func (lrv *LRValue) RValue() ssa.Value {
+// RValue returns the r-value of the LRValue. The r-value of an
+// inactive union variant is the zero value of the variant type.
+func (lrv *LRValue) RValue() (ssa.Value, error) {
+	if lrv.value.Type.Undefined() && lrv.variant > 0 {
+		return lrv.variantRValue()
+	}
 	if lrv.value.Type.Undefined() && lrv.structField != nil {
 		fieldType := lrv.valueType
 		fieldType.Offset = 0
@@ -133,7 +184,55 @@ func (lrv *LRValue) RValue() ssa.Value {
 				toConst, lrv.value))
 		}
 	}
-	return lrv.value
+	return lrv.value, nil
+}
+
+// variantRValue returns the value of the union variant if the
+// variant is active and the zero value of the variant type
+// otherwise.
+func (lrv *LRValue) variantRValue() (ssa.Value, error) {
+	variantType := lrv.valueType
+	variantType.Offset = 0
+
+	init, err := initValue(variantType)
+	if err != nil {
+		return ssa.Undefined, err
+	}
+	zero := lrv.gen.Constant(init, variantType)
+	lrv.gen.AddConstant(zero)
+	if variantType.Bits == 0 {
+		lrv.value = zero
+		return lrv.value, nil
+	}
+
+	raw := lrv.gen.AnonVal(variantType)
+	lrv.slice(lrv.baseValue, lrv.valueType.Offset, variantType.Bits, raw)
+
+	tag := lrv.gen.AnonVal(types.Byte)
+	lrv.slice(lrv.baseValue, 0, types.ByteBits, tag)
+
+	tagConst := lrv.gen.Constant(int64(lrv.variant), types.Byte)
+	lrv.gen.AddConstant(tagConst)
+
+	active := lrv.gen.AnonVal(types.Bool)
+	instr, err := ssa.NewEqInstr(tag, tagConst, active)
+	if err != nil {
+		return ssa.Undefined, err
+	}
+	lrv.block.AddInstr(instr)
+
+	lrv.value = lrv.gen.AnonVal(variantType)
+	lrv.block.AddInstr(ssa.NewPhiInstr(active, raw, zero, lrv.value))
+
+	return lrv.value, nil
+}
+
+// slice adds an instruction that sets o to the bits bits of v,
+// starting from the offset.
+func (lrv *LRValue) slice(v ssa.Value, offset, bits types.Size, o ssa.Value) {
+	fromConst := lrv.gen.Constant(int64(offset), types.Undefined)
+	toConst := lrv.gen.Constant(int64(offset+bits), types.Undefined)
+	lrv.block.AddInstr(ssa.NewSliceInstr(v, fromConst, toConst, o))
 }
 
 // ValueType returns the value type of the LRValue.
@@ -166,11 +265,31 @@ func (lrv *LRValue) ConstValue() (ssa.Value, bool, error) {
 	}
 }
 
-// LookupVar resolves the named variable from the context.
+// LookupVar resolves the named variable from the context and marks
+// its value read.
 func (ctx *Codegen) LookupVar(block *ssa.Block, gen *ssa.Generator,
 	bindings *ssa.Bindings, ref *VariableRef) (
 	lrv *LRValue, cf, df bool, err error) {
 
+	lrv, cf, df, err = ctx.lookupVar(block, gen, bindings, ref)
+	if err != nil || lrv == nil {
+		return
+	}
+	if !lrv.baseValue.Type.Undefined() {
+		ctx.readVar(lrv.baseInfo.Name, lrv.baseValue)
+	}
+	if !lrv.value.Type.Undefined() {
+		ctx.readVar(ref.Name.Name, lrv.value)
+	}
+	return
+}
+
+// lookupVar resolves the named variable from the context without
+// marking it read.
+func (ctx *Codegen) lookupVar(block *ssa.Block, gen *ssa.Generator,
+	bindings *ssa.Bindings, ref *VariableRef) (
+	lrv *LRValue, cf, df bool, err error) {
+
 	lrv = &LRValue{
 		ctx:   ctx,
 		ast:   ref,
@@ -192,6 +311,7 @@ func (ctx *Codegen) LookupVar(block *ssa.Block, gen *ssa.Generator,
 			b, ok = ctx.Package.Bindings.Get(ref.Name.Package)
 			if ok {
 				env = ctx.Package.Bindings
+				ctx.globalAccess(ctx.Package, ref.Name.Package)
 			}
 		}
 		if ok {
@@ -232,6 +352,15 @@ func (ctx *Codegen) LookupVar(block *ssa.Block, gen *ssa.Generator,
 					break
 				}
 			}
+			if lrv.structField == nil {
+				for idx, f := range lrv.baseValue.Type.Variants {
+					if f.Name == ref.Name.Name {
+						lrv.structField = &f
+						lrv.variant = idx + 1
+						break
+					}
+				}
+			}
 			if lrv.structField == nil {
 				return nil, false, false, fmt.Errorf(
 					"%s undefined (type %s has no field or method %s)",
@@ -246,7 +375,7 @@ func (ctx *Codegen) LookupVar(block *ssa.Block, gen *ssa.Generator,
 	// Explicit package references.
 	var pkg *Package
 	if len(ref.Name.Package) > 0 {
-		pkg, ok = ctx.Packages[ref.Name.Package]
+		pkg, ok = ctx.lookupPackage(ref.Name)
 		if !ok {
 			return nil, false, false, fmt.Errorf("package '%s' not found",
 				ref.Name.Package)
@@ -257,6 +386,7 @@ func (ctx *Codegen) LookupVar(block *ssa.Block, gen *ssa.Generator,
 			return nil, false, false, fmt.Errorf("undefined variable '%s'",
 				ref.Name)
 		}
+		ctx.globalAccess(pkg, ref.Name.Name)
 	} else {
 		// Check block bindings.
 		env = bindings
@@ -264,13 +394,16 @@ func (ctx *Codegen) LookupVar(block *ssa.Block, gen *ssa.Generator,
 		if !ok {
 			// Check names in the name's package.
 			if len(ref.Name.Defined) > 0 {
-				pkg, ok = ctx.Packages[ref.Name.Defined]
+				pkg, ok = ctx.lookupPackage(ref.Name)
 				if !ok {
 					return nil, false, false,
 						fmt.Errorf("package '%s' not found", ref.Name.Defined)
 				}
 				env = pkg.Bindings
 				b, ok = env.Get(ref.Name.Name)
+				if ok {
+					ctx.globalAccess(pkg, ref.Name.Name)
+				}
 			}
 		}
 	}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -9,6 +9,9 @@ package ast
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler/ssa"
@@ -18,7 +21,11 @@ import (
 
 // Package implements a MPCL package.
 type Package struct {
-	Name        string
+	Name string
+	// Path is the import path of the package. The compiler keeps
+	// the packages by their import paths and the Defined package of
+	// the identifiers is the path of their package.
+	Path        string
 	Source      string
 	Annotations Annotations
 	Initialized bool
@@ -28,12 +35,16 @@ type Package struct {
 	Constants   []*ConstantDef
 	Variables   []*VariableDef
 	Functions   map[string]*Func
+	// Digest identifies the source code of the package-level
+	// declarations.
+	Digest string
 }
 
 // NewPackage creates a new package.
 func NewPackage(name, source string, annotations Annotations) *Package {
 	return &Package{
 		Name:        name,
+		Path:        name,
 		Source:      source,
 		Annotations: annotations,
 		Imports:     make(map[string]string),
@@ -42,6 +53,13 @@ func NewPackage(name, source string, annotations Annotations) *Package {
 	}
 }
 
+// Reset resets the package's initialization state so that the
+// package can be used in a new compilation.
+func (pkg *Package) Reset() {
+	pkg.Initialized = false
+	pkg.Bindings = new(ssa.Bindings)
+}
+
 // Compile compiles the package.
 func (pkg *Package) Compile(ctx *Codegen) (*ssa.Program, Annotations, error) {
 
@@ -51,9 +69,16 @@ func (pkg *Package) Compile(ctx *Codegen) (*ssa.Program, Annotations, error) {
 			Source: pkg.Source,
 		}, err.Error())
 	}
+	if err := pkg.Precheck(ctx); err != nil {
+		return nil, nil, err
+	}
 
 	gen := ssa.NewGenerator(ctx.Params)
 
+	if ctx.Cache != nil {
+		ctx.Cache.begin(ctx.Packages)
+	}
+
 	// Init is the program start point.
 	init := gen.Block()
 
@@ -63,8 +88,19 @@ func (pkg *Package) Compile(ctx *Codegen) (*ssa.Program, Annotations, error) {
 		return nil, nil, err
 	}
 
-	// Main block derives package's bindings from block with NextBlock().
+	// Main block sees the package variables through the package
+	// bindings like all other functions so it can't assign them.
 	ctx.PushCompilation(gen.NextBlock(block), gen.Block(), nil, main)
+	ctx.Start().Bindings = new(ssa.Bindings)
+
+	public, err := publicArgs(main)
+	if err != nil {
+		return nil, nil, ctx.Error(main, err.Error())
+	}
+	parties, err := partyArgs(main)
+	if err != nil {
+		return nil, nil, ctx.Error(main, err.Error())
+	}
 
 	// Arguments.
 	var inputs circuit.IO
@@ -97,8 +133,13 @@ func (pkg *Package) Compile(ctx *Codegen) (*ssa.Program, Annotations, error) {
 		ctx.Start().Bindings.Define(a, nil)
 
 		input := circuit.IOArg{
-			Name: arg.Name,
-			Type: a.Type,
+			Name:   arg.Name,
+			Type:   a.Type,
+			Public: public[arg.Name],
+		}
+		if party, ok := parties[arg.Name]; ok {
+			input.Party = party
+			input.HasParty = true
 		}
 		if typeInfo.Type == types.TStruct {
 			input.Compound = flattenStruct(typeInfo)
@@ -123,20 +164,23 @@ func (pkg *Package) Compile(ctx *Codegen) (*ssa.Program, Annotations, error) {
 		if err != nil {
 			return nil, nil, ctx.Errorf(rt, "invalid return type: %s", err)
 		}
+		if rt.Type == nil {
+			typeInfo = returnVars[idx].Type
+		}
 		// Instantiate result values for template functions.
 		if !typeInfo.Concrete() && !typeInfo.Instantiate(returnVars[idx].Type) {
 			return nil, nil, ctx.Errorf(main,
-				"invalid value %v for return value %d of %s",
-				returnVars[idx].Type, idx, main)
+				"cannot use return value %d of %s (type %v) as type %s",
+				idx, main, returnVars[idx].Type, typeInfo)
 		}
 		// The native() returns undefined values.
 		if returnVars[idx].Type.Undefined() {
 			returnVars[idx].Type.Type = typeInfo.Type
 		}
 		if !ssa.LValueFor(typeInfo, returnVars[idx]) {
-			return nil, nil,
-				ctx.Errorf(main, "invalid value %v for return value %d of %s",
-					returnVars[idx].Type, idx, main)
+			return nil, nil, ctx.Errorf(main,
+				"cannot use return value %d of %s (type %v) as type %s",
+				idx, main, returnVars[idx].Type, typeInfo)
 		}
 
 		v := returnVars[idx]
@@ -145,14 +189,27 @@ func (pkg *Package) Compile(ctx *Codegen) (*ssa.Program, Annotations, error) {
 			Type: v.Type,
 		})
 	}
+	if len(returnVars) > len(main.Return) {
+		// The abort status follows the return values.
+		outputs = append(outputs, circuit.IOArg{
+			Name: circuit.AbortOutput,
+			Type: returnVars[len(returnVars)-1].Type,
+		})
+	}
 
 	steps := init.Serialize()
+	ctx.checkUnused(steps)
+
+	if ctx.Cache != nil {
+		ctx.Cache.end()
+	}
 
 	program, err := ssa.NewProgram(ctx.Params, inputs, outputs, gen.Constants(),
 		steps)
 	if err != nil {
 		return nil, nil, err
 	}
+	program.Fold(gen)
 	if false { // XXX Peephole liveness analysis is broken.
 		err = program.Peephole()
 		if err != nil {
@@ -171,6 +228,16 @@ func (pkg *Package) Compile(ctx *Codegen) (*ssa.Program, Annotations, error) {
 	return program, main.Annotations, nil
 }
 
+// abortStatus tests if the program uses the result package. The
+// abort status of the computation is then kept in the implicit
+// circuit.AbortOutput variable of the function bindings. The status
+// is passed to the called functions and returned from them like the
+// function arguments and return values.
+func (ctx *Codegen) abortStatus() bool {
+	_, ok := ctx.Packages["result"]
+	return ok
+}
+
 // Main returns package's main function.
 func (pkg *Package) Main() (*Func, error) {
 	main, ok := pkg.Functions["main"]
@@ -180,6 +247,92 @@ func (pkg *Package) Main() (*Func, error) {
 	return main, nil
 }
 
+// publicArgs returns the main function arguments that are declared
+// public with the @public annotation:
+//
+//	// @public b
+//	func main(a, b int32) int32 {
+//
+// The values of the public arguments are known to both parties.
+func publicArgs(main *Func) (map[string]bool, error) {
+	result := make(map[string]bool)
+	for _, annotation := range main.Annotations {
+		fields := strings.Fields(annotation)
+		if len(fields) == 0 || fields[0] != "@public" {
+			continue
+		}
+		for _, name := range fields[1:] {
+			var found bool
+			for _, arg := range main.Args {
+				if arg.Name == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("@public: %s is not an argument of %s",
+					name, main.Name)
+			}
+			result[name] = true
+		}
+	}
+	return result, nil
+}
+
+// partyArgs returns the parties of the main function arguments that
+// are declared with the @party annotation:
+//
+//	// @party 0 a b
+//	// @party 1 c
+//	func main(a, b, c int32) int32 {
+//
+// The party numbers match the player numbers of the multi-party
+// computation. If any argument has a party, all arguments must have
+// one.
+func partyArgs(main *Func) (map[string]int, error) {
+	result := make(map[string]int)
+	for _, annotation := range main.Annotations {
+		fields := strings.Fields(annotation)
+		if len(fields) == 0 || fields[0] != "@party" {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("@party: expected party and arguments")
+		}
+		party, err := strconv.Atoi(fields[1])
+		if err != nil || party < 0 {
+			return nil, fmt.Errorf("@party: invalid party %s", fields[1])
+		}
+		for _, name := range fields[2:] {
+			var found bool
+			for _, arg := range main.Args {
+				if arg.Name == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("@party: %s is not an argument of %s",
+					name, main.Name)
+			}
+			if _, ok := result[name]; ok {
+				return nil, fmt.Errorf(
+					"@party: argument %s has multiple parties", name)
+			}
+			result[name] = party
+		}
+	}
+	if len(result) > 0 {
+		for _, arg := range main.Args {
+			if _, ok := result[arg.Name]; !ok {
+				return nil, fmt.Errorf("@party: argument %s has no party",
+					arg.Name)
+			}
+		}
+	}
+	return result, nil
+}
+
 func flattenStruct(t types.Info) circuit.IO {
 	var result circuit.IO
 	if t.Type != types.TStruct {
@@ -213,11 +366,18 @@ func (pkg *Package) Init(packages map[string]*Package, block *ssa.Block,
 		fmt.Printf("Initializing %s\n", pkg.Name)
 	}
 
-	// Imported packages.
-	for alias, name := range pkg.Imports {
-		p, ok := packages[alias]
+	// Imported packages. The packages are initialized in a stable
+	// order so that the type IDs do not change between compilations.
+	var aliases []string
+	for alias := range pkg.Imports {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		p, ok := packages[pkg.Imports[alias]]
 		if !ok {
-			return nil, fmt.Errorf("imported and not used: \"%s\"", name)
+			return nil, fmt.Errorf("imported and not used: \"%s\"",
+				pkg.Imports[alias])
 		}
 		var err error
 		block, err = p.Init(packages, block, ctx, gen)
@@ -259,7 +419,10 @@ func (pkg *Package) Init(packages map[string]*Package, block *ssa.Block,
 		}
 	}
 
-	pkg.Bindings = block.Bindings
+	// The package variables are initialized at compile time and
+	// they are read-only after the initialization.
+	pkg.Bindings = block.Bindings.Clone()
+	pkg.Bindings.SetReadOnly()
 
 	return block, nil
 }
@@ -350,6 +513,62 @@ func (pkg *Package) defineType(def *TypeInfo, ctx *Codegen,
 			Struct:     fields,
 		}
 
+	case TypeUnion:
+		// Tagged union: the Tag field holds the active variant as
+		// its index starting from 1, and the Payload field holds the
+		// value of the active variant. The zero Tag marks an empty
+		// union.
+		if len(def.StructFields) > UnionMaxVariants {
+			return ctx.Errorf(def, "union %s has too many variants: %d > %d",
+				def.TypeName, len(def.StructFields), UnionMaxVariants)
+		}
+		var variants []types.StructField
+		var payload types.Size
+		for _, field := range def.StructFields {
+			if field.Name == UnionTag || field.Name == UnionPayload {
+				return ctx.Errorf(field, "invalid union variant name: %s",
+					field.Name)
+			}
+			info, err := field.Type.Resolve(env, ctx, gen)
+			if err != nil {
+				return err
+			}
+			if !info.Concrete() {
+				return ctx.Errorf(field, "unspecified size for type %v", info)
+			}
+			info.Offset = types.ByteBits
+			variants = append(variants, types.StructField{
+				Name: field.Name,
+				Type: info,
+			})
+			if info.Bits > payload {
+				payload = info.Bits
+			}
+		}
+		info = types.Info{
+			Type:       types.TStruct,
+			IsConcrete: true,
+			Bits:       types.ByteBits + payload,
+			MinBits:    types.ByteBits + payload,
+			Struct: []types.StructField{
+				{
+					Name: UnionTag,
+					Type: types.Byte,
+				},
+				{
+					Name: UnionPayload,
+					Type: types.Info{
+						Type:       types.TUint,
+						IsConcrete: true,
+						Bits:       payload,
+						MinBits:    payload,
+						Offset:     types.ByteBits,
+					},
+				},
+			},
+			Variants: variants,
+		}
+
 	case TypeArray:
 		info, err = def.Resolve(env, ctx, gen)
 		if err != nil {
@@ -0,0 +1,654 @@
+//
+// precheck.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ast
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/markkurossi/mpc/compiler/mpa"
+)
+
+// kind classifies the types of the expressions for the precheck. The
+// precheck resolves the types only to their kinds without
+// instantiating them; the types are resolved and checked by the SSA
+// generation.
+type kind int
+
+const (
+	kindUnknown kind = iota
+	kindBool
+	kindInt
+	kindString
+)
+
+// checkType describes the type of an expression. The Name is the
+// type name for the error messages.
+type checkType struct {
+	Kind kind
+	Name string
+}
+
+// Known tests if the type kind is known.
+func (t checkType) Known() bool {
+	return t.Kind != kindUnknown
+}
+
+func (t checkType) String() string {
+	return t.Name
+}
+
+var (
+	checkUnknown       = checkType{}
+	checkBool          = checkType{Kind: kindBool, Name: "bool"}
+	checkUntypedBool   = checkType{Kind: kindBool, Name: "untyped bool"}
+	checkUntypedInt    = checkType{Kind: kindInt, Name: "untyped int"}
+	checkUntypedString = checkType{Kind: kindString, Name: "untyped string"}
+)
+
+// basicKind returns the kind of the predeclared type name.
+func basicKind(name string) kind {
+	switch name {
+	case "bool":
+		return kindBool
+	case "string":
+		return kindString
+	case "byte", "rune", "int", "uint":
+		return kindInt
+	}
+	for _, prefix := range []string{"int", "uint"} {
+		if strings.HasPrefix(name, prefix) {
+			_, err := strconv.ParseUint(name[len(prefix):], 10, 32)
+			if err == nil {
+				return kindInt
+			}
+		}
+	}
+	return kindUnknown
+}
+
+// checker implements the precheck of a package.
+type checker struct {
+	ctx    *Codegen
+	pkg    *Package
+	f      *Func
+	types  map[string]bool
+	global map[string]checkType
+	scopes []map[string]checkType
+	errors []error
+}
+
+// Precheck runs the diagnostics of the package's functions before
+// their SSA generation. The precheck is not a type checker: it
+// classifies the expressions by their kinds, boolean, integer, and
+// string, and reports the kind mismatches in the assignments, the
+// function arguments and return values, and the operator operands,
+// and the wrong number of the function arguments and return values.
+// The types of the other expressions, for example, the arrays,
+// structs, pointers, and the package references, are unknown to the
+// precheck and it does not annotate the AST. The SSA generation
+// resolves the types and reports the remaining type errors. The
+// precheck logs all errors it finds and returns the first one.
+func (pkg *Package) Precheck(ctx *Codegen) error {
+	c := &checker{
+		ctx:    ctx,
+		pkg:    pkg,
+		types:  make(map[string]bool),
+		global: make(map[string]checkType),
+	}
+	for _, t := range pkg.Types {
+		c.types[t.TypeName] = true
+	}
+	for _, def := range pkg.Constants {
+		t := c.typeOf(def.Type)
+		if def.Type == nil && def.Init != nil {
+			t = c.expr(def.Init)
+		}
+		c.global[def.Name] = t
+	}
+	for _, def := range pkg.Variables {
+		t := c.typeOf(def.Type)
+		if def.Type == nil && def.Init != nil {
+			t = c.expr(def.Init)
+		}
+		for _, name := range def.Names {
+			c.global[name] = t
+		}
+	}
+
+	var funcs []*Func
+	for _, f := range pkg.Functions {
+		funcs = append(funcs, f)
+	}
+	for _, t := range pkg.Types {
+		for _, m := range t.Methods {
+			funcs = append(funcs, m)
+		}
+	}
+	sort.Slice(funcs, func(i, j int) bool {
+		if funcs[i].Line != funcs[j].Line {
+			return funcs[i].Line < funcs[j].Line
+		}
+		return funcs[i].Col < funcs[j].Col
+	})
+	for _, f := range funcs {
+		c.function(f)
+	}
+
+	if len(c.errors) > 0 {
+		return c.errors[0]
+	}
+	return nil
+}
+
+func (c *checker) errorf(ast AST, format string, a ...interface{}) {
+	c.errors = append(c.errors, c.ctx.Errorf(ast, format, a...))
+}
+
+func (c *checker) push() {
+	c.scopes = append(c.scopes, make(map[string]checkType))
+}
+
+func (c *checker) pop() {
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *checker) define(name string, t checkType) {
+	if name == "_" {
+		return
+	}
+	c.scopes[len(c.scopes)-1][name] = t
+}
+
+// local returns the type of the local variable name.
+func (c *checker) local(name string) (checkType, bool) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		t, ok := c.scopes[i][name]
+		if ok {
+			return t, true
+		}
+	}
+	return checkUnknown, false
+}
+
+// typeOf returns the type of the type declaration ti.
+func (c *checker) typeOf(ti *TypeInfo) checkType {
+	if ti == nil || ti.Type != TypeName || ti.Name.Package != "" ||
+		c.types[ti.Name.Name] {
+		return checkUnknown
+	}
+	k := basicKind(ti.Name.Name)
+	if k == kindUnknown {
+		return checkUnknown
+	}
+	return checkType{
+		Kind: k,
+		Name: ti.String(),
+	}
+}
+
+// function checks the function f.
+func (c *checker) function(f *Func) {
+	c.f = f
+	c.push()
+	if f.This != nil {
+		c.define(f.This.Name, checkUnknown)
+	}
+	for _, arg := range f.Args {
+		c.define(arg.Name, c.typeOf(arg.Type))
+	}
+	for _, ret := range f.Return {
+		if len(ret.Name) > 0 {
+			c.define(ret.Name, c.typeOf(ret.Type))
+		}
+	}
+	c.list(f.Body)
+	c.pop()
+	c.f = nil
+}
+
+func (c *checker) list(list List) {
+	c.push()
+	for _, stmt := range list {
+		c.stmt(stmt)
+	}
+	c.pop()
+}
+
+func (c *checker) stmt(ast AST) {
+	switch stmt := ast.(type) {
+	case List:
+		c.list(stmt)
+
+	case *VariableDef:
+		t := c.typeOf(stmt.Type)
+		if stmt.Init != nil {
+			init := c.expr(stmt.Init)
+			if !assignable(init, t) {
+				c.errorf(stmt, "cannot use %s (type %s) as type %s in assignment",
+					stmt.Init, init, t)
+			}
+		}
+		for _, name := range stmt.Names {
+			c.define(name, t)
+		}
+
+	case *Assign:
+		c.assign(stmt)
+
+	case *If:
+		c.cond(stmt.Expr, "if condition")
+		c.stmt(stmt.True)
+		if stmt.False != nil {
+			c.stmt(stmt.False)
+		}
+
+	case *Switch:
+		var tag checkType
+		if stmt.Expr != nil {
+			tag = c.expr(stmt.Expr)
+		}
+		for _, cs := range stmt.Cases {
+			for _, expr := range cs.Exprs {
+				if stmt.Expr == nil {
+					c.cond(expr, "if condition")
+					continue
+				}
+				t := c.expr(expr)
+				if t.Known() && tag.Known() && t.Kind != tag.Kind {
+					c.errorf(expr,
+						"invalid case %s in switch on %s (mismatched types %s and %s)",
+						expr, stmt.Expr, t, tag)
+				}
+			}
+			c.list(cs.Body)
+		}
+
+	case *For:
+		c.push()
+		if stmt.Init != nil {
+			c.stmt(stmt.Init)
+		}
+		if stmt.Cond != nil {
+			c.cond(stmt.Cond, "for condition")
+		}
+		if stmt.Inc != nil {
+			c.stmt(stmt.Inc)
+		}
+		c.list(stmt.Body)
+		c.pop()
+
+	case *ForRange:
+		c.expr(stmt.Expr)
+		c.push()
+		for _, expr := range stmt.ExprList {
+			ref, ok := expr.(*VariableRef)
+			if stmt.Def && ok && len(ref.Name.Package) == 0 {
+				c.define(ref.Name.Name, checkUnknown)
+			} else {
+				c.expr(expr)
+			}
+		}
+		c.list(stmt.Body)
+		c.pop()
+
+	case *Return:
+		c.ret(stmt)
+
+	case *LabeledStmt:
+		c.stmt(stmt.Stmt)
+
+	case *Break, *Continue, *Goto:
+
+	default:
+		c.values([]AST{ast})
+	}
+}
+
+// cond checks that the condition expression is a boolean value.
+func (c *checker) cond(expr AST, what string) {
+	t := c.expr(expr)
+	if t.Known() && t.Kind != kindBool {
+		c.errorf(expr, "non-bool %s (type %s) used as %s", expr, t, what)
+	}
+}
+
+// assignable tests if the value of type v can be assigned to a
+// variable of type t.
+func assignable(v, t checkType) bool {
+	return !v.Known() || !t.Known() || v.Kind == t.Kind
+}
+
+func (c *checker) assign(ast *Assign) {
+	values, exprs, ok := c.values(ast.Exprs)
+	if ok && len(values) != len(ast.LValues) {
+		c.errorf(ast, "assignment mismatch: %d variables but %d values",
+			len(ast.LValues), len(values))
+		ok = false
+	}
+	for idx, lvalue := range ast.LValues {
+		v := checkUnknown
+		if ok {
+			v = values[idx]
+		}
+		ref, isRef := lvalue.(*VariableRef)
+		if isRef && ref.IsBlank() {
+			continue
+		}
+		if ast.Define && isRef && len(ref.Name.Package) == 0 {
+			t, declared := c.scopes[len(c.scopes)-1][ref.Name.Name]
+			if !declared {
+				c.define(ref.Name.Name, defaultType(v))
+				continue
+			}
+			if !assignable(v, t) {
+				c.errorf(lvalue,
+					"cannot use %s (type %s) as type %s in assignment",
+					exprs[idx], v, t)
+			}
+			continue
+		}
+		t := c.expr(lvalue)
+		if !assignable(v, t) {
+			c.errorf(lvalue, "cannot use %s (type %s) as type %s in assignment",
+				exprs[idx], v, t)
+		}
+	}
+}
+
+// defaultType returns the type of a variable defined with a value of
+// type t.
+func defaultType(t checkType) checkType {
+	switch t {
+	case checkUntypedBool:
+		return checkBool
+	case checkUntypedInt:
+		return checkType{Kind: kindInt, Name: "int"}
+	case checkUntypedString:
+		return checkType{Kind: kindString, Name: "string"}
+	default:
+		return t
+	}
+}
+
+func (c *checker) ret(ast *Return) {
+	if ast.AutoGenerated || c.f == nil ||
+		(len(ast.Exprs) == 0 && c.f.NamedReturn) {
+		return
+	}
+	values, exprs, ok := c.values(ast.Exprs)
+	if !ok {
+		return
+	}
+	if len(values) < len(c.f.Return) {
+		c.errorf(ast, "not enough arguments to return")
+		return
+	}
+	if len(values) > len(c.f.Return) {
+		c.errorf(ast, "too many arguments to return")
+		return
+	}
+	for idx, ret := range c.f.Return {
+		t := c.typeOf(ret.Type)
+		if !assignable(values[idx], t) {
+			c.errorf(exprs[idx],
+				"cannot use %s (type %s) as type %s in return argument",
+				exprs[idx], values[idx], t)
+		}
+	}
+}
+
+// values checks the expressions and returns the types of their
+// values. The multi-value function calls are expanded to their
+// return values. The exprs specifies the expression of each value.
+// The ok is false if the number of the values is not known.
+func (c *checker) values(list []AST) (values []checkType, exprs []AST,
+	ok bool) {
+
+	ok = true
+	for _, expr := range list {
+		call, isCall := expr.(*Call)
+		if !isCall {
+			values = append(values, c.expr(expr))
+			exprs = append(exprs, expr)
+			continue
+		}
+		result, known := c.call(call)
+		if !known {
+			ok = false
+			continue
+		}
+		for _, t := range result {
+			values = append(values, t)
+			exprs = append(exprs, expr)
+		}
+	}
+	return
+}
+
+// call checks the function call and returns the types of its return
+// values. The known is false if the callee is not known.
+func (c *checker) call(ast *Call) (result []checkType, known bool) {
+	args, exprs, ok := c.values(ast.Exprs)
+
+	name := ast.Ref.Name
+	if len(name.Package) > 0 {
+		return nil, false
+	}
+	if _, ok := c.local(name.Name); ok {
+		// Function value.
+		return nil, false
+	}
+	if !c.types[name.Name] {
+		if k := basicKind(name.Name); k != kindUnknown {
+			// Type conversion.
+			return []checkType{{
+				Kind: k,
+				Name: name.Name,
+			}}, true
+		}
+	}
+	f, found := c.pkg.Functions[name.Name]
+	if !found {
+		return nil, false
+	}
+	for _, ret := range f.Return {
+		result = append(result, c.typeOf(ret.Type))
+	}
+	if !ok {
+		return result, true
+	}
+	if len(args) < len(f.Args) {
+		c.errorf(ast, "not enough arguments in call to %s", ast.Ref)
+		return result, true
+	}
+	if len(args) > len(f.Args) {
+		c.errorf(ast, "too many arguments in call to %s", ast.Ref)
+		return result, true
+	}
+	for idx, arg := range f.Args {
+		t := c.typeOf(arg.Type)
+		if !assignable(args[idx], t) {
+			c.errorf(exprs[idx],
+				"cannot use %s (type %s) as type %s in argument to %s",
+				exprs[idx], args[idx], t, ast.Ref)
+		}
+	}
+	return result, true
+}
+
+// expr checks the single-valued expression and returns its type.
+func (c *checker) expr(ast AST) checkType {
+	switch expr := ast.(type) {
+	case *BasicLit:
+		switch expr.Value.(type) {
+		case bool:
+			return checkUntypedBool
+		case int, uint, int32, uint32, int64, uint64, *mpa.Int:
+			return checkUntypedInt
+		case string:
+			return checkUntypedString
+		}
+
+	case *VariableRef:
+		if len(expr.Name.Package) > 0 || expr.IsBlank() {
+			return checkUnknown
+		}
+		if t, ok := c.local(expr.Name.Name); ok {
+			return t
+		}
+		return c.global[expr.Name.Name]
+
+	case *Binary:
+		return c.binary(expr)
+
+	case *Unary:
+		t := c.expr(expr.Expr)
+		switch expr.Type {
+		case UnaryNot:
+			if t.Known() && t.Kind != kindBool {
+				c.errorf(expr,
+					"invalid operation: operator %s not defined on %s (%s)",
+					expr.Type, expr.Expr, t)
+			}
+			return checkBool
+
+		case UnaryPlus, UnaryMinus, UnaryXor:
+			if t.Known() && t.Kind != kindInt {
+				c.errorf(expr,
+					"invalid operation: operator %s not defined on %s (%s)",
+					expr.Type, expr.Expr, t)
+				return checkUnknown
+			}
+			return t
+		}
+
+	case *Call:
+		result, _ := c.call(expr)
+		if len(result) == 1 {
+			return result[0]
+		}
+
+	case *Index:
+		c.expr(expr.Expr)
+		c.expr(expr.Index)
+
+	case *Slice:
+		c.expr(expr.Expr)
+		if expr.From != nil {
+			c.expr(expr.From)
+		}
+		if expr.To != nil {
+			c.expr(expr.To)
+		}
+
+	case *ArrayCast:
+		c.expr(expr.Expr)
+
+	case *CompositeLit:
+		for _, e := range expr.Value {
+			c.expr(e.Element)
+		}
+
+	case *Make:
+		for _, e := range expr.Exprs {
+			c.expr(e)
+		}
+	}
+	return checkUnknown
+}
+
+func (c *checker) binary(ast *Binary) checkType {
+	l := c.expr(ast.Left)
+	r := c.expr(ast.Right)
+
+	result := l
+	if !l.Known() {
+		result = r
+	}
+
+	var valid func(k kind) bool
+	switch ast.Op {
+	case BinaryAnd, BinaryOr:
+		valid = func(k kind) bool {
+			return k == kindBool
+		}
+		result = checkBool
+
+	case BinaryEq, BinaryNeq:
+		valid = func(k kind) bool {
+			return true
+		}
+		result = checkBool
+
+	case BinaryLt, BinaryLe, BinaryGt, BinaryGe:
+		valid = func(k kind) bool {
+			return k != kindBool
+		}
+		result = checkBool
+
+	case BinaryAdd:
+		valid = func(k kind) bool {
+			return k != kindBool
+		}
+
+	case BinaryBand, BinaryBclear, BinaryBor, BinaryBxor:
+		valid = func(k kind) bool {
+			return k != kindString
+		}
+
+	case BinaryLshift, BinaryRshift:
+		for _, operand := range []struct {
+			expr AST
+			t    checkType
+		}{{ast.Left, l}, {ast.Right, r}} {
+			if operand.t.Known() && operand.t.Kind != kindInt {
+				c.errorf(ast,
+					"invalid operation: operator %s not defined on %s (%s)",
+					ast.Op, operand.expr, operand.t)
+				return checkUnknown
+			}
+		}
+		return l
+
+	default:
+		valid = func(k kind) bool {
+			return k == kindInt
+		}
+	}
+
+	if l.Known() && !valid(l.Kind) {
+		c.errorf(ast, "invalid operation: operator %s not defined on %s (%s)",
+			ast.Op, ast.Left, l)
+		return errorResult(result)
+	}
+	if r.Known() && !valid(r.Kind) {
+		c.errorf(ast, "invalid operation: operator %s not defined on %s (%s)",
+			ast.Op, ast.Right, r)
+		return errorResult(result)
+	}
+	if l.Known() && r.Known() && l.Kind != r.Kind {
+		c.errorf(ast, "invalid operation: %s (mismatched types %s and %s)",
+			ast, l, r)
+		return errorResult(result)
+	}
+	return result
+}
+
+// errorResult returns the type of an invalid expression with the
+// result type t. The boolean results are known but the other result
+// types are unknown so that the error does not cascade to the
+// enclosing expressions.
+func errorResult(t checkType) checkType {
+	if t == checkBool {
+		return t
+	}
+	return checkUnknown
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler/ssa"
 	"github.com/markkurossi/mpc/compiler/utils"
 	"github.com/markkurossi/mpc/types"
@@ -24,29 +25,127 @@ const (
 func (ast List) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Value, error) {
 
-	var err error
+	targets, err := ctx.PushGotoTargets(ast)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		for _, target := range targets {
+			target.Closed = true
+		}
+	}()
 
-	for _, b := range ast {
-		if block.Dead {
-			warn := true
+	loc := gen.SetLocation(ast.Location())
+	var warned bool
+	for idx, b := range ast {
+		labeled, _ := b.(*LabeledStmt)
+		target := targets[labeled]
+
+		if block.Dead && (target == nil || target.Exit == nil) {
+			warn := !warned
 			ret, ok := b.(*Return)
 			if ok && ret.AutoGenerated {
 				warn = false
 			}
+			if idx > 0 && ctx.loopConstIf(ast[idx-1]) {
+				// The if statements with constant conditions
+				// terminate only in some loop iterations.
+				warn = false
+			}
 			if warn {
 				ctx.Warningf(b, "unreachable code")
 			}
-			break
+			warned = true
+			if !gotoPending(targets) {
+				break
+			}
+			// Skip to the labeled statement of the pending goto.
+			continue
+		}
+		gen.SetLocation(b.Location())
+
+		if target != nil {
+			block, _, err = ctx.joinBlocks(b, target.Start, block,
+				target.Exit, gen)
+			if err != nil {
+				return nil, nil, err
+			}
+			target.Reached = true
+			warned = false
 		}
+		for _, t := range targets {
+			if t.Reached {
+				continue
+			}
+			if t.Exit == nil {
+				t.Start = block
+			} else if isDeclaration(b) {
+				return nil, nil, ctx.Errorf(b,
+					"goto %s jumps over variable declaration", t.Label)
+			}
+		}
+
 		block, _, err = b.SSA(block, ctx, gen)
 		if err != nil {
 			return nil, nil, err
 		}
 	}
+	gen.SetLocation(loc)
 
 	return block, nil, nil
 }
 
+// gotoPending tests if any of the goto targets has a goto statement
+// branching to it and its labeled statement is not reached yet.
+func gotoPending(targets map[*LabeledStmt]*GotoTarget) bool {
+	for _, target := range targets {
+		if target.Exit != nil && !target.Reached {
+			return true
+		}
+	}
+	return false
+}
+
+// isDeclaration tests if the statement declares new variables.
+func isDeclaration(stmt AST) bool {
+	switch stmt := stmt.(type) {
+	case *VariableDef:
+		return true
+	case *Assign:
+		return stmt.Define
+	default:
+		return false
+	}
+}
+
+// hasLabel tests if the statement or any of its nested statements is
+// labeled with the label.
+func hasLabel(stmt AST, label string) bool {
+	switch stmt := stmt.(type) {
+	case List:
+		for _, s := range stmt {
+			if hasLabel(s, label) {
+				return true
+			}
+		}
+	case *LabeledStmt:
+		return stmt.Label == label || hasLabel(stmt.Stmt, label)
+	case *If:
+		return hasLabel(stmt.True, label) || hasLabel(stmt.False, label)
+	case *For:
+		return hasLabel(stmt.Body, label)
+	case *ForRange:
+		return hasLabel(stmt.Body, label)
+	case *Switch:
+		for _, c := range stmt.Cases {
+			if hasLabel(c.Body, label) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // SSA implements the compiler.ast.AST.SSA for function definitions.
 func (ast *Func) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Value, error) {
@@ -67,6 +166,14 @@ func (ast *Func) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		r := gen.NewVal(ret.Name, typeInfo, ctx.Scope())
 		block.Bindings.Define(r, nil)
 	}
+	// The main function returns the abort status of the computation
+	// as an implicit return value.
+	if ctx.Caller() == nil && ctx.abortStatus() {
+		r := gen.NewVal(circuit.AbortOutput, types.Bool, ctx.Scope())
+		f := gen.Constant(false, types.Bool)
+		gen.AddConstant(f)
+		block.Bindings.Define(r, &f)
+	}
 
 	ast.Body = append(ast.Body, &Return{
 		Point:         ast.End,
@@ -127,6 +234,14 @@ func (ast *Func) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 
 	caller := ctx.Caller()
 	if caller == nil {
+		if ctx.abortStatus() {
+			v, _, ok := ctx.Start().ReturnBinding(ssa.NewReturnBindingCTX(),
+				circuit.AbortOutput, ctx.Return(), gen)
+			if !ok {
+				return nil, nil, ctx.Errorf(ast, "undefined abort status")
+			}
+			vars = append(vars, v)
+		}
 		ctx.Return().AddInstr(ssa.NewRetInstr(vars))
 	}
 
@@ -203,6 +318,7 @@ func (ast *VariableDef) SSA(block *ssa.Block, ctx *Codegen,
 		// Constant init values can be shared between different
 		// instances so let's move the init to the new variable value.
 		block.AddInstr(ssa.NewMovInstr(init, lValue))
+		ctx.defineVar(ast, n, lValue, lValue)
 	}
 	return block, nil, nil
 }
@@ -280,9 +396,18 @@ func (ast *Assign) SSA(block *ssa.Block, ctx *Codegen,
 		rv := values[idx]
 		switch lv := lvalue.(type) {
 		case *VariableRef:
-			lrv, _, df, err := ctx.LookupVar(block, gen, block.Bindings, lv)
-			if err != nil {
-				if !ast.Define || !df {
+			if lv.IsBlank() {
+				// Blank identifier discards the value.
+				continue
+			}
+			old, _ := block.Bindings.Get(lv.Name.Name)
+			lrv, _, df, err := ctx.lookupVar(block, gen, block.Bindings, lv)
+			// The := defines a new local variable that shadows the
+			// package variable.
+			shadow := err == nil && ast.Define &&
+				lrv.baseInfo.Bindings.ReadOnly()
+			if err != nil || shadow {
+				if !shadow && (!ast.Define || !df) {
 					// Not := or lvalue can't be defined.
 					return nil, nil, ctx.Errorf(lv,
 						"a non-name %s on left side of :=", lv)
@@ -299,6 +424,7 @@ func (ast *Assign) SSA(block *ssa.Block, ctx *Codegen,
 				defined = true
 				block.Bindings.Define(lValue, &rv)
 				block.AddInstr(ssa.NewMovInstr(rv, lValue))
+				ctx.defineVar(lv, lv.Name.Name, rv, lValue)
 				continue
 			}
 
@@ -306,6 +432,10 @@ func (ast *Assign) SSA(block *ssa.Block, ctx *Codegen,
 			if err != nil {
 				return nil, nil, ctx.Error(lvalue, err.Error())
 			}
+			if lrv.structField == nil && lrv.baseInfo.Name == lv.Name.Name {
+				instr := block.Instr[len(block.Instr)-1]
+				ctx.assignVar(lv, lv.Name.Name, old.Bound, rv, *instr.Out)
+			}
 
 		case *Index:
 			if ast.Define {
@@ -455,12 +585,14 @@ func (ast *If) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 			return nil, nil, ctx.Errorf(ast.Expr,
 				"condition is not boolean expression")
 		}
+		var v []ssa.Value
 		if val {
-			return ast.True.SSA(block, ctx, gen)
+			block, v, err = ast.True.SSA(block, ctx, gen)
 		} else if ast.False != nil {
-			return ast.False.SSA(block, ctx, gen)
+			block, v, err = ast.False.SSA(block, ctx, gen)
 		}
-		return block, nil, nil
+		ctx.setConstIf(ast)
+		return block, v, err
 	}
 
 	block, e, err := ast.Expr.SSA(block, ctx, gen)
@@ -535,19 +667,139 @@ func (ast *If) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	return next, nil, nil
 }
 
+// SSA implements the compiler.ast.AST.SSA for switch statements. The
+// switch is compiled into an if-else chain that compares the tag
+// value with the case expressions in the source order. The body of
+// the first matching case is executed and the default case is
+// executed if none of the cases match. The cases do not fall
+// through.
+func (ast *Switch) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
+	*ssa.Block, []ssa.Value, error) {
+
+	var tag AST
+	if ast.Expr != nil {
+		env := NewEnv(block)
+		_, ok, err := ast.Expr.Eval(env, ctx, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			tag = ast.Expr
+		} else {
+			var v []ssa.Value
+			block, v, err = ast.Expr.SSA(block, ctx, gen)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(v) == 0 {
+				return nil, nil, ctx.Errorf(ast.Expr, "%s used as value",
+					ast.Expr)
+			} else if len(v) > 1 {
+				return nil, nil, ctx.Errorf(ast.Expr,
+					"multiple-value %s used in single-value context", ast.Expr)
+			}
+			tag = &switchTag{
+				Expr:  ast.Expr,
+				Value: v[0],
+			}
+		}
+	}
+
+	var chain AST
+	for _, c := range ast.Cases {
+		if len(c.Exprs) == 0 {
+			chain = c.Body
+		}
+	}
+	for i := len(ast.Cases) - 1; i >= 0; i-- {
+		c := ast.Cases[i]
+		if len(c.Exprs) == 0 {
+			continue
+		}
+		var cond AST
+		for _, expr := range c.Exprs {
+			if tag != nil {
+				expr = &Binary{
+					Point: expr.Location(),
+					Left:  tag,
+					Op:    BinaryEq,
+					Right: expr,
+				}
+			}
+			if cond == nil {
+				cond = expr
+			} else {
+				cond = &Binary{
+					Point: c.Point,
+					Left:  cond,
+					Op:    BinaryOr,
+					Right: expr,
+				}
+			}
+		}
+		chain = &If{
+			Point: c.Point,
+			Expr:  cond,
+			True:  c.Body,
+			False: chain,
+		}
+	}
+	if chain == nil {
+		return block, nil, nil
+	}
+
+	loop := ctx.PushLoop(true)
+
+	start := block
+
+	block, _, err := chain.SSA(block, ctx, gen)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx.PopLoop()
+
+	return ctx.joinBlocks(ast, start, block, loop.Exit, gen)
+}
+
+// SSA implements the compiler.ast.AST.SSA for switch tag values.
+func (ast *switchTag) SSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator) (*ssa.Block, []ssa.Value, error) {
+	return block, []ssa.Value{ast.Value}, nil
+}
+
 // SSA implements the compiler.ast.AST.SSA for call expressions.
 func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Value, error) {
 
+	// Resolve called.
+	called, err := ctx.LookupFunc(block, ast.Ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Generate call values.
 
 	var callValues [][]ssa.Value
+	var funcValues []*Func
 	var v []ssa.Value
-	var err error
 
 	env := NewEnv(block)
 
-	for _, expr := range ast.Exprs {
+	for idx, expr := range ast.Exprs {
+		if called != nil && idx < len(called.Args) &&
+			called.Args[idx].Type.Type == TypeFunc {
+
+			f, err := ast.funcValue(block, ctx, gen, called, idx)
+			if err != nil {
+				return nil, nil, err
+			}
+			if funcValues == nil {
+				funcValues = make([]*Func, len(called.Args))
+			}
+			funcValues[idx] = f
+			callValues = append(callValues, []ssa.Value{ssa.Undefined})
+			continue
+		}
 		constVal, ok, err := expr.Eval(env, ctx, gen)
 		if err != nil {
 			return nil, nil, err
@@ -564,14 +816,9 @@ func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		callValues = append(callValues, v)
 	}
 
-	// Resolve called.
-	called, err := ctx.LookupFunc(block, ast.Ref)
-	if err != nil {
-		return nil, nil, err
-	}
 	if called == nil {
 		// Check builtin functions.
-		bi, ok := builtins[ast.Ref.Name.Name]
+		bi, ok := lookupBuiltin(ctx, ast.Ref)
 		if ok {
 			// Flatten arguments.
 			var args []ssa.Value
@@ -645,32 +892,50 @@ func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		}
 	}
 
+	err = ctx.checkContext(ast)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = ctx.checkRecursion(ast, called, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Return block.
 	rblock := gen.Block()
 	rblock.Bindings = block.Bindings.Clone()
 
+	// Parameter values of the called function instance.
+	var params []ssa.Value
+
 	ctx.PushCompilation(gen.Block(), gen.Block(), rblock, called)
 
 	// Define arguments.
 	for idx, arg := range called.Args {
+		if funcValues != nil && funcValues[idx] != nil {
+			ctx.BindFuncValue(arg.Name, funcValues[idx])
+			continue
+		}
 		typeInfo, err := arg.Type.Resolve(NewEnv(block), ctx, gen)
 		if err != nil {
 			return nil, nil, ctx.Errorf(arg, "invalid argument type: %s", err)
 		}
 		// Instantiate argument types of template functions.
-		if !typeInfo.Concrete() && !typeInfo.Instantiate(args[idx].Type) {
+		if (!typeInfo.Concrete() && !typeInfo.Instantiate(args[idx].Type)) ||
+			!ssa.LValueFor(typeInfo, args[idx]) {
 			return nil, nil, ctx.Errorf(ast.Exprs[idx],
-				"cannot use %v as type %s in argument to %s",
-				args[idx].Type, typeInfo, called.Name)
+				"cannot use %s (type %v) as type %s in argument to %s",
+				ast.Exprs[idx], args[idx].Type, typeInfo, called.Name)
 		}
-		if !ssa.LValueFor(typeInfo, args[idx]) {
-			return nil, nil, ctx.Errorf(ast,
-				"cannot use %v as type %s in argument to %s",
-				args[idx].Type, typeInfo, called.Name)
+		argType := args[idx].Type
+		if argType.Untyped {
+			// Untyped constants adopt the argument type.
+			argType = typeInfo
 		}
-		a := gen.NewVal(arg.Name, args[idx].Type, ctx.Scope())
+		a := gen.NewVal(arg.Name, argType, ctx.Scope())
 		a.PtrInfo = args[idx].PtrInfo
 		ctx.Start().Bindings.Define(a, &args[idx])
+		params = append(params, a)
 
 		block.AddInstr(ssa.NewMovInstr(args[idx], a))
 	}
@@ -692,6 +957,7 @@ func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 			b, ok = ctx.Package.Bindings.Get(ast.Ref.Name.Package)
 			if ok {
 				bindings = ctx.Package.Bindings
+				ctx.globalAccess(ctx.Package, ast.Ref.Name.Package)
 			} else {
 				return nil, nil, ctx.Errorf(ast, "undefined: %s",
 					ast.Ref.Name.Package)
@@ -727,18 +993,65 @@ func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		}
 		ctx.Start().Bindings.Define(a, &this)
 		block.AddInstr(ssa.NewMovInstr(this, a))
+		args = append(args[:len(args):len(args)], this)
+		params = append(params, a)
+	}
+	// The abort status is an implicit argument.
+	abort, hasAbort := block.Bindings.Get(circuit.AbortOutput)
+	if hasAbort {
+		v := abort.Value(block, gen)
+		a := gen.NewVal(circuit.AbortOutput, types.Bool, ctx.Scope())
+		ctx.Start().Bindings.Define(a, &v)
 	}
 
 	// Instantiate called function.
-	_, returnValues, err := called.SSA(ctx.Start(), ctx, gen)
-	if err != nil {
-		return nil, nil, err
+	var returnValues []ssa.Value
+	key, cacheable := ctx.cacheKey(called, args)
+	if funcValues != nil || hasAbort {
+		// The instance code depends on the called function values
+		// or it returns the abort status.
+		cacheable = false
+	}
+	var entry *funcCacheEntry
+	if cacheable {
+		entry = ctx.Cache.lookup(key)
+	}
+	if entry != nil {
+		returnValues = ctx.reuseInstance(key, entry, called, args, params,
+			gen)
+	} else {
+		ctx.cacheDepend(called.Digest, nil)
+		var rec *funcRecord
+		if cacheable {
+			rec = ctx.beginInstance(key)
+		}
+		_, returnValues, err = called.SSA(ctx.Start(), ctx, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rec != nil {
+			ctx.endInstance(rec, args, params, returnValues)
+		}
 	}
 
 	block.SetNext(ctx.Start())
 
 	rblock.Bindings = block.Bindings.Clone()
 
+	// The abort status is an implicit return value.
+	if hasAbort {
+		v, _, ok := ctx.Start().ReturnBinding(ssa.NewReturnBindingCTX(),
+			circuit.AbortOutput, ctx.Return(), gen)
+		if !ok {
+			return nil, nil, ctx.Errorf(ast, "undefined abort status")
+		}
+		lValue := gen.NewVal(circuit.AbortOutput, types.Bool, abort.Scope)
+		err = rblock.Bindings.Set(lValue, &v)
+		if err != nil {
+			return nil, nil, ctx.Error(ast, err.Error())
+		}
+	}
+
 	ctx.Return().SetNext(rblock)
 	block = rblock
 
@@ -747,6 +1060,75 @@ func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	return block, returnValues, nil
 }
 
+// funcValue resolves the function value for the function-typed
+// argument idx of the called function. The function values must
+// resolve to named functions at compile time.
+func (ast *Call) funcValue(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator, called *Func, idx int) (*Func, error) {
+
+	expr := ast.Exprs[idx]
+	arg := called.Args[idx]
+
+	ref, ok := expr.(*VariableRef)
+	if !ok {
+		return nil, ctx.Errorf(expr,
+			"cannot use %s as function value in argument to %s: "+
+				"function values must be named functions", expr, called.Name)
+	}
+	f, err := ctx.LookupFunc(block, ref)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil || f.This != nil {
+		return nil, ctx.Errorf(expr,
+			"cannot use %s as function value in argument to %s: "+
+				"function values must be named functions", expr, called.Name)
+	}
+
+	// Check the function signature.
+	env := NewEnv(block)
+	match := len(f.Args) == len(arg.Type.ArgTypes) &&
+		len(f.Return) == len(arg.Type.ReturnTypes)
+	for i := 0; match && i < len(f.Args); i++ {
+		match, err = typeMatch(env, ctx, gen, arg.Type.ArgTypes[i],
+			f.Args[i].Type)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; match && i < len(f.Return); i++ {
+		match, err = typeMatch(env, ctx, gen, arg.Type.ReturnTypes[i],
+			f.Return[i].Type)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !match {
+		return nil, ctx.Errorf(expr,
+			"cannot use %s (type %s) as type %s in argument to %s",
+			expr, f.Signature(), arg.Type, called.Name)
+	}
+	return f, nil
+}
+
+// typeMatch tests if the types a and b resolve to the same type.
+func typeMatch(env *Env, ctx *Codegen, gen *ssa.Generator, a, b *TypeInfo) (
+	bool, error) {
+
+	if a.Type == TypeFunc || b.Type == TypeFunc {
+		return a.Equal(b), nil
+	}
+	at, err := a.Resolve(env, ctx, gen)
+	if err != nil {
+		return false, err
+	}
+	bt, err := b.Resolve(env, ctx, gen)
+	if err != nil {
+		return false, err
+	}
+	return at.Equal(bt), nil
+}
+
 func (ast *Call) cast(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
 	typeInfo types.Info, cv ssa.Value) (*ssa.Block, []ssa.Value, error) {
 
@@ -794,10 +1176,10 @@ castTargetType:
 		default:
 			break castTargetType
 		}
-		t = gen.AnonVal(typeInfo)
+		t = gen.AnonValFor(typeInfo, ast)
 
 	default:
-		t = gen.AnonVal(typeInfo)
+		t = gen.AnonValFor(typeInfo, ast)
 	}
 	if t.Type.Undefined() {
 		return nil, nil, ctx.Errorf(ast.Exprs[0], "cast from %v to %v",
@@ -930,7 +1312,7 @@ func (ast *ArrayCast) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 			typeInfo.SetConcrete(true)
 		}
 
-		t = gen.AnonVal(typeInfo)
+		t = gen.AnonValFor(typeInfo, ast)
 
 	default:
 		return nil, nil, ctx.Errorf(ast.Expr, "cast from %v to %v",
@@ -1036,11 +1418,15 @@ func (ast *Return) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		if err != nil {
 			return nil, nil, ctx.Errorf(r, "invalid return type: %s", err)
 		}
+		if r.Type == nil {
+			// Result type is inferred from the returned value.
+			typeInfo = result[idx].Type
+			typeInfo.Untyped = false
+		}
 		// Instantiate result values for template functions.
 		if !typeInfo.Concrete() && !typeInfo.Instantiate(result[idx].Type) {
-			return nil, nil, ctx.Errorf(ast,
-				"invalid value %v for return value %v",
-				result[idx].Type, typeInfo)
+			return nil, nil, returnTypeError(ctx, exprs, idx, result[idx],
+				typeInfo)
 		}
 		info.Types = append(info.Types, typeInfo)
 		v := gen.NewVal(r.Name, typeInfo, ctx.Scope())
@@ -1054,9 +1440,8 @@ func (ast *Return) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		}
 
 		if !ssa.LValueFor(typeInfo, result[idx]) {
-			return nil, nil, ctx.Errorf(ast,
-				"invalid value %v for return value %v",
-				result[idx].Type, v.Type)
+			return nil, nil, returnTypeError(ctx, exprs, idx, result[idx],
+				typeInfo)
 		}
 
 		block.AddInstr(ssa.NewMovInstr(result[idx], v))
@@ -1065,13 +1450,158 @@ func (ast *Return) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 			return nil, nil, ctx.Error(ast, err.Error())
 		}
 	}
-
 	block.SetNext(ctx.Return())
 	block.Dead = true
 
 	return block, nil, nil
 }
 
+// SSA implements the compiler.ast.AST.SSA for break statements. The
+// block branches to the exit block of the target loop and the code
+// following the break statement is dead. If the break statement is
+// in a branch of a non-constant if statement, the variable values of
+// the loop exit block are selected by the branch conditions.
+func (ast *Break) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
+	*ssa.Block, []ssa.Value, error) {
+
+	loop := ctx.LookupLoop(ast.Label, false)
+	if loop == nil {
+		if len(ast.Label) > 0 {
+			return nil, nil, ctx.Errorf(ast, "invalid break label %s",
+				ast.Label)
+		}
+		return nil, nil, ctx.Errorf(ast, "break is not in a loop or switch")
+	}
+	if loop.Exit == nil {
+		loop.Exit = gen.Block()
+	}
+	block.SetNext(loop.Exit)
+	block.Dead = true
+
+	return block, nil, nil
+}
+
+// SSA implements the compiler.ast.AST.SSA for continue statements. The
+// block branches to the continue block of the current iteration of
+// the target loop.
+func (ast *Continue) SSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator) (*ssa.Block, []ssa.Value, error) {
+
+	loop := ctx.LookupLoop(ast.Label, true)
+	if loop == nil {
+		if len(ast.Label) > 0 {
+			return nil, nil, ctx.Errorf(ast, "invalid continue label %s",
+				ast.Label)
+		}
+		return nil, nil, ctx.Errorf(ast, "continue is not in a loop")
+	}
+	if loop.Cont == nil {
+		loop.Cont = gen.Block()
+	}
+	block.SetNext(loop.Cont)
+	block.Dead = true
+
+	return block, nil, nil
+}
+
+// SSA implements the compiler.ast.AST.SSA for goto statements. The
+// goto statements can only jump forward to a labeled statement in the
+// same or in an enclosing statement list. The block branches to the
+// target block of the label and the code following the goto
+// statement is dead. Like with the break statements, the variable
+// values of the target block are selected by the branch conditions.
+func (ast *Goto) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
+	*ssa.Block, []ssa.Value, error) {
+
+	target := ctx.LookupGoto(ast.Label)
+	if target == nil || target.Closed {
+		c := ctx.Stack[len(ctx.Stack)-1]
+		if c.Called != nil && hasLabel(c.Called.Body, ast.Label) {
+			return nil, nil, ctx.Errorf(ast, "goto %s jumps into block",
+				ast.Label)
+		}
+		return nil, nil, ctx.Errorf(ast, "label %s not defined", ast.Label)
+	}
+	if target.Reached {
+		return nil, nil, ctx.Errorf(ast,
+			"goto %s jumps backward: use a for loop", ast.Label)
+	}
+	if target.Exit == nil {
+		target.Exit = gen.Block()
+	}
+	block.SetNext(target.Exit)
+	block.Dead = true
+
+	return block, nil, nil
+}
+
+// SSA implements the compiler.ast.AST.SSA for labeled statements. The
+// label of a for or switch statement names the statement for the
+// labeled break and continue statements.
+func (ast *LabeledStmt) SSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator) (*ssa.Block, []ssa.Value, error) {
+
+	switch ast.Stmt.(type) {
+	case *For, *ForRange, *Switch:
+		ctx.SetLabel(ast.Label)
+	}
+	return ast.Stmt.SSA(block, ctx, gen)
+}
+
+// joinBlocks joins the block and the blocks branching to the target
+// block into the target block. The start block is the block where the
+// joined paths started. The variable values of the target block are
+// selected from the values of the joined paths. If the target is nil,
+// no statement branched to it and the function returns the block.
+func (ctx *Codegen) joinBlocks(loc utils.Locator, start, block,
+	target *ssa.Block, gen *ssa.Generator) (*ssa.Block, []ssa.Value, error) {
+
+	if target == nil {
+		return block, nil, nil
+	}
+	if !block.Dead {
+		block.SetNext(target)
+	}
+	if len(target.From) == 1 {
+		target.Bindings = target.From[0].Bindings.Clone()
+		return target, nil, nil
+	}
+
+	// The target block must not have bindings when the values of the
+	// paths are resolved.
+	rctx := ssa.NewReturnBindingCTX()
+	bindings := start.Bindings.Clone()
+	for _, b := range start.Bindings.Values {
+		v, _, ok := start.ReturnBinding(rctx, b.Name, target, gen)
+		if !ok {
+			continue
+		}
+		lValue := gen.NewVal(b.Name, b.Type, b.Scope)
+		err := bindings.Set(lValue, &v)
+		if err != nil {
+			return nil, nil, ctx.Error(loc, err.Error())
+		}
+	}
+	target.Bindings = bindings
+	return target, nil, nil
+}
+
+// returnTypeError creates an error for the return value idx that
+// can't be assigned to the result type. The exprs are the return
+// statement's expressions; a single multi-valued call provides all
+// return values.
+func returnTypeError(ctx *Codegen, exprs []AST, idx int, v ssa.Value,
+	t types.Info) error {
+
+	expr := exprs[0]
+	if idx < len(exprs) {
+		expr = exprs[idx]
+	}
+	return ctx.Errorf(expr,
+		"cannot use %s (type %v) as type %s in return argument",
+		expr, v.Type, t)
+}
+
 func (ast *Return) error(ctx *Codegen, message string, have [][]ssa.Value,
 	want []*Variable) error {
 
@@ -1135,11 +1665,14 @@ func (ast *For) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		}
 	}
 
+	loop := ctx.PushLoop(false)
+
+	start := block
+
 	// Expand body as long as condition is true.
 	for i := 0; ; i++ {
-		if i >= gen.Params.MaxLoopUnroll {
-			return nil, nil, ctx.Errorf(ast,
-				"for-loop unroll limit exceeded: %d", i)
+		if i >= gen.Params.LoopLimit() {
+			return nil, nil, loopLimitError(ctx, gen, ast, i)
 		}
 		constVal, ok, err := ast.Cond.Eval(env, ctx, gen)
 		if err != nil {
@@ -1161,10 +1694,13 @@ func (ast *For) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		block.Bindings = env.Bindings
 
 		// Expand block.
-		block, _, err = ast.Body.SSA(block, ctx, gen)
+		block, err = ast.Body.iterationSSA(block, ctx, gen, loop)
 		if err != nil {
 			return nil, nil, err
 		}
+		if block.Dead {
+			break
+		}
 
 		// Increment.
 		env = NewEnv(block)
@@ -1178,7 +1714,44 @@ func (ast *For) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		}
 	}
 
-	return block, nil, nil
+	ctx.PopLoop()
+
+	return ctx.joinBlocks(ast, start, block, loop.Exit, gen)
+}
+
+// iterationSSA generates SSA code for one iteration of the loop body.
+// The continue statements of the iteration are joined into the block
+// that the function returns.
+func (ast List) iterationSSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator, loop *Loop) (*ssa.Block, error) {
+
+	err := ctx.checkContext(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	loop.Cont = nil
+	start := block
+
+	block, _, err = ast.SSA(block, ctx, gen)
+	if err != nil {
+		return nil, err
+	}
+	block, _, err = ctx.joinBlocks(ast, start, block, loop.Cont, gen)
+	return block, err
+}
+
+// loopLimitError creates an error for the loop that exceeds the loop
+// unrolling limit with count iterations.
+func loopLimitError(ctx *Codegen, gen *ssa.Generator, loop AST,
+	count int) error {
+
+	if gen.Params.LoopLimit() < gen.Params.MaxLoopUnroll {
+		return ctx.Errorf(loop,
+			"loop unrolling disabled: loop exceeds %d iterations",
+			utils.NoUnrollLimit)
+	}
+	return ctx.Errorf(loop, "for-loop unroll limit exceeded: %d", count)
 }
 
 // SSA implements the compiler.ast.AST.SSA for for statements.
@@ -1197,7 +1770,7 @@ func (ast *ForRange) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 				"range clause supports only identifiers")
 		}
 		name := ref.Name.Name
-		if name == "_" {
+		if ref.IsBlank() {
 			name = ""
 		}
 		switch idx {
@@ -1251,6 +1824,13 @@ func (ast *ForRange) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		return nil, nil, ctx.Errorf(ast.Expr,
 			"cannot range over unspecified element type %v", it)
 	}
+	if count > gen.Params.LoopLimit() {
+		return nil, nil, loopLimitError(ctx, gen, ast, count)
+	}
+
+	loop := ctx.PushLoop(false)
+
+	start := block
 
 	// Expand body for each element in value.
 	for i := 0; i < count; i++ {
@@ -1282,7 +1862,7 @@ func (ast *ForRange) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 
 		// Value variable.
 		if len(valVar) > 0 {
-			r := gen.AnonVal(it)
+			r := gen.AnonValFor(it, ast)
 
 			switch values.Type.Type {
 			case types.TArray:
@@ -1326,13 +1906,18 @@ func (ast *ForRange) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		}
 
 		// Expand block.
-		block, _, err = ast.Body.SSA(block, ctx, gen)
+		block, err = ast.Body.iterationSSA(block, ctx, gen, loop)
 		if err != nil {
 			return nil, nil, err
 		}
+		if block.Dead {
+			break
+		}
 	}
 
-	return block, nil, nil
+	ctx.PopLoop()
+
+	return ctx.joinBlocks(ast, start, block, loop.Exit, gen)
 }
 
 func isPowerOf2(ast AST, env *Env, ctx *Codegen, gen *ssa.Generator) (
@@ -1452,7 +2037,7 @@ func (ast *Binary) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	if err != nil {
 		return nil, nil, err
 	}
-	t := gen.AnonVal(resultType)
+	t := gen.AnonValFor(resultType, ast)
 
 	var instr ssa.Instr
 	switch ast.Op {
@@ -1555,8 +2140,19 @@ func (ast *Binary) resultType(ctx *Codegen, l, r ssa.Value) (
 		}
 		resultType = l.Type
 
-	case BinaryLt, BinaryLe, BinaryGt, BinaryGe, BinaryEq, BinaryNeq,
-		BinaryAnd, BinaryOr:
+	case BinaryEq, BinaryNeq:
+		// Arrays and structs are compared bitwise so the operands
+		// must be of the same type.
+		if isComposite(l.Type) || isComposite(r.Type) {
+			if !l.Type.Equal(r.Type) {
+				return types.Undefined,
+					ctx.Errorf(ast, "invalid types: %s %s %s",
+						l.Type, ast.Op, r.Type)
+			}
+		}
+		resultType = types.Bool
+
+	case BinaryLt, BinaryLe, BinaryGt, BinaryGe, BinaryAnd, BinaryOr:
 		resultType = types.Bool
 
 	default:
@@ -1567,6 +2163,10 @@ func (ast *Binary) resultType(ctx *Codegen, l, r ssa.Value) (
 	return resultType, nil
 }
 
+func isComposite(t types.Info) bool {
+	return t.Type == types.TArray || t.Type == types.TStruct
+}
+
 func (ast *Binary) value(env *Env, val AST, block *ssa.Block, ctx *Codegen,
 	gen *ssa.Generator) (*ssa.Block, ssa.Value, error) {
 
@@ -1614,7 +2214,7 @@ func (ast *Binary) constMult(v ssa.Value, c int64, block *ssa.Block,
 
 	shift := gen.Constant(int64(count), types.Undefined)
 
-	t := gen.AnonVal(v.Type)
+	t := gen.AnonValFor(v.Type, ast)
 	instr := ssa.NewLshiftInstr(v, shift, t)
 	block.AddInstr(instr)
 
@@ -1649,7 +2249,7 @@ func (ast *Unary) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		}
 		expr := exprs[0]
 
-		t := gen.AnonVal(expr.Type)
+		t := gen.AnonValFor(expr.Type, ast)
 		switch expr.Type.Type {
 		case types.TInt, types.TUint:
 			zero := gen.Constant(int64(0), types.Undefined)
@@ -1680,7 +2280,7 @@ func (ast *Unary) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 				"invalid operation: operator ! not defined on %v (%v)",
 				ast.Expr, expr.Type)
 		}
-		t := gen.AnonVal(expr.Type)
+		t := gen.AnonValFor(expr.Type, ast)
 		instr, err := ssa.NewNotInstr(expr, t)
 		if err != nil {
 			return nil, nil, err
@@ -1902,7 +2502,7 @@ func (ast *Slice) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 				MinBits:     bits,
 				ElementType: &et,
 			}
-			t = gen.AnonVal(ti)
+			t = gen.AnonValFor(ti, ast)
 			t.PtrInfo = &ptrInfo
 		} else {
 			return nil, nil, ctx.Errorf(ast, "slice of %s not supported",
@@ -1920,7 +2520,7 @@ func (ast *Slice) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 			ti.ArraySize = ti.Bits / ti.ElementType.Bits
 		}
 
-		t = gen.AnonVal(ti)
+		t = gen.AnonValFor(ti, ast)
 	}
 	if bits > 0 {
 		fromConst := gen.Constant(int64(from*elementSize), types.Undefined)
@@ -1998,7 +2598,7 @@ func (ast *Index) constIndex(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
 			MinBits:    types.ByteBits,
 		}
 
-		t := gen.AnonVal(indexType)
+		t := gen.AnonValFor(indexType, ast)
 		if to > from {
 			fromConst := gen.Constant(from, types.Undefined)
 			toConst := gen.Constant(to, types.Undefined)
@@ -2016,7 +2616,7 @@ func (ast *Index) constIndex(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
 		from := int64(index*it.ElementType.Bits + ptrInfo.Offset)
 		to := int64((index+1)*it.ElementType.Bits + ptrInfo.Offset)
 
-		t := gen.AnonVal(*it.ElementType)
+		t := gen.AnonValFor(*it.ElementType, ast)
 		if to > from {
 			fromConst := gen.Constant(from, types.Undefined)
 			toConst := gen.Constant(to, types.Undefined)
@@ -2053,7 +2653,7 @@ func (ast *Index) index(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
 	switch it.Type {
 	case types.TArray:
 		offset := gen.Constant(int64(ptrInfo.Offset), types.Undefined)
-		t := gen.AnonVal(*it.ElementType)
+		t := gen.AnonValFor(*it.ElementType, ast)
 		block.AddInstr(ssa.NewIndexInstr(expr, offset, index, t))
 		return block, []ssa.Value{t}, nil
 
@@ -2068,12 +2668,19 @@ func (ast *Index) index(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
 func (ast *VariableRef) SSA(block *ssa.Block, ctx *Codegen,
 	gen *ssa.Generator) (*ssa.Block, []ssa.Value, error) {
 
+	if ast.IsBlank() {
+		return nil, nil, ctx.Errorf(ast, "cannot use _ as value")
+	}
+
 	lrv, _, _, err := ctx.LookupVar(block, gen, block.Bindings, ast)
 	if err != nil {
 		return nil, nil, ctx.Error(ast, err.Error())
 	}
 
-	value := lrv.RValue()
+	value, err := lrv.RValue()
+	if err != nil {
+		return nil, nil, ctx.Error(ast, err.Error())
+	}
 	if value.Const {
 		gen.AddConstant(value)
 	}
@@ -2144,7 +2751,7 @@ func (ast *Make) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	init := gen.Constant(initVal, typeInfo)
 	gen.AddConstant(init)
 
-	v := gen.AnonVal(typeInfo)
+	v := gen.AnonValFor(typeInfo, ast)
 	block.AddInstr(ssa.NewMovInstr(init, v))
 
 	return block, []ssa.Value{v}, nil
@@ -0,0 +1,214 @@
+//
+// unused.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ast
+
+import (
+	"github.com/markkurossi/mpc/compiler/ssa"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+// varRef identifies an SSA value bound to a named variable.
+type varRef struct {
+	Name string
+	ID   ssa.ValueID
+}
+
+// varDecl describes a local variable declaration.
+type varDecl struct {
+	Loc  utils.Point
+	Name string
+}
+
+// varStore describes an assignment to a local variable. The Bound
+// value is the value the variable is bound to after the assignment
+// and Out is the output of the mov instruction implementing the
+// assignment.
+type varStore struct {
+	Loc   utils.Point
+	Name  string
+	Decl  *varDecl
+	Bound ssa.ValueID
+	Out   ssa.ValueID
+}
+
+type usage struct {
+	decls   []*varDecl
+	stores  []*varStore
+	byRef   map[varRef]*varStore
+	storeOp map[ssa.ValueID]bool
+	reads   map[varRef]bool
+}
+
+func newUsage() *usage {
+	return &usage{
+		byRef:   make(map[varRef]*varStore),
+		storeOp: make(map[ssa.ValueID]bool),
+		reads:   make(map[varRef]bool),
+	}
+}
+
+// trackVar tests if the variable stores of name are tracked for the
+// unused variables check. Only local variables of the functions of
+// the compiled package are tracked; package variables and named
+// return values are read implicitly. Library packages are compiled
+// only for the instances the program calls so their variables can
+// look unused for the program.
+func (ctx *Codegen) trackVar(name string) bool {
+	f := ctx.Func()
+	if f == nil || name == "_" || f.Source != ctx.Package.Source {
+		return false
+	}
+	for _, ret := range f.Return {
+		if ret.Name == name {
+			return false
+		}
+	}
+	return true
+}
+
+// defineVar records the declaration of the local variable name. The
+// bound is the value the variable is bound to and out is the output
+// value of the mov instruction initializing the variable.
+func (ctx *Codegen) defineVar(loc utils.Locator, name string,
+	bound, out ssa.Value) {
+
+	if !ctx.trackVar(name) || bound.TypeRef {
+		// Type values are not variables.
+		return
+	}
+	decl := &varDecl{
+		Loc:  loc.Location(),
+		Name: name,
+	}
+	ctx.usage.decls = append(ctx.usage.decls, decl)
+	ctx.addStore(loc, name, decl, bound, out)
+}
+
+// assignVar records the assignment of the local variable name. The
+// old specifies the variable binding before the assignment.
+func (ctx *Codegen) assignVar(loc utils.Locator, name string,
+	old ssa.BindingValue, bound, out ssa.Value) {
+
+	if !ctx.trackVar(name) {
+		return
+	}
+	ctx.addStore(loc, name, ctx.declOf(name, old), bound, out)
+}
+
+// declOf returns the declaration of the variable name that is bound
+// to the binding value b.
+func (ctx *Codegen) declOf(name string, b ssa.BindingValue) *varDecl {
+	switch v := b.(type) {
+	case *ssa.Value:
+		store, ok := ctx.usage.byRef[varRef{
+			Name: name,
+			ID:   v.ID,
+		}]
+		if ok {
+			return store.Decl
+		}
+	case *ssa.Select:
+		decl := ctx.declOf(name, v.True)
+		if decl == nil {
+			decl = ctx.declOf(name, v.False)
+		}
+		return decl
+	}
+	return nil
+}
+
+func (ctx *Codegen) addStore(loc utils.Locator, name string, decl *varDecl,
+	bound, out ssa.Value) {
+
+	store := &varStore{
+		Loc:   loc.Location(),
+		Name:  name,
+		Decl:  decl,
+		Bound: bound.ID,
+		Out:   out.ID,
+	}
+	ctx.usage.stores = append(ctx.usage.stores, store)
+	ctx.usage.byRef[varRef{
+		Name: name,
+		ID:   bound.ID,
+	}] = store
+	ctx.usage.storeOp[out.ID] = true
+}
+
+// readVar marks the value v of the variable name read.
+func (ctx *Codegen) readVar(name string, v ssa.Value) {
+	ctx.usage.reads[varRef{
+		Name: name,
+		ID:   v.ID,
+	}] = true
+}
+
+// checkUnused warns about local variables that are declared but
+// never read and about assignments whose values are never used. The
+// check is done for the program steps so that values consumed by
+// instructions count as uses. The check can be silenced by assigning
+// the variable to the blank identifier.
+func (ctx *Codegen) checkUnused(steps []ssa.Step) {
+	inputs := make(map[ssa.ValueID]bool)
+	for _, step := range steps {
+		if step.Instr.Op == ssa.Mov && step.Instr.Out != nil &&
+			ctx.usage.storeOp[step.Instr.Out.ID] {
+			// Variable assignment, not a use.
+			continue
+		}
+		for _, in := range step.Instr.In {
+			inputs[in.ID] = true
+		}
+	}
+
+	// The same source location can be instantiated many times in
+	// unrolled loops and in different function instances. The
+	// location is used if any of its instances is used.
+	usedStores := make(map[varDecl]bool)
+	usedDecls := make(map[*varDecl]bool)
+	var order []varDecl
+
+	for _, store := range ctx.usage.stores {
+		used := inputs[store.Bound] || ctx.usage.reads[varRef{
+			Name: store.Name,
+			ID:   store.Bound,
+		}]
+		key := varDecl{
+			Loc:  store.Loc,
+			Name: store.Name,
+		}
+		if _, ok := usedStores[key]; !ok {
+			order = append(order, key)
+		}
+		usedStores[key] = usedStores[key] || used
+		if used && store.Decl != nil {
+			usedDecls[store.Decl] = true
+		}
+	}
+
+	declared := make(map[varDecl]bool)
+	for _, decl := range ctx.usage.decls {
+		key := *decl
+		declared[key] = declared[key] || usedDecls[decl]
+	}
+
+	for _, key := range order {
+		used, ok := declared[key]
+		if ok {
+			if !used {
+				ctx.Warningf(key.Loc, "%s declared and not used", key.Name)
+			}
+			continue
+		}
+		if !usedStores[key] {
+			ctx.Warningf(key.Loc, "value assigned to %s is never used",
+				key.Name)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+//
+// circ_abs.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+// NewAbs creates a circuit computing the absolute value r=|x| of the
+// signed two's complement value x. The circuit negates x
+// conditionally by its sign bit s as r=(x XOR s)+s. The result r is
+// unsigned and it must have len(x) bits. The absolute value of the
+// most negative value -2^(len(x)-1) is 2^(len(x)-1), which fits in
+// the unsigned result.
+func NewAbs(cc *Compiler, x, r []*Wire) error {
+	if len(x) == 0 || len(r) != len(x) {
+		return fmt.Errorf("invalid abs arguments: x=%d, r=%d", len(x), len(r))
+	}
+	sign := x[len(x)-1]
+
+	t := make([]*Wire, len(x))
+	for i := range x {
+		t[i] = cc.Calloc.Wire()
+		cc.AddGate(cc.Calloc.BinaryGate(circuit.XOR, x[i], sign, t[i]))
+	}
+	return NewAdder(cc, t, []*Wire{sign}, r)
+}
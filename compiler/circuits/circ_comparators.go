@@ -60,6 +60,58 @@ func NewLeComparator(cc *Compiler, x, y, r []*Wire) error {
 	return comparator(cc, cc.OneWire(), y, x, r)
 }
 
+// NewCompare creates a three-way comparator that sets r to -1, 0, or
+// 1 if x is smaller than, equal to, or bigger than y. The signed
+// argument specifies if x and y are signed integers. The result is
+// built from lt and gt comparators and it is sign extended to the
+// width of r.
+func NewCompare(cc *Compiler, signed bool, x, y, r []*Wire) error {
+	if len(r) < 2 {
+		return fmt.Errorf("invalid compare arguments: r=%d", len(r))
+	}
+	n := len(x)
+	if len(y) > n {
+		n = len(y)
+	}
+	x = resize(cc, signed, x, n)
+	y = resize(cc, signed, y, n)
+	if signed {
+		x, y = swapSignBits(x, y)
+	}
+
+	lt := cc.Calloc.Wire()
+	err := NewLtComparator(cc, x, y, []*Wire{lt})
+	if err != nil {
+		return err
+	}
+	gt := cc.Calloc.Wire()
+	err = NewGtComparator(cc, x, y, []*Wire{gt})
+	if err != nil {
+		return err
+	}
+
+	// The lt and gt are never set at the same time so the two's
+	// complement result is lt:(lt^gt).
+	cc.AddGate(cc.Calloc.BinaryGate(circuit.XOR, lt, gt, r[0]))
+	for i := 1; i < len(r); i++ {
+		r[i] = lt
+	}
+	return nil
+}
+
+// swapSignBits returns copies of the equal-sized x and y with their
+// sign bits swapped. This maps the signed order of x and y into the
+// unsigned order of the comparators.
+func swapSignBits(x, y []*Wire) ([]*Wire, []*Wire) {
+	msb := len(x) - 1
+	sx := make([]*Wire, len(x))
+	copy(sx, x)
+	sy := make([]*Wire, len(y))
+	copy(sy, y)
+	sx[msb], sy[msb] = y[msb], x[msb]
+	return sx, sy
+}
+
 // NewNeqComparator tewsts if x!=y.
 func NewNeqComparator(cc *Compiler, x, y, r []*Wire) error {
 	x, y = cc.ZeroPad(x, y)
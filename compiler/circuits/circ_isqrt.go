@@ -0,0 +1,76 @@
+//
+// circ_isqrt.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// NewIsqrt creates an integer square root circuit computing
+// r=floor(sqrt(x)). The circuit implements the bit-by-bit algorithm
+// that determines one root bit per step, starting from the most
+// significant bit. Each step subtracts the trial value 4*root+1 from
+// the partial remainder and the subtractor's borrow bit selects the
+// root bit and the next remainder with a multiplexer. The result r
+// must have (len(x)+1)/2 bits.
+func NewIsqrt(cc *Compiler, x, r []*Wire) error {
+	k := (len(x) + 1) / 2
+	if len(x) == 0 || len(r) != k {
+		return fmt.Errorf("invalid isqrt arguments: x=%d, r=%d",
+			len(x), len(r))
+	}
+	x = cc.zeroExtend(x, 2*k)
+
+	// The partial remainder is at most 2*root so it fits in k+2
+	// bits.
+	m := k + 2
+	rem := make([]*Wire, m)
+	for i := range rem {
+		rem[i] = cc.ZeroWire()
+	}
+
+	for i := k - 1; i >= 0; i-- {
+		// shifted = rem<<2 | x[2i+1:2i]
+		shifted := make([]*Wire, m)
+		shifted[0] = x[2*i]
+		shifted[1] = x[2*i+1]
+		copy(shifted[2:], rem[:m-2])
+
+		// trial = root<<2 | 1 where the root bits above the bit
+		// i are already set.
+		trial := make([]*Wire, m)
+		trial[0] = cc.OneWire()
+		for j := 1; j < m; j++ {
+			trial[j] = cc.ZeroWire()
+		}
+		copy(trial[2:], r[i+1:])
+
+		diff := cc.Calloc.Wires(types.Size(m + 1))
+		err := NewSubtractor(cc, shifted, trial, diff)
+		if err != nil {
+			return err
+		}
+		borrow := diff[m]
+
+		// The root bit is set if the trial value did not exceed
+		// the remainder.
+		cc.INV(borrow, r[i])
+		if i == 0 {
+			break
+		}
+		rem = cc.Calloc.Wires(types.Size(m))
+		err = NewMUX(cc, []*Wire{borrow}, shifted, diff[:m], rem)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
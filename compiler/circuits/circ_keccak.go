@@ -0,0 +1,138 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+const (
+	keccakLanes    = 25
+	keccakLaneBits = 64
+	keccakRounds   = 24
+)
+
+// keccakRC defines the Keccak-f[1600] round constants.
+var keccakRC = [keccakRounds]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808A,
+	0x8000000080008000, 0x000000000000808B, 0x0000000080000001,
+	0x8000000080008081, 0x8000000000008009, 0x000000000000008A,
+	0x0000000000000088, 0x0000000080008009, 0x000000008000000A,
+	0x000000008000808B, 0x800000000000008B, 0x8000000000008089,
+	0x8000000000008003, 0x8000000000008002, 0x8000000000000080,
+	0x000000000000800A, 0x800000008000000A, 0x8000000080008081,
+	0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+// keccakRho defines the rotation offsets of the lanes A[x,y],
+// indexed by x+5y.
+var keccakRho = [keccakLanes]int{
+	0, 1, 62, 28, 27,
+	36, 44, 6, 55, 20,
+	3, 10, 43, 25, 39,
+	41, 45, 15, 21, 8,
+	18, 2, 61, 56, 14,
+}
+
+// NewKeccakF1600 creates a Keccak-f[1600] permutation circuit. The
+// argument state holds the lanes A[x,y] in the bits 64*(x+5y) ...
+// 64*(x+5y)+63 and the permuted state is returned in r.
+func NewKeccakF1600(cc *Compiler, state, r []*Wire) error {
+	if len(state) != keccakLanes*keccakLaneBits || len(r) != len(state) {
+		return fmt.Errorf("invalid keccak arguments: state=%d, r=%d",
+			len(state), len(r))
+	}
+	var a [keccakLanes][]*Wire
+	for i := 0; i < keccakLanes; i++ {
+		a[i] = state[i*keccakLaneBits : (i+1)*keccakLaneBits]
+	}
+
+	for round := 0; round < keccakRounds; round++ {
+		// Theta.
+		var c [5][]*Wire
+		for x := 0; x < 5; x++ {
+			c[x] = a[x]
+			for y := 1; y < 5; y++ {
+				c[x] = keccakXOR(cc, c[x], a[x+5*y])
+			}
+		}
+		for x := 0; x < 5; x++ {
+			d := keccakXOR(cc, c[(x+4)%5], keccakRotate(c[(x+1)%5], 1))
+			for y := 0; y < 5; y++ {
+				a[x+5*y] = keccakXOR(cc, a[x+5*y], d)
+			}
+		}
+
+		// Rho and pi: B[y,2x+3y] = rot(A[x,y], rho[x,y]). The
+		// rotations are wire permutations.
+		var b [keccakLanes][]*Wire
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				b[y+5*((2*x+3*y)%5)] = keccakRotate(a[x+5*y],
+					keccakRho[x+5*y])
+			}
+		}
+
+		// Chi: A[x,y] = B[x,y] ^ (^B[x+1,y] & B[x+2,y]).
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				b1 := b[(x+1)%5+5*y]
+				b2 := b[(x+2)%5+5*y]
+				lane := make([]*Wire, keccakLaneBits)
+				for z := 0; z < keccakLaneBits; z++ {
+					inv := cc.Calloc.Wire()
+					cc.INV(b1[z], inv)
+					and := cc.Calloc.Wire()
+					cc.AddGate(cc.Calloc.BinaryGate(circuit.AND, inv, b2[z],
+						and))
+					lane[z] = cc.Calloc.Wire()
+					cc.AddGate(cc.Calloc.BinaryGate(circuit.XOR, b[x+5*y][z],
+						and, lane[z]))
+				}
+				a[x+5*y] = lane
+			}
+		}
+
+		// Iota.
+		lane := make([]*Wire, keccakLaneBits)
+		copy(lane, a[0])
+		for z := 0; z < keccakLaneBits; z++ {
+			if keccakRC[round]&(1<<z) != 0 {
+				lane[z] = cc.Calloc.Wire()
+				cc.INV(a[0][z], lane[z])
+			}
+		}
+		a[0] = lane
+	}
+
+	for i := 0; i < keccakLanes; i++ {
+		for z := 0; z < keccakLaneBits; z++ {
+			cc.ID(a[i][z], r[i*keccakLaneBits+z])
+		}
+	}
+	return nil
+}
+
+func keccakXOR(cc *Compiler, x, y []*Wire) []*Wire {
+	result := make([]*Wire, len(x))
+	for i := range x {
+		result[i] = cc.Calloc.Wire()
+		cc.AddGate(cc.Calloc.BinaryGate(circuit.XOR, x[i], y[i], result[i]))
+	}
+	return result
+}
+
+// keccakRotate rotates the lane w left by n bits.
+func keccakRotate(w []*Wire, n int) []*Wire {
+	result := make([]*Wire, len(w))
+	for i := range w {
+		result[(i+n)%len(w)] = w[i]
+	}
+	return result
+}
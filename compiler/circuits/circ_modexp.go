@@ -0,0 +1,96 @@
+//
+// circ_modexp.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// NewModExp creates a modular exponentiation circuit computing
+// r=b**e mod m. The circuit implements the left-to-right
+// square-and-multiply algorithm where each exponent bit selects the
+// multiplied or the squared value with a multiplexer. The arguments
+// b, m, and r must be of the same width. The modulus m must not be 0.
+func NewModExp(cc *Compiler, b, e, m, r []*Wire) error {
+	n := len(m)
+	if len(b) != n || len(r) != n || len(e) == 0 {
+		return fmt.Errorf("invalid modexp arguments: b=%d, e=%d, m=%d, r=%d",
+			len(b), len(e), len(m), len(r))
+	}
+
+	// mulMod computes x*y mod m with a double-width product.
+	mulMod := func(x, y []*Wire) ([]*Wire, error) {
+		z := cc.Calloc.Wires(types.Size(n * 2))
+		err := NewMultiplier(cc, cc.Params.CircMultArrayTreshold,
+			cc.zeroExtend(x, n*2), cc.zeroExtend(y, n*2), z)
+		if err != nil {
+			return nil, err
+		}
+		rem := cc.Calloc.Wires(types.Size(n))
+		err = NewDivider(cc, z, m, nil, rem)
+		if err != nil {
+			return nil, err
+		}
+		return rem, nil
+	}
+
+	// base = b mod m
+	base := cc.Calloc.Wires(types.Size(n))
+	err := NewDivider(cc, b, m, nil, base)
+	if err != nil {
+		return err
+	}
+
+	// acc = 1 mod m
+	one := make([]*Wire, n)
+	one[0] = cc.OneWire()
+	for i := 1; i < n; i++ {
+		one[i] = cc.ZeroWire()
+	}
+	acc := cc.Calloc.Wires(types.Size(n))
+	err = NewDivider(cc, one, m, nil, acc)
+	if err != nil {
+		return err
+	}
+
+	for i := len(e) - 1; i >= 0; i-- {
+		acc, err = mulMod(acc, acc)
+		if err != nil {
+			return err
+		}
+		prod, err := mulMod(acc, base)
+		if err != nil {
+			return err
+		}
+		var out []*Wire
+		if i == 0 {
+			out = r
+		} else {
+			out = cc.Calloc.Wires(types.Size(n))
+		}
+		err = NewMUX(cc, e[i:i+1], prod, acc, out)
+		if err != nil {
+			return err
+		}
+		acc = out
+	}
+	return nil
+}
+
+// zeroExtend extends the wires w to size bits with zero wires.
+func (cc *Compiler) zeroExtend(w []*Wire, size int) []*Wire {
+	result := make([]*Wire, size)
+	copy(result, w)
+	for i := len(w); i < size; i++ {
+		result[i] = cc.ZeroWire()
+	}
+	return result
+}
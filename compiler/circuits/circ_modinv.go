@@ -0,0 +1,258 @@
+//
+// circ_modinv.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/types"
+)
+
+// NewModInverse creates a modular inverse circuit computing r=a**-1
+// mod m. The circuit implements the binary extended GCD algorithm
+// that maintains the values u=A*a+B*m and v=C*a+D*m. Each step halves
+// an even value of u and v, or subtracts the smaller odd value from
+// the larger one, until u is zero and v is gcd(a, m). The
+// coefficients A and C are kept in the range [0, m) so the result is
+// the coefficient C. The circuit runs the worst-case number of steps
+// and multiplexers select the operation of each step. The result is 0
+// if the inverse does not exist. The arguments a, m, and r must be of
+// the same width.
+func NewModInverse(cc *Compiler, a, m, r []*Wire) error {
+	n := len(m)
+	if n == 0 || len(a) != n || len(r) != n {
+		return fmt.Errorf("invalid modinverse arguments: a=%d, m=%d, r=%d",
+			len(a), len(m), len(r))
+	}
+	// The coefficients B and D are in the range (-2**n, 2**n) and
+	// their intermediate values are in the range (-2**(n+2),
+	// 2**(n+2)).
+	w := n + 3
+
+	and := func(x, y *Wire) *Wire {
+		o := cc.Calloc.Wire()
+		cc.AddGate(cc.Calloc.BinaryGate(circuit.AND, x, y, o))
+		return o
+	}
+	or := func(x, y *Wire) *Wire {
+		o := cc.Calloc.Wire()
+		cc.AddGate(cc.Calloc.BinaryGate(circuit.OR, x, y, o))
+		return o
+	}
+	inv := func(x *Wire) *Wire {
+		o := cc.Calloc.Wire()
+		cc.INV(x, o)
+		return o
+	}
+	mux := func(cond *Wire, t, f []*Wire) ([]*Wire, error) {
+		o := cc.Calloc.Wires(types.Size(len(t)))
+		return o, NewMUX(cc, []*Wire{cond}, t, f, o)
+	}
+	add := func(x, y []*Wire, bits int) ([]*Wire, error) {
+		o := cc.Calloc.Wires(types.Size(bits))
+		return o, NewAdder(cc, x, y, o)
+	}
+	sub := func(x, y []*Wire, bits int) ([]*Wire, error) {
+		o := cc.Calloc.Wires(types.Size(bits))
+		return o, NewSubtractor(cc, x, y, o)
+	}
+	constant := func(bits, value int) []*Wire {
+		o := make([]*Wire, bits)
+		for i := range o {
+			if i == 0 && value == 1 {
+				o[i] = cc.OneWire()
+			} else {
+				o[i] = cc.ZeroWire()
+			}
+		}
+		return o
+	}
+
+	x := cc.zeroExtend(a, w)
+
+	u := a
+	v := m
+	A := constant(n, 1)
+	B := constant(w, 0)
+	C := constant(n, 0)
+	D := constant(w, 1)
+
+	// The halvings decrease the total bit length of u and v by one
+	// and there is a halving between two subtractions.
+	steps := max(4*n-3, 1)
+
+	for i := 0; i < steps; i++ {
+		nz := cc.Calloc.Wire()
+		err := NewNeqComparator(cc, u, constant(n, 0), []*Wire{nz})
+		if err != nil {
+			return err
+		}
+		ge := cc.Calloc.Wire()
+		err = NewGeComparator(cc, u, v, []*Wire{ge})
+		if err != nil {
+			return err
+		}
+		uEven := inv(u[0])
+		halve := inv(and(u[0], v[0]))
+
+		// Halve u if it is even, and v otherwise.
+		p, err := mux(uEven, u, v)
+		if err != nil {
+			return err
+		}
+		P, err := mux(uEven, A, C)
+		if err != nil {
+			return err
+		}
+		Q, err := mux(uEven, B, D)
+		if err != nil {
+			return err
+		}
+		pHalf := append(p[1:], cc.ZeroWire())
+
+		// The coefficients are halved as such if they are even and
+		// after adding (m, -a) otherwise.
+		odd := or(P[0], Q[0])
+		Pm, err := add(P, m, n+1)
+		if err != nil {
+			return err
+		}
+		Pm, err = mux(odd, Pm, cc.zeroExtend(P, n+1))
+		if err != nil {
+			return err
+		}
+		PHalf := Pm[1:]
+		Qa, err := sub(Q, x, w)
+		if err != nil {
+			return err
+		}
+		Qa, err = mux(odd, Qa, Q)
+		if err != nil {
+			return err
+		}
+		QHalf := append(Qa[1:], Qa[w-1])
+
+		// Subtract the smaller value from the larger one. The
+		// negative differences of the coefficients are corrected
+		// by adding (m, -a).
+		hi, err := mux(ge, u, v)
+		if err != nil {
+			return err
+		}
+		lo, err := mux(ge, v, u)
+		if err != nil {
+			return err
+		}
+		s, err := sub(hi, lo, n)
+		if err != nil {
+			return err
+		}
+		hi, err = mux(ge, A, C)
+		if err != nil {
+			return err
+		}
+		lo, err = mux(ge, C, A)
+		if err != nil {
+			return err
+		}
+		S, err := sub(hi, lo, n+1)
+		if err != nil {
+			return err
+		}
+		neg := S[n]
+		Sm, err := add(S, m, n+1)
+		if err != nil {
+			return err
+		}
+		S, err = mux(neg, Sm[:n], S[:n])
+		if err != nil {
+			return err
+		}
+		hi, err = mux(ge, B, D)
+		if err != nil {
+			return err
+		}
+		lo, err = mux(ge, D, B)
+		if err != nil {
+			return err
+		}
+		T, err := sub(hi, lo, w)
+		if err != nil {
+			return err
+		}
+		Ta, err := sub(T, x, w)
+		if err != nil {
+			return err
+		}
+		T, err = mux(neg, Ta, T)
+		if err != nil {
+			return err
+		}
+
+		// Select the operation and its target value. Nothing is
+		// updated after u is zero.
+		np, err := mux(halve, pHalf, s)
+		if err != nil {
+			return err
+		}
+		nP, err := mux(halve, PHalf, S)
+		if err != nil {
+			return err
+		}
+		nQ, err := mux(halve, QHalf, T)
+		if err != nil {
+			return err
+		}
+		toU, err := mux(halve, []*Wire{uEven}, []*Wire{ge})
+		if err != nil {
+			return err
+		}
+		updU := and(nz, toU[0])
+		updV := and(nz, inv(toU[0]))
+
+		if u, err = mux(updU, np, u); err != nil {
+			return err
+		}
+		if A, err = mux(updU, nP, A); err != nil {
+			return err
+		}
+		if B, err = mux(updU, nQ, B); err != nil {
+			return err
+		}
+		if v, err = mux(updV, np, v); err != nil {
+			return err
+		}
+		if C, err = mux(updV, nP, C); err != nil {
+			return err
+		}
+		if D, err = mux(updV, nQ, D); err != nil {
+			return err
+		}
+	}
+
+	// The inverse exists if gcd(a, m) is 1 and m is not 1. The
+	// algorithm requires that a or m is odd but their gcd is even
+	// otherwise.
+	one := cc.Calloc.Wire()
+	err := NewEqComparator(cc, v, constant(n, 1), []*Wire{one})
+	if err != nil {
+		return err
+	}
+	m1 := cc.Calloc.Wire()
+	err = NewNeqComparator(cc, m, constant(n, 1), []*Wire{m1})
+	if err != nil {
+		return err
+	}
+	ok := and(and(one, m1), or(a[0], m[0]))
+	for i := 0; i < n; i++ {
+		cc.AddGate(cc.Calloc.BinaryGate(circuit.AND, C[i], ok, r[i]))
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+// NewIntersectionSize creates a circuit that counts the elements of
+// the array a that are also elements of the array b. The arrays
+// contain elementBits wide elements. Each element of a is compared
+// against all elements of b so the circuit has len(a)*len(b)
+// equality comparators. The membership bits of the elements of a are
+// summed with an adder tree into r.
+func NewIntersectionSize(cc *Compiler, elementBits int, a, b, r []*Wire) error {
+	if elementBits <= 0 || len(a)%elementBits != 0 ||
+		len(b)%elementBits != 0 {
+		return fmt.Errorf("invalid intersection arguments: a=%d, b=%d, "+
+			"elementBits=%d", len(a), len(b), elementBits)
+	}
+	var found []*Wire
+	for i := 0; i < len(a); i += elementBits {
+		// The element is not found if it differs from all elements
+		// of b.
+		var notFound *Wire
+		for j := 0; j < len(b); j += elementBits {
+			neq := cc.Calloc.Wire()
+			err := NewNeqComparator(cc, a[i:i+elementBits],
+				b[j:j+elementBits], []*Wire{neq})
+			if err != nil {
+				return err
+			}
+			if notFound == nil {
+				notFound = neq
+			} else {
+				and := cc.Calloc.Wire()
+				cc.AddGate(cc.Calloc.BinaryGate(circuit.AND, notFound, neq,
+					and))
+				notFound = and
+			}
+		}
+		if notFound == nil {
+			found = append(found, cc.ZeroWire())
+			continue
+		}
+		w := cc.Calloc.Wire()
+		cc.INV(notFound, w)
+		found = append(found, w)
+	}
+	return NewSum(cc, false, 1, found, r)
+}
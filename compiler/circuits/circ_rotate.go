@@ -0,0 +1,69 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// rotateLeft returns the wires of x rotated left by k bits.
+func rotateLeft(x []*Wire, k int) []*Wire {
+	n := len(x)
+	k %= n
+	if k < 0 {
+		k += n
+	}
+	result := make([]*Wire, n)
+	for i := 0; i < n; i++ {
+		result[(i+k)%n] = x[i]
+	}
+	return result
+}
+
+// NewBarrelRotateLeft creates a barrel rotator circuit that rotates x
+// left by the amount k and returns the result in r. The signed
+// argument specifies if k is a signed two's complement value. The
+// rotator has a stage of multiplexers for each bit of k.
+func NewBarrelRotateLeft(cc *Compiler, x, k []*Wire, signed bool,
+	r []*Wire) error {
+
+	if len(x) != len(r) {
+		return fmt.Errorf("invalid rotate arguments: x=%d, r=%d",
+			len(x), len(r))
+	}
+	if len(x) == 0 {
+		return nil
+	}
+	n := big.NewInt(int64(len(x)))
+
+	for i := 0; i < len(k); i++ {
+		// The bit i of k rotates by 2^i bits. The sign bit of a
+		// signed k rotates by -2^i bits.
+		amount := new(big.Int).Lsh(big.NewInt(1), uint(i))
+		if signed && i+1 == len(k) {
+			amount.Neg(amount)
+		}
+		amount.Mod(amount, n)
+		if amount.Sign() == 0 {
+			continue
+		}
+		stage := cc.Calloc.Wires(types.Size(len(x)))
+		err := NewMUX(cc, []*Wire{k[i]}, rotateLeft(x, int(amount.Int64())),
+			x, stage)
+		if err != nil {
+			return err
+		}
+		x = stage
+	}
+	for i, w := range x {
+		cc.ID(w, r[i])
+	}
+	return nil
+}
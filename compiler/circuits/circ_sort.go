@@ -0,0 +1,193 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// NewSortingNetwork creates a Batcher odd-even merge sort network
+// sorting the argument elements in ascending order. The function
+// returns the wires of the sorted elements. The network is
+// data-oblivious i.e. its structure depends only on the number of
+// elements.
+func NewSortingNetwork(cc *Compiler, elems [][]*Wire) ([][]*Wire, error) {
+	n := len(elems)
+	result := make([][]*Wire, n)
+	copy(result, elems)
+
+	for p := 1; p < n; p *= 2 {
+		for k := p; k >= 1; k /= 2 {
+			for j := k % p; j+k < n; j += 2 * k {
+				for i := 0; i < k && i < n-j-k; i++ {
+					if (i+j)/(p*2) != (i+j+k)/(p*2) {
+						continue
+					}
+					lo, hi, err := compareAndSwap(cc, result[i+j],
+						result[i+j+k])
+					if err != nil {
+						return nil, err
+					}
+					result[i+j] = lo
+					result[i+j+k] = hi
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// compareAndSwap creates a compare-and-swap unit returning the
+// smaller of a and b in lo and the bigger in hi.
+func compareAndSwap(cc *Compiler, a, b []*Wire) (lo, hi []*Wire, err error) {
+	a, b = cc.ZeroPad(a, b)
+
+	lo = cc.Calloc.Wires(types.Size(len(a)))
+	hi = cc.Calloc.Wires(types.Size(len(a)))
+	err = NewCompareSwap(cc, false, a, b, lo, hi)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lo, hi, nil
+}
+
+// NewCompareSwap creates a compare-and-swap unit setting the smaller
+// of a and b to lo and the bigger to hi. The signed argument
+// specifies if a and b are signed integers. The unit is built from
+// one comparator and two multiplexers.
+func NewCompareSwap(cc *Compiler, signed bool, a, b, lo, hi []*Wire) error {
+	if len(lo) == 0 || len(lo) != len(hi) {
+		return fmt.Errorf("invalid compare-swap arguments: lo=%d, hi=%d",
+			len(lo), len(hi))
+	}
+	gt, a, b, err := newGt(cc, signed, a, b, len(lo))
+	if err != nil {
+		return err
+	}
+	err = NewMUX(cc, gt, b, a, lo)
+	if err != nil {
+		return err
+	}
+	return NewMUX(cc, gt, a, b, hi)
+}
+
+// NewMin creates a circuit that sets the smaller of a and b to r. The
+// signed argument specifies if a and b are signed integers. The
+// arguments are resized to the width of r so the same circuit works
+// for all integer widths.
+func NewMin(cc *Compiler, signed bool, a, b, r []*Wire) error {
+	if len(r) == 0 {
+		return fmt.Errorf("invalid min arguments: r=%d", len(r))
+	}
+	gt, a, b, err := newGt(cc, signed, a, b, len(r))
+	if err != nil {
+		return err
+	}
+	return NewMUX(cc, gt, b, a, r)
+}
+
+// NewMax creates a circuit that sets the bigger of a and b to r. The
+// signed argument specifies if a and b are signed integers. The
+// arguments are resized to the width of r so the same circuit works
+// for all integer widths.
+func NewMax(cc *Compiler, signed bool, a, b, r []*Wire) error {
+	if len(r) == 0 {
+		return fmt.Errorf("invalid max arguments: r=%d", len(r))
+	}
+	gt, a, b, err := newGt(cc, signed, a, b, len(r))
+	if err != nil {
+		return err
+	}
+	return NewMUX(cc, gt, a, b, r)
+}
+
+// newGt resizes a and b to n bits and creates a comparator testing if
+// a is greater than b. The function returns the comparator result
+// and the resized arguments.
+func newGt(cc *Compiler, signed bool, a, b []*Wire, n int) (
+	gt, ra, rb []*Wire, err error) {
+
+	ra = resize(cc, signed, a, n)
+	rb = resize(cc, signed, b, n)
+
+	x, y := ra, rb
+	if signed {
+		x, y = swapSignBits(ra, rb)
+	}
+	gt = []*Wire{cc.Calloc.Wire()}
+	err = NewGtComparator(cc, x, y, gt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return gt, ra, rb, nil
+}
+
+// resize truncates or extends the wires w to n bits. Signed values
+// are sign extended and unsigned values are padded with zero wires.
+func resize(cc *Compiler, signed bool, w []*Wire, n int) []*Wire {
+	if len(w) >= n {
+		return w[:n]
+	}
+	pad := cc.ZeroWire()
+	if signed && len(w) > 0 {
+		pad = w[len(w)-1]
+	}
+	result := make([]*Wire, n)
+	copy(result, w)
+	for i := len(w); i < n; i++ {
+		result[i] = pad
+	}
+	return result
+}
+
+// NewSort creates a circuit that sorts the array a of bits-sized
+// elements in ascending order and returns the result in r. The
+// signed argument specifies if the elements are signed integers.
+func NewSort(cc *Compiler, signed bool, bits types.Size, a, r []*Wire) error {
+	if bits <= 0 || len(a)%int(bits) != 0 || len(a) != len(r) {
+		return fmt.Errorf("invalid sort arguments: bits=%d, a=%d, r=%d",
+			bits, len(a), len(r))
+	}
+	var elems [][]*Wire
+	for i := 0; i < len(a); i += int(bits) {
+		elem := a[i : i+int(bits)]
+		if signed {
+			// Inverting the sign bit maps the signed order into the
+			// unsigned order of the comparators.
+			elem = flipSign(cc, elem)
+		}
+		elems = append(elems, elem)
+	}
+	sorted, err := NewSortingNetwork(cc, elems)
+	if err != nil {
+		return err
+	}
+	for i, elem := range sorted {
+		out := r[i*int(bits) : (i+1)*int(bits)]
+		for j := 0; j < len(elem)-1; j++ {
+			cc.ID(elem[j], out[j])
+		}
+		msb := len(elem) - 1
+		if signed {
+			cc.INV(elem[msb], out[msb])
+		} else {
+			cc.ID(elem[msb], out[msb])
+		}
+	}
+	return nil
+}
+
+func flipSign(cc *Compiler, w []*Wire) []*Wire {
+	result := make([]*Wire, len(w))
+	copy(result, w)
+	msb := len(w) - 1
+	result[msb] = cc.Calloc.Wire()
+	cc.INV(w[msb], result[msb])
+	return result
+}
@@ -0,0 +1,112 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// NewSum creates an adder tree that sums the elementBits wide
+// elements of the array a into r. The signed argument specifies if
+// the elements are signed two's complement values. The adder tree
+// adds the elements pairwise and each level widens the sums by one
+// bit so the sum does not overflow if r has at least elementBits +
+// ceil(log2(len(a)/elementBits)) bits.
+func NewSum(cc *Compiler, signed bool, elementBits int, a, r []*Wire) error {
+	if elementBits <= 0 || len(a)%elementBits != 0 {
+		return fmt.Errorf("invalid sum arguments: a=%d, elementBits=%d",
+			len(a), elementBits)
+	}
+	extend := func(w []*Wire, size int) []*Wire {
+		if !signed || len(w) == 0 {
+			return cc.zeroExtend(w, size)
+		}
+		result := make([]*Wire, size)
+		copy(result, w)
+		for i := len(w); i < size; i++ {
+			result[i] = w[len(w)-1]
+		}
+		return result
+	}
+
+	var values [][]*Wire
+	for i := 0; i < len(a); i += elementBits {
+		values = append(values, a[i:i+elementBits])
+	}
+	for len(values) > 1 {
+		var next [][]*Wire
+		for i := 0; i+1 < len(values); i += 2 {
+			bits := max(len(values[i]), len(values[i+1])) + 1
+			z := make([]*Wire, bits)
+			for j := range z {
+				z[j] = cc.Calloc.Wire()
+			}
+			err := NewAdder(cc, extend(values[i], bits),
+				extend(values[i+1], bits), z)
+			if err != nil {
+				return err
+			}
+			next = append(next, z)
+		}
+		if len(values)%2 != 0 {
+			next = append(next, values[len(values)-1])
+		}
+		values = next
+	}
+
+	var sum []*Wire
+	if len(values) > 0 {
+		sum = values[0]
+	}
+	sum = extend(sum, len(r))
+	for i := 0; i < len(r); i++ {
+		cc.ID(sum[i], r[i])
+	}
+	return nil
+}
+
+// NewDot creates a dot product circuit that multiplies the
+// elementBits wide elements of the arrays a and b pairwise and sums
+// the products into r with an adder tree. The signed argument
+// specifies if the elements are signed two's complement values. The
+// products are 2*elementBits wide so the dot product does not
+// overflow if r has at least 2*elementBits + ceil(log2(N)) bits for
+// N elements.
+func NewDot(cc *Compiler, signed bool, elementBits int, a, b, r []*Wire) error {
+	if elementBits <= 0 || len(a)%elementBits != 0 || len(a) != len(b) {
+		return fmt.Errorf("invalid dot arguments: a=%d, b=%d, elementBits=%d",
+			len(a), len(b), elementBits)
+	}
+	bits := 2 * elementBits
+	extend := func(w []*Wire) []*Wire {
+		if !signed {
+			return w
+		}
+		result := make([]*Wire, bits)
+		copy(result, w)
+		for i := len(w); i < bits; i++ {
+			result[i] = w[len(w)-1]
+		}
+		return result
+	}
+
+	// The signed elements are sign extended to the product width so
+	// that the truncated product is the two's complement product.
+	var products []*Wire
+	for i := 0; i < len(a); i += elementBits {
+		z := cc.Calloc.Wires(types.Size(bits))
+		err := NewMultiplier(cc, cc.Params.CircMultArrayTreshold,
+			extend(a[i:i+elementBits]), extend(b[i:i+elementBits]), z)
+		if err != nil {
+			return err
+		}
+		products = append(products, z...)
+	}
+	return NewSum(cc, signed, bits, products, r)
+}
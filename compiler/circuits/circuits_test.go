@@ -142,3 +142,60 @@ func TestMultiply(t *testing.T) {
 		result.Marshal(os.Stdout)
 	}
 }
+
+func TestMultiplyFanOut(t *testing.T) {
+	bits := 8
+
+	inputs := makeWires(bits*2, false)
+	outputs := makeWires(bits*2, true)
+
+	c, err := NewCompiler(params, calloc, NewIO(bits*2, "in"),
+		NewIO(bits*2, "out"), inputs, outputs)
+	if err != nil {
+		t.Fatalf("NewCompiler: %s", err)
+	}
+
+	err = NewMultiplier(c, 0, inputs[0:bits], inputs[bits:2*bits], outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := c.Compile()
+	fanOut := result.FanOut()
+
+	var sum int
+	for _, count := range fanOut {
+		sum += int(count)
+	}
+	expected := 2*result.NumGates - int(result.Stats[circuit.INV])
+	if sum != expected {
+		t.Errorf("sum of fan-outs %d, expected %d", sum, expected)
+	}
+
+	// Each input bit is multiplied with all bits of the other input.
+	for i := 0; i < bits*2; i++ {
+		if int(fanOut[i]) < bits {
+			t.Errorf("input wire %d: fan-out %d, expected at least %d",
+				i, fanOut[i], bits)
+		}
+	}
+
+	top := result.TopFanOut(4)
+	if len(top) != 4 {
+		t.Fatalf("TopFanOut returned %d wires, expected 4", len(top))
+	}
+	for idx, w := range top {
+		if w.FanOut != fanOut[w.Wire] {
+			t.Errorf("wire %d: fan-out %d, expected %d",
+				w.Wire, w.FanOut, fanOut[w.Wire])
+		}
+		if idx > 0 && w.FanOut > top[idx-1].FanOut {
+			t.Errorf("TopFanOut not sorted: %v", top)
+		}
+	}
+	for _, count := range fanOut {
+		if count > top[0].FanOut {
+			t.Errorf("TopFanOut missed wire with fan-out %d", count)
+		}
+	}
+}
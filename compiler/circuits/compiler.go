@@ -8,6 +8,7 @@ package circuits
 
 import (
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/markkurossi/mpc/circuit"
@@ -344,6 +345,92 @@ func (cc *Compiler) Prune() int {
 
 // Compile compiles the circuit.
 func (cc *Compiler) Compile() *circuit.Circuit {
+	cc.assign()
+
+	cc.compiled = make([]circuit.Gate, 0, len(cc.assigned))
+
+	// Compile circuit.
+	for _, gate := range cc.assigned {
+		gate.Compile(cc)
+	}
+
+	var stats circuit.Stats
+	for _, g := range cc.compiled {
+		stats[g.Op]++
+	}
+
+	result := &circuit.Circuit{
+		NumGates: len(cc.compiled),
+		NumWires: int(cc.nextWireID),
+		Inputs:   cc.Inputs,
+		Outputs:  cc.Outputs,
+		Gates:    cc.compiled,
+		Stats:    stats,
+	}
+
+	return result
+}
+
+// compileStreamBatch specifies how many compiled gates CompileStream
+// buffers before writing them out.
+const compileStreamBatch = 4096
+
+// CompileStream compiles the circuit like Compile but it writes the
+// compiled gates to out in the MPCL circuit format as they are
+// produced. The output is identical to the output of Compile and
+// Circuit.Marshal. CompileStream does not build the compiled gate
+// slice but the compiler's gates and their compilation order are
+// kept until the compiler is released. The returned circuit has no
+// gates.
+func (cc *Compiler) CompileStream(out io.Writer) (*circuit.Circuit, error) {
+	cc.assign()
+
+	gw, err := circuit.NewGateWriter(out, len(cc.assigned),
+		int(cc.nextWireID), cc.Inputs, cc.Outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats circuit.Stats
+	flush := func() error {
+		for _, g := range cc.compiled {
+			stats[g.Op]++
+			if err := gw.Write(g); err != nil {
+				return err
+			}
+		}
+		cc.compiled = cc.compiled[:0]
+		return nil
+	}
+
+	cc.compiled = make([]circuit.Gate, 0, compileStreamBatch)
+	for _, gate := range cc.assigned {
+		gate.Compile(cc)
+		if len(cc.compiled) >= compileStreamBatch {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &circuit.Circuit{
+		NumGates: int(stats.Count()),
+		NumWires: int(cc.nextWireID),
+		Inputs:   cc.Inputs,
+		Outputs:  cc.Outputs,
+		Stats:    stats,
+	}, nil
+}
+
+// assign assigns the wire IDs of the circuit gates and collects the
+// gates in the compilation order.
+func (cc *Compiler) assign() {
 	if len(cc.pending) != 0 {
 		panic("Compile: pending set")
 	}
@@ -355,7 +442,6 @@ func (cc *Compiler) Compile() *circuit.Circuit {
 	if len(cc.compiled) != 0 {
 		panic("Compile: compiled set")
 	}
-	cc.compiled = make([]circuit.Gate, 0, len(cc.Gates))
 
 	for _, w := range cc.InputWires {
 		w.Assign(cc)
@@ -375,25 +461,4 @@ func (cc *Compiler) Compile() *circuit.Circuit {
 			w.SetID(cc.NextWireID())
 		}
 	}
-
-	// Compile circuit.
-	for _, gate := range cc.assigned {
-		gate.Compile(cc)
-	}
-
-	var stats circuit.Stats
-	for _, g := range cc.compiled {
-		stats[g.Op]++
-	}
-
-	result := &circuit.Circuit{
-		NumGates: len(cc.compiled),
-		NumWires: int(cc.nextWireID),
-		Inputs:   cc.Inputs,
-		Outputs:  cc.Outputs,
-		Gates:    cc.compiled,
-		Stats:    stats,
-	}
-
-	return result
 }
@@ -0,0 +1,98 @@
+//
+// dedup.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+// gateKey identifies the gates by their operations and input wires.
+type gateKey struct {
+	op   circuit.Operation
+	a, b *Wire
+}
+
+// Dedup merges the structurally identical gates. Two gates are
+// identical if they have the same operation and the same input wires
+// in either order since all binary gates are commutative. The
+// consumers of the duplicate gate are rewired to the output of the
+// first gate and the duplicate gate is removed. Since the gates are
+// processed in topological order, the merging cascades through
+// identical subcircuits. The gates producing circuit output wires are
+// not merged since the output wires are assigned after the other
+// wires and their consumers would not be reached. The function
+// returns the number of removed gates.
+func (cc *Compiler) Dedup() int {
+	var stats circuit.Stats
+
+	start := time.Now()
+	numGates := len(cc.Gates)
+
+	seen := make(map[gateKey]*Gate)
+	gates := make([]*Gate, 0, len(cc.Gates))
+
+	for _, g := range cc.Gates {
+		if g.Dead {
+			continue
+		}
+		key := gateKey{
+			op: g.Op,
+			a:  g.A,
+		}
+		if g.Op != circuit.INV {
+			key.b = g.B
+		}
+		prev, ok := seen[key]
+		if !ok && g.Op != circuit.INV {
+			prev, ok = seen[gateKey{
+				op: g.Op,
+				a:  g.B,
+				b:  g.A,
+			}]
+		}
+		if !ok || g.O.Output() || prev.O.Output() {
+			if !ok || prev.O.Output() {
+				seen[key] = g
+			}
+			gates = append(gates, g)
+			continue
+		}
+
+		// The wire's output list is not updated when the outputs
+		// are removed so check that the gates still consume it.
+		g.O.ForEachOutput(func(c *Gate) {
+			if c.Dead {
+				return
+			}
+			for c.A == g.O || (c.Op != circuit.INV && c.B == g.O) {
+				c.ReplaceInput(g.O, prev.O)
+			}
+		})
+		g.Dead = true
+		g.A.RemoveOutput(g)
+		if g.Op != circuit.INV {
+			g.B.RemoveOutput(g)
+		}
+		stats[g.Op]++
+	}
+	cc.Gates = gates
+
+	elapsed := time.Since(start)
+
+	if cc.Params.Diagnostics && stats.Count() > 0 {
+		fmt.Printf(" - Dedup:               %12s: %d/%d (%.2f%%)\n",
+			elapsed, stats.Count(), numGates,
+			float64(stats.Count())/float64(numGates)*100)
+	}
+
+	return int(stats.Count())
+}
@@ -0,0 +1,99 @@
+//
+// dedup_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+// newDoubled creates a circuit that computes x*y+x*y for the
+// bits-wide inputs. If twice is true, the product is computed with two
+// identical multiplier subcircuits and otherwise both addends are
+// wired from one multiplier. The function returns the compiled
+// circuit and the number of gates merged by Dedup.
+func newDoubled(t *testing.T, bits int, twice, dedup bool) (
+	*circuit.Circuit, int) {
+
+	inputs := makeWires(bits*2, false)
+	outputs := makeWires(bits, true)
+	cc, err := NewCompiler(params, calloc, NewIO(bits*2, "in"),
+		NewIO(bits, "out"), inputs, outputs)
+	if err != nil {
+		t.Fatalf("NewCompiler: %s", err)
+	}
+	x := inputs[:bits]
+	y := inputs[bits:]
+
+	p0 := makeWires(bits, false)
+	err = NewMultiplier(cc, 0, x, y, p0)
+	if err != nil {
+		t.Fatalf("NewMultiplier: %s", err)
+	}
+	p1 := p0
+	if twice {
+		p1 = makeWires(bits, false)
+		err = NewMultiplier(cc, 0, x, y, p1)
+		if err != nil {
+			t.Fatalf("NewMultiplier: %s", err)
+		}
+	}
+	err = NewAdder(cc, p0, p1, outputs)
+	if err != nil {
+		t.Fatalf("NewAdder: %s", err)
+	}
+	cc.ConstPropagate()
+	var merged int
+	if dedup {
+		merged = cc.Dedup()
+	}
+	cc.Prune()
+
+	return cc.Compile(), merged
+}
+
+func TestDedup(t *testing.T) {
+	const bits = 16
+
+	orig, _ := newDoubled(t, bits, true, false)
+	dedup, merged := newDoubled(t, bits, true, true)
+	single, _ := newDoubled(t, bits, false, true)
+
+	if merged == 0 || dedup.NumGates >= orig.NumGates {
+		t.Errorf("Dedup merged %d gates: %d -> %d", merged,
+			orig.NumGates, dedup.NumGates)
+	}
+	// The second multiplier must be merged completely.
+	if dedup.NumGates != single.NumGates {
+		t.Errorf("gate count: got %d, expected %d", dedup.NumGates,
+			single.NumGates)
+	}
+
+	r := rand.New(rand.NewSource(686))
+	for i := 0; i < 100; i++ {
+		input := new(big.Int).Rand(r,
+			new(big.Int).Lsh(big.NewInt(1), bits*2))
+
+		expected, err := orig.Compute([]*big.Int{input})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		result, err := dedup.Compute([]*big.Int{input})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		if result[0].Cmp(expected[0]) != 0 {
+			t.Errorf("%x: got %v, expected %v", input, result[0],
+				expected[0])
+		}
+	}
+}
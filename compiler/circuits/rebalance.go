@@ -0,0 +1,265 @@
+//
+// rebalance.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+// Rebalance restructures the chains of associative AND, OR, and XOR
+// gates into balanced trees. A chain is a tree of gates of the same
+// operation where each internal gate output has exactly one consumer
+// gate. The chain is rebuilt by combining its two shallowest inputs
+// until only one value remains. The number of gates does not change
+// but a left-leaning reduction of N values becomes a tree of depth
+// log2(N). The chains are compared by their AND-depth first and by
+// their gate depth after that, and a chain is replaced only if its
+// rebuilt tree is shallower. The function returns the number of
+// replaced chains. The gates must be in topological order.
+func (cc *Compiler) Rebalance() int {
+	var stats circuit.Stats
+
+	start := time.Now()
+
+	// Map the wires to their consumer gates.
+	consumers := make(map[*Wire]int)
+	consumer := make(map[*Wire]*Gate)
+	for _, g := range cc.Gates {
+		if g.Dead {
+			continue
+		}
+		consumers[g.A]++
+		consumer[g.A] = g
+		if g.Op != circuit.INV {
+			consumers[g.B]++
+			consumer[g.B] = g
+		}
+	}
+	producer := make(map[*Wire]*Gate)
+	inner := make(map[*Gate]bool)
+	for _, g := range cc.Gates {
+		if g.Dead || !associative(g.Op) {
+			continue
+		}
+		producer[g.O] = g
+		// The constant wires are kept since the compiler shares
+		// them between gates.
+		c := consumer[g.O]
+		if !g.O.Output() && g.O.Value() == Unknown &&
+			g.O.NumOutputs() == 1 && consumers[g.O] == 1 && c.Op == g.Op {
+			inner[g] = true
+		}
+	}
+
+	depths := make(map[*Wire]gateDepth)
+	depthOf := func(g *Gate) gateDepth {
+		d := depths[g.A]
+		if g.Op != circuit.INV {
+			d = d.max(depths[g.B])
+		}
+		return d.add(g.Op)
+	}
+
+	var replaced int
+	gates := make([]*Gate, 0, len(cc.Gates))
+
+	for _, g := range cc.Gates {
+		if g.Dead {
+			continue
+		}
+		if inner[g] {
+			// The chain's root gate processes the inner gates.
+			continue
+		}
+		if !associative(g.Op) {
+			depths[g.O] = depthOf(g)
+			gates = append(gates, g)
+			continue
+		}
+
+		// Collect the chain's leaf values and its inner gates in
+		// their topological order.
+		var leaves []*Wire
+		var chain []*Gate
+		var collect func(w *Wire)
+		collect = func(w *Wire) {
+			p, ok := producer[w]
+			if !ok || !inner[p] {
+				leaves = append(leaves, w)
+				return
+			}
+			collect(p.A)
+			collect(p.B)
+			depths[p.O] = depthOf(p)
+			chain = append(chain, p)
+		}
+		collect(g.A)
+		collect(g.B)
+		depth := depthOf(g)
+		chain = append(chain, g)
+
+		if len(leaves) <= 2 || !cc.rebalance(g, leaves, depth, &gates,
+			depths) {
+			depths[g.O] = depth
+			gates = append(gates, chain...)
+			continue
+		}
+		for _, p := range chain {
+			p.Dead = true
+			p.A.RemoveOutput(p)
+			p.B.RemoveOutput(p)
+		}
+		replaced++
+		stats[g.Op] += uint64(len(chain))
+	}
+	cc.Gates = gates
+
+	elapsed := time.Since(start)
+
+	if cc.Params.Diagnostics && stats.Count() > 0 {
+		fmt.Printf(" - Rebalance:           %12s: %d/%d (%.2f%%)\n",
+			elapsed, stats.Count(), len(cc.Gates),
+			float64(stats.Count())/float64(len(cc.Gates))*100)
+	}
+
+	return replaced
+}
+
+// rebalance builds a balanced tree of root's operation over the
+// leaves. If the tree is shallower than depth, the function appends
+// the tree's gates to gates, moves the root's output wire to the
+// tree, and returns true.
+func (cc *Compiler) rebalance(root *Gate, leaves []*Wire, depth gateDepth,
+	gates *[]*Gate, depths map[*Wire]gateDepth) bool {
+
+	values := make(depthHeap, len(leaves))
+	for idx, leaf := range leaves {
+		values[idx] = depthValue{
+			depth: depths[leaf],
+			order: idx,
+		}
+	}
+	heap.Init(&values)
+
+	// Compute the tree shape before creating any gates.
+	type pair struct {
+		a, b int
+	}
+	var pairs []pair
+	for order := len(leaves); values.Len() > 1; order++ {
+		a := heap.Pop(&values).(depthValue)
+		b := heap.Pop(&values).(depthValue)
+		pairs = append(pairs, pair{a.order, b.order})
+		heap.Push(&values, depthValue{
+			depth: a.depth.max(b.depth).add(root.Op),
+			order: order,
+		})
+	}
+	if !values[0].depth.less(depth) {
+		return false
+	}
+
+	wires := make([]*Wire, len(leaves)+len(pairs))
+	copy(wires, leaves)
+	root.O.SetInput(nil)
+	for idx, p := range pairs {
+		var o *Wire
+		if idx+1 < len(pairs) {
+			o = cc.Calloc.Wire()
+		} else {
+			o = root.O
+		}
+		g := cc.Calloc.BinaryGate(root.Op, wires[p.a], wires[p.b], o)
+		depths[o] = depths[g.A].max(depths[g.B]).add(root.Op)
+		wires[len(leaves)+idx] = o
+		*gates = append(*gates, g)
+	}
+	return true
+}
+
+func associative(op circuit.Operation) bool {
+	switch op {
+	case circuit.AND, circuit.OR, circuit.XOR:
+		return true
+	default:
+		return false
+	}
+}
+
+// gateDepth describes the AND-depth and the gate depth of a wire.
+type gateDepth struct {
+	and   int
+	gates int
+}
+
+func (d gateDepth) max(o gateDepth) gateDepth {
+	if o.and > d.and {
+		d.and = o.and
+	}
+	if o.gates > d.gates {
+		d.gates = o.gates
+	}
+	return d
+}
+
+func (d gateDepth) add(op circuit.Operation) gateDepth {
+	switch op {
+	case circuit.AND, circuit.OR:
+		d.and++
+	}
+	d.gates++
+	return d
+}
+
+func (d gateDepth) less(o gateDepth) bool {
+	if d.and != o.and {
+		return d.and < o.and
+	}
+	return d.gates < o.gates
+}
+
+type depthValue struct {
+	depth gateDepth
+	order int
+}
+
+// depthHeap orders the values by their depths. The values of the
+// same depth are ordered by their creation order.
+type depthHeap []depthValue
+
+func (h depthHeap) Len() int {
+	return len(h)
+}
+
+func (h depthHeap) Less(i, j int) bool {
+	if h[i].depth != h[j].depth {
+		return h[i].depth.less(h[j].depth)
+	}
+	return h[i].order < h[j].order
+}
+
+func (h depthHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *depthHeap) Push(x interface{}) {
+	*h = append(*h, x.(depthValue))
+}
+
+func (h *depthHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,98 @@
+//
+// rebalance_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+// newReduction creates a left-leaning reduction circuit that tests if
+// the bits-wide inputs are different and computes their parity.
+func newReduction(t *testing.T, bits int, rebalance bool) *circuit.Circuit {
+	inputs := makeWires(bits*2, false)
+	outputs := makeWires(2, true)
+	cc, err := NewCompiler(params, calloc, NewIO(bits*2, "in"),
+		NewIO(2, "out"), inputs, outputs)
+	if err != nil {
+		t.Fatalf("NewCompiler: %s", err)
+	}
+	err = NewNeqComparator(cc, inputs[:bits], inputs[bits:], outputs[:1])
+	if err != nil {
+		t.Fatalf("NewNeqComparator: %s", err)
+	}
+	parity := inputs[0]
+	for i := 1; i < bits; i++ {
+		o := outputs[1]
+		if i+1 < bits {
+			o = calloc.Wire()
+		}
+		cc.AddGate(cc.Calloc.BinaryGate(circuit.XOR, parity, inputs[i], o))
+		parity = o
+	}
+	cc.ConstPropagate()
+	cc.Prune()
+	if rebalance {
+		if n := cc.Rebalance(); n != 2 {
+			t.Errorf("Rebalance replaced %d chains, expected 2", n)
+		}
+	}
+	circ := cc.Compile()
+	circ.AssignLevels()
+	return circ
+}
+
+func TestRebalance(t *testing.T) {
+	const bits = 64
+
+	orig := newReduction(t, bits, false)
+	balanced := newReduction(t, bits, true)
+
+	if orig.NumGates != balanced.NumGates {
+		t.Errorf("rebalancing changed gate count: %d -> %d",
+			orig.NumGates, balanced.NumGates)
+	}
+	origDepth := len(orig.CriticalPath())
+	depth := len(balanced.CriticalPath())
+	if origDepth != bits-1 || depth != 6 {
+		t.Errorf("AND-depth: got %d -> %d, expected %d -> 6",
+			origDepth, depth, bits-1)
+	}
+	if levels := balanced.Stats[circuit.NumLevels]; levels != 7 {
+		t.Errorf("levels: got %d, expected 7", levels)
+	}
+
+	r := rand.New(rand.NewSource(676))
+	for i := 0; i < 100; i++ {
+		x := new(big.Int).Rand(r, new(big.Int).Lsh(big.NewInt(1), bits))
+		y := new(big.Int).Set(x)
+		if i%2 == 0 {
+			j := r.Intn(bits)
+			y.SetBit(y, j, y.Bit(j)^1)
+		}
+		input := new(big.Int).Lsh(y, bits)
+		input.Or(input, x)
+
+		expected, err := orig.Compute([]*big.Int{input})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		result, err := balanced.Compute([]*big.Int{input})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		if result[0].Cmp(expected[0]) != 0 {
+			t.Errorf("%x,%x: got %v, expected %v", x, y, result[0],
+				expected[0])
+		}
+	}
+}
@@ -7,11 +7,13 @@
 package compiler
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"math/big"
 	"os"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/markkurossi/mpc/circuit"
@@ -26,6 +28,7 @@ type Compiler struct {
 	params   *utils.Params
 	packages map[string]*ast.Package
 	pkgPath  string
+	cache    *ast.FuncCache
 }
 
 type pkgPath struct {
@@ -36,28 +39,138 @@ type pkgPath struct {
 
 // New creates a new compiler instance.
 func New(params *utils.Params) *Compiler {
-	return &Compiler{
+	c := &Compiler{
 		params:   params,
 		packages: make(map[string]*ast.Package),
 	}
+	if params.FuncCache {
+		c.cache = ast.NewFuncCache()
+	}
+	return c
+}
+
+// Close releases the packages and the function cache of the
+// compiler. The compiler can be used after Close but it parses all
+// imported packages again.
+func (c *Compiler) Close() {
+	c.packages = make(map[string]*ast.Package)
+	if c.cache != nil {
+		c.cache = ast.NewFuncCache()
+	}
+}
+
+// CacheStats returns the function cache statistics. The statistics
+// are accumulated over all compilations of the compiler.
+func (c *Compiler) CacheStats() ast.FuncCacheStats {
+	if c.cache == nil {
+		return ast.FuncCacheStats{}
+	}
+	return c.cache.Stats
+}
+
+func (c *Compiler) logger() *utils.Logger {
+	if c.params.LogOut != nil {
+		return utils.NewLogger(c.params.LogOut)
+	}
+	return utils.NewLogger(os.Stdout)
 }
 
 // Compile compiles the input program.
 func (c *Compiler) Compile(data string, inputSizes [][]int) (
 	*circuit.Circuit, ast.Annotations, error) {
-	return c.compile("{data}", strings.NewReader(data), inputSizes)
+	return c.CompileContext(context.Background(), data, inputSizes)
+}
+
+// CompileContext compiles the input program. The compilation is
+// aborted with utils.CanceledError if ctx is canceled or its deadline
+// expires during loop unrolling, function instantiation, or circuit
+// generation. The compiler remains usable after the cancellation.
+func (c *Compiler) CompileContext(ctx context.Context, data string,
+	inputSizes [][]int) (*circuit.Circuit, ast.Annotations, error) {
+	return c.compile(ctx, "{data}", strings.NewReader(data), inputSizes, nil)
 }
 
 // CompileFile compiles the input file.
 func (c *Compiler) CompileFile(file string, inputSizes [][]int) (
 	*circuit.Circuit, ast.Annotations, error) {
+	return c.CompileFileContext(context.Background(), file, inputSizes)
+}
+
+// CompileFileContext compiles the input file. The context aborts the
+// compilation as in CompileContext.
+func (c *Compiler) CompileFileContext(ctx context.Context, file string,
+	inputSizes [][]int) (*circuit.Circuit, ast.Annotations, error) {
 
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer f.Close()
-	return c.compile(file, f, inputSizes)
+	return c.compile(ctx, file, f, inputSizes, nil)
+}
+
+// CompileFileStream compiles the input file and writes the circuit to
+// out in the MPCL circuit format as the gates are compiled. The
+// output is identical to the output of Circuit.Marshal but the
+// compiled circuit.Gate slice is not built. The compiler still holds
+// the gate graph of the whole circuit while it writes the output. The
+// returned circuit contains the circuit header and statistics but no
+// gates.
+func (c *Compiler) CompileFileStream(file string, inputSizes [][]int,
+	out io.Writer) (*circuit.Circuit, ast.Annotations, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return c.compile(context.Background(), file, f, inputSizes, out)
+}
+
+// CompileLocalFile compiles the input file for the local computation
+// with Circuit.Compute. The circuits need an input so the main
+// function without arguments is compiled with an unused bool argument
+// that must be given to Compute. The other main functions are
+// compiled as in CompileFile.
+func (c *Compiler) CompileLocalFile(file string, inputSizes [][]int) (
+	*circuit.Circuit, ast.Annotations, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	logger := c.logger()
+	c.reset()
+	pkg, err := c.parse(file, f, logger, ast.NewPackage("main", file, nil))
+	if err != nil {
+		c.release()
+		return nil, nil, err
+	}
+	main, err := pkg.Main()
+	if err != nil {
+		c.release()
+		return nil, nil, err
+	}
+	if len(main.Args) == 0 {
+		main.Args = []*ast.Variable{
+			{
+				Point: main.Point,
+				Name:  "_",
+				Type: &ast.TypeInfo{
+					Point: main.Point,
+					Type:  ast.TypeName,
+					Name: ast.Identifier{
+						Defined: pkg.Path,
+						Name:    "bool",
+					},
+				},
+			},
+		}
+	}
+	return c.compilePkg(context.Background(), logger, file, pkg, inputSizes,
+		nil)
 }
 
 // ParseFile parses the input file.
@@ -67,35 +180,98 @@ func (c *Compiler) ParseFile(file string) (*ast.Package, error) {
 		return nil, err
 	}
 	defer f.Close()
-	logger := utils.NewLogger(os.Stdout)
+	logger := c.logger()
 	return c.parse(file, f, logger, nil)
 }
 
-func (c *Compiler) compile(source string, in io.Reader, inputSizes [][]int) (
+func (c *Compiler) compile(cctx context.Context, source string,
+	in io.Reader, inputSizes [][]int, out io.Writer) (
 	*circuit.Circuit, ast.Annotations, error) {
 
-	logger := utils.NewLogger(os.Stdout)
+	logger := c.logger()
+	c.reset()
 	pkg, err := c.parse(source, in, logger, ast.NewPackage("main", source, nil))
 	if err != nil {
+		c.release()
 		return nil, nil, err
 	}
+	return c.compilePkg(cctx, logger, source, pkg, inputSizes, out)
+}
+
+// compilePkg compiles the parsed main package. If out is not nil, the
+// circuit is streamed to it and the returned circuit has no gates.
+func (c *Compiler) compilePkg(cctx context.Context, logger *utils.Logger,
+	source string, pkg *ast.Package, inputSizes [][]int, out io.Writer) (
+	*circuit.Circuit, ast.Annotations, error) {
 
 	ctx := ast.NewCodegen(logger, pkg, c.packages, c.params, inputSizes)
+	ctx.Cache = c.cache
+	ctx.Context = cctx
 
 	program, annotation, err := pkg.Compile(ctx)
 	if err != nil {
+		c.release()
 		return nil, nil, err
 	}
+	program.Context = cctx
+	if c.cache != nil && c.params.Verbose {
+		fmt.Printf("Function cache: %s\n", c.cache.Stats)
+	}
 	if c.params.NoCircCompile {
 		return nil, annotation, nil
 	}
+	if out != nil {
+		circ, err := program.CompileCircuitStream(c.params, out)
+		if err != nil {
+			c.release()
+			return nil, nil, err
+		}
+		return circ, annotation, nil
+	}
 	circ, err := program.CompileCircuit(c.params)
 	if err != nil {
+		c.release()
 		return nil, nil, err
 	}
+	if c.params.FanOutWarning > 0 {
+		checkFanOut(logger, source, circ, c.params.FanOutWarning)
+	}
 	return circ, annotation, nil
 }
 
+// maxFanOutWarnings specifies the maximum number of wires listed in
+// the fan-out warning.
+const maxFanOutWarnings = 5
+
+// checkFanOut warns about the circuit wires whose fan-out exceeds the
+// limit.
+func checkFanOut(logger *utils.Logger, source string, circ *circuit.Circuit,
+	limit int) {
+
+	var count int
+	for _, fanOut := range circ.FanOut() {
+		if int(fanOut) > limit {
+			count++
+		}
+	}
+	if count == 0 {
+		return
+	}
+	var wires string
+	for idx, w := range circ.TopFanOut(count) {
+		if idx >= maxFanOutWarnings {
+			wires += ", ..."
+			break
+		}
+		if idx > 0 {
+			wires += ", "
+		}
+		wires += fmt.Sprintf("w%d=%d", w.Wire, w.FanOut)
+	}
+	logger.Warningf(utils.Point{Source: source},
+		"fan-out above %d in %d wires: %s", limit, count, wires)
+}
+
 // StreamFile compiles the input program and uses the streaming mode
 // to garble and stream the circuit to the evaluator node.
 func (c *Compiler) StreamFile(conn *p2p.Conn, oti ot.OT, file string,
@@ -115,16 +291,20 @@ func (c *Compiler) stream(conn *p2p.Conn, oti ot.OT, source string,
 
 	timing := circuit.NewTiming()
 
-	logger := utils.NewLogger(os.Stdout)
+	logger := c.logger()
+	c.reset()
 	pkg, err := c.parse(source, in, logger, ast.NewPackage("main", source, nil))
 	if err != nil {
+		c.release()
 		return nil, nil, err
 	}
 
 	ctx := ast.NewCodegen(logger, pkg, c.packages, c.params, inputSizes)
+	ctx.Cache = c.cache
 
 	program, _, err := pkg.Compile(ctx)
 	if err != nil {
+		c.release()
 		return nil, nil, err
 	}
 
@@ -164,6 +344,22 @@ func (c *Compiler) stream(conn *p2p.Conn, oti ot.OT, source string,
 	return out, bits, err
 }
 
+// reset resets the initialization state of the packages of the
+// previous compilation.
+func (c *Compiler) reset() {
+	for _, pkg := range c.packages {
+		pkg.Reset()
+	}
+}
+
+// release releases the state of a failed compilation so that the
+// compiler can be used for other programs. The parsed library packages
+// are kept but their compilation state is reset.
+func (c *Compiler) release() {
+	delete(c.packages, "main")
+	c.reset()
+}
+
 func (c *Compiler) parse(source string, in io.Reader, logger *utils.Logger,
 	pkg *ast.Package) (*ast.Package, error) {
 
@@ -172,11 +368,20 @@ func (c *Compiler) parse(source string, in io.Reader, logger *utils.Logger,
 	if err != nil {
 		return nil, err
 	}
-	c.packages[pkg.Name] = pkg
+	c.packages[pkg.Path] = pkg
 
-	for alias, name := range pkg.Imports {
-		_, err := c.parsePkg(alias, name, source)
+	// Parse the imported packages in a stable order so that the
+	// compilation and its errors do not depend on the map order.
+	var aliases []string
+	for alias := range pkg.Imports {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		_, err := c.parsePkg(pkg.Imports[alias], source)
 		if err != nil {
+			// Do not keep packages with missing imports.
+			delete(c.packages, pkg.Path)
 			return nil, err
 		}
 	}
@@ -248,12 +453,19 @@ var pkgPaths = []*pkgPath{
 	},
 }
 
-func (c *Compiler) parsePkg(alias, name, source string) (*ast.Package, error) {
-	pkg, ok := c.packages[alias]
+// parsePkg parses the package with the import path name. The
+// packages are kept by their import paths and the import aliases are
+// resolved with the imports of the importing package.
+func (c *Compiler) parsePkg(name, source string) (*ast.Package, error) {
+	parts := strings.Split(name, "/")
+	pkgName := parts[len(parts)-1]
+
+	pkg, ok := c.packages[name]
 	if ok {
 		return pkg, nil
 	}
-	pkg = ast.NewPackage(alias, source, nil)
+	pkg = ast.NewPackage(pkgName, source, nil)
+	pkg.Path = name
 
 	err := c.resolvePkgPath()
 	if err != nil {
@@ -261,7 +473,7 @@ func (c *Compiler) parsePkg(alias, name, source string) (*ast.Package, error) {
 	}
 
 	if c.params.Verbose {
-		fmt.Printf("looking for package %s (%s)\n", alias, name)
+		fmt.Printf("looking for package %s (%s)\n", pkgName, name)
 	}
 
 	var dirs []string
@@ -319,10 +531,13 @@ func (c *Compiler) tryParsePkg(pkg *ast.Package, prefix, name string) (
 		}
 		defer f.Close()
 
-		pkg, err = c.parse(fp, f, utils.NewLogger(os.Stdout), pkg)
+		parsed, err := c.parse(fp, f, c.logger(), pkg)
 		if err != nil {
+			// Do not keep partially parsed packages.
+			delete(c.packages, pkg.Path)
 			return nil, false, err
 		}
+		pkg = parsed
 	}
 	return pkg, true, nil
 }
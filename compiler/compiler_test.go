@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -7,12 +7,29 @@
 package compiler
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"math"
 	"math/big"
+	"math/bits"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/ast"
 	"github.com/markkurossi/mpc/compiler/utils"
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+	"github.com/markkurossi/mpc/types"
 )
 
 type IteratorTest struct {
@@ -207,6 +224,20 @@ func MinMax(a, b int) (int, int) {
     }
     return a, b
 }
+`,
+	},
+	{
+		N1: 5,
+		N2: 3,
+		N3: 5,
+		Code: `
+package main
+import (
+    m "math"
+)
+func main(a, b uint64) uint64 {
+    return m.MaxUint(a, b)
+}
 `,
 	},
 }
@@ -218,6 +249,10 @@ func TestFixed(t *testing.T) {
 			t.Errorf("failed to compile test %d: %s", idx, err)
 			continue
 		}
+		if err := circ.Validate(); err != nil {
+			t.Errorf("test %d: invalid circuit: %s", idx, err)
+			continue
+		}
 		n1 := big.NewInt(test.N1)
 		n2 := big.NewInt(test.N2)
 		results, err := circ.Compute([]*big.Int{n1, n2})
@@ -268,3 +303,3999 @@ func main(a, b uint64) uint64 {
 		}
 	}
 }
+
+type UntypedTest struct {
+	Code string
+	Bits []int
+}
+
+var untypedTests = []UntypedTest{
+	{
+		Code: `
+package main
+func main(a, b int32) (uint, uint, int) {
+    var x uint8 = 1
+    var y uint64 = 1
+    var z int = 1
+    return x, y, z
+}
+`,
+		Bits: []int{8, 64, 32},
+	},
+	{
+		Code: `
+package main
+const X uint8 = 1
+const Y uint64 = 1
+const Z = 1
+func main(a, b int32) (uint, uint, int) {
+    x := X
+    y := Y
+    z := Z
+    return x, y, z
+}
+`,
+		Bits: []int{8, 64, 32},
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) (uint, uint, int) {
+    var x uint8
+    var y uint64
+    var z int32
+    x = 1
+    y = 1
+    z = 1
+    return x, y, z
+}
+`,
+		Bits: []int{8, 64, 32},
+	},
+	{
+		Code: `
+package main
+const X uint8 = 200
+func main(a, b int32) (uint, uint, int) {
+    return X - 199, id(1), 1
+}
+func id(v uint) uint {
+    return v
+}
+`,
+		Bits: []int{8, 32, 32},
+	},
+}
+
+func TestUntypedConst(t *testing.T) {
+	for idx, test := range untypedTests {
+		circ, _, err := New(utils.NewParams()).Compile(test.Code, nil)
+		if err != nil {
+			t.Errorf("failed to compile test %d: %s", idx, err)
+			continue
+		}
+		if len(circ.Outputs) != len(test.Bits) {
+			t.Errorf("test %d: got %d outputs, expected %d",
+				idx, len(circ.Outputs), len(test.Bits))
+			continue
+		}
+		for i, out := range circ.Outputs {
+			if int(out.Type.Bits) != test.Bits[i] {
+				t.Errorf("test %d: output %d: got %v, expected %d bits",
+					idx, i, out.Type, test.Bits[i])
+			}
+		}
+		results, err := circ.Compute([]*big.Int{big.NewInt(0), big.NewInt(0)})
+		if err != nil {
+			t.Errorf("test %d: compute failed: %s", idx, err)
+			continue
+		}
+		for i, r := range results {
+			if r.Int64() != 1 {
+				t.Errorf("test %d: result %d: got %v, expected 1", idx, i, r)
+			}
+		}
+	}
+}
+
+var compareTypeTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+func main(a, b [4]uint8) bool {
+    var c [3]uint8
+    return a == c
+}
+`,
+		Error: "invalid types: [4]uint8 == [3]uint8",
+	},
+	{
+		Code: `
+package main
+func main(a [4]uint8, b uint32) bool {
+    return a != b
+}
+`,
+		Error: "invalid types: [4]uint8 != uint32",
+	},
+	{
+		Code: `
+package main
+func main(a [4]uint8, b [4]int8) bool {
+    return a == b
+}
+`,
+		Error: "invalid types: [4]uint8 == [4]int8",
+	},
+}
+
+func TestCompareTypes(t *testing.T) {
+	for idx, test := range compareTypeTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+}
+
+var typeMismatchTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+func f(a uint16) uint16 {
+    return a
+}
+func main(a, b uint8) uint16 {
+    return f(a)
+}
+`,
+		Error: "cannot use a (type uint8) as type uint16 in argument to f",
+	},
+	{
+		Code: `
+package main
+func f(a, b [4]uint8) [4]uint8 {
+    return a
+}
+func main(a [4]uint8, b uint32) [4]uint8 {
+    return f(a, b)
+}
+`,
+		Error: "cannot use b (type uint32) as type [4]uint8 in argument to f",
+	},
+	{
+		Code: `
+package main
+func f(a uint32) uint8 {
+    return a
+}
+func main(a, b uint32) uint8 {
+    return f(a)
+}
+`,
+		Error: "cannot use a (type uint32) as type uint8 in return argument",
+	},
+	{
+		Code: `
+package main
+func f(a uint32) (uint32, uint8) {
+    return a, a
+}
+func main(a, b uint32) (uint32, uint8) {
+    return f(a)
+}
+`,
+		Error: "cannot use a (type uint32) as type uint8 in return argument",
+	},
+}
+
+func TestTypeMismatch(t *testing.T) {
+	for idx, test := range typeMismatchTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+}
+
+var structLiteralTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+type Point struct {
+    X, Y int32
+}
+func main(a int32) int32 {
+    p := Point{X: 1, Z: 2}
+    return p.X + a
+}
+`,
+		Error: "unknown field Z in struct literal of type",
+	},
+	{
+		Code: `
+package main
+type Point struct {
+    X, Y int32
+}
+func main(a int32) int32 {
+    p := Point{X: 1, X: 2}
+    return p.X + a
+}
+`,
+		Error: "duplicate field name X in struct literal",
+	},
+	{
+		Code: `
+package main
+type Point struct {
+    X, Y int32
+}
+func main(a int32) int32 {
+    p := Point{X: 1, 2}
+    return p.X + a
+}
+`,
+		Error: "mixture of field:value and value elements in struct literal",
+	},
+	{
+		Code: `
+package main
+type Point struct {
+    X, Y int32
+}
+func main(a int32) int32 {
+    p := Point{1}
+    return p.X + a
+}
+`,
+		Error: "wrong number of values in struct literal",
+	},
+}
+
+func TestStructLiteral(t *testing.T) {
+	for idx, test := range structLiteralTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+}
+
+var staticAssertTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+const N = 8
+func main(a, b uint8) uint8 {
+    static_assert(N&(N-1) == 0, "N is not a power of two")
+    static_assert(size(a) == 8)
+    return a + b
+}
+`,
+	},
+	{
+		Code: `
+package main
+const N = 6
+func main(a, b uint8) uint8 {
+    static_assert(N&(N-1) == 0, "N is not a power of two")
+    return a + b
+}
+`,
+		Error: "static assertion failed: N is not a power of two",
+	},
+	{
+		Code: `
+package main
+func main(a, b [16]byte) uint8 {
+    static_assert(len(a) == 32)
+    return a[0] + b[0]
+}
+`,
+		Error: "static assertion failed",
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    static_assert(a == b)
+    return a + b
+}
+`,
+		Error: "non-constant argument",
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    static_assert(1)
+    return a + b
+}
+`,
+		Error: "non-bool condition",
+	},
+}
+
+func TestStaticAssert(t *testing.T) {
+	var gates int
+	for idx, test := range staticAssertTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		circ, _, err := New(params).Compile(test.Code, nil)
+		if len(test.Error) == 0 {
+			if err != nil {
+				t.Errorf("test %d: compile failed: %v", idx, err)
+				continue
+			}
+			gates = circ.NumGates
+			continue
+		}
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+
+	// The assertions do not emit any gates.
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+func main(a, b uint8) uint8 {
+    return a + b
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	if circ.NumGates != gates {
+		t.Errorf("static_assert added gates: %d -> %d", circ.NumGates, gates)
+	}
+}
+
+var noUnrollTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    for i := 0; i < 4; i++ {
+        a += b
+    }
+    return a
+}
+`,
+	},
+	{
+		Code: `
+package main
+func main(a, b [8]uint8) uint8 {
+    var r uint8
+    for _, v := range a {
+        r += v
+    }
+    return r
+}
+`,
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    for i := 0; i < 1000; i++ {
+        a += b
+    }
+    return a
+}
+`,
+		Error: "loop unrolling disabled: loop exceeds 32 iterations",
+	},
+	{
+		Code: `
+package main
+func main(a, b [64]uint8) uint8 {
+    var r uint8
+    for _, v := range a {
+        r += v
+    }
+    return r
+}
+`,
+		Error: "loop unrolling disabled: loop exceeds 32 iterations",
+	},
+}
+
+func TestNoUnroll(t *testing.T) {
+	for idx, test := range noUnrollTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+		params.NoUnroll = true
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if len(test.Error) == 0 {
+			if err != nil {
+				t.Errorf("test %d: compile failed: %v", idx, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+}
+
+var switchUnionTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+type Message union {
+    Tag uint8
+}
+func main(a, b uint8) uint8 {
+    return a
+}
+`,
+		Error: "invalid union variant name: Tag",
+	},
+	{
+		Code: `
+package main
+type Message union {
+    A uint8
+}
+func main(a, b uint8) uint8 {
+    var m Message
+    m.A = a
+    return m.B
+}
+`,
+		Error: "has no field or method B",
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    switch a {
+    default:
+        return a
+    default:
+        return b
+    }
+}
+`,
+		Error: "multiple defaults in switch",
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    switch {
+    case a:
+        return a
+    }
+    return b
+}
+`,
+		Error: "non-bool a (type uint8) used as if condition",
+	},
+}
+
+func TestSwitchUnion(t *testing.T) {
+	for idx, test := range switchUnionTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+}
+
+var arrayLitTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    arr := [4]uint8{1, 2, 3, 4, 5}
+    return arr[0] + a + b
+}
+`,
+		Error: "array index 4 out of bounds [0:4]",
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    arr := [4]uint8{5: 1}
+    return arr[0] + a + b
+}
+`,
+		Error: "array index 5 out of bounds [0:4]",
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    arr := [...]uint8{1, 2, 1: 3}
+    return arr[0] + a + b
+}
+`,
+		Error: "duplicate index 1 in array literal",
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    arr := [4]uint8{a: 1}
+    return arr[0] + b
+}
+`,
+		Error: "array index a must be constant",
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    arr := [...]uint8{-1: 1}
+    return arr[0] + a + b
+}
+`,
+		Error: "invalid array index -1",
+	},
+}
+
+func TestArrayLit(t *testing.T) {
+	for idx, test := range arrayLitTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+}
+
+var arraySizeTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    var arr [a]uint8
+    return arr[0]
+}
+`,
+		Error: "array length is not constant: a",
+	},
+	{
+		Code: `
+package main
+const N = 4
+func main(a, b uint8) uint8 {
+    var arr [N - 5]uint8
+    return a
+}
+`,
+		Error: "invalid array length N - 5 (-1)",
+	},
+}
+
+func TestArraySize(t *testing.T) {
+	for idx, test := range arraySizeTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+}
+
+func TestArrayLitFill(t *testing.T) {
+	const code = `
+package main
+func main(a, b uint16) uint16 {
+    fill := [65536]uint16{7}
+    keyed := [...]uint16{65535: 9}
+    return fill[0] + fill[65535] + keyed[65535] + keyed[0] + a + b
+}
+`
+	start := time.Now()
+	circ, _, err := New(utils.NewParams()).Compile(code, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("compilation took %s", elapsed)
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(1), big.NewInt(2)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if results[0].Int64() != 26 {
+		t.Errorf("got %v, expected 26", results[0])
+	}
+}
+
+func TestArrayLitSparse(t *testing.T) {
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+func main(a, b uint8) ([8]uint8, [6]uint8) {
+    sparse := [8]uint8{0: 1, 7: 2}
+    table := [...]uint8{5: 0x30, 2: 0x20, 0x21}
+    return sparse, table
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	if size := circ.Outputs[1].Type.ArraySize; size != 6 {
+		t.Errorf("got [%d]uint8 table, expected [6]uint8", size)
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(0), big.NewInt(0)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if results[0].Uint64() != 0x0200000000000001 {
+		t.Errorf("sparse: got %x, expected 0200000000000001", results[0])
+	}
+	if results[1].Uint64() != 0x300021200000 {
+		t.Errorf("table: got %x, expected 300021200000", results[1])
+	}
+}
+
+func TestConstantTimeCompare(t *testing.T) {
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "crypto/subtle"
+)
+func main(a, b [8]byte) (bool, bool) {
+    var short [7]byte
+    return subtle.ConstantTimeCompare(a, b),
+        subtle.ConstantTimeCompare(a, short)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	r := rand.New(rand.NewSource(683))
+	for i := 0; i < 100; i++ {
+		a := big.NewInt(r.Int63())
+		b := new(big.Int).Set(a)
+		if i%2 == 0 {
+			bit := r.Intn(64)
+			b.SetBit(b, bit, b.Bit(bit)^1)
+		}
+		results, err := circ.Compute([]*big.Int{a, b})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		equal := a.Cmp(b) == 0
+		if (results[0].Int64() == 1) != equal {
+			t.Errorf("ConstantTimeCompare(%x, %x)=%v, expected %v",
+				a, b, results[0], equal)
+		}
+		if results[1].Int64() != 0 {
+			t.Errorf("ConstantTimeCompare(%x, [7]byte)=%v, expected 0",
+				a, results[1])
+		}
+	}
+}
+
+func TestCondSelect(t *testing.T) {
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "cond"
+)
+func main(c bool, a [4]uint8) [4]uint8 {
+    b := [4]uint8{1, 2, 3, 4}
+    return cond.Select(c, a, b)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	a := big.NewInt(0x0d0c0b0a)
+	b := big.NewInt(0x04030201)
+	for _, c := range []int64{0, 1} {
+		results, err := circ.Compute([]*big.Int{big.NewInt(c), a})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		expected := b
+		if c == 1 {
+			expected = a
+		}
+		if results[0].Cmp(expected) != 0 {
+			t.Errorf("Select(%v)=%x, expected %x", c, results[0], expected)
+		}
+	}
+
+	circ, _, err = New(utils.NewParams()).Compile(`
+package main
+import (
+    "cond"
+)
+type Point struct {
+    X int16
+    Y bool
+}
+func main(c bool, x int16) int16 {
+    var a, b Point
+    a.X = x
+    a.Y = true
+    b.X = -x
+    p := cond.Select(c, a, b)
+    if p.Y {
+        return p.X + 1
+    }
+    return p.X
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	for _, c := range []int64{0, 1} {
+		results, err := circ.Compute([]*big.Int{big.NewInt(c),
+			big.NewInt(100)})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		expected := int64(0x10000 - 100)
+		if c == 1 {
+			expected = 101
+		}
+		if results[0].Int64() != expected {
+			t.Errorf("Select(%v)=%v, expected %v", c, results[0], expected)
+		}
+	}
+
+	for _, code := range []string{`
+package main
+import (
+    "cond"
+)
+func main(c bool, a [4]uint8) [4]uint8 {
+    var b [3]uint8
+    return cond.Select(c, a, b)
+}
+`, `
+package main
+import (
+    "cond"
+)
+func main(c uint8, a [4]uint8) [4]uint8 {
+    var b [4]uint8
+    return cond.Select(c, a, b)
+}
+`,
+	} {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+		_, _, err := New(params).Compile(code, nil)
+		if err == nil {
+			t.Errorf("compile succeeded:%s", code)
+		}
+	}
+}
+
+var funcValueTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    return apply(a, b, sub)
+}
+func apply(a, b int32, f func(int32, int32) int32) int32 {
+    return f(a, b)
+}
+func sub(a int32) int32 {
+    return -a
+}
+`,
+		Error: "cannot use sub (type func(int32) int32) as type " +
+			"func(int32, int32) int32 in argument to apply",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    return apply(a, b, a)
+}
+func apply(a, b int32, f func(int32, int32) int32) int32 {
+    return f(a, b)
+}
+`,
+		Error: "cannot use a as function value in argument to apply",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    return apply(a, b, undefined)
+}
+func apply(a, b int32, f func(int32, int32) int32) int32 {
+    return f(a, b)
+}
+`,
+		Error: "cannot use undefined as function value in argument to apply",
+	},
+	{
+		Code: `
+package main
+func main(a int32, f func(int32) int32) int32 {
+    return f(a)
+}
+`,
+		Error: "function type func(int32) int32 can only be used as " +
+			"an argument type",
+	},
+}
+
+func TestFuncValue(t *testing.T) {
+	for idx, test := range funcValueTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+}
+
+var packageVarTests = []string{
+	`
+package main
+var c int32
+func main(a, b int32) int32 {
+    c = a
+    return c
+}
+`,
+	`
+package main
+var c int32
+func main(a, b int32) int32 {
+    c += a
+    return c
+}
+`,
+	`
+package main
+var c [2]int32
+func main(a, b int32) int32 {
+    c[1] = a
+    return c[1]
+}
+`,
+	`
+package main
+type S struct {
+    A int32
+}
+var c S
+func main(a, b int32) int32 {
+    c.A = a
+    return c.A
+}
+`,
+	`
+package main
+var c int32
+func set(a int32) {
+    c = a
+}
+func main(a, b int32) int32 {
+    set(a)
+    return c
+}
+`,
+	`
+package main
+var c int32
+func set(p *int32, a int32) {
+    *p = a
+}
+func main(a, b int32) int32 {
+    set(&c, a)
+    return c
+}
+`,
+}
+
+func TestPackageVarAssign(t *testing.T) {
+	for idx, code := range packageVarTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(),
+			"cannot assign to package variable c") {
+			t.Errorf("test %d: got error %q", idx, err)
+		}
+	}
+}
+
+var breakTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    break
+    return a
+}
+`,
+		Error: "break is not in a loop or switch",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    switch a {
+    case 1:
+        continue
+    }
+    return a
+}
+`,
+		Error: "continue is not in a loop",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    for i := 0; i < 2; i++ {
+        if a == b {
+            break outer
+        }
+    }
+    return a
+}
+`,
+		Error: "invalid break label outer",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+outer:
+    switch a {
+    case 1:
+        for i := 0; i < 2; i++ {
+            continue outer
+        }
+    }
+    return a
+}
+`,
+		Error: "invalid continue label outer",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+outer:
+    for i := 0; i < 2; i++ {
+        loop(a)
+    }
+    return a
+}
+func loop(a int32) {
+    for i := 0; i < 2; i++ {
+        break outer
+    }
+}
+`,
+		Error: "invalid break label outer",
+	},
+	{
+		Code: `
+package main
+var c int32
+func main(a, b int32) int32 {
+    for i := 0; i < 2; i++ {
+        if a == b {
+            break
+        }
+        c = a
+    }
+    return c
+}
+`,
+		Error: "cannot assign to package variable c",
+	},
+}
+
+func TestBreak(t *testing.T) {
+	for idx, test := range breakTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+}
+
+func TestGoto(t *testing.T) {
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+func main(a, b uint8) (uint8, uint8) {
+    var r uint8
+    if a > b {
+        r = a - b
+        goto done
+    }
+    r = b - a
+    for i := 0; i < 4; i++ {
+        if r < 8 {
+            goto done
+        }
+        r = r >> 1
+    }
+    r = r + 100
+done:
+    var c uint8 = 1
+    goto skip
+    c = 2
+skip:
+    return r, c
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	for a := 0; a < 256; a += 3 {
+		for b := 0; b < 256; b += 5 {
+			results, err := circ.Compute([]*big.Int{
+				big.NewInt(int64(a)), big.NewInt(int64(b)),
+			})
+			if err != nil {
+				t.Fatalf("compute failed: %s", err)
+			}
+			var expected uint8
+			if a > b {
+				expected = uint8(a - b)
+			} else {
+				expected = uint8(b - a)
+				done := false
+				for i := 0; i < 4 && !done; i++ {
+					if expected < 8 {
+						done = true
+					} else {
+						expected >>= 1
+					}
+				}
+				if !done {
+					expected += 100
+				}
+			}
+			if results[0].Uint64() != uint64(expected) {
+				t.Fatalf("main(%v, %v)=%v, expected %v",
+					a, b, results[0], expected)
+			}
+			if results[1].Uint64() != 1 {
+				t.Fatalf("main(%v, %v): c=%v, expected 1",
+					a, b, results[1])
+			}
+		}
+	}
+
+	for idx, test := range gotoTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+}
+
+var gotoTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    goto end
+    return a
+}
+`,
+		Error: "label end not defined",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+start:
+    a++
+    if a < b {
+        goto start
+    }
+    return a
+}
+`,
+		Error: "goto start jumps backward",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    if a < b {
+        goto end
+    }
+    c := a + b
+end:
+    return a
+}
+`,
+		Error: "goto end jumps over variable declaration",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    goto inner
+    if a < b {
+    inner:
+        a++
+    }
+    return a
+}
+`,
+		Error: "goto inner jumps into block",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+end:
+    a++
+end:
+    return a
+}
+`,
+		Error: "label end already defined",
+	},
+}
+
+var recursionTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    return fact(a)
+}
+func fact(n int32) int32 {
+    if n <= 1 {
+        return 1
+    }
+    return n * fact(n-1)
+}
+`,
+		Error: "recursive call to fact not supported (circuits must be finite)",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    return even(a)
+}
+func even(n int32) int32 {
+    if n == 0 {
+        return 1
+    }
+    return odd(n - 1)
+}
+func odd(n int32) int32 {
+    if n == 0 {
+        return 0
+    }
+    return even(n - 1)
+}
+`,
+		Error: "recursive call to even not supported (circuits must be finite)",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    return sum(a, 0)
+}
+func sum(a int32, n int) int32 {
+    return a + sum(a, n+1)
+}
+`,
+		Error: "recursion depth exceeds",
+	},
+}
+
+func TestRecursion(t *testing.T) {
+	for idx, test := range recursionTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+func main(a, b int32) int32 {
+    return pow(a, 5) + fib(b, 10)
+}
+func pow(a int32, n int) int32 {
+    if n == 0 {
+        return 1
+    }
+    return a * pow(a, n-1)
+}
+func fib(a int32, n int) int32 {
+    if n < 2 {
+        return a
+    }
+    return fib(a, n-1) + fib(a, n-2)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile bounded recursion: %s", err)
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(3), big.NewInt(2)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if results[0].Int64() != 243+2*89 {
+		t.Errorf("got %v, expected %v", results[0], 243+2*89)
+	}
+}
+
+var unusedTests = []struct {
+	Code    string
+	Warning string
+}{
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    c := a + b
+    return a
+}
+`,
+		Warning: "c declared and not used",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    var c int32 = a * b
+    return a
+}
+`,
+		Warning: "c declared and not used",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    c := a
+    c = a * b
+    c = a + b
+    return c
+}
+`,
+		Warning: "value assigned to c is never used",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    c := a + b
+    return c
+}
+`,
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    c := a + b
+    _ = c
+    return a
+}
+`,
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    c := a
+    if b > 0 {
+        c = b
+    }
+    return c
+}
+`,
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    if a > 10 {
+        return 1
+    } else {
+        return 2
+    }
+    a = a + 5
+    return a
+}
+`,
+		Warning: "unreachable code",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    for i := 0; i < 4; i++ {
+        if i == 2 {
+            break
+        }
+        a = a + b
+    }
+    return a
+}
+`,
+	},
+}
+
+func TestUnused(t *testing.T) {
+	for idx, test := range unusedTests {
+		var log bytes.Buffer
+		params := utils.NewParams()
+		params.LogOut = &log
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err != nil {
+			t.Errorf("failed to compile test %d: %s", idx, err)
+			continue
+		}
+		if len(test.Warning) == 0 {
+			if log.Len() != 0 {
+				t.Errorf("test %d: unexpected warning: %s", idx, log.String())
+			}
+		} else if !strings.Contains(log.String(), test.Warning) {
+			t.Errorf("test %d: got warnings %q, expected %q",
+				idx, log.String(), test.Warning)
+		}
+	}
+}
+
+var blankTests = []struct {
+	Code  string
+	Error string
+}{
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    _ := a
+    return b
+}
+`,
+		Error: "no new variables on left side of :=",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    c := _
+    return c
+}
+`,
+		Error: "cannot use _ as value",
+	},
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    return _ + b
+}
+`,
+		Error: "cannot use _ as value",
+	},
+}
+
+func TestBlank(t *testing.T) {
+	for idx, test := range blankTests {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Error)
+		}
+	}
+
+	// Discarding a return value must not add any gates.
+	params := utils.NewParams()
+	params.OptPruneGates = true
+
+	discard, _, err := New(params).Compile(`
+package main
+func minMax(a, b int32) (int32, int32) {
+    if a < b {
+        return a, b
+    }
+    return b, a
+}
+func main(a, b int32) int32 {
+    _, max := minMax(a, b)
+    return max
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	single, _, err := New(params).Compile(`
+package main
+func maximum(a, b int32) int32 {
+    if a < b {
+        return b
+    }
+    return a
+}
+func main(a, b int32) int32 {
+    return maximum(a, b)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if discard.NumGates != single.NumGates {
+		t.Errorf("discarded value: got %d gates, expected %d",
+			discard.NumGates, single.NumGates)
+	}
+}
+
+var precheckTests = []struct {
+	Code   string
+	Errors []string
+}{
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    var c bool = a
+    return b
+}
+`,
+		Errors: []string{"cannot use a (type uint8) as type bool in assignment"},
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    c := a > b
+    c = 1
+    return b
+}
+`,
+		Errors: []string{
+			"cannot use 1 (type untyped int) as type bool in assignment",
+		},
+	},
+	{
+		Code: `
+package main
+func f(a, b uint8) (uint8, uint8) {
+    return a, b
+}
+func main(a, b uint8) uint8 {
+    c, d, e := f(a, b)
+    return c
+}
+`,
+		Errors: []string{"assignment mismatch: 3 variables but 2 values"},
+	},
+	{
+		Code: `
+package main
+func f(a, b uint8) uint8 {
+    return a
+}
+func main(a, b uint8) uint8 {
+    return f(a)
+}
+`,
+		Errors: []string{"not enough arguments in call to f"},
+	},
+	{
+		Code: `
+package main
+func f(a, b uint8) uint8 {
+    return a
+}
+func main(a, b uint8) uint8 {
+    return f(a, b, a)
+}
+`,
+		Errors: []string{"too many arguments in call to f"},
+	},
+	{
+		Code: `
+package main
+func f(a uint8, b bool) uint8 {
+    return a
+}
+func main(a, b uint8) uint8 {
+    return f(a, b)
+}
+`,
+		Errors: []string{
+			"cannot use b (type uint8) as type bool in argument to f",
+		},
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) (uint8, uint8) {
+    return a
+}
+`,
+		Errors: []string{"not enough arguments to return"},
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    return a, b
+}
+`,
+		Errors: []string{"too many arguments to return"},
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    return a < b
+}
+`,
+		Errors: []string{
+			"cannot use a < b (type bool) as type uint8 in return argument",
+		},
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) bool {
+    return a && b
+}
+`,
+		Errors: []string{
+			"invalid operation: operator && not defined on a (uint8)",
+		},
+	},
+	{
+		Code: `
+package main
+func main(a, b bool) bool {
+    return a + b
+}
+`,
+		Errors: []string{
+			"invalid operation: operator + not defined on a (bool)",
+		},
+	},
+	{
+		Code: `
+package main
+func main(a uint8, b bool) bool {
+    return a == b
+}
+`,
+		Errors: []string{
+			"invalid operation: a == b (mismatched types uint8 and bool)",
+		},
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    if !a {
+        return b
+    }
+    return -(a < b)
+}
+`,
+		Errors: []string{
+			"invalid operation: operator ! not defined on a (uint8)",
+			"invalid operation: operator - not defined on a < b (bool)",
+		},
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    for i := 0; i; i++ {
+        a += b
+    }
+    return a
+}
+`,
+		Errors: []string{"non-bool i (type int) used as for condition"},
+	},
+	{
+		Code: `
+package main
+func main(a, b uint8) uint8 {
+    switch a {
+    case true:
+        return b
+    }
+    return a
+}
+`,
+		Errors: []string{
+			"invalid case true in switch on a (mismatched types untyped bool and uint8)",
+		},
+	},
+	{
+		// All type errors are reported before the SSA generation.
+		Code: `
+package main
+func f(a uint8) bool {
+    return a
+}
+func main(a, b uint8) bool {
+    if a {
+        return f(a, b)
+    }
+    return a || b
+}
+`,
+		Errors: []string{
+			"cannot use a (type uint8) as type bool in return argument",
+			"non-bool a (type uint8) used as if condition",
+			"too many arguments in call to f",
+			"invalid operation: operator || not defined on a (uint8)",
+		},
+	},
+}
+
+func TestPrecheck(t *testing.T) {
+	for idx, test := range precheckTests {
+		var log bytes.Buffer
+		params := utils.NewParams()
+		params.LogOut = &log
+
+		_, _, err := New(params).Compile(test.Code, nil)
+		if err == nil {
+			t.Errorf("test %d: compile succeeded", idx)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Errors[0]) {
+			t.Errorf("test %d: got error %q, expected %q",
+				idx, err, test.Errors[0])
+		}
+		for _, e := range test.Errors {
+			if !strings.Contains(log.String(), e) {
+				t.Errorf("test %d: error %q not reported:\n%s",
+					idx, e, log.String())
+			}
+		}
+		n := strings.Count(strings.TrimSpace(log.String()), "\n") + 1
+		if n != len(test.Errors) {
+			t.Errorf("test %d: got %d errors, expected %d:\n%s",
+				idx, n, len(test.Errors), log.String())
+		}
+	}
+}
+
+func TestLineCost(t *testing.T) {
+	const code = `
+package main
+func main(a, b uint32) uint32 {
+    c := a + b
+    d := a * b
+    return c ^ d
+}
+`
+	var out bytes.Buffer
+	params := utils.NewParams()
+	params.OptPruneGates = true
+	params.CostOut = &out
+
+	circ, _, err := New(params).Compile(code, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	var total uint64
+	var lineNumbers []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var loc string
+		var count uint64
+		_, err := fmt.Sscanf(line, "%s\t%d", &loc, &count)
+		if err != nil {
+			t.Fatalf("invalid cost line %q: %s", line, err)
+		}
+		total += count
+		if loc != "<unknown>" {
+			lineNumbers = append(lineNumbers,
+				loc[strings.LastIndexByte(loc, ':')+1:])
+		}
+	}
+	// The multiplication is the most expensive line.
+	if len(lineNumbers) != 2 || lineNumbers[0] != "5" ||
+		lineNumbers[1] != "4" {
+		t.Errorf("unexpected cost report order:\n%s", out.String())
+	}
+	expected := circ.Stats[circuit.AND] + circ.Stats[circuit.OR]
+	if total != expected {
+		t.Errorf("report has %d AND gates, circuit has %d", total, expected)
+	}
+}
+
+// closeBuffer implements io.WriteCloser for bytes.Buffer.
+type closeBuffer struct {
+	bytes.Buffer
+}
+
+func (b *closeBuffer) Close() error {
+	return nil
+}
+
+func TestSSASvg(t *testing.T) {
+	const code = `
+package main
+func main(a, b uint4) uint4 {
+    if a > b {
+        return a + b
+    }
+    return a ^ b
+}
+`
+	out := new(closeBuffer)
+	params := utils.NewParams()
+	params.OptPruneGates = true
+	params.SSACircSvgOut = out
+
+	_, _, err := New(params).Compile(code, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(out.Bytes()))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %s", err)
+		}
+	}
+	// The gadgets are labeled with the source lines of the
+	// comparison, addition, and xor.
+	for _, label := range []string{":4:4: ugt", ":5:8: uadd", ":7:4: bxor"} {
+		if !strings.Contains(out.String(), label) {
+			t.Errorf("SVG does not contain gadget %q", label)
+		}
+	}
+
+	params = utils.NewParams()
+	params.OptPruneGates = true
+	params.SSACircSvgOut = new(closeBuffer)
+	_, _, err = New(params).Compile(`
+package main
+func main(a, b uint64) uint64 {
+    return a * b
+}
+`, nil)
+	if err == nil {
+		t.Errorf("SSA SVG of a large circuit succeeded")
+	}
+}
+
+func TestSSAFold(t *testing.T) {
+	const code = `
+package main
+func add(a, b int32) int32 {
+    var r int32
+    r = a
+    r += b
+    return r
+}
+func main(x int32) int32 {
+    return x * (add(1, 2) + add(3, 4))
+}
+`
+	out := new(closeBuffer)
+	params := utils.NewParams()
+	params.SSAOut = out
+
+	circ, _, err := New(params).Compile(code, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	// The inlined calls return constants and their sum is folded
+	// into the multiplication.
+	ssa := out.String()
+	if strings.Contains(ssa, "iadd") {
+		t.Errorf("addition of constants not folded:\n%s", ssa)
+	}
+	if !strings.Contains(ssa, "imult   x{1,0}i32 $10 ") {
+		t.Errorf("folded constant not propagated:\n%s", ssa)
+	}
+	result, err := circ.Compute([]*big.Int{big.NewInt(7)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if len(result) != 1 || result[0].Int64() != 70 {
+		t.Errorf("got %v, expected 70", result)
+	}
+}
+
+func TestCompileContext(t *testing.T) {
+	params := utils.NewParams()
+	params.LogOut = io.Discard
+	c := New(params)
+
+	// Canceled during loop unrolling.
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := c.CompileContext(ctx, `
+package main
+func main(a, b uint64) uint64 {
+    for i := 0; i < 100000; i++ {
+        a = a * b + uint64(i)
+    }
+    return a
+}
+`, nil)
+	var canceled *utils.CanceledError
+	if !errors.As(err, &canceled) {
+		t.Fatalf("got error %v, expected CanceledError", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, expected DeadlineExceeded", err)
+	}
+	if canceled.Loc.Undefined() {
+		t.Errorf("CanceledError has no location")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("compilation canceled after %v", elapsed)
+	}
+
+	// Canceled during circuit generation. The program has no loops
+	// or calls so the cancellation is detected when the gates are
+	// created.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, _, err = c.CompileContext(ctx, `
+package main
+func main(a, b uint64) uint64 {
+    return a * b
+}
+`, nil)
+	if !errors.As(err, &canceled) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, expected context.Canceled", err)
+	}
+
+	// The compiler remains usable after the cancellations.
+	for i := 0; i < 2; i++ {
+		circ, _, err := c.Compile(`
+package main
+import (
+    "sort"
+)
+func main(a, b int32) int32 {
+    lo, _ := sort.CompareSwap(a, b)
+    return lo
+}
+`, nil)
+		if err != nil {
+			t.Fatalf("compile failed: %s", err)
+		}
+		results, err := circ.Compute([]*big.Int{big.NewInt(7), big.NewInt(3)})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		if results[0].Int64() != 3 {
+			t.Errorf("got %v, expected 3", results[0])
+		}
+		c.Close()
+	}
+}
+
+func TestCompileFileStream(t *testing.T) {
+	const code = `
+package main
+func main(a, b uint32) (uint32, bool) {
+    d := b | 1
+    return a*b + a/d + a%d, a > b
+}
+`
+	file := filepath.Join(t.TempDir(), "stream.mpcl")
+	if err := os.WriteFile(file, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, renumber := range []bool{false, true} {
+		params := utils.NewParams()
+		params.OptRenumberWires = renumber
+
+		circ, _, err := New(params).CompileFile(file, nil)
+		if err != nil {
+			t.Fatalf("failed to compile %s: %s", file, err)
+		}
+		var batch bytes.Buffer
+		if err := circ.Marshal(&batch); err != nil {
+			t.Fatalf("failed to marshal circuit: %s", err)
+		}
+
+		params = utils.NewParams()
+		params.OptRenumberWires = renumber
+
+		var stream bytes.Buffer
+		sc, _, err := New(params).CompileFileStream(file, nil, &stream)
+		if err != nil {
+			t.Fatalf("failed to stream %s: %s", file, err)
+		}
+		if sc.NumGates != circ.NumGates || sc.NumWires != circ.NumWires ||
+			sc.Stats != circ.Stats {
+			t.Errorf("streamed circuit %v, expected %v", sc, circ)
+		}
+		if circ.NumGates < 10000 {
+			t.Errorf("circuit too small: %d gates", circ.NumGates)
+		}
+		if !bytes.Equal(batch.Bytes(), stream.Bytes()) {
+			t.Errorf("renumber=%v: streamed circuit differs from batch "+
+				"circuit: %d vs. %d bytes", renumber, stream.Len(), batch.Len())
+		}
+		results, err := circ.Compute([]*big.Int{
+			big.NewInt(1000), big.NewInt(7),
+		})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		if results[0].Int64() != 7000+142+6 || results[1].Int64() != 1 {
+			t.Errorf("renumber=%v: got %v, expected [7148 1]", renumber,
+				results)
+		}
+	}
+}
+
+func TestCompileLocalFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct {
+		code   string
+		inputs []*big.Int
+		result int64
+	}{
+		{
+			code: `
+package main
+func main() int32 {
+    return 6 * 7
+}
+`,
+			inputs: []*big.Int{big.NewInt(0)},
+			result: 42,
+		},
+		{
+			code: `
+package main
+func main(a int32) int32 {
+    return a * 7
+}
+`,
+			inputs: []*big.Int{big.NewInt(3)},
+			result: 21,
+		},
+	} {
+		file := filepath.Join(dir, "local.mpcl")
+		err := os.WriteFile(file, []byte(test.code), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		circ, _, err := New(utils.NewParams()).CompileLocalFile(file, nil)
+		if err != nil {
+			t.Fatalf("failed to compile %s: %s", test.code, err)
+		}
+		if len(circ.Inputs) != 1 {
+			t.Errorf("got %d inputs, expected 1", len(circ.Inputs))
+		}
+		results, err := circ.Compute(test.inputs)
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		if results[0].Int64() != test.result {
+			t.Errorf("got %v, expected %v", results[0], test.result)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	const code = `
+package main
+import (
+    "encoding/binary"
+    "math/bits"
+    "sort"
+)
+type Pair struct {
+    A uint32
+    B uint32
+}
+func main(a, b [8]byte) (Pair, uint32) {
+    x := binary.GetUint32(a[:])
+    y := binary.GetUint32(b[:])
+    lo, hi := sort.CompareSwap(x, y)
+    q, r := divmod(hi, lo|1)
+    var p Pair
+    p.A = bits.RotateLeft(lo, 3)
+    p.B = q * r
+    return p, x * y
+}
+`
+	marshal := func(cc *Compiler) []byte {
+		circ, _, err := cc.Compile(code, nil)
+		if err != nil {
+			t.Fatalf("compile failed: %s", err)
+		}
+		var buf bytes.Buffer
+		if err := circ.Marshal(&buf); err != nil {
+			t.Fatalf("marshal failed: %s", err)
+		}
+		return buf.Bytes()
+	}
+
+	expected := marshal(New(utils.NewParams()))
+	for i := 0; i < 3; i++ {
+		if !bytes.Equal(marshal(New(utils.NewParams())), expected) {
+			t.Fatalf("compilation %d differs", i)
+		}
+	}
+	cc := New(utils.NewParams())
+	for i := 0; i < 2; i++ {
+		if !bytes.Equal(marshal(cc), expected) {
+			t.Fatalf("recompilation %d differs", i)
+		}
+	}
+}
+
+func TestSortInts(t *testing.T) {
+	for _, n := range []int{1, 2, 5, 8, 13} {
+		code := fmt.Sprintf(`
+package main
+import (
+    "sort"
+)
+func main(a [%d]int8, b int32) [%d]int8 {
+    return sort.Ints(a)
+}
+`, n, n)
+		circ, _, err := New(utils.NewParams()).Compile(code, nil)
+		if err != nil {
+			t.Fatalf("failed to compile sort(%d): %s", n, err)
+		}
+		r := rand.New(rand.NewSource(int64(n)))
+		for i := 0; i < 10; i++ {
+			input := new(big.Int)
+			values := make([]int, n)
+			for j := range values {
+				values[j] = r.Intn(256) - 128
+				input.Or(input, new(big.Int).Lsh(
+					big.NewInt(int64(uint8(values[j]))), uint(j*8)))
+			}
+			results, err := circ.Compute([]*big.Int{input, big.NewInt(0)})
+			if err != nil {
+				t.Fatalf("sort(%d): compute failed: %s", n, err)
+			}
+			mask := big.NewInt(0xff)
+			prev := int64(math.MinInt8)
+			for j := 0; j < n; j++ {
+				v := new(big.Int).Rsh(results[0], uint(j*8))
+				v.And(v, mask)
+				if int64(int8(v.Int64())) < prev {
+					t.Errorf("sort(%d): %v: result not sorted: %x",
+						n, values, results[0])
+					break
+				}
+				prev = int64(int8(v.Int64()))
+			}
+		}
+	}
+}
+
+func TestCompareSwap(t *testing.T) {
+	for _, typ := range []string{"int8", "uint8"} {
+		code := fmt.Sprintf(`
+package main
+import (
+    "sort"
+)
+func main(a, b %s) (%s, %s, %s, %s) {
+    lo, hi := sort.CompareSwap(a, b)
+    c, d := sort.CompareSwap(a, 3)
+    return lo, hi, c, d
+}
+`, typ, typ, typ, typ, typ)
+		circ, _, err := New(utils.NewParams()).Compile(code, nil)
+		if err != nil {
+			t.Fatalf("failed to compile %s: %s", typ, err)
+		}
+		value := func(v *big.Int) int64 {
+			if typ == "int8" {
+				return int64(int8(v.Int64()))
+			}
+			return v.Int64()
+		}
+		for a := 0; a < 256; a++ {
+			for b := 0; b < 256; b++ {
+				results, err := circ.Compute([]*big.Int{
+					big.NewInt(int64(a)), big.NewInt(int64(b)),
+				})
+				if err != nil {
+					t.Fatalf("compute failed: %s", err)
+				}
+				x := value(big.NewInt(int64(a)))
+				y := value(big.NewInt(int64(b)))
+				lo, hi := value(results[0]), value(results[1])
+				if lo != min(x, y) || hi != max(x, y) {
+					t.Fatalf("%s: CompareSwap(%v, %v)=%v, %v",
+						typ, x, y, lo, hi)
+				}
+				lo, hi = value(results[2]), value(results[3])
+				if lo != min(x, 3) || hi != max(x, 3) {
+					t.Fatalf("%s: CompareSwap(%v, 3)=%v, %v", typ, x, lo, hi)
+				}
+			}
+		}
+	}
+
+	for _, code := range []string{`
+package main
+import (
+    "sort"
+)
+func main(a int8, b uint8) (int8, int8) {
+    return sort.CompareSwap(a, b)
+}
+`, `
+package main
+import (
+    "sort"
+)
+func main(a, b bool) (bool, bool) {
+    return sort.CompareSwap(a, b)
+}
+`, `
+package main
+import (
+    "sort"
+)
+func main(a, b int8) (int8, int8) {
+    return sort.CompareSwap(a)
+}
+`,
+	} {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+		_, _, err := New(params).Compile(code, nil)
+		if err == nil {
+			t.Errorf("compile succeeded:%s", code)
+		}
+	}
+}
+
+func TestDivmod(t *testing.T) {
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+func split(a, b uint8) (uint8, uint8) {
+    return divmod(a, b)
+}
+func main(a, b uint8) (uint8, uint8, uint8, uint8) {
+    q, r := divmod(a, b)
+    var q7, r7 uint8
+    q7, r7 = split(a, 7)
+    return q, r, q7, r7
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	for a := 0; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			results, err := circ.Compute([]*big.Int{
+				big.NewInt(int64(a)), big.NewInt(int64(b)),
+			})
+			if err != nil {
+				t.Fatalf("compute failed: %s", err)
+			}
+			q, r := results[0].Int64(), results[1].Int64()
+			if q != int64(a/b) || r != int64(a%b) {
+				t.Fatalf("divmod(%v, %v)=%v, %v", a, b, q, r)
+			}
+			q, r = results[2].Int64(), results[3].Int64()
+			if q != int64(a/7) || r != int64(a%7) {
+				t.Fatalf("divmod(%v, 7)=%v, %v", a, q, r)
+			}
+		}
+	}
+
+	for _, code := range []string{`
+package main
+func main(a int8, b uint8) (int8, int8) {
+    return divmod(a, b)
+}
+`, `
+package main
+func main(a, b bool) (bool, bool) {
+    return divmod(a, b)
+}
+`, `
+package main
+func main(a, b int8) (int8, int8) {
+    return divmod(a)
+}
+`, `
+package main
+func main(a, b int8) (int8, int8) {
+    return divmod(a, 0)
+}
+`,
+	} {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+		_, _, err := New(params).Compile(code, nil)
+		if err == nil {
+			t.Errorf("compile succeeded:%s", code)
+		}
+	}
+}
+
+// keccakF1600 is the reference Keccak-f[1600] permutation.
+func keccakF1600(a *[25]uint64) {
+	rc := [24]uint64{
+		0x0000000000000001, 0x0000000000008082, 0x800000000000808A,
+		0x8000000080008000, 0x000000000000808B, 0x0000000080000001,
+		0x8000000080008081, 0x8000000000008009, 0x000000000000008A,
+		0x0000000000000088, 0x0000000080008009, 0x000000008000000A,
+		0x000000008000808B, 0x800000000000008B, 0x8000000000008089,
+		0x8000000000008003, 0x8000000000008002, 0x8000000000000080,
+		0x000000000000800A, 0x800000008000000A, 0x8000000080008081,
+		0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+	}
+	rotc := [24]int{
+		1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14,
+		27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44,
+	}
+	piln := [24]int{
+		10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4,
+		15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1,
+	}
+	for round := 0; round < 24; round++ {
+		var c [5]uint64
+		for x := 0; x < 5; x++ {
+			c[x] = a[x] ^ a[x+5] ^ a[x+10] ^ a[x+15] ^ a[x+20]
+		}
+		for x := 0; x < 5; x++ {
+			d := c[(x+4)%5] ^ bits.RotateLeft64(c[(x+1)%5], 1)
+			for y := 0; y < 25; y += 5 {
+				a[y+x] ^= d
+			}
+		}
+		t := a[1]
+		for i := 0; i < 24; i++ {
+			j := piln[i]
+			t, a[j] = a[j], bits.RotateLeft64(t, rotc[i])
+		}
+		for y := 0; y < 25; y += 5 {
+			var row [5]uint64
+			copy(row[:], a[y:y+5])
+			for x := 0; x < 5; x++ {
+				a[y+x] = row[x] ^ (^row[(x+1)%5] & row[(x+2)%5])
+			}
+		}
+		a[0] ^= rc[round]
+	}
+}
+
+func TestMathSum(t *testing.T) {
+	r := rand.New(rand.NewSource(61))
+
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "math"
+)
+func main(a [16]uint8, b [5]int8) (uint, int) {
+    return math.Sum(a), math.Sum(b)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	// 16*255 needs 12 bits and 5*-128 needs 8+3 bits.
+	if bits := circ.Outputs[0].Type.Bits; bits != 12 {
+		t.Errorf("uint8 sum: got %d bits, expected 12", bits)
+	}
+	if bits := circ.Outputs[1].Type.Bits; bits != 11 {
+		t.Errorf("int8 sum: got %d bits, expected 11", bits)
+	}
+
+	for i := 0; i < 20; i++ {
+		a := new(big.Int)
+		var sumA int64
+		for j := 0; j < 16; j++ {
+			v := r.Intn(256)
+			if i == 0 {
+				v = 255
+			}
+			sumA += int64(v)
+			a.Or(a, new(big.Int).Lsh(big.NewInt(int64(v)), uint(j*8)))
+		}
+		b := new(big.Int)
+		var sumB int64
+		for j := 0; j < 5; j++ {
+			v := r.Intn(256) - 128
+			if i == 0 {
+				v = -128
+			}
+			sumB += int64(v)
+			b.Or(b, new(big.Int).Lsh(big.NewInt(int64(uint8(v))), uint(j*8)))
+		}
+		results, err := circ.Compute([]*big.Int{a, b})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		if results[0].Int64() != sumA {
+			t.Errorf("uint8 sum: got %v, expected %v", results[0], sumA)
+		}
+		got := results[1].Int64()
+		if got >= 1<<10 {
+			got -= 1 << 11
+		}
+		if got != sumB {
+			t.Errorf("int8 sum: got %v, expected %v", got, sumB)
+		}
+	}
+
+	for _, code := range []string{
+		`return math.Sum(x, x)`,
+		`return math.Sum(x[0])`,
+		`var s [2]bool
+    return math.Sum(s)`,
+	} {
+		_, _, err := New(utils.NewParams()).Compile(fmt.Sprintf(`
+package main
+import (
+    "math"
+)
+func main(x [4]uint32) uint {
+    %s
+}
+`, code), nil)
+		if err == nil {
+			t.Errorf("compile succeeded: %s", code)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	for _, typ := range []string{"int8", "uint8"} {
+		code := fmt.Sprintf(`
+package main
+import (
+    "cmp"
+)
+func main(a, b %s) (int, int) {
+    return cmp.Compare(a, b), cmp.Compare(a, 3)
+}
+`, typ)
+		circ, _, err := New(utils.NewParams()).Compile(code, nil)
+		if err != nil {
+			t.Fatalf("failed to compile %s: %s", typ, err)
+		}
+		value := func(v int) int64 {
+			if typ == "int8" {
+				return int64(int8(v))
+			}
+			return int64(v)
+		}
+		compare := func(x, y int64) int64 {
+			if x < y {
+				return -1
+			} else if x > y {
+				return 1
+			}
+			return 0
+		}
+		for a := 0; a < 256; a++ {
+			for b := 0; b < 256; b++ {
+				results, err := circ.Compute([]*big.Int{
+					big.NewInt(int64(a)), big.NewInt(int64(b)),
+				})
+				if err != nil {
+					t.Fatalf("compute failed: %s", err)
+				}
+				x, y := value(a), value(b)
+				r := int64(int32(results[0].Int64()))
+				if r != compare(x, y) {
+					t.Fatalf("%s: Compare(%v, %v)=%v", typ, x, y, r)
+				}
+				r = int64(int32(results[1].Int64()))
+				if r != compare(x, 3) {
+					t.Fatalf("%s: Compare(%v, 3)=%v", typ, x, r)
+				}
+			}
+		}
+	}
+
+	for _, code := range []string{`
+package main
+import (
+    "cmp"
+)
+func main(a int8, b uint8) int {
+    return cmp.Compare(a, b)
+}
+`, `
+package main
+import (
+    "cmp"
+)
+func main(a, b bool) int {
+    return cmp.Compare(a, b)
+}
+`,
+	} {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+		_, _, err := New(params).Compile(code, nil)
+		if err == nil {
+			t.Errorf("compile succeeded:%s", code)
+		}
+	}
+}
+
+func TestMathDot(t *testing.T) {
+	r := rand.New(rand.NewSource(675))
+
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "math"
+)
+func main(a [6]uint8, b [6]int8) (uint, int) {
+    return math.Dot(a, a), math.Dot(b, b)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	// 6*255*255 and 6*-128*-128 need 16+3 bits.
+	for idx, output := range circ.Outputs {
+		if bits := output.Type.Bits; bits != 19 {
+			t.Errorf("output %d: got %d bits, expected 19", idx, bits)
+		}
+	}
+
+	circ2, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "math"
+)
+func main(a, b [5]int8) int {
+    return math.Dot(a, b)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		a := new(big.Int)
+		b := new(big.Int)
+		c := new(big.Int)
+		var dotA, dotB, dotC int64
+		va := make([]int64, 6)
+		vb := make([]int64, 6)
+		for j := 0; j < 6; j++ {
+			va[j] = int64(r.Intn(256))
+			vb[j] = int64(r.Intn(256) - 128)
+			if i == 0 {
+				va[j] = 255
+				vb[j] = -128
+			}
+			dotA += va[j] * va[j]
+			dotB += vb[j] * vb[j]
+			a.Or(a, new(big.Int).Lsh(big.NewInt(va[j]), uint(j*8)))
+			b.Or(b, new(big.Int).Lsh(big.NewInt(int64(uint8(vb[j]))),
+				uint(j*8)))
+		}
+		// The uint8 values of a are int8 values in the signed test.
+		for j := 0; j < 5; j++ {
+			dotC += int64(int8(va[j])) * vb[j]
+			c.Or(c, new(big.Int).Lsh(big.NewInt(va[j]), uint(j*8)))
+		}
+		results, err := circ.Compute([]*big.Int{a, b})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		if results[0].Int64() != dotA {
+			t.Errorf("uint8 dot: got %v, expected %v", results[0], dotA)
+		}
+		if results[1].Int64() != dotB {
+			t.Errorf("int8 dot: got %v, expected %v", results[1], dotB)
+		}
+
+		b5 := new(big.Int).And(b, big.NewInt(1<<40-1))
+		results, err = circ2.Compute([]*big.Int{c, b5})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		got := results[0].Int64()
+		if got >= 1<<18 {
+			got -= 1 << 19
+		}
+		if got != dotC {
+			t.Errorf("int8 dot: got %v, expected %v", got, dotC)
+		}
+	}
+
+	for _, code := range []string{
+		`return math.Dot(x)`,
+		`return math.Dot(x, x[0])`,
+		`var y [3]uint32
+    return math.Dot(x, y)`,
+		`var y [4]uint16
+    return math.Dot(x, y)`,
+		`var y [4]int32
+    return math.Dot(x, y)`,
+	} {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+		_, _, err := New(params).Compile(fmt.Sprintf(`
+package main
+import (
+    "math"
+)
+func main(x [4]uint32) uint {
+    %s
+}
+`, code), nil)
+		if err == nil {
+			t.Errorf("compile succeeded: %s", code)
+		}
+	}
+}
+
+func TestMathAbs(t *testing.T) {
+	r := rand.New(rand.NewSource(694))
+
+	for _, bits := range []int{8, 16, 64} {
+		code := fmt.Sprintf(`
+package main
+import (
+    "math"
+)
+func main(a, b int%d) (uint%d, uint%d) {
+    return math.Abs(a), math.Abs(a - b)
+}
+`, bits, bits, bits)
+		circ, _, err := New(utils.NewParams()).Compile(code, nil)
+		if err != nil {
+			t.Fatalf("failed to compile int%d: %s", bits, err)
+		}
+		for idx, output := range circ.Outputs {
+			if output.Type.Type != types.TUint ||
+				int(output.Type.Bits) != bits {
+				t.Errorf("int%d: output %d type %v", bits, idx, output.Type)
+			}
+		}
+		mod := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+		half := new(big.Int).Rsh(mod, 1)
+
+		// The values are the two's complement bit patterns. The
+		// int8 range is tested exhaustively.
+		var values []*big.Int
+		if bits == 8 {
+			for v := int64(0); v < 256; v++ {
+				values = append(values, big.NewInt(v))
+			}
+		} else {
+			values = append(values, big.NewInt(0), big.NewInt(1),
+				new(big.Int).Sub(half, big.NewInt(1)), half,
+				new(big.Int).Add(half, big.NewInt(1)),
+				new(big.Int).Sub(mod, big.NewInt(1)))
+			for i := 0; i < 100; i++ {
+				values = append(values, new(big.Int).Rand(r, mod))
+			}
+		}
+		abs := func(v *big.Int) *big.Int {
+			if v.Cmp(half) >= 0 {
+				return new(big.Int).Sub(mod, v)
+			}
+			return v
+		}
+		for _, a := range values {
+			b := new(big.Int).Rand(r, mod)
+			results, err := circ.Compute([]*big.Int{a, b})
+			if err != nil {
+				t.Fatalf("compute failed: %s", err)
+			}
+			diff := new(big.Int).Sub(a, b)
+			diff.Mod(diff, mod)
+			for idx, expected := range []*big.Int{abs(a), abs(diff)} {
+				if results[idx].Cmp(expected) != 0 {
+					t.Errorf("int%d: abs %d of %v, %v: got %v, expected %v",
+						bits, idx, a, b, results[idx], expected)
+				}
+			}
+		}
+	}
+
+	// The absolute value of the most negative value is its magnitude
+	// as an unsigned integer.
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "math"
+)
+func main(a int8) (uint8, uint8, uint8, uint64, int) {
+    return math.Abs(int8(-128)), math.Abs(int8(-5)), math.Abs(int8(7)),
+        math.Abs(int64(-9223372036854775808)), math.Abs(-12)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(0)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	for idx, expected := range []uint64{128, 5, 7, 1 << 63, 12} {
+		if !results[idx].IsUint64() || results[idx].Uint64() != expected {
+			t.Errorf("constant abs %d: got %v, expected %v", idx,
+				results[idx], expected)
+		}
+	}
+
+	for _, code := range []string{
+		`return math.Abs(x)`,
+		`return math.Abs(int32(x), int32(x))`,
+		`return math.Abs(x > 0)`,
+	} {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+		_, _, err := New(params).Compile(fmt.Sprintf(`
+package main
+import (
+    "math"
+)
+func main(x uint32) uint32 {
+    %s
+}
+`, code), nil)
+		if err == nil {
+			t.Errorf("compile succeeded: %s", code)
+		}
+	}
+}
+
+func TestIntersectionSize(t *testing.T) {
+	r := rand.New(rand.NewSource(66))
+
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "psi"
+)
+func main(a [8]uint8, b [6]uint8) uint {
+    return psi.IntersectionSize(a, b)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	if bits := circ.Outputs[0].Type.Bits; bits != 4 {
+		t.Errorf("got %d result bits, expected 4", bits)
+	}
+	for i := 0; i < 50; i++ {
+		a := make([]uint8, 8)
+		b := make([]uint8, 6)
+		av := new(big.Int)
+		bv := new(big.Int)
+		// Draw the values from a small range so that the arrays
+		// have common elements.
+		for j := range a {
+			a[j] = uint8(r.Intn(16))
+			av.Or(av, new(big.Int).Lsh(big.NewInt(int64(a[j])), uint(j*8)))
+		}
+		for j := range b {
+			b[j] = uint8(r.Intn(16))
+			bv.Or(bv, new(big.Int).Lsh(big.NewInt(int64(b[j])), uint(j*8)))
+		}
+		var expected int64
+		for _, x := range a {
+			for _, y := range b {
+				if x == y {
+					expected++
+					break
+				}
+			}
+		}
+		results, err := circ.Compute([]*big.Int{av, bv})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		if results[0].Int64() != expected {
+			t.Errorf("IntersectionSize(%v, %v)=%v, expected %v",
+				a, b, results[0], expected)
+		}
+	}
+
+	for _, code := range []string{
+		`return psi.IntersectionSize(a)`,
+		`return psi.IntersectionSize(a, c)`,
+		`return psi.IntersectionSize(a[0], b[0])`,
+	} {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+		_, _, err := New(params).Compile(fmt.Sprintf(`
+package main
+import (
+    "psi"
+)
+func main(a, b [4]uint8, c [4]uint16) uint {
+    %s
+}
+`, code), nil)
+		if err == nil {
+			t.Errorf("compile succeeded: %s", code)
+		}
+	}
+}
+
+func TestImportAlias(t *testing.T) {
+	// The hmac package imports crypto/sha256 and the alias sha256 of
+	// the main package must not conflict with it.
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    sha256 "math"
+    "crypto/hmac"
+)
+func main(a, b uint64) uint64 {
+    return sha256.MaxUint(a, b)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(3), big.NewInt(7)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if results[0].Int64() != 7 {
+		t.Errorf("got %v, expected 7", results[0])
+	}
+}
+
+func TestIntrinsicAlias(t *testing.T) {
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    c "cond"
+    b "math/bits"
+)
+func main(x bool, y uint8) uint8 {
+    return c.Select(x, b.Reverse(y), y)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	for _, test := range []struct {
+		x        int64
+		expected int64
+	}{
+		{0, 0x01},
+		{1, 0x80},
+	} {
+		results, err := circ.Compute([]*big.Int{
+			big.NewInt(test.x), big.NewInt(0x01),
+		})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		if results[0].Int64() != test.expected {
+			t.Errorf("main(%v, 1)=%v, expected %v",
+				test.x, results[0], test.expected)
+		}
+	}
+}
+
+func TestAbort(t *testing.T) {
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "result"
+)
+func checkRange(v uint8) {
+    if v > 100 {
+        result.Abort()
+    }
+}
+func main(a, b uint8) uint8 {
+    if a == 0 {
+        return 0
+    }
+    checkRange(a)
+    checkRange(b)
+    return a + b
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	if len(circ.Outputs) != 2 || circ.Outputs[1].Name != circuit.AbortOutput {
+		t.Fatalf("invalid outputs: %v", circ.Outputs)
+	}
+	for a := 0; a < 256; a += 5 {
+		for b := 0; b < 256; b += 7 {
+			results, err := circ.Compute([]*big.Int{
+				big.NewInt(int64(a)), big.NewInt(int64(b)),
+			})
+			if err != nil {
+				t.Fatalf("compute failed: %s", err)
+			}
+			// The early return precedes the range checks.
+			expected := a != 0 && (a > 100 || b > 100)
+			outputs, values, aborted := circ.Outputs.SplitAbort(results)
+			if aborted != expected {
+				t.Errorf("main(%v, %v): aborted=%v, expected %v",
+					a, b, aborted, expected)
+			}
+			if len(outputs) != 1 || len(values) != 1 {
+				t.Fatalf("SplitAbort returned %d outputs", len(outputs))
+			}
+			var sum int64
+			if a != 0 {
+				sum = int64(uint8(a + b))
+			}
+			if !aborted && values[0].Int64() != sum {
+				t.Errorf("main(%v, %v)=%v, expected %v",
+					a, b, values[0], sum)
+			}
+		}
+	}
+}
+
+func TestKeccakF1600(t *testing.T) {
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "crypto/sha3"
+)
+func main(state uint1600, b int32) uint1600 {
+    return sha3.KeccakF1600(state)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	r := rand.New(rand.NewSource(1600))
+	for i := 0; i < 3; i++ {
+		var state [25]uint64
+		input := new(big.Int)
+		for j := range state {
+			if i > 0 {
+				state[j] = r.Uint64()
+			}
+			lane := new(big.Int).SetUint64(state[j])
+			input.Or(input, lane.Lsh(lane, uint(j*64)))
+		}
+		results, err := circ.Compute([]*big.Int{input, big.NewInt(0)})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		keccakF1600(&state)
+		if i == 0 && state[0] != 0xF1258F7940E1DDE7 {
+			t.Fatalf("reference: got %016x for zero state", state[0])
+		}
+		mask := new(big.Int).SetUint64(math.MaxUint64)
+		for j := range state {
+			lane := new(big.Int).Rsh(results[0], uint(j*64))
+			lane.And(lane, mask)
+			if lane.Uint64() != state[j] {
+				t.Errorf("test %d: lane %d: got %016x, expected %016x",
+					i, j, lane.Uint64(), state[j])
+			}
+		}
+	}
+}
+
+type countingOT struct {
+	ot.OT
+	count int
+}
+
+func (c *countingOT) Receive(flags []bool, result []ot.Label) error {
+	c.count += len(flags)
+	return c.OT.Receive(flags, result)
+}
+
+var publicTests = []struct {
+	Code string
+	OTs  int
+}{
+	{
+		Code: `
+package main
+func main(a, b int32) int32 {
+    return a + b
+}
+`,
+		OTs: 32,
+	},
+	{
+		Code: `
+package main
+// @public b
+func main(a, b int32) int32 {
+    return a + b
+}
+`,
+		OTs: 0,
+	},
+}
+
+func TestPublicInput(t *testing.T) {
+	for idx, test := range publicTests {
+		circ, _, err := New(utils.NewParams()).Compile(test.Code, nil)
+		if err != nil {
+			t.Fatalf("failed to compile test %d: %s", idx, err)
+		}
+		gr, ew := io.Pipe()
+		er, gw := io.Pipe()
+
+		gio := newReadWriter(gr, gw)
+		eio := newReadWriter(er, ew)
+
+		gerr := make(chan error)
+		go func() {
+			_, err := circuit.Garbler(p2p.NewConn(gio), ot.NewCO(), circ,
+				big.NewInt(11), false)
+			gerr <- err
+		}()
+
+		oti := &countingOT{
+			OT: ot.NewCO(),
+		}
+		result, err := circuit.Evaluator(p2p.NewConn(eio), oti, circ,
+			big.NewInt(13), false)
+		if err != nil {
+			t.Fatalf("test %d: Evaluator failed: %s", idx, err)
+		}
+		err = <-gerr
+		if err != nil {
+			t.Fatalf("test %d: Garbler failed: %s", idx, err)
+		}
+		if result[0].Int64() != 24 {
+			t.Errorf("test %d: got %v, expected 24", idx, result[0])
+		}
+		if oti.count != test.OTs {
+			t.Errorf("test %d: got %d OTs, expected %d",
+				idx, oti.count, test.OTs)
+		}
+	}
+}
+
+var partyTests = []struct {
+	Code    string
+	Parties []int
+}{
+	{
+		Code: `
+package main
+func main(a, b, c uint1) uint1 {
+    return a & b & c
+}
+`,
+		Parties: []int{0, 1, 2},
+	},
+	{
+		Code: `
+package main
+// @party 1 a c
+// @party 0 b
+func main(a, b, c uint1) uint1 {
+    return a & b & c
+}
+`,
+		Parties: []int{1, 0, 1},
+	},
+	{
+		Code: `
+package main
+// @party 0 a b
+func main(a, b, c uint1) uint1 {
+    return a & b & c
+}
+`,
+	},
+	{
+		Code: `
+package main
+// @party 0 a b
+// @party 1 b c
+func main(a, b, c uint1) uint1 {
+    return a & b & c
+}
+`,
+	},
+	{
+		Code: `
+package main
+// @party 0 a b d
+func main(a, b, c uint1) uint1 {
+    return a & b & c
+}
+`,
+	},
+	{
+		Code: `
+package main
+// @party -1 a b c
+func main(a, b, c uint1) uint1 {
+    return a & b & c
+}
+`,
+	},
+	{
+		Code: `
+package main
+// @party a b c
+func main(a, b, c uint1) uint1 {
+    return a & b & c
+}
+`,
+	},
+}
+
+func TestParty(t *testing.T) {
+	for idx, test := range partyTests {
+		circ, _, err := New(utils.NewParams()).Compile(test.Code, nil)
+		if test.Parties == nil {
+			if err == nil {
+				t.Errorf("test %d: compile succeeded", idx)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: compile failed: %s", idx, err)
+		}
+		parties, err := circ.Inputs.Parties()
+		if err != nil {
+			t.Fatalf("test %d: Parties failed: %s", idx, err)
+		}
+		for i, party := range parties {
+			if party != test.Parties[i] {
+				t.Errorf("test %d: input %d: got party %d, expected %d",
+					idx, i, party, test.Parties[i])
+			}
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	r := rand.New(rand.NewSource(32))
+
+	identity, _, err := New(utils.NewParams()).Compile(`
+package main
+func main(x uint32, b int32) uint32 {
+    return x
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile identity: %s", err)
+	}
+
+	for _, k := range []int{0, 5, -3, 37, -64} {
+		circ, _, err := New(utils.NewParams()).Compile(fmt.Sprintf(`
+package main
+import (
+    "math/bits"
+)
+func main(x uint32, b int32) uint32 {
+    return bits.RotateLeft(x, %d)
+}
+`, k), nil)
+		if err != nil {
+			t.Fatalf("failed to compile rotate %d: %s", k, err)
+		}
+		if circ.NumGates != identity.NumGates {
+			t.Errorf("rotate %d: got %d gates, expected %d",
+				k, circ.NumGates, identity.NumGates)
+		}
+		x := r.Uint32()
+		results, err := circ.Compute([]*big.Int{
+			big.NewInt(int64(x)), big.NewInt(0),
+		})
+		if err != nil {
+			t.Fatalf("rotate %d: compute failed: %s", k, err)
+		}
+		expected := bits.RotateLeft32(x, k)
+		if results[0].Uint64() != uint64(expected) {
+			t.Errorf("rotate %d: got %x, expected %x", k, results[0], expected)
+		}
+	}
+
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "math/bits"
+)
+func main(x uint32, k int8) (uint32, uint32) {
+    return bits.RotateLeft(x, k), bits.RotateRight(x, k)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile secret rotate: %s", err)
+	}
+	for i := 0; i < 20; i++ {
+		x := r.Uint32()
+		k := r.Intn(256) - 128
+		results, err := circ.Compute([]*big.Int{
+			big.NewInt(int64(x)), big.NewInt(int64(uint8(k))),
+		})
+		if err != nil {
+			t.Fatalf("rotate %d: compute failed: %s", k, err)
+		}
+		left := bits.RotateLeft32(x, k)
+		right := bits.RotateLeft32(x, -k)
+		if results[0].Uint64() != uint64(left) {
+			t.Errorf("RotateLeft(%x, %d): got %x, expected %x",
+				x, k, results[0], left)
+		}
+		if results[1].Uint64() != uint64(right) {
+			t.Errorf("RotateRight(%x, %d): got %x, expected %x",
+				x, k, results[1], right)
+		}
+	}
+}
+
+func TestReverse(t *testing.T) {
+	r := rand.New(rand.NewSource(59))
+
+	// The reversals are wire permutations and the pruned circuits
+	// have the same gates as the identity function.
+	params := utils.NewParams()
+	params.OptPruneGates = true
+
+	for _, size := range []int{8, 16, 32, 64} {
+		identity, _, err := New(params).Compile(fmt.Sprintf(`
+package main
+func main(x uint%d) (uint%d, uint%d) {
+    return x, x
+}
+`, size, size, size), nil)
+		if err != nil {
+			t.Fatalf("failed to compile identity: %s", err)
+		}
+		circ, _, err := New(params).Compile(fmt.Sprintf(`
+package main
+import (
+    "math/bits"
+)
+func main(x uint%d) (uint%d, uint%d) {
+    return bits.Reverse(x), bits.ReverseBytes(x)
+}
+`, size, size, size), nil)
+		if err != nil {
+			t.Fatalf("failed to compile reverse uint%d: %s", size, err)
+		}
+		if circ.NumGates != identity.NumGates {
+			t.Errorf("reverse uint%d: got %d gates, expected %d",
+				size, circ.NumGates, identity.NumGates)
+		}
+		for i := 0; i < 10; i++ {
+			x := r.Uint64() >> (64 - size)
+			results, err := circ.Compute([]*big.Int{
+				new(big.Int).SetUint64(x),
+			})
+			if err != nil {
+				t.Fatalf("reverse uint%d: compute failed: %s", size, err)
+			}
+			var rev, revBytes uint64
+			switch size {
+			case 8:
+				rev = uint64(bits.Reverse8(uint8(x)))
+				revBytes = x
+			case 16:
+				rev = uint64(bits.Reverse16(uint16(x)))
+				revBytes = uint64(bits.ReverseBytes16(uint16(x)))
+			case 32:
+				rev = uint64(bits.Reverse32(uint32(x)))
+				revBytes = uint64(bits.ReverseBytes32(uint32(x)))
+			case 64:
+				rev = bits.Reverse64(x)
+				revBytes = bits.ReverseBytes64(x)
+			}
+			if results[0].Uint64() != rev {
+				t.Errorf("Reverse(uint%d(%x)): got %x, expected %x",
+					size, x, results[0], rev)
+			}
+			if results[1].Uint64() != revBytes {
+				t.Errorf("ReverseBytes(uint%d(%x)): got %x, expected %x",
+					size, x, results[1], revBytes)
+			}
+		}
+	}
+
+	// Constant folding.
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "math/bits"
+)
+const R = bits.Reverse(uint16(0x1234))
+func main(x uint16) (uint16, uint32) {
+    return R, bits.ReverseBytes(uint32(0x11223344))
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile constant reverse: %s", err)
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(0)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if v := results[0].Uint64(); v != uint64(bits.Reverse16(0x1234)) {
+		t.Errorf("Reverse(0x1234): got %x, expected %x",
+			v, bits.Reverse16(0x1234))
+	}
+	if v := results[1].Uint64(); v != 0x44332211 {
+		t.Errorf("ReverseBytes(0x11223344): got %x, expected 44332211", v)
+	}
+
+	for _, code := range []string{
+		`return bits.Reverse(x, x)`,
+		`return bits.Reverse(int32(x))`,
+		`return bits.ReverseBytes(uint12(x))`,
+		`return bits.ReverseBytes(uint12(1))`,
+	} {
+		_, _, err := New(utils.NewParams()).Compile(fmt.Sprintf(`
+package main
+import (
+    "math/bits"
+)
+func main(x uint32) uint32 {
+    %s
+}
+`, code), nil)
+		if err == nil {
+			t.Errorf("compile succeeded: %s", code)
+		}
+	}
+}
+
+func TestBytesReverse(t *testing.T) {
+	params := utils.NewParams()
+	params.OptPruneGates = true
+
+	identity, _, err := New(params).Compile(`
+package main
+func main(a [4]uint8, b [4]uint16) ([4]uint8, [4]uint16, uint32, uint32) {
+    return a, b, 0, 0
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile identity: %s", err)
+	}
+	circ, _, err := New(params).Compile(`
+package main
+import (
+    "bytes"
+    "encoding/binary"
+)
+func main(a [4]uint8, b [4]uint16) ([4]uint8, [4]uint16, uint32, uint32) {
+    return bytes.Reverse(a), bytes.Reverse(b),
+        binary.GetUint32(a[:]), binary.GetUint32LSB(a[:])
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile reverse: %s", err)
+	}
+	if circ.NumGates != identity.NumGates {
+		t.Errorf("got %d gates, expected %d",
+			circ.NumGates, identity.NumGates)
+	}
+
+	// The array elements are packed from the least significant bits
+	// of the argument values.
+	a := big.NewInt(0x44332211)
+	b, _ := new(big.Int).SetString("4444333322221111", 16)
+	results, err := circ.Compute([]*big.Int{a, b})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	for idx, expected := range []string{
+		"11223344", "1111222233334444", "11223344", "44332211",
+	} {
+		if v := results[idx].Text(16); v != expected {
+			t.Errorf("result %d: got %s, expected %s", idx, v, expected)
+		}
+	}
+
+	for _, code := range []string{
+		`return bytes.Reverse(x, x)`,
+		`return bytes.Reverse(x[0])`,
+	} {
+		_, _, err := New(utils.NewParams()).Compile(fmt.Sprintf(`
+package main
+import (
+    "bytes"
+)
+func main(x [4]uint8) [4]uint8 {
+    %s
+}
+`, code), nil)
+		if err == nil {
+			t.Errorf("compile succeeded: %s", code)
+		}
+	}
+}
+
+func TestComputeSHA256(t *testing.T) {
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "crypto/sha256"
+)
+func main(data [3]byte, b int32) [sha256.Size]byte {
+    return sha256.Sum256(data)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	data := []byte("abc")
+	input := new(big.Int)
+	for i, b := range data {
+		input.Or(input, new(big.Int).Lsh(big.NewInt(int64(b)), uint(i*8)))
+	}
+	results, err := circ.Compute([]*big.Int{input, big.NewInt(0)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	digest := sha256.Sum256(data)
+	expected := new(big.Int)
+	for i, b := range digest {
+		expected.Or(expected,
+			new(big.Int).Lsh(big.NewInt(int64(b)), uint(i*8)))
+	}
+	if results[0].Cmp(expected) != 0 {
+		t.Errorf("got %x, expected %x", results[0], expected)
+	}
+}
+
+var funcCacheTests = []struct {
+	g      string
+	hits   int
+	misses int
+	result int64
+}{
+	{
+		g:      "return a - b",
+		misses: 2,
+		result: 7*3 + 7 - 3,
+	},
+	{
+		g:      "return a ^ b",
+		hits:   1,
+		misses: 1,
+		result: 7*3 + (7 ^ 3),
+	},
+	{
+		g:      "return a ^ b",
+		hits:   2,
+		result: 7*3 + (7 ^ 3),
+	},
+}
+
+func TestFuncCache(t *testing.T) {
+	params := utils.NewParams()
+	params.FuncCache = true
+	compiler := New(params)
+
+	var stats ast.FuncCacheStats
+	for idx, test := range funcCacheTests {
+		code := fmt.Sprintf(`
+package main
+func main(a, b int32) int32 {
+    return f(a, b) + g(a, b)
+}
+func f(a, b int32) int32 {
+    return a * b
+}
+func g(a, b int32) int32 {
+    %s
+}
+`, test.g)
+		circ, _, err := compiler.Compile(code, nil)
+		if err != nil {
+			t.Fatalf("test %d: failed to compile: %s", idx, err)
+		}
+		s := compiler.CacheStats()
+		if s.Hits-stats.Hits != test.hits ||
+			s.Misses-stats.Misses != test.misses {
+			t.Errorf("test %d: got %d hits, %d misses, expected %d, %d",
+				idx, s.Hits-stats.Hits, s.Misses-stats.Misses,
+				test.hits, test.misses)
+		}
+		stats = s
+
+		fresh, _, err := New(utils.NewParams()).Compile(code, nil)
+		if err != nil {
+			t.Fatalf("test %d: failed to compile: %s", idx, err)
+		}
+		if circ.NumGates != fresh.NumGates {
+			t.Errorf("test %d: got %d gates, expected %d",
+				idx, circ.NumGates, fresh.NumGates)
+		}
+		results, err := circ.Compute([]*big.Int{big.NewInt(7), big.NewInt(3)})
+		if err != nil {
+			t.Fatalf("test %d: compute failed: %s", idx, err)
+		}
+		if results[0].Int64() != test.result {
+			t.Errorf("test %d: got %v, expected %v",
+				idx, results[0], test.result)
+		}
+	}
+}
+
+func TestCompilerReuse(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, code string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	failing := write("failing.mpcl", `
+package main
+import (
+    "encoding/hex"
+)
+func main(a [2]byte, b byte) string {
+    return hex.EncodeToString(a[:]) + undefined
+}
+`)
+	succeeding := write("succeeding.mpcl", `
+package main
+import (
+    "encoding/hex"
+)
+func main(a [2]byte, b byte) string {
+    return hex.EncodeToString(a[:])
+}
+`)
+	params := utils.NewParams()
+	params.LogOut = io.Discard
+	compiler := New(params)
+	defer compiler.Close()
+
+	fresh, _, err := New(utils.NewParams()).CompileFile(succeeding, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+	inputs := []*big.Int{big.NewInt(0xa51f), big.NewInt(0)}
+	expected, err := fresh.Compute(inputs)
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, _, err = compiler.CompileFile(failing, nil)
+		if err == nil {
+			t.Fatalf("compiling %s succeeded", failing)
+		}
+		circ, _, err := compiler.CompileFile(succeeding, nil)
+		if err != nil {
+			t.Fatalf("failed to compile: %s", err)
+		}
+		results, err := circ.Compute(inputs)
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		if results[0].Cmp(expected[0]) != 0 {
+			t.Errorf("got %x, expected %x", results[0], expected[0])
+		}
+		compiler.Close()
+	}
+}
+
+func TestModExp(t *testing.T) {
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+import (
+    "math"
+)
+func main(b, e, m uint8) uint8 {
+    return math.ModExp(b, e, m)
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+
+	r := rand.New(rand.NewSource(617))
+	tests := [][3]int64{
+		{3, 5, 7},
+		{0, 0, 1},
+		{5, 0, 13},
+		{200, 255, 251},
+		{255, 255, 255},
+	}
+	for i := 0; i < 20; i++ {
+		tests = append(tests, [3]int64{
+			r.Int63n(256), r.Int63n(256), 1 + r.Int63n(255),
+		})
+	}
+	for _, test := range tests {
+		b := big.NewInt(test[0])
+		e := big.NewInt(test[1])
+		m := big.NewInt(test[2])
+		results, err := circ.Compute([]*big.Int{b, e, m})
+		if err != nil {
+			t.Fatalf("compute failed: %s", err)
+		}
+		expected := new(big.Int).Exp(b, e, m)
+		if results[0].Cmp(expected) != 0 {
+			t.Errorf("ModExp(%v, %v, %v)=%v, expected %v",
+				b, e, m, results[0], expected)
+		}
+	}
+
+	params := utils.NewParams()
+	params.LogOut = io.Discard
+	_, _, err = New(params).Compile(`
+package main
+import (
+    "math"
+)
+func main(b, e uint8, m uint16) uint8 {
+    return math.ModExp(b, e, m)
+}
+`, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid arguments") {
+		t.Errorf("mismatched widths: got error %v", err)
+	}
+}
+
+func TestModInverse(t *testing.T) {
+	r := rand.New(rand.NewSource(670))
+
+	for _, n := range []int{1, 4, 8, 16} {
+		code := fmt.Sprintf(`
+package main
+import (
+    "math"
+)
+func main(a, m uint%d) uint%d {
+    return math.ModInverse(a, m)
+}
+`, n, n)
+		circ, _, err := New(utils.NewParams()).Compile(code, nil)
+		if err != nil {
+			t.Fatalf("uint%d: failed to compile: %s", n, err)
+		}
+		var tests [][2]int64
+		if n <= 4 {
+			for a := int64(0); a < 1<<n; a++ {
+				for m := int64(1); m < 1<<n; m++ {
+					tests = append(tests, [2]int64{a, m})
+				}
+			}
+		} else {
+			max := int64(1) << n
+			tests = append(tests, [2]int64{3, 7}, [2]int64{0, 1},
+				[2]int64{max - 1, max - 1}, [2]int64{max - 2, max - 1},
+				[2]int64{2, max - 2}, [2]int64{max - 1, 2})
+			for i := 0; i < 50; i++ {
+				tests = append(tests, [2]int64{r.Int63n(max),
+					1 + r.Int63n(max-1)})
+			}
+		}
+		for _, test := range tests {
+			a := big.NewInt(test[0])
+			m := big.NewInt(test[1])
+			results, err := circ.Compute([]*big.Int{a, m})
+			if err != nil {
+				t.Fatalf("compute failed: %s", err)
+			}
+			expected := new(big.Int).ModInverse(a, m)
+			if expected == nil {
+				expected = big.NewInt(0)
+			}
+			if results[0].Cmp(expected) != 0 {
+				t.Errorf("uint%d: ModInverse(%v, %v)=%v, expected %v",
+					n, a, m, results[0], expected)
+			}
+		}
+	}
+
+	params := utils.NewParams()
+	params.LogOut = io.Discard
+	_, _, err := New(params).Compile(`
+package main
+import (
+    "math"
+)
+func main(a uint8, m uint16) uint16 {
+    return math.ModInverse(a, m)
+}
+`, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid arguments") {
+		t.Errorf("mismatched widths: got error %v", err)
+	}
+}
+
+func TestIsqrt(t *testing.T) {
+	r := rand.New(rand.NewSource(627))
+
+	for _, n := range []int{1, 7, 8, 16, 33, 64} {
+		code := fmt.Sprintf(`
+package main
+import (
+    "math"
+)
+func main(x uint%d, _ bool) uint%d {
+    return math.Isqrt(x)
+}
+`, n, (n+1)/2)
+		circ, _, err := New(utils.NewParams()).Compile(code, nil)
+		if err != nil {
+			t.Fatalf("uint%d: failed to compile: %s", n, err)
+		}
+
+		max := new(big.Int).Lsh(big.NewInt(1), uint(n))
+		tests := []*big.Int{
+			big.NewInt(0),
+			new(big.Int).Sub(max, big.NewInt(1)),
+		}
+		for i := 0; i < 100; i++ {
+			tests = append(tests, new(big.Int).Rand(r, max))
+		}
+		for _, x := range tests {
+			results, err := circ.Compute([]*big.Int{x, new(big.Int)})
+			if err != nil {
+				t.Fatalf("compute failed: %s", err)
+			}
+			expected := new(big.Int).Sqrt(x)
+			if results[0].Cmp(expected) != 0 {
+				t.Errorf("uint%d: Isqrt(%v)=%v, expected %v",
+					n, x, results[0], expected)
+			}
+		}
+	}
+
+	params := utils.NewParams()
+	params.LogOut = io.Discard
+	_, _, err := New(params).Compile(`
+package main
+import (
+    "math"
+)
+func main(x int16, _ bool) uint8 {
+    return math.Isqrt(x)
+}
+`, nil)
+	if err == nil {
+		t.Errorf("signed argument: compile succeeded")
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	r := rand.New(rand.NewSource(691))
+
+	for _, typ := range []struct {
+		name   string
+		bits   int
+		signed bool
+	}{
+		{"uint8", 8, false},
+		{"uint32", 32, false},
+		{"uint64", 64, false},
+		{"int8", 8, true},
+		{"int64", 64, true},
+	} {
+		code := fmt.Sprintf(`
+package main
+func main(a, b %[1]s) (%[1]s, %[1]s, %[1]s, %[1]s, %[1]s) {
+    return min(a, b), max(a, b), min(a, b, 100), max(3, a, b), min(7, 2, 5)
+}
+`, typ.name)
+		circ, _, err := New(utils.NewParams()).Compile(code, nil)
+		if err != nil {
+			t.Fatalf("failed to compile %s: %s", typ.name, err)
+		}
+		mod := new(big.Int).Lsh(big.NewInt(1), uint(typ.bits))
+		value := func(v *big.Int) *big.Int {
+			v = new(big.Int).Mod(v, mod)
+			if typ.signed && v.Bit(typ.bits-1) == 1 {
+				v.Sub(v, mod)
+			}
+			return v
+		}
+		less := func(x, y *big.Int) bool {
+			return value(x).Cmp(value(y)) < 0
+		}
+		minOf := func(vals ...*big.Int) *big.Int {
+			m := vals[0]
+			for _, v := range vals[1:] {
+				if less(v, m) {
+					m = v
+				}
+			}
+			return value(m)
+		}
+		maxOf := func(vals ...*big.Int) *big.Int {
+			m := vals[0]
+			for _, v := range vals[1:] {
+				if less(m, v) {
+					m = v
+				}
+			}
+			return value(m)
+		}
+		edges := []*big.Int{
+			big.NewInt(0),
+			big.NewInt(3),
+			big.NewInt(100),
+			new(big.Int).Sub(mod, big.NewInt(1)),
+			new(big.Int).Rsh(mod, 1),
+		}
+		var pairs [][2]*big.Int
+		for _, a := range edges {
+			for _, b := range edges {
+				pairs = append(pairs, [2]*big.Int{a, b})
+			}
+		}
+		for i := 0; i < 100; i++ {
+			pairs = append(pairs, [2]*big.Int{
+				new(big.Int).Rand(r, mod), new(big.Int).Rand(r, mod),
+			})
+		}
+		for _, pair := range pairs {
+			a, b := pair[0], pair[1]
+			results, err := circ.Compute([]*big.Int{a, b})
+			if err != nil {
+				t.Fatalf("compute failed: %s", err)
+			}
+			for i, expected := range []*big.Int{
+				minOf(a, b),
+				maxOf(a, b),
+				minOf(a, b, big.NewInt(100)),
+				maxOf(big.NewInt(3), a, b),
+				big.NewInt(2),
+			} {
+				if value(results[i]).Cmp(expected) != 0 {
+					t.Fatalf("%s: result %d for %v, %v: got %v, expected %v",
+						typ.name, i, value(a), value(b), value(results[i]),
+						expected)
+				}
+			}
+		}
+	}
+
+	// The gadget is built for the argument width.
+	var gates []uint64
+	for _, typ := range []string{"uint8", "uint32", "uint64"} {
+		circ, _, err := New(utils.NewParams()).Compile(fmt.Sprintf(`
+package main
+func main(a, b %[1]s) %[1]s {
+    return min(a, b)
+}
+`, typ), nil)
+		if err != nil {
+			t.Fatalf("failed to compile %s: %s", typ, err)
+		}
+		gates = append(gates, circ.Stats[circuit.AND])
+	}
+	if gates[0] >= gates[1] || gates[1] >= gates[2] {
+		t.Errorf("min AND gates by width: %v", gates)
+	}
+
+	for _, test := range []struct {
+		code  string
+		error string
+	}{
+		{
+			code: `
+package main
+func main(a uint8, b uint32) uint32 {
+    return min(a, b)
+}
+`,
+			error: "mismatched types uint8 and uint32 in call to min",
+		},
+		{
+			code: `
+package main
+func main(a, b int32) int32 {
+    return max(a, b, int64(1))
+}
+`,
+			error: "mismatched types int32 and int64 in call to max",
+		},
+		{
+			code: `
+package main
+func main(a, b uint8) uint8 {
+    return max(a, 300)
+}
+`,
+			error: "constant 300 overflows uint8 in call to max",
+		},
+		{
+			code: `
+package main
+func main(a, b uint8) uint8 {
+    return uint8(min(uint8(1), uint16(2)))
+}
+`,
+			error: "mismatched types uint8 and uint16 in call to min",
+		},
+		{
+			code: `
+package main
+func main(a, b bool) bool {
+    return min(a, b)
+}
+`,
+			error: "invalid argument type bool1 in call to min",
+		},
+		{
+			code: `
+package main
+func main(a, b uint8) uint8 {
+    return min()
+}
+`,
+			error: "not enough arguments in call to min",
+		},
+	} {
+		params := utils.NewParams()
+		params.LogOut = io.Discard
+		_, _, err := New(params).Compile(test.code, nil)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("got error %v, expected %q", err, test.error)
+		}
+	}
+}
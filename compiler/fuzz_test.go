@@ -0,0 +1,289 @@
+//
+// fuzz_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+var (
+	fuzzCount = flag.Int("circfuzz.n", 10,
+		"number of random programs in TestCircuitFuzz")
+	fuzzSeed = flag.Int64("circfuzz.seed", 1,
+		"seed of the first random program in TestCircuitFuzz")
+)
+
+// fuzzInputs specifies the number of random inputs each random
+// program is evaluated with.
+const fuzzInputs = 3
+
+// fuzzTypes specify the integer types of the random programs.
+var fuzzTypes = []struct {
+	name   string
+	bits   int
+	signed bool
+}{
+	{"uint8", 8, false},
+	{"uint16", 16, false},
+	{"uint32", 32, false},
+	{"int32", 32, true},
+}
+
+// TestCircuitFuzz compiles random programs and checks that the
+// garbled evaluation of the circuits gives the same results as the
+// plaintext computation. The program i is generated from the seed
+// circfuzz.seed+i so a failing program can be reproduced with:
+//
+//	go test ./compiler -run TestCircuitFuzz -args -circfuzz.seed=S -circfuzz.n=1
+func TestCircuitFuzz(t *testing.T) {
+	for i := 0; i < *fuzzCount; i++ {
+		seed := *fuzzSeed + int64(i)
+		code := newProgGen(seed).program()
+		if err := fuzzProgram(seed, code); err != nil {
+			t.Fatalf("program seed %d: %v\n%s", seed, err, code)
+		}
+	}
+}
+
+func fuzzProgram(seed int64, code string) error {
+	params := utils.NewParams()
+	params.LogOut = io.Discard
+
+	circ, _, err := New(params).Compile(code, nil)
+	if err != nil {
+		return err
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+	for i := 0; i < fuzzInputs; i++ {
+		var inputs []*big.Int
+		for _, arg := range circ.Inputs {
+			v := new(big.Int).SetUint64(rnd.Uint64())
+			mask := new(big.Int).Lsh(big.NewInt(1), uint(arg.Type.Bits))
+			inputs = append(inputs, v.Mod(v, mask))
+		}
+		computed, err := circ.Compute(inputs)
+		if err != nil {
+			return fmt.Errorf("Compute failed: %v", err)
+		}
+		garbled, err := circuit.EvalLocal(circ, inputs[0], inputs[1])
+		if err != nil {
+			return fmt.Errorf("EvalLocal failed: %v", err)
+		}
+		if len(garbled) != len(computed) {
+			return fmt.Errorf("EvalLocal%v returned %d values, expected %d",
+				inputs, len(garbled), len(computed))
+		}
+		for idx := range computed {
+			if garbled[idx].Cmp(computed[idx]) != 0 {
+				return fmt.Errorf("EvalLocal%v=%v, Compute=%v",
+					inputs, garbled, computed)
+			}
+		}
+	}
+	return nil
+}
+
+// progGen generates random MPCL programs. The programs are of the
+// form:
+//
+//	program = "func main(a, b T) T {" decls { stmt } return "}"
+//	decls   = var ":=" expr
+//	stmt    = var assign-op expr
+//	        | "if" cond "{" { stmt } "}" [ "else" "{" { stmt } "}" ]
+//	        | "for" loop-var ":= 0;" loop-var "<" N ";" loop-var "++ {"
+//	          { stmt | "if" cond "{ break }" } "}"
+//	expr    = var | var binary-op operand | var shift-op N
+//	operand = expr | const
+//	cond    = expr compare-op operand | cond logical-op cond | "!" cond
+//
+// The left operand of the binary operations is never constant and the
+// divisors are never constant zero so the programs compile without
+// constant overflows.
+type progGen struct {
+	rnd    *rand.Rand
+	typ    string
+	bits   int
+	signed bool
+	vars   []string
+	loops  int
+	out    strings.Builder
+}
+
+func newProgGen(seed int64) *progGen {
+	rnd := rand.New(rand.NewSource(seed))
+	t := fuzzTypes[rnd.Intn(len(fuzzTypes))]
+	return &progGen{
+		rnd:    rnd,
+		typ:    t.name,
+		bits:   t.bits,
+		signed: t.signed,
+		vars:   []string{"a", "b"},
+	}
+}
+
+func (g *progGen) printf(indent int, format string, a ...interface{}) {
+	g.out.WriteString(strings.Repeat("\t", indent))
+	fmt.Fprintf(&g.out, format, a...)
+	g.out.WriteString("\n")
+}
+
+func (g *progGen) program() string {
+	g.printf(0, "package main")
+	g.printf(0, "")
+	g.printf(0, "func main(a, b %s) %s {", g.typ, g.typ)
+
+	numVars := 1 + g.rnd.Intn(3)
+	for i := 0; i < numVars; i++ {
+		name := fmt.Sprintf("v%d", i)
+		g.printf(1, "%s := %s", name, g.expr(2))
+		g.vars = append(g.vars, name)
+	}
+	g.stmts(1, 2+g.rnd.Intn(4), 2, false)
+	g.printf(1, "return %s", strings.Join(g.vars, " ^ "))
+	g.printf(0, "}")
+
+	return g.out.String()
+}
+
+func (g *progGen) stmts(indent, count, depth int, inLoop bool) {
+	for i := 0; i < count; i++ {
+		g.stmt(indent, depth, inLoop)
+	}
+}
+
+func (g *progGen) stmt(indent, depth int, inLoop bool) {
+	choice := 0
+	if depth > 0 {
+		choice = g.rnd.Intn(5)
+	}
+	switch choice {
+	case 2:
+		g.printf(indent, "if %s {", g.cond(2))
+		g.stmts(indent+1, 1+g.rnd.Intn(2), depth-1, inLoop)
+		if g.rnd.Intn(2) == 0 {
+			g.printf(indent, "} else {")
+			g.stmts(indent+1, 1+g.rnd.Intn(2), depth-1, inLoop)
+		}
+		g.printf(indent, "}")
+
+	case 3:
+		v := fmt.Sprintf("i%d", g.loops)
+		g.loops++
+		g.printf(indent, "for %s := 0; %s < %d; %s++ {",
+			v, v, 1+g.rnd.Intn(3), v)
+		g.stmts(indent+1, 1+g.rnd.Intn(2), depth-1, true)
+		g.printf(indent, "}")
+
+	case 4:
+		if inLoop {
+			g.printf(indent, "if %s {", g.cond(1))
+			g.printf(indent+1, "break")
+			g.printf(indent, "}")
+			return
+		}
+		fallthrough
+
+	default:
+		ops := []string{"=", "+=", "-=", "*=", "^=", "|=", "&="}
+		g.printf(indent, "%s %s %s", g.variable(true),
+			ops[g.rnd.Intn(len(ops))], g.expr(2))
+	}
+}
+
+// variable returns a random variable. If assign is true, the
+// function does not return the argument variables.
+func (g *progGen) variable(assign bool) string {
+	if assign {
+		return g.vars[2+g.rnd.Intn(len(g.vars)-2)]
+	}
+	return g.vars[g.rnd.Intn(len(g.vars))]
+}
+
+func (g *progGen) constant(nonZero bool) string {
+	max := int64(1) << 16
+	if g.bits < 16 {
+		max = int64(1) << g.bits
+	}
+	var v int64
+	if g.signed {
+		v = g.rnd.Int63n(max) - max/2
+	} else {
+		v = g.rnd.Int63n(max)
+	}
+	if v == 0 && nonZero {
+		v = 1
+	}
+	if v < 0 {
+		return fmt.Sprintf("(%d)", v)
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+func (g *progGen) expr(depth int) string {
+	if depth == 0 || g.rnd.Intn(3) == 0 {
+		return g.variable(false)
+	}
+	left := g.expr(depth - 1)
+	switch g.rnd.Intn(10) {
+	case 0:
+		ops := []string{"<<", ">>"}
+		return fmt.Sprintf("(%s %s %d)", left, ops[g.rnd.Intn(len(ops))],
+			g.rnd.Intn(g.bits))
+
+	case 1:
+		ops := []string{"/", "%"}
+		var right string
+		if g.rnd.Intn(2) == 0 {
+			right = g.constant(true)
+		} else {
+			right = g.expr(depth - 1)
+		}
+		return fmt.Sprintf("(%s %s %s)", left, ops[g.rnd.Intn(len(ops))],
+			right)
+
+	default:
+		ops := []string{"+", "-", "*", "&", "|", "^"}
+		return fmt.Sprintf("(%s %s %s)", left, ops[g.rnd.Intn(len(ops))],
+			g.operand(depth-1))
+	}
+}
+
+func (g *progGen) operand(depth int) string {
+	if g.rnd.Intn(3) == 0 {
+		return g.constant(false)
+	}
+	return g.expr(depth)
+}
+
+func (g *progGen) cond(depth int) string {
+	switch {
+	case depth > 0 && g.rnd.Intn(4) == 0:
+		ops := []string{"&&", "||"}
+		return fmt.Sprintf("(%s %s %s)", g.cond(depth-1),
+			ops[g.rnd.Intn(len(ops))], g.cond(depth-1))
+
+	case depth > 0 && g.rnd.Intn(6) == 0:
+		return fmt.Sprintf("!%s", g.cond(depth-1))
+
+	default:
+		ops := []string{"==", "!=", "<", "<=", ">", ">="}
+		return fmt.Sprintf("(%s %s %s)", g.expr(1),
+			ops[g.rnd.Intn(len(ops))], g.operand(1))
+	}
+}
@@ -36,6 +36,10 @@ const (
 	TSymGoto
 	TSymReturn
 	TSymStruct
+	TSymUnion
+	TSymSwitch
+	TSymCase
+	TSymDefault
 	TSymVar
 	TSymConst
 	TSymType
@@ -81,6 +85,10 @@ var tokenTypes = map[TokenType]string{
 	TSymGoto:     "goto",
 	TSymReturn:   "return",
 	TSymStruct:   "struct",
+	TSymUnion:    "union",
+	TSymSwitch:   "switch",
+	TSymCase:     "case",
+	TSymDefault:  "default",
 	TSymVar:      "var",
 	TSymConst:    "const",
 	TSymType:     "type",
@@ -175,22 +183,26 @@ func (t TokenType) UnaryType() ast.UnaryType {
 }
 
 var symbols = map[string]TokenType{
-	"import": TSymImport,
-	"const":  TSymConst,
-	"type":   TSymType,
-	"for":    TSymFor,
-	"range":  TSymRange,
-	"nil":    TSymNil,
-	"else":   TSymElse,
-	// "break":    TSymBreak,
-	// "continue": TSymContinue,
-	// "goto":     TSymGoto,
-	"func":    TSymFunc,
-	"if":      TSymIf,
-	"package": TSymPackage,
-	"return":  TSymReturn,
-	"struct":  TSymStruct,
-	"var":     TSymVar,
+	"import":   TSymImport,
+	"const":    TSymConst,
+	"type":     TSymType,
+	"for":      TSymFor,
+	"range":    TSymRange,
+	"nil":      TSymNil,
+	"else":     TSymElse,
+	"break":    TSymBreak,
+	"continue": TSymContinue,
+	"goto":     TSymGoto,
+	"func":     TSymFunc,
+	"if":       TSymIf,
+	"package":  TSymPackage,
+	"return":   TSymReturn,
+	"struct":   TSymStruct,
+	"union":    TSymUnion,
+	"switch":   TSymSwitch,
+	"case":     TSymCase,
+	"default":  TSymDefault,
+	"var":      TSymVar,
 }
 
 // Token specifies an input token.
@@ -39,3 +39,28 @@ func TestInt128Lsh(t *testing.T) {
 		}
 	}
 }
+
+var andNot128Tests = []int128Test{
+	{
+		a: 0xff,
+		b: 0x0f,
+		r: "f0",
+	},
+	{
+		a: -1,
+		b: 0xff,
+		r: "-100",
+	},
+}
+
+func TestInt128AndNot(t *testing.T) {
+	for _, test := range andNot128Tests {
+		a := NewInt(test.a, 128)
+		b := NewInt(test.b, 128)
+		r := New(128).AndNot(a, b)
+		result := r.Text(16)
+		if result != test.r {
+			t.Errorf("TestInt128AndNot: got %v, expected %v", result, test.r)
+		}
+	}
+}
@@ -243,3 +243,33 @@ func TestInt32SubMaxInt32(t *testing.T) {
 		t.Errorf("%v-%v=%v, expected %v\n", a, b, r, math.MaxInt32-1)
 	}
 }
+
+var andNot32Tests = []int32Test{
+	{
+		a: 0xff,
+		b: 0x0f,
+		r: 0xf0,
+	},
+	{
+		a: -1,
+		b: 0xff,
+		r: -256,
+	},
+	{
+		a: math.MinInt32,
+		b: -1,
+		r: 0,
+	},
+}
+
+func TestInt32AndNot(t *testing.T) {
+	for idx, test := range andNot32Tests {
+		a := NewInt(test.a, 32)
+		b := NewInt(test.b, 32)
+		r := New(32).AndNot(a, b)
+		if r.Int64() != test.r {
+			t.Errorf("TestInt32AndNot-%v: %v&^%v=%v, expected %v\n",
+				idx, test.a, test.b, r.Int64(), test.r)
+		}
+	}
+}
@@ -82,6 +82,36 @@ func TestInt64And(t *testing.T) {
 	}
 }
 
+var andNot64Tests = []int64Test{
+	{
+		a: 0x0000ffff,
+		b: 0x00001111,
+		r: 0x0000eeee,
+	},
+	{
+		a: -1,
+		b: 0x000000ff,
+		r: -256,
+	},
+	{
+		a: math.MinInt64,
+		b: math.MaxInt64,
+		r: math.MinInt64,
+	},
+}
+
+func TestInt64AndNot(t *testing.T) {
+	for _, test := range andNot64Tests {
+		a := NewInt(test.a, 64)
+		b := NewInt(test.b, 64)
+		r := New(64).AndNot(a, b)
+		if r.Int64() != test.r {
+			t.Errorf("%v&^%v=%v, expected %v\n",
+				test.a, test.b, r.Int64(), test.r)
+		}
+	}
+}
+
 func TestInt64Cmp(t *testing.T) {
 	a := NewInt(1, 64)
 	b := NewInt(1, 64)
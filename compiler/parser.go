@@ -7,10 +7,12 @@
 package compiler
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/markkurossi/mpc/compiler/ast"
@@ -23,6 +25,13 @@ type Parser struct {
 	logger   *utils.Logger
 	lexer    *Lexer
 	pkg      *ast.Package
+	funcs    []lineRange
+}
+
+// lineRange specifies an inclusive range of source code lines.
+type lineRange struct {
+	From int
+	To   int
 }
 
 // NewParser creates a new parser.
@@ -73,6 +82,9 @@ func (p *Parser) Parse(pkg *ast.Package) (*ast.Package, error) {
 			}
 
 			var alias string
+			if t.Type == '.' {
+				return nil, p.errf(t.From, "dot-imports not supported")
+			}
 			if t.Type == TIdentifier {
 				alias = t.StrVal
 				t, err = p.lexer.Get()
@@ -87,16 +99,23 @@ func (p *Parser) Parse(pkg *ast.Package) (*ast.Package, error) {
 			if !ok {
 				return nil, p.errUnexpected(t, TConstant)
 			}
-			_, ok = p.pkg.Imports[str]
-			if ok {
-				return nil, p.errf(t.From,
-					"package %s imported more than once", str)
+			for _, imported := range p.pkg.Imports {
+				if imported == str {
+					return nil, p.errf(t.From,
+						"package %s imported more than once", str)
+				}
 			}
 
 			if len(alias) == 0 {
 				parts := strings.Split(str, "/")
 				alias = parts[len(parts)-1]
 			}
+			imported, ok := p.pkg.Imports[alias]
+			if ok {
+				return nil, p.errf(t.From,
+					"%s redeclared in this block: %s and %s",
+					alias, imported, str)
+			}
 
 			p.pkg.Imports[alias] = str
 		}
@@ -112,10 +131,48 @@ func (p *Parser) Parse(pkg *ast.Package) (*ast.Package, error) {
 			return nil, err
 		}
 	}
+	p.pkg.Digest = p.declDigest()
 
 	return p.pkg, nil
 }
 
+// funcDigest computes the digest of the source code lines of a
+// function.
+func (p *Parser) funcDigest(lines lineRange) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", p.pkg.Name)
+	for l := lines.From; l <= lines.To; l++ {
+		fmt.Fprintf(h, "%s\n", string(p.lexer.history[l]))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// declDigest computes the digest of the package-level declarations of
+// the package. The declarations are all source code lines outside
+// the functions. The digest is chained with the digest of the
+// package's previously parsed source files.
+func (p *Parser) declDigest() string {
+	var lines []int
+	for l := range p.lexer.history {
+		lines = append(lines, l)
+	}
+	sort.Ints(lines)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", p.pkg.Name, p.pkg.Digest)
+
+outer:
+	for _, l := range lines {
+		for _, f := range p.funcs {
+			if f.From <= l && l <= f.To {
+				continue outer
+			}
+		}
+		fmt.Fprintf(h, "%s\n", string(p.lexer.history[l]))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
 var leaves = map[string]bool{
 	"errorLoc":      true,
 	"errf":          true,
@@ -177,6 +234,85 @@ func (p *Parser) errf(loc utils.Point, format string, a ...interface{}) error {
 	return errors.New(msg)
 }
 
+// parseFuncType parses the function type after its "func" keyword.
+//
+// FunctionType = "func" "(" [ TypeList ] ")" [ Result ] .
+// Result       = Type | "(" TypeList ")" .
+func (p *Parser) parseFuncType(loc utils.Point) (*ast.TypeInfo, error) {
+	_, err := p.needToken('(')
+	if err != nil {
+		return nil, err
+	}
+	args, err := p.parseTypeList()
+	if err != nil {
+		return nil, err
+	}
+	result := &ast.TypeInfo{
+		Point:    loc,
+		Type:     ast.TypeFunc,
+		ArgTypes: args,
+	}
+	n, err := p.lexer.Get()
+	if err != nil {
+		if err == io.EOF {
+			return result, nil
+		}
+		return nil, err
+	}
+	switch n.Type {
+	case '(':
+		result.ReturnTypes, err = p.parseTypeList()
+		if err != nil {
+			return nil, err
+		}
+
+	case TIdentifier, '[', '*', TSymFunc:
+		p.lexer.Unget(n)
+		ret, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		result.ReturnTypes = []*ast.TypeInfo{ret}
+
+	default:
+		p.lexer.Unget(n)
+	}
+	return result, nil
+}
+
+// parseTypeList parses the comma-separated list of types up to and
+// including the closing ')' token.
+func (p *Parser) parseTypeList() ([]*ast.TypeInfo, error) {
+	var result []*ast.TypeInfo
+
+	t, err := p.lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	if t.Type == ')' {
+		return nil, nil
+	}
+	p.lexer.Unget(t)
+	for {
+		typeInfo, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, typeInfo)
+
+		t, err = p.lexer.Get()
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == ')' {
+			return result, nil
+		}
+		if t.Type != ',' {
+			return nil, p.errUnexpected(t, ',')
+		}
+	}
+}
+
 func (p *Parser) errUnexpected(offending *Token, expected TokenType) error {
 	return p.errf(offending.From, "unexpected token '%s': expected '%s'",
 		offending, expected)
@@ -442,8 +578,12 @@ func (p *Parser) parseTypeDecl(annotations ast.Annotations) error {
 		return err
 	}
 	switch t.Type {
-	case TSymStruct:
+	case TSymStruct, TSymUnion:
 		loc := t.From
+		kind := ast.TypeStruct
+		if t.Type == TSymUnion {
+			kind = ast.TypeUnion
+		}
 		_, err := p.needToken('{')
 		if err != nil {
 		}
@@ -491,7 +631,7 @@ func (p *Parser) parseTypeDecl(annotations ast.Annotations) error {
 		}
 		typeInfo := &ast.TypeInfo{
 			Point:        loc,
-			Type:         ast.TypeStruct,
+			Type:         kind,
 			TypeName:     name.StrVal,
 			StructFields: fields,
 			Annotations:  annotations,
@@ -709,8 +849,17 @@ func (p *Parser) parseFunc(annotations ast.Annotations) (*ast.Func, error) {
 		return nil, err
 	}
 
-	return ast.NewFunc(name.From, name.StrVal, arguments, returnValues,
-		namedReturnValues, body, end, annotations), nil
+	f := ast.NewFunc(name.From, name.StrVal, arguments, returnValues,
+		namedReturnValues, body, end, annotations)
+
+	lines := lineRange{
+		From: name.From.Line,
+		To:   end.Line,
+	}
+	p.funcs = append(p.funcs, lines)
+	f.Digest = p.funcDigest(lines)
+
+	return f, nil
 }
 
 func (p *Parser) parseBlock() (ast.List, utils.Point, error) {
@@ -821,6 +970,7 @@ func (p *Parser) parseStatement(needLBrace bool) (ast.AST, error) {
 				p.lexer.Unget(n)
 				b2, err = p.parseStatement(needLBrace)
 				if err != nil {
+					return nil, err
 				}
 
 			default:
@@ -830,11 +980,15 @@ func (p *Parser) parseStatement(needLBrace bool) (ast.AST, error) {
 			p.lexer.Unget(t)
 		}
 		return &ast.If{
+			Point: tStmt.From,
 			Expr:  expr,
 			True:  b1,
 			False: b2,
 		}, nil
 
+	case TSymSwitch:
+		return p.parseSwitch(tStmt)
+
 	case TSymReturn:
 		var exprs []ast.AST
 		if p.sameLine(tStmt.To) {
@@ -864,6 +1018,40 @@ func (p *Parser) parseStatement(needLBrace bool) (ast.AST, error) {
 			Exprs: exprs,
 		}, nil
 
+	case TSymBreak, TSymContinue:
+		var label string
+		if p.sameLine(tStmt.To) {
+			t, err := p.lexer.Get()
+			if err != nil {
+				return nil, err
+			}
+			if t.Type == TIdentifier {
+				label = t.StrVal
+			} else {
+				p.lexer.Unget(t)
+			}
+		}
+		if tStmt.Type == TSymBreak {
+			return &ast.Break{
+				Point: tStmt.From,
+				Label: label,
+			}, nil
+		}
+		return &ast.Continue{
+			Point: tStmt.From,
+			Label: label,
+		}, nil
+
+	case TSymGoto:
+		t, err := p.needToken(TIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Goto{
+			Point: tStmt.From,
+			Label: t.StrVal,
+		}, nil
+
 	case TSymFor:
 		var init ast.AST
 		n, err := p.lexer.Get()
@@ -1036,6 +1224,21 @@ func (p *Parser) parseStatement(needLBrace bool) (ast.AST, error) {
 				},
 			}, nil
 
+		case ':':
+			ref, ok := lvalues[0].(*ast.VariableRef)
+			if len(lvalues) != 1 || !ok || len(ref.Name.Package) > 0 {
+				return nil, p.errf(t.From, "unexpected %s", t)
+			}
+			stmt, err := p.parseStatement(needLBrace)
+			if err != nil {
+				return nil, err
+			}
+			return &ast.LabeledStmt{
+				Point: ref.Point,
+				Label: ref.Name.Name,
+				Stmt:  stmt,
+			}, nil
+
 		default:
 			p.lexer.Unget(t)
 			return ast.List(lvalues), nil
@@ -1043,6 +1246,81 @@ func (p *Parser) parseStatement(needLBrace bool) (ast.AST, error) {
 	}
 }
 
+func (p *Parser) parseSwitch(tStmt *Token) (ast.AST, error) {
+	result := &ast.Switch{
+		Point: tStmt.From,
+	}
+
+	t, err := p.lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != '{' {
+		p.lexer.Unget(t)
+		result.Expr, err = p.parseExpr(true)
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.needToken('{')
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var hasDefault bool
+	for {
+		t, err := p.lexer.Get()
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == '}' {
+			break
+		}
+		c := &ast.Case{
+			Point: t.From,
+		}
+		switch t.Type {
+		case TSymCase:
+			c.Exprs, err = p.parseExprList(false)
+			if err != nil {
+				return nil, err
+			}
+
+		case TSymDefault:
+			if hasDefault {
+				return nil, p.errf(t.From, "multiple defaults in switch")
+			}
+			hasDefault = true
+
+		default:
+			return nil, p.errf(t.From, "unexpected %s, expected case or default",
+				t)
+		}
+		_, err = p.needToken(':')
+		if err != nil {
+			return nil, err
+		}
+		for {
+			t, err := p.lexer.Get()
+			if err != nil {
+				return nil, err
+			}
+			p.lexer.Unget(t)
+			if t.Type == TSymCase || t.Type == TSymDefault || t.Type == '}' {
+				break
+			}
+			stmt, err := p.parseStatement(false)
+			if err != nil {
+				return nil, err
+			}
+			c.Body = append(c.Body, stmt)
+		}
+		result.Cases = append(result.Cases, c)
+	}
+
+	return result, nil
+}
+
 func (p *Parser) parseExprList(needLBrace bool) ([]ast.AST, error) {
 	var list []ast.AST
 
@@ -1466,7 +1744,7 @@ func (p *Parser) parseOperand(needLBrace bool) (ast.AST, error) {
 			operandName = &ast.VariableRef{
 				Point: t.From,
 				Name: ast.Identifier{
-					Defined: p.pkg.Name,
+					Defined: p.pkg.Path,
 					Package: t.StrVal,
 					Name:    id.StrVal,
 				},
@@ -1477,7 +1755,7 @@ func (p *Parser) parseOperand(needLBrace bool) (ast.AST, error) {
 			operandName = &ast.VariableRef{
 				Point: t.From,
 				Name: ast.Identifier{
-					Defined: p.pkg.Name,
+					Defined: p.pkg.Path,
 					Name:    t.StrVal,
 				},
 			}
@@ -1501,12 +1779,43 @@ func (p *Parser) parseOperand(needLBrace bool) (ast.AST, error) {
 		})
 
 	case '[': // ArrayType LiteralValue
-		p.lexer.Unget(t)
-		typeInfo, err := p.parseType()
+		n, err := p.lexer.Get()
 		if err != nil {
 			return nil, err
 		}
-		n, err := p.lexer.Get()
+		if n.Type == '.' {
+			// "[" "..." "]" ElementType, the literal defines the
+			// array length.
+			for i := 0; i < 2; i++ {
+				_, err = p.needToken('.')
+				if err != nil {
+					return nil, err
+				}
+			}
+			_, err = p.needToken(']')
+			if err != nil {
+				return nil, err
+			}
+			elType, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			_, err = p.needToken('{')
+			if err != nil {
+				return nil, err
+			}
+			return p.parseCompositeLit(&ast.TypeInfo{
+				Point:       t.From,
+				Type:        ast.TypeSlice,
+				ElementType: elType,
+			})
+		}
+		p.lexer.Unget(n)
+		typeInfo, err := p.parseArrayType(t.From)
+		if err != nil {
+			return nil, err
+		}
+		n, err = p.lexer.Get()
 		if err != nil {
 			return nil, err
 		}
@@ -1601,19 +1910,12 @@ func (p *Parser) parseCompositeLitValue(typeInfo *ast.TypeInfo) (
 		if n.Type == '}' {
 			break
 		} else if n.Type == '{' {
-			if typeInfo.Type != ast.TypeArray {
-				return nil, p.errf(n.From,
-					"invalid initializer for type %s", typeInfo)
-			}
-			v, err := p.parseCompositeLitValue(typeInfo.ElementType)
+			element, err := p.parseElidedCompositeLit(n, typeInfo)
 			if err != nil {
 				return nil, err
 			}
 			value = append(value, ast.KeyedElement{
-				Element: &ast.CompositeLit{
-					Type:  typeInfo.ElementType,
-					Value: v,
-				},
+				Element: element,
 			})
 		} else {
 			p.lexer.Unget(n)
@@ -1627,7 +1929,16 @@ func (p *Parser) parseCompositeLitValue(typeInfo *ast.TypeInfo) (
 			}
 			var element ast.AST
 			if n.Type == ':' {
-				element, err = p.parseExpr(false)
+				n, err = p.lexer.Get()
+				if err != nil {
+					return nil, err
+				}
+				if n.Type == '{' {
+					element, err = p.parseElidedCompositeLit(n, typeInfo)
+				} else {
+					p.lexer.Unget(n)
+					element, err = p.parseExpr(false)
+				}
 				if err != nil {
 					return nil, err
 				}
@@ -1656,6 +1967,26 @@ func (p *Parser) parseCompositeLitValue(typeInfo *ast.TypeInfo) (
 	return value, nil
 }
 
+// parseElidedCompositeLit parses the array element composite literal
+// whose type is elided. The opening '{' token t is already consumed.
+func (p *Parser) parseElidedCompositeLit(t *Token,
+	typeInfo *ast.TypeInfo) (ast.AST, error) {
+
+	if typeInfo.Type != ast.TypeArray && typeInfo.Type != ast.TypeSlice {
+		return nil, p.errf(t.From, "invalid initializer for type %s",
+			typeInfo)
+	}
+	v, err := p.parseCompositeLitValue(typeInfo.ElementType)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.CompositeLit{
+		Point: t.From,
+		Type:  typeInfo.ElementType,
+		Value: v,
+	}, nil
+}
+
 // Type      = TypeName | TypeLit | "(" Type ")" .
 // TypeName  = identifier | QualifiedIdent .
 // TypeLit   = ArrayType | StructType | PointerType | SliceType .
@@ -1700,47 +2031,14 @@ func (p *Parser) parseType() (*ast.TypeInfo, error) {
 			Point: loc,
 			Type:  ast.TypeName,
 			Name: ast.Identifier{
-				Defined: p.pkg.Name,
+				Defined: p.pkg.Path,
 				Package: pkg,
 				Name:    name,
 			},
 		}, nil
 
 	case '[':
-		loc := t.From
-		n, err := p.lexer.Get()
-		if err != nil {
-			return nil, err
-		}
-		var length ast.AST
-		if n.Type != ']' {
-			p.lexer.Unget(n)
-			length, err = p.parseExpr(false)
-			if err != nil {
-				return nil, err
-			}
-			_, err := p.needToken(']')
-			if err != nil {
-				return nil, err
-			}
-		}
-		elType, err := p.parseType()
-		if err != nil {
-			return nil, err
-		}
-		if length != nil {
-			return &ast.TypeInfo{
-				Point:       loc,
-				Type:        ast.TypeArray,
-				ElementType: elType,
-				ArrayLength: length,
-			}, nil
-		}
-		return &ast.TypeInfo{
-			Point:       loc,
-			Type:        ast.TypeSlice,
-			ElementType: elType,
-		}, nil
+		return p.parseArrayType(t.From)
 
 	case '*':
 		elType, err := p.parseType()
@@ -1753,8 +2051,52 @@ func (p *Parser) parseType() (*ast.TypeInfo, error) {
 			ElementType: elType,
 		}, nil
 
+	case TSymFunc:
+		return p.parseFuncType(t.From)
+
 	default:
 		return nil, p.errf(t.From,
 			"unexpected token '%s' while parsing type", t)
 	}
 }
+
+// parseArrayType parses the array or slice type after its opening
+// '[' token.
+//
+// ArrayType   = "[" ArrayLength "]" ElementType .
+// SliceType   = "[" "]" ElementType .
+func (p *Parser) parseArrayType(loc utils.Point) (*ast.TypeInfo, error) {
+	n, err := p.lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	var length ast.AST
+	if n.Type != ']' {
+		p.lexer.Unget(n)
+		length, err = p.parseExpr(false)
+		if err != nil {
+			return nil, err
+		}
+		_, err := p.needToken(']')
+		if err != nil {
+			return nil, err
+		}
+	}
+	elType, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if length != nil {
+		return &ast.TypeInfo{
+			Point:       loc,
+			Type:        ast.TypeArray,
+			ElementType: elType,
+			ArrayLength: length,
+		}, nil
+	}
+	return &ast.TypeInfo{
+		Point:       loc,
+		Type:        ast.TypeSlice,
+		ElementType: elType,
+	}, nil
+}
@@ -9,6 +9,7 @@ package compiler
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"testing"
 
@@ -127,3 +128,77 @@ func TestParser(t *testing.T) {
 		}
 	}
 }
+
+var importErrorTests = []string{
+	`
+package main
+import (
+    . "math"
+)
+`,
+	`
+package main
+import (
+    "math"
+    "math"
+)
+`,
+	`
+package main
+import (
+    m "math"
+    m "sort"
+)
+`,
+}
+
+func TestImportErrors(t *testing.T) {
+	for idx, test := range importErrorTests {
+		logger := utils.NewLogger(io.Discard)
+		parser := NewParser(fmt.Sprintf("{test %d}", idx),
+			New(utils.NewParams()), logger,
+			bytes.NewReader([]byte(test)))
+		_, err := parser.Parse(nil)
+		if err == nil {
+			t.Errorf("Parse test %d succeeded, expected error", idx)
+		}
+	}
+}
+
+var elseIfErrorTests = []string{
+	`
+package main
+func main(a, b int4) int4 {
+    if a > b {
+        return a
+    } else if a < {
+        return b
+    }
+    return 0
+}
+`,
+	`
+package main
+func main(a, b int4) int4 {
+    if a > b {
+        return a
+    } else if a < b {
+        return b +
+    }
+    return 0
+}
+`,
+}
+
+func TestElseIfErrors(t *testing.T) {
+	for idx, test := range elseIfErrorTests {
+		logger := utils.NewLogger(io.Discard)
+		parser := NewParser(fmt.Sprintf("{test %d}", idx),
+			New(utils.NewParams()), logger,
+			bytes.NewReader([]byte(test)))
+		_, err := parser.Parse(nil)
+		if err == nil {
+			t.Errorf("Parse test %d succeeded, expected error", idx)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+//
+// repl.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"path"
+	"strings"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/ast"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+const replSource = "{repl}"
+
+// REPL implements an interactive read-eval-print loop that evaluates
+// MPCL expressions and statements in the clear. Each input is
+// compiled into a circuit of the main function which is then
+// computed locally. The accepted statements and declarations are
+// kept and compiled again with each new input so the variable
+// bindings persist across the inputs of a session.
+type REPL struct {
+	compiler *Compiler
+	imports  []string
+	decls    []string
+	stmts    []string
+	pending  string
+}
+
+// NewREPL creates a new REPL with the compiler parameters. The
+// compiler warnings and the output files of the parameters are not
+// used by the REPL.
+func NewREPL(params *utils.Params) *REPL {
+	p := *params
+	p.LogOut = io.Discard
+	p.SSAOut = nil
+	p.SSADotOut = nil
+	p.CircOut = nil
+	p.CircDotOut = nil
+	p.CircSvgOut = nil
+	p.FanOutWarning = 0
+
+	return &REPL{
+		compiler: New(&p),
+	}
+}
+
+// Run reads the input lines from in and writes the results and
+// errors to out until the input ends.
+func (r *REPL) Run(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	prompt := "> "
+	for {
+		fmt.Fprint(out, prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		result, more, err := r.Eval(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(out, "error: %s\n", err)
+		} else if len(result) > 0 {
+			fmt.Fprintln(out, result)
+		}
+		if more {
+			prompt = "... "
+		} else {
+			prompt = "> "
+		}
+	}
+}
+
+// Eval evaluates the input line. The function returns the value of
+// an expression as a string. If the line does not complete the input,
+// the function returns true and the line is evaluated together with
+// the following lines. The failing inputs are discarded and the REPL
+// state remains as it was before the input.
+func (r *REPL) Eval(line string) (string, bool, error) {
+	r.pending += line + "\n"
+	depth, first, err := nesting(r.pending)
+	if err != nil {
+		r.pending = ""
+		return "", false, err
+	}
+	if depth > 0 {
+		return "", true, nil
+	}
+	input := strings.TrimSpace(r.pending)
+	r.pending = ""
+	if len(input) == 0 {
+		return "", false, nil
+	}
+
+	switch first {
+	case TSymImport:
+		return "", false, r.evalImport(input)
+
+	case TSymFunc, TSymType:
+		r.decls = append(r.decls, input)
+		_, err = r.compile("", false)
+		if err != nil {
+			r.decls = r.decls[:len(r.decls)-1]
+		}
+		return "", false, err
+	}
+
+	// Try the input as an expression and fall back to statement if
+	// it is not a valid value.
+	circ, exprErr := r.compile("return "+input, true)
+	if exprErr == nil {
+		result, err := r.compute(circ)
+		return result, false, err
+	}
+	r.stmts = append(r.stmts, input)
+	_, err = r.compile("", false)
+	if err != nil {
+		r.stmts = r.stmts[:len(r.stmts)-1]
+		if !errors.Is(exprErr, errREPLSyntax) {
+			return "", false, exprErr
+		}
+		return "", false, err
+	}
+	return "", false, nil
+}
+
+var errREPLSyntax = errors.New("syntax error")
+
+func (r *REPL) evalImport(input string) error {
+	lexer := NewLexer(replSource, strings.NewReader(input))
+	lexer.Get()
+	t, err := lexer.Get()
+	if err != nil || t.Type != TConstant {
+		return fmt.Errorf("expected import path: %s", input)
+	}
+	name, ok := t.ConstVal.(string)
+	if !ok {
+		return fmt.Errorf("expected import path: %s", input)
+	}
+	_, err = lexer.Get()
+	if err != io.EOF {
+		return fmt.Errorf("unexpected input after import path: %s", input)
+	}
+	for _, imp := range r.imports {
+		if imp == name {
+			return nil
+		}
+	}
+	_, err = r.compiler.parsePkg(name, replSource)
+	if err != nil {
+		return err
+	}
+	r.imports = append(r.imports, name)
+	return nil
+}
+
+// source returns the program source for the main function body.
+func (r *REPL) source(body string) string {
+	code := strings.Join(r.decls, "\n") + strings.Join(r.stmts, "\n") + body
+
+	var sb strings.Builder
+	sb.WriteString("package main\n")
+	sb.WriteString("import (\n")
+	for _, imp := range r.imports {
+		// Import only the used packages.
+		if strings.Contains(code, path.Base(imp)+".") {
+			fmt.Fprintf(&sb, "%q\n", imp)
+		}
+	}
+	sb.WriteString(")\n")
+	for _, decl := range r.decls {
+		sb.WriteString(decl)
+		sb.WriteRune('\n')
+	}
+	// The circuit needs an input so main takes an unused argument.
+	sb.WriteString("func main(_ bool) {\n")
+	for _, stmt := range r.stmts {
+		sb.WriteString(stmt)
+		sb.WriteRune('\n')
+	}
+	sb.WriteString(body)
+	sb.WriteString("\n}\n")
+
+	return sb.String()
+}
+
+// compile compiles the main function body. If value is true, the
+// body returns a value and the main function's result type is
+// inferred from it. Otherwise the body is only type checked.
+func (r *REPL) compile(body string, value bool) (*circuit.Circuit, error) {
+	c := r.compiler
+	logger := c.logger()
+	c.reset()
+	pkg, err := c.parse(replSource, strings.NewReader(r.source(body)), logger,
+		ast.NewPackage("main", replSource, nil))
+	if err != nil {
+		c.release()
+		return nil, fmt.Errorf("%w: %s", errREPLSyntax, err)
+	}
+	main, err := pkg.Main()
+	if err != nil {
+		c.release()
+		return nil, err
+	}
+	if value {
+		main.Return = []*ast.Variable{
+			{
+				Point: main.Point,
+			},
+		}
+	}
+	c.params.NoCircCompile = !value
+	circ, _, err := c.compilePkg(context.Background(), logger, replSource, pkg,
+		nil, nil)
+	return circ, err
+}
+
+// compute computes the circuit and returns its result value as a
+// string.
+func (r *REPL) compute(circ *circuit.Circuit) (string, error) {
+	results, err := circ.Compute([]*big.Int{new(big.Int)})
+	if err != nil {
+		return "", err
+	}
+	if len(results) != 1 || len(circ.Outputs) != 1 {
+		return "", fmt.Errorf("expected one result, got %d", len(results))
+	}
+	v, err := circuit.Decode(results[0], circ.Outputs[0].Type)
+	if err != nil {
+		return "", err
+	}
+	switch val := v.(type) {
+	case []byte:
+		return fmt.Sprintf("%x", val), nil
+	default:
+		return fmt.Sprintf("%v", val), nil
+	}
+}
+
+// nesting returns the nesting depth of the parentheses, brackets, and
+// braces at the end of the input, and the type of the first token.
+func nesting(input string) (int, TokenType, error) {
+	lexer := NewLexer(replSource, strings.NewReader(input))
+	var depth int
+	var first TokenType
+	for {
+		t, err := lexer.Get()
+		if err != nil {
+			if err == io.EOF {
+				return depth, first, nil
+			}
+			return 0, 0, err
+		}
+		if first == 0 {
+			first = t.Type
+		}
+		switch t.Type {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		}
+	}
+}
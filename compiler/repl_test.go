@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+var replTests = []struct {
+	input  string
+	result string
+	more   bool
+	err    string
+}{
+	{input: "1 + 2", result: "3"},
+	{input: "x := uint8(200)"},
+	{input: "x + 50", result: "250"},
+	{input: "y := int8(-3)"},
+	{input: "y * 2", result: "-6"},
+	{input: "x > 100", result: "true"},
+	{input: "x = x + 1"},
+	{input: "x", result: "201"},
+	{input: "var arr [4]byte"},
+	{input: "for i := 0; i < len(arr); i++ {", more: true},
+	{input: "    arr[i] = byte(i + 1)", more: true},
+	{input: "}"},
+	{input: "arr", result: "01020304"},
+	{input: "func double(v uint16) uint16 {", more: true},
+	{input: "    return v * 2", more: true},
+	{input: "}"},
+	{input: "double(21)", result: "42"},
+	{input: "z + 1", err: "undefined"},
+	{input: "x := 1", err: "no new variables"},
+	{input: "x", result: "201"},
+	{input: `"hello"`, result: "hello"},
+	{input: `import "math"`},
+	{input: "math.MaxUint8", result: "255"},
+}
+
+func TestREPL(t *testing.T) {
+	repl := NewREPL(utils.NewParams())
+
+	for idx, test := range replTests {
+		result, more, err := repl.Eval(test.input)
+		if len(test.err) > 0 {
+			if err == nil {
+				t.Errorf("test %d: %q: expected error %q", idx, test.input,
+					test.err)
+			} else if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("test %d: %q: got error %q, expected %q",
+					idx, test.input, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: %q: Eval failed: %v", idx, test.input, err)
+		}
+		if result != test.result || more != test.more {
+			t.Errorf("test %d: %q: got %q (more=%v), expected %q (more=%v)",
+				idx, test.input, result, more, test.result, test.more)
+		}
+	}
+}
@@ -19,8 +19,9 @@ var (
 
 // Bindings defines value bindings.
 type Bindings struct {
-	shared bool
-	Values []Binding
+	shared   bool
+	readOnly bool
+	Values   []Binding
 }
 
 // Debug prints the bindings.
@@ -38,8 +39,9 @@ func (bindings *Bindings) Count() int {
 	return len(bindings.Values)
 }
 
-// Clone makes a copy of the bindings.
-func (bindings Bindings) Clone() *Bindings {
+// Clone makes a copy of the bindings. The bindings share their
+// values until either of them is modified.
+func (bindings *Bindings) Clone() *Bindings {
 	result := &Bindings{
 		shared: true,
 		Values: bindings.Values,
@@ -56,13 +58,28 @@ func (bindings *Bindings) Define(v Value, val *Value) {
 	bindings.set(v, v.Type, val)
 }
 
+// SetReadOnly marks the bindings read-only. The package bindings are
+// read-only after the package initialization. The read-only bindings
+// can define new names but the defined names can't be set.
+func (bindings *Bindings) SetReadOnly() {
+	bindings.readOnly = true
+}
+
+// ReadOnly tests if the bindings are read-only.
+func (bindings *Bindings) ReadOnly() bool {
+	return bindings.readOnly
+}
+
 // Set sets a new binding for the name. It is an error if the name is
-// not defined.
+// not defined or the bindings are read-only.
 func (bindings *Bindings) Set(v Value, val *Value) error {
 	b, ok := bindings.Get(v.Name)
 	if !ok {
 		return fmt.Errorf("name %s not defined", v.Name)
 	}
+	if bindings.readOnly {
+		return fmt.Errorf("cannot assign to package variable %s", v.Name)
+	}
 	bindings.set(v, b.Type, val)
 	return nil
 }
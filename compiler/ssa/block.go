@@ -26,6 +26,7 @@ type Block struct {
 	Bindings   *Bindings
 	Dead       bool
 	Processed  bool
+	gen        *Generator
 }
 
 // BlockID defines unique block IDs.
@@ -74,9 +75,13 @@ func (b *Block) addFrom(o *Block) {
 	b.From = append(b.From, o)
 }
 
-// AddInstr adds an instruction to this basic block.
+// AddInstr adds an instruction to this basic block. The instruction
+// is attributed to the generator's current source location.
 func (b *Block) AddInstr(instr Instr) {
 	instr.Check()
+	if b.gen != nil {
+		instr.Loc = b.gen.loc
+	}
 	b.Instr = append(b.Instr, instr)
 }
 
@@ -218,6 +223,7 @@ func (b *Block) serialize(code []Step, seen map[BlockID]bool) []Step {
 	for _, instr := range b.Instr {
 		code = append(code, Step{
 			Label: label,
+			Block: b,
 			Instr: instr,
 		})
 		label = ""
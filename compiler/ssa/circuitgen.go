@@ -8,6 +8,7 @@ package ssa
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler/circuits"
@@ -19,17 +20,95 @@ import (
 func (prog *Program) CompileCircuit(params *utils.Params) (
 	*circuit.Circuit, error) {
 
+	cc, gates, err := prog.compileGates(params)
+	if err != nil {
+		return nil, err
+	}
+	circ := cc.Compile()
+	if params.OptRenumberWires {
+		circ = circ.Renumber()
+	}
+	if params.CostOut != nil {
+		PrintLineCosts(params.CostOut, prog.LineCosts(gates))
+	}
+	if params.CircOut != nil {
+		if params.Verbose {
+			fmt.Printf("Serializing circuit...\n")
+		}
+		err = circ.MarshalFormat(params.CircOut, params.CircFormat)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if params.CircDotOut != nil {
+		circ.Dot(params.CircDotOut)
+	}
+	if params.CircSvgOut != nil {
+		circ.Svg(params.CircSvgOut)
+	}
+	if params.SSACircSvgOut != nil {
+		err = prog.Svg(params.SSACircSvgOut, circ, gates)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return circ, nil
+}
+
+// CompileCircuitStream compiles the MPCL program into a boolean
+// circuit and writes the circuit to out in the MPCL circuit format as
+// the gates are compiled. The output is identical to the output of
+// CompileCircuit and Circuit.Marshal. The returned circuit has no
+// gates. Only the compiled gate slice is skipped: the gate graph of
+// the program is kept in memory until the function returns. The wire
+// renumbering needs the complete circuit so with
+// params.OptRenumberWires the circuit is compiled in memory before it
+// is written to out.
+func (prog *Program) CompileCircuitStream(params *utils.Params,
+	out io.Writer) (*circuit.Circuit, error) {
+
+	cc, gates, err := prog.compileGates(params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Verbose {
+		fmt.Printf("Serializing circuit...\n")
+	}
+	var circ *circuit.Circuit
+	if params.OptRenumberWires {
+		circ = cc.Compile().Renumber()
+		err = circ.Marshal(out)
+		circ.Gates = nil
+	} else {
+		circ, err = cc.CompileStream(out)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if params.CostOut != nil {
+		PrintLineCosts(params.CostOut, prog.LineCosts(gates))
+	}
+	return circ, nil
+}
+
+// compileGates creates and optimizes the circuit gates for the
+// program. The function returns the circuit compiler and the gates
+// before pruning.
+func (prog *Program) compileGates(params *utils.Params) (
+	*circuits.Compiler, []*circuits.Gate, error) {
+
 	calloc := circuits.NewAllocator()
 
 	cc, err := circuits.NewCompiler(params, calloc, prog.Inputs, prog.Outputs,
 		prog.InputWires, prog.OutputWires)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	err = prog.DefineConstants(cc.ZeroWire(), cc.OneWire())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if params.Verbose {
@@ -37,8 +116,9 @@ func (prog *Program) CompileCircuit(params *utils.Params) (
 	}
 	err = prog.Circuit(cc)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	gates := cc.Gates
 
 	if params.Verbose {
 		fmt.Printf("Compiling circuit...\n")
@@ -46,6 +126,10 @@ func (prog *Program) CompileCircuit(params *utils.Params) (
 	cc.ConstPropagate()
 	cc.ShortCircuitXORZero()
 	if params.OptPruneGates {
+		merged := cc.Dedup()
+		if params.Verbose && merged > 0 {
+			fmt.Printf(" - Merged %d duplicate gates\n", merged)
+		}
 		orig := float64(len(cc.Gates))
 		pruned := cc.Prune()
 		if params.Verbose {
@@ -53,31 +137,31 @@ func (prog *Program) CompileCircuit(params *utils.Params) (
 				float64(pruned)/orig*100)
 		}
 	}
-	circ := cc.Compile()
-	if params.CircOut != nil {
+	if params.OptRebalance {
+		replaced := cc.Rebalance()
 		if params.Verbose {
-			fmt.Printf("Serializing circuit...\n")
+			fmt.Printf(" - Rebalanced %d gate chains\n", replaced)
 		}
-		err = circ.MarshalFormat(params.CircOut, params.CircFormat)
-		if err != nil {
-			return nil, err
-		}
-	}
-	if params.CircDotOut != nil {
-		circ.Dot(params.CircDotOut)
-	}
-	if params.CircSvgOut != nil {
-		circ.Svg(params.CircSvgOut)
 	}
-
-	return circ, nil
+	return cc, gates, nil
 }
 
-// Circuit creates the boolean circuits for the program steps.
+// Circuit creates the boolean circuits for the program steps. If the
+// program context is set, the function returns a utils.CanceledError
+// when the context is canceled or its deadline expires.
 func (prog *Program) Circuit(cc *circuits.Compiler) error {
 
-	for _, step := range prog.Steps {
+	for idx, step := range prog.Steps {
 		instr := step.Instr
+		if prog.Context != nil {
+			if err := prog.Context.Err(); err != nil {
+				return &utils.CanceledError{
+					Loc: instr.Loc,
+					Err: err,
+				}
+			}
+		}
+		start := len(cc.Gates)
 		var wires [][]*circuits.Wire
 		for idx, in := range instr.In {
 			if !in.Type.Concrete() {
@@ -596,6 +680,15 @@ func (prog *Program) Circuit(cc *circuits.Compiler) error {
 		default:
 			return fmt.Errorf("Block.Circuit: %s not implemented yet", instr.Op)
 		}
+		if (cc.Params.CostOut != nil || cc.Params.SSACircSvgOut != nil) &&
+			len(cc.Gates) > start {
+			prog.spans = append(prog.spans, gateSpan{
+				step: idx,
+				loc:  instr.Loc,
+				from: start,
+				to:   len(cc.Gates),
+			})
+		}
 	}
 
 	return nil
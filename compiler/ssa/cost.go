@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/circuits"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+// gateSpan defines the circuit gates that a program step created.
+type gateSpan struct {
+	step int
+	loc  utils.Point
+	from int
+	to   int
+}
+
+// LineCost defines the MPC cost of a source line.
+type LineCost struct {
+	Source string
+	Line   int
+	AND    int
+}
+
+func (c LineCost) String() string {
+	if c.Line == 0 {
+		return "<unknown>"
+	}
+	return fmt.Sprintf("%s:%d", c.Source, c.Line)
+}
+
+// LineCosts computes the number of AND gates each source line
+// contributes to the compiled circuit. The OR gates are counted as
+// AND gates since they have the same garbling cost. The gates that
+// were removed by the circuit optimizations are not counted. The
+// gates without a source line, such as the constant wires, are
+// reported with the zero line number. The argument gates are the
+// circuit gates before pruning. The result is sorted by the
+// descending AND count.
+func (prog *Program) LineCosts(gates []*circuits.Gate) []LineCost {
+	counts := make(map[LineCost]int)
+	var attributed int
+	for _, span := range prog.spans {
+		count := countANDs(gates[span.from:span.to])
+		if count == 0 {
+			continue
+		}
+		key := LineCost{
+			Source: span.loc.Source,
+			Line:   span.loc.Line,
+		}
+		if key.Line == 0 {
+			key.Source = ""
+		}
+		counts[key] += count
+		attributed += count
+	}
+	if count := countANDs(gates) - attributed; count > 0 {
+		counts[LineCost{}] += count
+	}
+
+	var result []LineCost
+	for key, count := range counts {
+		key.AND = count
+		result = append(result, key)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.AND != b.AND {
+			return a.AND > b.AND
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Line < b.Line
+	})
+	return result
+}
+
+func countANDs(gates []*circuits.Gate) int {
+	var count int
+	for _, g := range gates {
+		if g.Compiled && (g.Op == circuit.AND || g.Op == circuit.OR) {
+			count++
+		}
+	}
+	return count
+}
+
+// PrintLineCosts prints the line costs to the writer w.
+func PrintLineCosts(w io.Writer, costs []LineCost) {
+	for _, c := range costs {
+		fmt.Fprintf(w, "%s\t%d\n", c, c.AND)
+	}
+}
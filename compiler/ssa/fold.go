@@ -0,0 +1,301 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa
+
+import (
+	"math/big"
+
+	"github.com/markkurossi/mpc/compiler/mpa"
+	"github.com/markkurossi/mpc/types"
+)
+
+// Fold evaluates the instructions whose inputs are constants and
+// replaces the uses of their outputs with the constant results. The
+// instructions whose outputs are not used are removed from the
+// program. The folding and the dead code elimination are repeated
+// until the program does not change. The generator gen creates the
+// constant values.
+func (prog *Program) Fold(gen *Generator) {
+	for {
+		folded := prog.fold(gen)
+		removed := prog.deadCode()
+		if !folded && !removed {
+			return
+		}
+	}
+}
+
+// fold folds the constant instructions and propagates their results
+// to the instructions that use them. The function returns true if any
+// instruction input was replaced with a constant.
+func (prog *Program) fold(gen *Generator) bool {
+	consts := make(map[ValueID]Value)
+	var changed bool
+
+	for i := 0; i < len(prog.Steps); i++ {
+		instr := &prog.Steps[i].Instr
+		var cloned bool
+		for idx, in := range instr.In {
+			if in.Const {
+				continue
+			}
+			c, ok := consts[in.ID]
+			if !ok {
+				continue
+			}
+			if !cloned {
+				// The steps share their inputs with the basic
+				// blocks that can be cached between compilations.
+				instr.In = append([]Value(nil), instr.In...)
+				cloned = true
+			}
+			instr.In[idx] = c
+			gen.AddConstant(c)
+			changed = true
+		}
+		if instr.Out == nil || instr.Out.Const {
+			continue
+		}
+		c, ok := instr.eval(gen)
+		if ok {
+			consts[instr.Out.ID] = c
+		}
+	}
+	return changed
+}
+
+// deadCode removes the instructions whose outputs are not used. The
+// function returns true if any instructions were removed.
+func (prog *Program) deadCode() bool {
+	used := make(map[ValueID]bool)
+	keep := make([]bool, len(prog.Steps))
+	var removed bool
+
+	for i := len(prog.Steps) - 1; i >= 0; i-- {
+		instr := prog.Steps[i].Instr
+		if instr.Out != nil && !used[instr.Out.ID] {
+			removed = true
+			continue
+		}
+		keep[i] = true
+		for _, in := range instr.In {
+			if !in.Const {
+				used[in.ID] = true
+			}
+		}
+	}
+	if !removed {
+		return false
+	}
+
+	steps := make([]Step, 0, len(prog.Steps))
+	var label string
+	var block *Block
+	for i, step := range prog.Steps {
+		if !keep[i] {
+			// Keep the block label for the block's next
+			// instruction.
+			if len(step.Label) > 0 {
+				label = step.Label
+				block = step.Block
+			}
+			continue
+		}
+		if len(step.Label) == 0 && len(label) > 0 && step.Block == block {
+			step.Label = label
+		}
+		label = ""
+		steps = append(steps, step)
+	}
+	prog.Steps = steps
+
+	return true
+}
+
+// eval evaluates the instruction if its inputs are constants. The
+// function returns the constant value of the instruction output and
+// true if the instruction was evaluated.
+func (instr Instr) eval(gen *Generator) (Value, bool) {
+	if instr.Op == Phi {
+		if !instr.In[0].Const {
+			return Undefined, false
+		}
+		in := instr.In[2]
+		if instr.In[0].Bit(0) {
+			in = instr.In[1]
+		}
+		return constResult(gen, instr.Out.Type, in)
+	}
+
+	var args []*big.Int
+	for _, in := range instr.In {
+		if !in.Const || !foldableType(in.Type) {
+			return Undefined, false
+		}
+		args = append(args, constBits(in))
+	}
+	r := new(big.Int)
+
+	switch instr.Op {
+	case Iadd, Uadd:
+		r.Add(args[0], args[1])
+
+	case Isub, Usub:
+		r.Sub(args[0], args[1])
+
+	case Imult, Umult:
+		r.Mul(args[0], args[1])
+
+	case Band, And:
+		r.And(args[0], args[1])
+
+	case Bor, Or:
+		r.Or(args[0], args[1])
+
+	case Bxor:
+		r.Xor(args[0], args[1])
+
+	case Bclr:
+		r.AndNot(args[0], args[1])
+
+	case Not:
+		r.Xor(args[0], big.NewInt(1))
+
+	case Lshift:
+		r.Lsh(args[0], uint(args[1].Uint64()))
+
+	case Rshift:
+		r.Rsh(args[0], uint(args[1].Uint64()))
+
+	case Srshift:
+		r.Set(args[0])
+		bits := int(instr.In[0].Type.Bits)
+		if bits > 0 && r.Bit(bits-1) == 1 {
+			r.Sub(r, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+		}
+		r.Rsh(r, uint(args[1].Uint64()))
+
+	case Slice:
+		r.Rsh(args[0], uint(args[1].Uint64()))
+		r.And(r, mask(int(args[2].Int64()-args[1].Int64())))
+
+	case Ult:
+		r.SetInt64(boolInt(args[0].Cmp(args[1]) < 0))
+
+	case Ule:
+		r.SetInt64(boolInt(args[0].Cmp(args[1]) <= 0))
+
+	case Ugt:
+		r.SetInt64(boolInt(args[0].Cmp(args[1]) > 0))
+
+	case Uge:
+		r.SetInt64(boolInt(args[0].Cmp(args[1]) >= 0))
+
+	case Eq:
+		r.SetInt64(boolInt(args[0].Cmp(args[1]) == 0))
+
+	case Neq:
+		r.SetInt64(boolInt(args[0].Cmp(args[1]) != 0))
+
+	case Mov:
+		r.Set(args[0])
+
+	case Amov:
+		// amov v arr from to o: o = arr with arr[from:to] = v
+		from := uint(args[2].Uint64())
+		to := uint(args[3].Uint64())
+		r.AndNot(args[1], new(big.Int).Lsh(mask(int(to-from)), from))
+		v := new(big.Int).And(args[0], mask(int(to-from)))
+		r.Or(r, v.Lsh(v, from))
+
+	default:
+		return Undefined, false
+	}
+
+	return constValue(gen, instr.Out.Type, r)
+}
+
+// foldableType tests if the values of type t can be folded. The
+// booleans, integers, and their arrays can be folded.
+func foldableType(t types.Info) bool {
+	switch t.Type {
+	case types.TBool, types.TInt, types.TUint:
+		return t.Bits > 0
+	case types.TArray:
+		return t.ElementType != nil && t.ArraySize > 0 &&
+			t.ElementType.Type != types.TArray &&
+			foldableType(*t.ElementType)
+	default:
+		return false
+	}
+}
+
+// constBits returns the bits of the constant value v as an unsigned
+// integer.
+func constBits(v Value) *big.Int {
+	r := new(big.Int)
+	for bit := types.Size(0); bit < v.Type.Bits; bit++ {
+		if v.Bit(bit) {
+			r.SetBit(r, int(bit), 1)
+		}
+	}
+	return r
+}
+
+// constResult returns the constant value in as a constant of type t.
+func constResult(gen *Generator, t types.Info, in Value) (Value, bool) {
+	if !in.Const || !foldableType(in.Type) {
+		return Undefined, false
+	}
+	return constValue(gen, t, constBits(in))
+}
+
+// constValue creates a constant of type t from the bits of the value
+// v. The value is truncated to the size of the type.
+func constValue(gen *Generator, t types.Info, v *big.Int) (Value, bool) {
+	if !foldableType(t) {
+		return Undefined, false
+	}
+	v.And(v, mask(int(t.Bits)))
+
+	switch t.Type {
+	case types.TBool:
+		return gen.Constant(v.Sign() != 0, types.Bool), true
+
+	case types.TArray:
+		elType := *t.ElementType
+		var arr []interface{}
+		for i := types.Size(0); i < t.ArraySize; i++ {
+			el := new(big.Int).Rsh(v, uint(i*elType.Bits))
+			c, ok := constValue(gen, elType, el)
+			if !ok {
+				return Undefined, false
+			}
+			arr = append(arr, c.ConstValue)
+		}
+		return gen.Constant(arr, t), true
+
+	default:
+		val, ok := mpa.Parse(v.Text(16), 16)
+		if !ok {
+			return Undefined, false
+		}
+		return gen.Constant(val, t), true
+	}
+}
+
+func mask(bits int) *big.Int {
+	m := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	return m.Sub(m, big.NewInt(1))
+}
+
+func boolInt(v bool) int64 {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -26,6 +26,7 @@ type Generator struct {
 	blockID   BlockID
 	constants map[string]ConstantInst
 	nextValID ValueID
+	loc       utils.Point
 }
 
 // ConstantInst defines a constant value instance.
@@ -86,6 +87,8 @@ func (gen *Generator) AnonVal(t types.Info) Value {
 	} else {
 		v.Version = v.Version + 1
 	}
+	// Values have always a type, only constants can be untyped.
+	t.Untyped = false
 	v.Type = t
 	v.ID = gen.nextValueID()
 	gen.versions[anon] = v
@@ -93,9 +96,36 @@ func (gen *Generator) AnonVal(t types.Info) Value {
 	return v
 }
 
+// Source describes the source code expression of a value.
+type Source interface {
+	utils.Locator
+	String() string
+}
+
+// debugNameReplacer removes whitespace and quotes from the debug
+// names so that they can be used in the SSA and DOT outputs.
+var debugNameReplacer = strings.NewReplacer(" ", "", "\t", "", "\n", "",
+	"\"", "'")
+
+// AnonValFor creates a new anonymous value for the source expression
+// src. If the Params.DebugNames is set, the value is named after the
+// expression and its location, for example a+b@12:3. The names are
+// only used in diagnostic output and they do not affect the
+// generated circuit.
+func (gen *Generator) AnonValFor(t types.Info, src Source) Value {
+	v := gen.AnonVal(t)
+	if gen.Params != nil && gen.Params.DebugNames {
+		loc := src.Location()
+		v.Name = fmt.Sprintf("%s@%d:%d", debugNameReplacer.Replace(src.String()),
+			loc.Line, loc.Col)
+	}
+	return v
+}
+
 // NewVal creates a new value with the name, type, and scope.
 func (gen *Generator) NewVal(name string, t types.Info, scope Scope) Value {
 
+	t.Untyped = false
 	key := fmtKey(name, scope)
 	v, ok := gen.versions[key]
 	if !ok {
@@ -150,11 +180,21 @@ func fmtKey(name string, scope Scope) string {
 	return fmt.Sprintf("%s@%d", name, scope)
 }
 
+// SetLocation sets the source location of the instructions that are
+// added to the generator's basic blocks. The function returns the
+// previous location.
+func (gen *Generator) SetLocation(loc utils.Point) utils.Point {
+	prev := gen.loc
+	gen.loc = loc
+	return prev
+}
+
 // Block creates a new basic block.
 func (gen *Generator) Block() *Block {
 	block := &Block{
 		ID:       gen.blockID,
 		Bindings: new(Bindings),
+		gen:      gen,
 	}
 	gen.blockID++
 
@@ -195,7 +235,8 @@ func (gen *Generator) Constant(value interface{}, ti types.Info) Value {
 		v.Name = fmt.Sprintf("$%d", val)
 		if v.Type.Undefined() {
 			v.Type = types.Info{
-				Type: types.TInt,
+				Type:    types.TInt,
+				Untyped: true,
 			}
 		}
 		for minBits = 1; minBits < 64; minBits++ {
@@ -203,7 +244,9 @@ func (gen *Generator) Constant(value interface{}, ti types.Info) Value {
 				break
 			}
 		}
-		if minBits > 32 {
+		if typedInteger(v.Type, minBits) {
+			bits = v.Type.Bits
+		} else if minBits > 32 {
 			bits = 64
 		} else {
 			bits = 32
@@ -218,11 +261,14 @@ func (gen *Generator) Constant(value interface{}, ti types.Info) Value {
 		v.Name = fmt.Sprintf("$%s", val.String())
 		if v.Type.Undefined() {
 			v.Type = types.Info{
-				Type: types.TInt,
+				Type:    types.TInt,
+				Untyped: true,
 			}
 		}
 		minBits = types.Size(val.BitLen())
-		if minBits > 64 {
+		if typedInteger(v.Type, minBits) {
+			bits = v.Type.Bits
+		} else if minBits > 64 {
 			bits = minBits
 		} else if minBits > 32 {
 			bits = 64
@@ -277,7 +323,12 @@ func (gen *Generator) Constant(value interface{}, ti types.Info) Value {
 			name = "interface{}"
 		}
 		if !ti.Undefined() && ti.Type == types.TStruct {
-			v.Name = "$" + ti.String()
+			// The struct fields have their own types.
+			bits = 0
+			for _, field := range ti.Struct {
+				bits += field.Type.Bits
+			}
+			v.Name = "$" + ti.String() + arrayString(val)
 			ti.Bits = bits
 			ti.MinBits = bits
 			v.Type = ti
@@ -323,6 +374,16 @@ func (gen *Generator) Constant(value interface{}, ti types.Info) Value {
 	return v
 }
 
+// typedInteger tests if the type info specifies a concrete integer
+// type that can hold minBits bits. Constants of such types keep their
+// declared width instead of the default width of untyped constants.
+func typedInteger(ti types.Info, minBits types.Size) bool {
+	if ti.Untyped || !ti.Concrete() || ti.Bits < minBits {
+		return false
+	}
+	return ti.Type == types.TInt || ti.Type == types.TUint
+}
+
 func arrayString(arr []interface{}) string {
 	var parts []string
 
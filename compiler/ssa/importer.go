@@ -0,0 +1,128 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa
+
+// valueKey identifies a value in the same way as Value.Equal.
+type valueKey struct {
+	Name    string
+	Scope   Scope
+	Version int32
+}
+
+func keyOf(v Value) valueKey {
+	return valueKey{
+		Name:    v.Name,
+		Scope:   v.Scope,
+		Version: v.Version,
+	}
+}
+
+// Importer copies instructions from another compilation into a
+// generator. The values defined by the instructions are renamed to
+// fresh values of the generator and the constants are registered to
+// the generator. The input values of the instructions must be mapped
+// with Map before importing the instructions.
+type Importer struct {
+	gen    *Generator
+	values map[valueKey]Value
+}
+
+// NewImporter creates a new importer for the generator.
+func (gen *Generator) NewImporter() *Importer {
+	return &Importer{
+		gen:    gen,
+		values: make(map[valueKey]Value),
+	}
+}
+
+// Map maps the value from to the value to.
+func (imp *Importer) Map(from, to Value) {
+	imp.values[keyOf(from)] = to
+}
+
+// Value returns the value of this compilation for the argument value
+// v. Unknown values are renamed to fresh values.
+func (imp *Importer) Value(v Value) Value {
+	if v.Const {
+		v.ID = imp.gen.nextValueID()
+		imp.gen.AddConstant(v)
+		return v
+	}
+	key := keyOf(v)
+	r, ok := imp.values[key]
+	if ok {
+		return r
+	}
+	var fresh Value
+	if v.Name == anon {
+		fresh = imp.gen.AnonVal(v.Type)
+	} else {
+		fresh = imp.gen.NewVal(v.Name, v.Type, v.Scope)
+	}
+	r = v
+	r.Scope = fresh.Scope
+	r.Version = fresh.Version
+	r.ID = fresh.ID
+	imp.values[key] = r
+
+	return r
+}
+
+// Instrs imports the argument instructions.
+func (imp *Importer) Instrs(instrs []Instr) []Instr {
+	result := make([]Instr, 0, len(instrs))
+	for _, instr := range instrs {
+		n := instr
+		n.Label = nil
+		if instr.In != nil {
+			n.In = make([]Value, len(instr.In))
+			for i, in := range instr.In {
+				n.In[i] = imp.Value(in)
+			}
+		}
+		if instr.Out != nil {
+			out := imp.Value(*instr.Out)
+			n.Out = &out
+		}
+		if instr.GC != nil {
+			gc := imp.Value(*instr.GC)
+			n.GC = &gc
+		}
+		if instr.Ret != nil {
+			n.Ret = make([]Value, len(instr.Ret))
+			for i, ret := range instr.Ret {
+				n.Ret[i] = imp.Value(ret)
+			}
+		}
+		result = append(result, n)
+	}
+	return result
+}
+
+// Inputs returns the non-constant values that the instructions read
+// but do not define.
+func Inputs(instrs []Instr) []Value {
+	defined := make(map[valueKey]bool)
+	for _, instr := range instrs {
+		if instr.Out != nil {
+			defined[keyOf(*instr.Out)] = true
+		}
+	}
+	var result []Value
+	seen := make(map[valueKey]bool)
+	for _, instr := range instrs {
+		for _, in := range instr.In {
+			key := keyOf(in)
+			if in.Const || defined[key] || seen[key] {
+				continue
+			}
+			seen[key] = true
+			result = append(result, in)
+		}
+	}
+	return result
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler/circuits"
+	"github.com/markkurossi/mpc/compiler/utils"
 	"github.com/markkurossi/mpc/types"
 )
 
@@ -157,6 +158,10 @@ type Instr struct {
 	Builtin circuits.Builtin
 	GC      *Value
 	Ret     []Value
+
+	// Loc is the source location of the statement that generated
+	// the instruction.
+	Loc utils.Point
 }
 
 // Check verifies that the instruction values are properly set. If any
@@ -85,13 +85,16 @@ func (rule Rule) Match(steps []Step) []Step {
 			return nil
 		}
 
-		// Base liveness from the first replaced instruction.
+		// Base liveness and location from the first replaced
+		// instruction.
+		instr.Loc = steps[0].Instr.Loc
 		live := steps[0].Live.Copy()
 		if instr.Out != nil {
 			live.Add(*instr.Out)
 		}
 
 		result = append(result, Step{
+			Block: steps[0].Block,
 			Instr: instr,
 			Live:  live,
 		})
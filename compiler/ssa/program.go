@@ -7,6 +7,7 @@
 package ssa
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"math/big"
@@ -29,11 +30,13 @@ type Program struct {
 	OutputWires []*circuits.Wire
 	Constants   map[string]ConstantInst
 	Steps       []Step
+	Context     context.Context
 	walloc      *WireAllocator
 	calloc      *circuits.Allocator
 	zeroWire    *circuits.Wire
 	oneWire     *circuits.Wire
 	stats       circuit.Stats
+	spans       []gateSpan
 	numWires    int
 	tInit       time.Duration
 	tGarble     time.Duration
@@ -78,6 +81,7 @@ func NewProgram(params *utils.Params, in, out circuit.IO,
 // Step defines one SSA program step.
 type Step struct {
 	Label string
+	Block *Block
 	Instr Instr
 	Live  Set
 }
@@ -9,6 +9,7 @@ package ssa
 import (
 	"crypto/rand"
 	"fmt"
+	"io"
 	"math/big"
 	"os"
 	"sort"
@@ -28,8 +29,15 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 	params *utils.Params, inputs *big.Int, timing *circuit.Timing) (
 	circuit.IO, []*big.Int, error) {
 
+	if err := prog.Inputs.CheckTwoParty(); err != nil {
+		return nil, nil, err
+	}
+	rnd := params.Rand
+	if rnd == nil {
+		rnd = rand.Reader
+	}
 	var key [32]byte
-	_, err := rand.Read(key[:])
+	_, err := io.ReadFull(rnd, key[:])
 	if err != nil {
 		return nil, nil, err
 	}
@@ -40,6 +48,13 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 	if err := conn.SendData(key[:]); err != nil {
 		return nil, nil, err
 	}
+	var options int
+	if params.CompressGates {
+		options |= circuit.StreamCompress
+	}
+	if err := conn.SendUint32(options); err != nil {
+		return nil, nil, err
+	}
 	// Our input.
 	if err := sendArgument(conn, prog.Inputs[0]); err != nil {
 		return nil, nil, err
@@ -71,10 +86,11 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 		ids = append(ids, w.ID())
 	}
 
-	streaming, err := circuit.NewStreaming(key[:], ids, conn)
+	streaming, err := circuit.NewStreamingWithRand(key[:], ids, conn, rnd)
 	if err != nil {
 		return nil, nil, err
 	}
+	streaming.Compress = params.CompressGates
 
 	// Select our inputs.
 	var n1 []ot.Label
@@ -491,10 +507,16 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 					return nil, nil, err
 				}
 				cc.ConstPropagate()
+				if params.OptPruneGates {
+					cc.Dedup()
+				}
 				pruned := cc.Prune()
 				if params.Verbose && circuit.StreamDebug {
 					fmt.Printf("%05d: - pruned %d gates\n", idx, pruned)
 				}
+				if params.OptRebalance {
+					cc.Rebalance()
+				}
 				circ = cc.Compile()
 				if cacheable {
 					cache[instr.StringTyped()] = circ
@@ -592,6 +614,10 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 	xfer = conn.Stats.Sum() - ioStats
 	timing.Sample("Result", []string{circuit.FileSize(xfer).String()})
 
+	if params.Profile != nil {
+		*params.Profile = *circuit.NewProfile(circuit.RoleGarbler, timing,
+			prog.stats, int(prog.Inputs[1].Type.Bits), conn.Stats)
+	}
 	if params.Verbose {
 		timing.Print(conn.Stats)
 	}
@@ -0,0 +1,288 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa
+
+import (
+	"fmt"
+	"html"
+	"io"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/circuits"
+)
+
+// SvgMaxGates specifies the maximum number of circuit gates for the
+// SSA and circuit SVG output.
+const SvgMaxGates = 2000
+
+const (
+	svgCharWidth  = 6
+	svgLineHeight = 12
+	svgPad        = 8
+	svgEdgeMargin = 64
+	svgLinkWidth  = 96
+)
+
+type svgBlock struct {
+	block *Block
+	steps []int
+	y     int
+	w     int
+	h     int
+}
+
+type svgGadget struct {
+	span  gateSpan
+	gates []*circuits.Gate
+	y     int
+	h     int
+}
+
+// Svg creates an SVG image of the program's SSA basic blocks and the
+// circuit gates that the SSA instructions generated. The basic blocks
+// are shown in the program order with their control flow edges and
+// each instruction is linked to its gadget, that is, the optimized
+// circuit gates that were created from the instruction. The gadgets
+// are labeled with the source locations of their instructions. The
+// argument gates are the circuit gates before pruning. The function
+// returns an error if the circuit has more than SvgMaxGates gates.
+func (prog *Program) Svg(out io.Writer, circ *circuit.Circuit,
+	gates []*circuits.Gate) error {
+
+	if circ.NumGates > SvgMaxGates {
+		return fmt.Errorf("circuit has %d gates, SSA SVG supports %d",
+			circ.NumGates, SvgMaxGates)
+	}
+
+	// Collect basic blocks and their instructions in the program
+	// order.
+	var blocks []*svgBlock
+	byBlock := make(map[*Block]*svgBlock)
+	var maxOp int
+	for idx, step := range prog.Steps {
+		if step.Instr.Op == GC || step.Block == nil {
+			continue
+		}
+		b, ok := byBlock[step.Block]
+		if !ok {
+			b = &svgBlock{
+				block: step.Block,
+			}
+			byBlock[step.Block] = b
+			blocks = append(blocks, b)
+		}
+		b.steps = append(b.steps, idx)
+		if l := len(step.Instr.Op.String()); l > maxOp {
+			maxOp = l
+		}
+	}
+
+	instrLine := func(idx int) string {
+		instr := prog.Steps[idx].Instr
+		line := instr.string(maxOp, false)
+		if instr.Loc.Line > 0 {
+			line += "  @" + instr.Loc.ShortString()
+		}
+		return line
+	}
+
+	// Collect gadgets from the gate spans. The gates that the
+	// optimizations removed are not shown.
+	gadgets := make(map[int]*svgGadget)
+	for _, span := range prog.spans {
+		g := &svgGadget{
+			span: span,
+		}
+		for _, gate := range gates[span.from:span.to] {
+			if gate.Compiled {
+				g.gates = append(g.gates, gate)
+			}
+		}
+		if len(g.gates) > 0 {
+			gadgets[span.step] = g
+		}
+	}
+
+	// Layout blocks.
+	var blockWidth int
+	y := svgPad
+	instrY := make(map[int]int)
+	for _, b := range blocks {
+		b.y = y
+		b.h = (len(b.steps)+1)*svgLineHeight + svgPad
+		for i, idx := range b.steps {
+			instrY[idx] = b.y + (i+2)*svgLineHeight
+			if l := len(instrLine(idx)); l > b.w {
+				b.w = l
+			}
+		}
+		b.w = b.w*svgCharWidth + 2*svgPad
+		if b.w > blockWidth {
+			blockWidth = b.w
+		}
+		y += b.h + svgPad*2
+	}
+	height := y
+
+	// Layout gadgets next to their instructions.
+	gadgetX := svgEdgeMargin + blockWidth + svgLinkWidth
+	var gadgetWidth int
+	var order []*svgGadget
+	y = svgPad
+	for _, b := range blocks {
+		for _, idx := range b.steps {
+			g, ok := gadgets[idx]
+			if !ok {
+				continue
+			}
+			g.y = max(y, instrY[idx]-svgLineHeight)
+			g.h = (len(g.gates)+1)*svgLineHeight + svgPad
+			y = g.y + g.h + svgPad
+			for _, gate := range g.gates {
+				if l := len(svgGate(gate)); l > gadgetWidth {
+					gadgetWidth = l
+				}
+			}
+			if l := len(svgGadgetTitle(prog.Steps[idx].Instr)); l > gadgetWidth {
+				gadgetWidth = l
+			}
+			order = append(order, g)
+		}
+	}
+	gadgetWidth = gadgetWidth*svgCharWidth + 2*svgPad
+	if y > height {
+		height = y
+	}
+
+	fmt.Fprintf(out,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">
+  <style><![CDATA[
+  text {
+    font: 10px Courier, monospace;
+  }
+  ]]></style>
+`,
+		gadgetX+gadgetWidth+svgPad, height)
+
+	// Basic blocks.
+	fmt.Fprintln(out, `  <g fill="none" stroke="#000" stroke-width=".5">`)
+	for _, b := range blocks {
+		fmt.Fprintf(out, `    <rect x="%d" y="%d" width="%d" height="%d" />
+`,
+			svgEdgeMargin, b.y, b.w, b.h)
+	}
+	for _, g := range order {
+		fmt.Fprintf(out, `    <rect x="%d" y="%d" width="%d" height="%d" />
+`,
+			gadgetX, g.y, gadgetWidth, g.h)
+	}
+
+	// Control flow edges.
+	for _, b := range blocks {
+		for _, edge := range []struct {
+			to   *Block
+			dash string
+		}{
+			{b.block.Next, ""},
+			{b.block.Branch, ` stroke-dasharray="4 2"`},
+		} {
+			to := svgTarget(byBlock, edge.to)
+			if to == nil {
+				continue
+			}
+			from := b.y + b.h/2
+			dst := to.y + svgLineHeight/2 + svgPad/2
+			dx := svgEdgeMargin - 8 - min(abs(dst-from)/8, svgEdgeMargin-16)
+			fmt.Fprintf(out,
+				`    <path d="M %d %d C %d %d %d %d %d %d"%s marker-end="url(#arrow)" />
+`,
+				svgEdgeMargin, from, dx, from, dx, dst, svgEdgeMargin, dst,
+				edge.dash)
+		}
+	}
+
+	// Links from instructions to their gadgets.
+	for _, g := range order {
+		from := instrY[g.span.step] - svgLineHeight/3
+		to := g.y + svgLineHeight/2 + svgPad/2
+		x0 := svgEdgeMargin + byBlock[prog.Steps[g.span.step].Block].w
+		mid := (x0 + gadgetX) / 2
+		fmt.Fprintf(out, `    <path d="M %d %d C %d %d %d %d %d %d" stroke="#00c" />
+`,
+			x0, from, mid, from, mid, to, gadgetX, to)
+	}
+	fmt.Fprintln(out, `  </g>`)
+
+	fmt.Fprintln(out, `  <defs>
+    <marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5"
+            markerWidth="6" markerHeight="6" orient="auto">
+      <path d="M 0 0 L 10 5 L 0 10 z" />
+    </marker>
+  </defs>`)
+
+	// Labels.
+	fmt.Fprintln(out, `  <g fill="#000">`)
+	for _, b := range blocks {
+		svgText(out, svgEdgeMargin+svgPad, b.y+svgLineHeight, b.block.String())
+		for _, idx := range b.steps {
+			svgText(out, svgEdgeMargin+svgPad, instrY[idx], instrLine(idx))
+		}
+	}
+	for _, g := range order {
+		svgText(out, gadgetX+svgPad, g.y+svgLineHeight,
+			svgGadgetTitle(prog.Steps[g.span.step].Instr))
+		for i, gate := range g.gates {
+			svgText(out, gadgetX+svgPad, g.y+(i+2)*svgLineHeight,
+				svgGate(gate))
+		}
+	}
+	fmt.Fprintln(out, "  </g>\n</svg>")
+
+	return nil
+}
+
+// svgTarget returns the first rendered basic block that is reached
+// from the block b. The empty blocks are not rendered and their edges
+// are followed to their next blocks.
+func svgTarget(blocks map[*Block]*svgBlock, b *Block) *svgBlock {
+	seen := make(map[*Block]bool)
+	for b != nil && !seen[b] {
+		if result, ok := blocks[b]; ok {
+			return result
+		}
+		seen[b] = true
+		b = b.Next
+	}
+	return nil
+}
+
+func svgGadgetTitle(instr Instr) string {
+	if instr.Loc.Line == 0 {
+		return instr.Op.String()
+	}
+	return fmt.Sprintf("%s: %s", instr.Loc.ShortString(), instr.Op)
+}
+
+func svgGate(g *circuits.Gate) string {
+	if g.Op == circuit.INV {
+		return fmt.Sprintf("%s w%d -> w%d", g.Op, g.A.ID(), g.O.ID())
+	}
+	return fmt.Sprintf("%s w%d w%d -> w%d", g.Op, g.A.ID(), g.B.ID(), g.O.ID())
+}
+
+func svgText(out io.Writer, x, y int, text string) {
+	fmt.Fprintf(out, `    <text x="%d" y="%d" xml:space="preserve">%s</text>
+`,
+		x, y, html.EscapeString(text))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
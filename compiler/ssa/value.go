@@ -365,6 +365,15 @@ func LValueFor(l types.Info, o Value) bool {
 func (v Value) TypeCompatible(o Value) *types.Info {
 	if v.Const && o.Const {
 		if v.Type.Type == o.Type.Type {
+			if v.Type.Untyped && !o.Type.Untyped {
+				return &o.Type
+			}
+			return &v.Type
+		}
+		if v.Type.Untyped && o.Type.CanAssignConst(v.Type) {
+			return &o.Type
+		}
+		if o.Type.Untyped && v.Type.CanAssignConst(o.Type) {
 			return &v.Type
 		}
 	} else if v.Const {
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -7,9 +7,11 @@
 package compiler
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/markkurossi/mpc/compiler/utils"
@@ -263,6 +265,21 @@ import (
 func main(data, a uint512) uint256 {
     return sha256.Block(data, sha256.init)
 }
+`,
+	},
+	{
+		Enabled: true,
+		Name:    "Aliased import",
+		Code: `
+package main
+
+import (
+    sha "crypto/sha256"
+)
+
+func main(data, a uint512) uint256 {
+    return sha.Block(data, sha.init)
+}
 `,
 	},
 }
@@ -292,3 +309,49 @@ func TestSSAGen(t *testing.T) {
 		}
 	}
 }
+
+type ssaBuffer struct {
+	bytes.Buffer
+}
+
+func (b *ssaBuffer) Close() error {
+	return nil
+}
+
+func TestDebugNames(t *testing.T) {
+	code := `
+package main
+func main(a, b int32) int32 {
+    c := a + b
+    return c * a
+}
+`
+	var ssaOut [2]*ssaBuffer
+	var circOut [2]bytes.Buffer
+
+	for i, debugNames := range []bool{false, true} {
+		ssaOut[i] = new(ssaBuffer)
+
+		params := utils.NewParams()
+		params.DebugNames = debugNames
+		params.SSAOut = ssaOut[i]
+
+		circ, _, err := New(params).Compile(code, nil)
+		if err != nil {
+			t.Fatalf("compile failed: %s", err)
+		}
+		err = circ.Marshal(&circOut[i])
+		if err != nil {
+			t.Fatalf("marshal failed: %s", err)
+		}
+	}
+	if strings.Contains(ssaOut[0].String(), "a+b@") {
+		t.Errorf("debug names without Params.DebugNames")
+	}
+	if !strings.Contains(ssaOut[1].String(), "a+b@4:") {
+		t.Errorf("debug names missing from SSA:\n%s", ssaOut[1].String())
+	}
+	if !bytes.Equal(circOut[0].Bytes(), circOut[1].Bytes()) {
+		t.Errorf("debug names changed the circuit")
+	}
+}
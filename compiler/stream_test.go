@@ -0,0 +1,92 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/utils"
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+const streamSHA256Result = "1fd35a2a9e6f530dd6e5e87075c4d98ebb2960e2b65085cddeae2f65853a3af"
+
+// streamSHA256 streams the SHA-256 test program between a garbler
+// and an evaluator and returns the number of bytes the garbler sent.
+func streamSHA256(t *testing.T, compress bool) uint64 {
+	input := []string{"0"}
+	sizes, err := circuit.InputSizes(input)
+	if err != nil {
+		t.Fatalf("InputSizes: %v", err)
+	}
+
+	gc, ec := net.Pipe()
+
+	type evalResult struct {
+		result string
+		err    error
+	}
+	done := make(chan evalResult)
+
+	go func() {
+		conn := p2p.NewConn(ec)
+		defer conn.Close()
+		_, result, err := circuit.StreamEvaluator(conn, ot.NewCO(), input,
+			false)
+		if err != nil {
+			done <- evalResult{err: err}
+			return
+		}
+		done <- evalResult{result: fmt.Sprintf("%x", result[0])}
+	}()
+
+	params := utils.NewParams()
+	params.CompressGates = compress
+
+	conn := p2p.NewConn(gc)
+	_, result, err := New(params).StreamFile(conn, ot.NewCO(),
+		"tests/crypto/sha256_block.mpcl", input, [][]int{sizes, sizes})
+	if err != nil {
+		t.Fatalf("StreamFile: %v", err)
+	}
+	sent := conn.Stats.Sent.Load()
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	eval := <-done
+	if eval.err != nil {
+		t.Fatalf("StreamEvaluator: %v", eval.err)
+	}
+	garbler := fmt.Sprintf("%x", result[0])
+	if garbler != streamSHA256Result {
+		t.Errorf("garbler: got %s, expected %s", garbler, streamSHA256Result)
+	}
+	if eval.result != streamSHA256Result {
+		t.Errorf("evaluator: got %s, expected %s",
+			eval.result, streamSHA256Result)
+	}
+	return sent
+}
+
+func TestStreamCompress(t *testing.T) {
+	raw := streamSHA256(t, false)
+	compressed := streamSHA256(t, true)
+
+	t.Logf("SHA-256: uncompressed=%d, compressed=%d (%.2f%%)",
+		raw, compressed, float64(compressed)*100/float64(raw))
+
+	// The wire indices of the gates compress well even if the
+	// garbled tables do not.
+	if compressed >= raw {
+		t.Errorf("compression did not help: %d >= %d", compressed, raw)
+	}
+}
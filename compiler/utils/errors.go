@@ -0,0 +1,32 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package utils
+
+import (
+	"fmt"
+)
+
+// CanceledError is returned when the compilation is aborted because
+// its context was canceled or its deadline expired. The error wraps
+// the context error so it can be tested with errors.Is against
+// context.Canceled and context.DeadlineExceeded.
+type CanceledError struct {
+	// Loc is the source location the compilation was processing
+	// when it was aborted.
+	Loc Point
+	// Err is the context error.
+	Err error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("compilation canceled: %s", e.Err)
+}
+
+// Unwrap returns the context error.
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
@@ -8,6 +8,8 @@ package utils
 
 import (
 	"io"
+
+	"github.com/markkurossi/mpc/circuit"
 )
 
 // Params specify compiler parameters.
@@ -18,6 +20,21 @@ type Params struct {
 	SSADotOut     io.WriteCloser
 	MPCLCErrorLoc bool
 
+	// DebugNames names the anonymous SSA values after their source
+	// expressions. The names are visible only in the diagnostic
+	// outputs.
+	DebugNames bool
+
+	// FuncCache enables caching of the SSA code of function
+	// instances between the compilations of a compiler. The
+	// unchanged functions are not lowered again when the program is
+	// recompiled.
+	FuncCache bool
+
+	// LogOut specifies the output for compiler errors and
+	// warnings. If unset, the messages are written to os.Stdout.
+	LogOut io.Writer
+
 	// PkgPath defines additional directories to search for imported
 	// packages.
 	PkgPath []string
@@ -28,19 +45,76 @@ type Params struct {
 	// MaxLoopUnroll specifies the upper limit for loop unrolling.
 	MaxLoopUnroll int
 
+	// NoUnroll disables the unrolling of large loops. The loops can
+	// iterate at most NoUnrollLimit times and the larger loops are
+	// reported as errors at the loop statement. The limit bounds the
+	// number of iterations and not the size of the circuit: a small
+	// loop can still expand a large body and the calls it makes.
+	NoUnroll bool
+
 	NoCircCompile bool
 	CircOut       io.WriteCloser
 	CircDotOut    io.WriteCloser
 	CircSvgOut    io.WriteCloser
 	CircFormat    string
 
+	// SSACircSvgOut specifies the output for the SVG image that
+	// shows the SSA basic blocks and the circuit gates that each SSA
+	// instruction generated. The output is supported only for small
+	// circuits.
+	SSACircSvgOut io.WriteCloser
+
 	CircMultArrayTreshold int
 
+	// FanOutWarning specifies the wire fan-out limit. If non-zero,
+	// the compiler warns about the circuit wires whose fan-out
+	// exceeds the limit.
+	FanOutWarning int
+
 	OptPruneGates bool
 
+	// OptRebalance enables the circuit rebalancing that restructures
+	// the chains of associative gates into balanced trees to reduce
+	// the circuit depth.
+	OptRebalance bool
+
+	// OptRenumberWires enables the wire renumbering that reorders
+	// the compiled circuit gates and wires for the memory locality
+	// of the garbling and evaluation. The option does not apply to
+	// the streaming mode.
+	OptRenumberWires bool
+
+	// CostOut specifies the output for the per-line MPC cost
+	// report. If set, the compiler attributes the AND gates of the
+	// compiled circuit to the source lines that generated them and
+	// prints the lines sorted by the descending gate count.
+	CostOut io.Writer
+
 	BenchmarkCompile bool
+
+	// CompressGates enables the compression of the garbled gates in
+	// the streaming mode. The gates are batched into blocks that are
+	// compressed with flate. The compression is disabled
+	// automatically if it does not reduce the amount of transferred
+	// data.
+	CompressGates bool
+
+	// Rand specifies the random source of the streaming garbler's
+	// garbling key and wire labels. If nil, crypto/rand.Reader is
+	// used. The deterministic sources make the protocol runs
+	// reproducible but they break the security of the computation.
+	Rand io.Reader
+
+	// Profile receives the protocol profile of the streaming garbler
+	// when the protocol completes. If nil, the profile is not
+	// collected.
+	Profile *circuit.Profile
 }
 
+// NoUnrollLimit specifies the maximum number of loop iterations when
+// loop unrolling is disabled with Params.NoUnroll.
+const NoUnrollLimit = 32
+
 // NewParams returns new compiler params object, initialized with the
 // default values.
 func NewParams() *Params {
@@ -50,6 +124,14 @@ func NewParams() *Params {
 	}
 }
 
+// LoopLimit returns the maximum number of loop iterations.
+func (p *Params) LoopLimit() int {
+	if p.NoUnroll && p.MaxLoopUnroll > NoUnrollLimit {
+		return NoUnrollLimit
+	}
+	return p.MaxLoopUnroll
+}
+
 // Close closes all open resources.
 func (p *Params) Close() {
 	if p.SSAOut != nil {
@@ -72,4 +154,8 @@ func (p *Params) Close() {
 		p.CircSvgOut.Close()
 		p.CircSvgOut = nil
 	}
+	if p.SSACircSvgOut != nil {
+		p.SSACircSvgOut.Close()
+		p.SSACircSvgOut = nil
+	}
 }
@@ -49,6 +49,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"hash"
+	"io"
 	"math/big"
 )
 
@@ -254,14 +255,24 @@ type CO struct {
 	hash   hash.Hash
 	digest []byte
 	io     IO
+	rand   io.Reader
 }
 
 // NewCO creates a new CO OT implementing the OT interface.
 func NewCO() *CO {
+	return NewCOWithRand(rand.Reader)
+}
+
+// NewCOWithRand creates a new CO OT that reads its random scalars
+// from the argument random source. The deterministic sources make
+// the protocol transcripts reproducible and they must be used only
+// in tests.
+func NewCOWithRand(rand io.Reader) *CO {
 	return &CO{
 		curve:  elliptic.P256(),
 		hash:   sha256.New(),
 		digest: make([]byte, sha256.Size),
+		rand:   rand,
 	}
 }
 
@@ -294,7 +305,7 @@ func (co *CO) Send(wires []Wire) error {
 	curveParams := co.curve.Params()
 
 	// a <- Zp
-	a, err := rand.Int(rand.Reader, curveParams.N)
+	a, err := rand.Int(co.rand, curveParams.N)
 	if err != nil {
 		return err
 	}
@@ -397,7 +408,7 @@ func (co *CO) Receive(flags []bool, result []Label) error {
 
 	for i := 0; i < flagsCnt; i++ {
 		// b <= Zp
-		b, err := rand.Int(rand.Reader, curveParams.N)
+		b, err := rand.Int(co.rand, curveParams.N)
 		if err != nil {
 			return err
 		}
@@ -14,20 +14,31 @@ import (
 	"io"
 )
 
+const (
+	// LabelBits specifies the label size in bits. This is the
+	// computational security parameter of the garbling and OT
+	// protocols. The labels are garbled with AES so a label matches
+	// the cipher block size.
+	LabelBits = 128
+
+	// LabelSize specifies the label size in bytes.
+	LabelSize = LabelBits / 8
+)
+
 // Wire implements a wire with 0 and 1 labels.
 type Wire struct {
 	L0 Label
 	L1 Label
 }
 
-// Label implements a 128 bit wire label.
+// Label implements a LabelBits bit wire label.
 type Label struct {
 	D0 uint64
 	D1 uint64
 }
 
-// LabelData contains lable data as byte array.
-type LabelData [16]byte
+// LabelData contains label data as byte array.
+type LabelData [LabelSize]byte
 
 func (l Label) String() string {
 	return fmt.Sprintf("%016x%016x", l.D0, l.D1)
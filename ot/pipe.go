@@ -13,7 +13,8 @@ import (
 )
 
 var (
-	_ IO = &Pipe{}
+	_ IO            = &Pipe{}
+	_ io.ReadWriter = &Pipe{}
 )
 
 // Pipe implements the IO interface with in-memory io.Pipe.
@@ -79,6 +80,16 @@ func (p *Pipe) Drain() error {
 	return err
 }
 
+// Read implements io.Reader.
+func (p *Pipe) Read(data []byte) (int, error) {
+	return p.r.Read(data)
+}
+
+// Write implements io.Writer.
+func (p *Pipe) Write(data []byte) (int, error) {
+	return p.w.Write(data)
+}
+
 // Close closes the pipe.
 func (p *Pipe) Close() error {
 	return p.w.Close()
@@ -112,6 +123,6 @@ func (p *Pipe) ReceiveData() ([]byte, error) {
 	if l > uint32(len(p.rBuf)) {
 		return nil, fmt.Errorf("pipe buffer too short: %d > %d", l, len(p.rBuf))
 	}
-	n, err := p.r.Read(p.rBuf[:])
+	n, err := io.ReadFull(p.r, p.rBuf[:l])
 	return p.rBuf[:n], err
 }
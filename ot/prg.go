@@ -0,0 +1,93 @@
+//
+// prg.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+
+package ot
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+)
+
+// PRG is a pseudorandom generator that expands a seed into a stream
+// of labels. The stream is deterministic for the seed so both peers
+// of a protocol can expand the same seed into the same labels.
+type PRG interface {
+	io.Reader
+
+	// Label returns the next label of the stream.
+	Label() Label
+}
+
+// NewPRG creates the default PRG for the seed. The default PRG is
+// AESPRG.
+func NewPRG(seed Label) PRG {
+	return NewAESPRG(seed)
+}
+
+// AESPRG implements PRG with AES-128 in counter mode. The seed is the
+// AES key and the stream is the encryption of the big-endian block
+// counter starting from zero.
+type AESPRG struct {
+	alg cipher.Block
+	ctr uint64
+	buf LabelData
+	pos int
+}
+
+// NewAESPRG creates a new AES-CTR based PRG for the seed.
+func NewAESPRG(seed Label) *AESPRG {
+	var key LabelData
+	seed.GetData(&key)
+
+	alg, err := aes.NewCipher(key[:])
+	if err != nil {
+		// The key is always a valid AES-128 key.
+		panic(err)
+	}
+	return &AESPRG{
+		alg: alg,
+		pos: len(key),
+	}
+}
+
+// next encrypts the next counter block into data.
+func (prg *AESPRG) next(data *LabelData) {
+	clear(data[:8])
+	binary.BigEndian.PutUint64(data[8:], prg.ctr)
+	prg.ctr++
+	prg.alg.Encrypt(data[:], data[:])
+}
+
+// Read implements io.Reader.
+func (prg *AESPRG) Read(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		if prg.pos >= len(prg.buf) {
+			prg.next(&prg.buf)
+			prg.pos = 0
+		}
+		c := copy(p[n:], prg.buf[prg.pos:])
+		prg.pos += c
+		n += c
+	}
+	return len(p), nil
+}
+
+// Label implements PRG.Label.
+func (prg *AESPRG) Label() Label {
+	var data LabelData
+	var label Label
+
+	if prg.pos >= len(prg.buf) {
+		prg.next(&data)
+	} else {
+		prg.Read(data[:])
+	}
+	label.SetData(&data)
+	return label
+}
@@ -0,0 +1,128 @@
+//
+// prg_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ot
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"math/bits"
+	"testing"
+)
+
+func TestPRGDeterministic(t *testing.T) {
+	seed := Label{
+		D0: 0x0123456789abcdef,
+		D1: 0xfedcba9876543210,
+	}
+	p0 := NewPRG(seed)
+	p1 := NewPRG(seed)
+	p2 := NewPRG(Label{D0: seed.D0, D1: seed.D1 ^ 1})
+
+	for i := 0; i < 1000; i++ {
+		l0 := p0.Label()
+		l1 := p1.Label()
+		l2 := p2.Label()
+		if !l0.Equal(l1) {
+			t.Fatalf("label %d: %v != %v", i, l0, l1)
+		}
+		if l0.Equal(l2) {
+			t.Fatalf("label %d: different seeds produced %v", i, l0)
+		}
+	}
+
+	// The labels and the bytes read are the same stream.
+	var buf [3*LabelSize + 5]byte
+	p0 = NewPRG(seed)
+	p1 = NewPRG(seed)
+	p1.Read(buf[:7])
+	p1.Read(buf[7:])
+
+	var data LabelData
+	for i := 0; i < len(buf)/LabelSize; i++ {
+		l := p0.Label()
+		l.GetData(&data)
+		if !bytes.Equal(data[:], buf[i*LabelSize:(i+1)*LabelSize]) {
+			t.Errorf("label %d: %x != %x", i, data,
+				buf[i*LabelSize:(i+1)*LabelSize])
+		}
+	}
+	// Label continues from the partially read label.
+	p1.Label().GetData(&data)
+
+	var expected LabelData
+	p0 = NewPRG(seed)
+	p0.Read(make([]byte, len(buf)))
+	p0.Read(expected[:])
+	if data != expected {
+		t.Errorf("Label after Read: %x, expected %x", data, expected)
+	}
+}
+
+func TestPRGAESCTR(t *testing.T) {
+	seed := Label{
+		D0: 0x0001020304050607,
+		D1: 0x08090a0b0c0d0e0f,
+	}
+	var key LabelData
+	seed.GetData(&key)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := make([]byte, 4096)
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(expected,
+		expected)
+
+	data := make([]byte, len(expected))
+	NewPRG(seed).Read(data)
+	if !bytes.Equal(data, expected) {
+		t.Errorf("PRG stream does not match AES-CTR")
+	}
+}
+
+func TestPRGUniform(t *testing.T) {
+	const size = 1 << 20
+
+	data := make([]byte, size)
+	NewPRG(Label{D0: 1}).Read(data)
+
+	// The share of one bits.
+	var ones int
+	var counts [256]int
+	for _, b := range data {
+		ones += bits.OnesCount8(b)
+		counts[b]++
+	}
+	// The standard deviation of the bit count is sqrt(8*size)/2.
+	diff := ones - size*8/2
+	if diff < -5*1448 || diff > 5*1448 {
+		t.Errorf("bit count %d differs %d from %d", ones, diff, size*8/2)
+	}
+
+	// Pearson's chi-squared test for the byte values. The 255
+	// degrees of freedom statistic exceeds 350 with probability
+	// below 0.0001.
+	var chi2 float64
+	e := float64(size) / 256
+	for _, c := range counts {
+		d := float64(c) - e
+		chi2 += d * d / e
+	}
+	if chi2 > 350 {
+		t.Errorf("byte distribution chi-squared %.2f", chi2)
+	}
+}
+
+func BenchmarkPRGLabel(b *testing.B) {
+	prg := NewPRG(Label{})
+	for i := 0; i < b.N; i++ {
+		prg.Label()
+	}
+}
@@ -0,0 +1,61 @@
+//
+// rand.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+
+package ot
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+)
+
+// seededReader implements a deterministic random source. The output
+// is the SHA-256 digests of the length-prefixed seed, the
+// length-prefixed stream label, and a running counter. The length
+// prefixes keep the seed and label pairs such as ("ab", "c") and ("a",
+// "bc") from producing the same stream.
+type seededReader struct {
+	prefix  []byte
+	counter uint64
+	buf     []byte
+}
+
+// NewSeededReader creates a deterministic random source from the
+// seed. The label separates the streams of different consumers of the
+// same seed. The source makes the protocol transcripts reproducible
+// but anyone knowing the seed can predict its output so it must be
+// used only for tests, demos, and debugging. The source is not safe
+// for concurrent use; each goroutine needs its own source.
+func NewSeededReader(seed []byte, label string) io.Reader {
+	prefix := binary.BigEndian.AppendUint32(nil, uint32(len(seed)))
+	prefix = append(prefix, seed...)
+	prefix = binary.BigEndian.AppendUint32(prefix, uint32(len(label)))
+	prefix = append(prefix, label...)
+
+	return &seededReader{
+		prefix: prefix,
+	}
+}
+
+func (r *seededReader) Read(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		if len(r.buf) == 0 {
+			var ctr [8]byte
+			binary.BigEndian.PutUint64(ctr[:], r.counter)
+			r.counter++
+
+			h := sha256.New()
+			h.Write(r.prefix)
+			h.Write(ctr[:])
+			r.buf = h.Sum(nil)
+		}
+		c := copy(p[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+	return len(p), nil
+}
@@ -0,0 +1,45 @@
+//
+// rand_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ot
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func readSeeded(t *testing.T, seed, label string) []byte {
+	buf := make([]byte, 48)
+	_, err := io.ReadFull(NewSeededReader([]byte(seed), label), buf)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	return buf
+}
+
+func TestSeededReader(t *testing.T) {
+	a := readSeeded(t, "seed", "garble")
+	if !bytes.Equal(a, readSeeded(t, "seed", "garble")) {
+		t.Errorf("same seed and label produce different streams")
+	}
+	for _, test := range []struct {
+		seed  string
+		label string
+	}{
+		{"seed", "ot"},
+		{"other", "garble"},
+		{"seedg", "arble"},
+		{"see", "dgarble"},
+	} {
+		if bytes.Equal(a, readSeeded(t, test.seed, test.label)) {
+			t.Errorf("(%q, %q) produces the stream of (seed, garble)",
+				test.seed, test.label)
+		}
+	}
+}
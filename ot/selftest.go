@@ -0,0 +1,241 @@
+//
+// selftest.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+
+package ot
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// selfTestWires specifies the number of transfers in each self-test.
+const selfTestWires = 16
+
+// selfTestSeed is the seed of the deterministic self-test inputs.
+var selfTestSeed = []byte("github.com/markkurossi/mpc/ot self-test")
+
+// selfTest defines the self-test of an OT implementation.
+type selfTest struct {
+	name string
+	// new creates a new OT instance. The deterministic tests pass a
+	// seeded random source, other tests pass nil.
+	new func(rand io.Reader) OT
+	// transcript is the known SHA-256 digest of the sender's protocol
+	// transcript with the deterministic random source. The tests
+	// without transcript do not have a deterministic variant.
+	transcript string
+}
+
+var selfTests = []selfTest{
+	{
+		name: "CO",
+		new: func(r io.Reader) OT {
+			if r == nil {
+				return NewCO()
+			}
+			return NewCOWithRand(r)
+		},
+		transcript: "de9c9768284c8cc3e9dade099a481110" +
+			"f376acc84d39465db869437d997aec6e",
+	},
+	{
+		// The RSA key generation does not use custom random sources.
+		name: "RSA-2048",
+		new: func(io.Reader) OT {
+			return NewRSA(2048)
+		},
+	},
+}
+
+// SelfTest runs the known-answer tests of the OT implementations. The
+// tests transfer fixed labels with fixed choice bits over NewPipe and
+// verify that the receiver obtains exactly the chosen labels. The
+// implementations supporting deterministic random sources are also
+// run with a seeded random source and their protocol transcripts are
+// compared against known digests. The function returns an error
+// describing the first failed test.
+func SelfTest() error {
+	for _, test := range selfTests {
+		if _, err := test.run(false); err != nil {
+			return fmt.Errorf("OT self-test %s: %w", test.name, err)
+		}
+		if len(test.transcript) == 0 {
+			continue
+		}
+		digest, err := test.run(true)
+		if err != nil {
+			return fmt.Errorf("OT self-test %s (deterministic): %w",
+				test.name, err)
+		}
+		if digest != test.transcript {
+			return fmt.Errorf("OT self-test %s: transcript %s, expected %s",
+				test.name, digest, test.transcript)
+		}
+	}
+	return nil
+}
+
+// run runs the self-test. If deterministic is true, the sender and
+// the receiver use seeded random sources. The function returns the
+// hex-encoded digest of the sender's transcript.
+func (test selfTest) run(deterministic bool) (string, error) {
+	wires, flags, err := selfTestInputs()
+	if err != nil {
+		return "", err
+	}
+	var sender, receiver OT
+	if deterministic {
+		sender = test.new(NewSeededReader(selfTestSeed, "sender"))
+		receiver = test.new(NewSeededReader(selfTestSeed, "receiver"))
+	} else {
+		sender = test.new(nil)
+		receiver = test.new(nil)
+	}
+
+	sPipe, rPipe := NewPipe()
+	transcript := &transcriptIO{
+		io:   sPipe,
+		hash: sha256.New(),
+	}
+
+	done := make(chan error)
+	go func() {
+		err := sender.InitSender(transcript)
+		if err == nil {
+			err = sender.Send(wires)
+		}
+		if err != nil {
+			sPipe.Close()
+			sPipe.Drain()
+		}
+		done <- err
+	}()
+
+	labels := make([]Label, len(flags))
+	err = receiver.InitReceiver(rPipe)
+	if err == nil {
+		err = receiver.Receive(flags, labels)
+	}
+	if err != nil {
+		rPipe.Close()
+		rPipe.Drain()
+		<-done
+		return "", err
+	}
+	if err := <-done; err != nil {
+		return "", err
+	}
+	for i, flag := range flags {
+		expected := wires[i].L0
+		if flag {
+			expected = wires[i].L1
+		}
+		if !labels[i].Equal(expected) {
+			return "", fmt.Errorf("label %d: got %v, expected %v",
+				i, labels[i], expected)
+		}
+	}
+	return hex.EncodeToString(transcript.hash.Sum(nil)), nil
+}
+
+// selfTestInputs creates the fixed self-test wire labels and choice
+// bits.
+func selfTestInputs() ([]Wire, []bool, error) {
+	r := NewSeededReader(selfTestSeed, "inputs")
+
+	wires := make([]Wire, selfTestWires)
+	flags := make([]bool, selfTestWires)
+	var err error
+	for i := range wires {
+		wires[i].L0, err = NewLabel(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		wires[i].L1, err = NewLabel(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		flags[i] = (0x9a5c>>(i%16))&1 == 1
+	}
+	return wires, flags, nil
+}
+
+// transcriptIO implements the IO interface and hashes all data that
+// is sent and received through it.
+type transcriptIO struct {
+	io   IO
+	hash hash.Hash
+}
+
+func (t *transcriptIO) record(dir byte, data []byte) {
+	var hdr [5]byte
+	hdr[0] = dir
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(data)))
+	t.hash.Write(hdr[:])
+	t.hash.Write(data)
+}
+
+// SendByte implements IO.SendByte.
+func (t *transcriptIO) SendByte(val byte) error {
+	t.record('>', []byte{val})
+	return t.io.SendByte(val)
+}
+
+// SendUint32 implements IO.SendUint32.
+func (t *transcriptIO) SendUint32(val int) error {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(val))
+	t.record('>', buf[:])
+	return t.io.SendUint32(val)
+}
+
+// SendData implements IO.SendData.
+func (t *transcriptIO) SendData(val []byte) error {
+	t.record('>', val)
+	return t.io.SendData(val)
+}
+
+// Flush implements IO.Flush.
+func (t *transcriptIO) Flush() error {
+	return t.io.Flush()
+}
+
+// ReceiveByte implements IO.ReceiveByte.
+func (t *transcriptIO) ReceiveByte() (byte, error) {
+	val, err := t.io.ReceiveByte()
+	if err != nil {
+		return 0, err
+	}
+	t.record('<', []byte{val})
+	return val, nil
+}
+
+// ReceiveUint32 implements IO.ReceiveUint32.
+func (t *transcriptIO) ReceiveUint32() (int, error) {
+	val, err := t.io.ReceiveUint32()
+	if err != nil {
+		return 0, err
+	}
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(val))
+	t.record('<', buf[:])
+	return val, nil
+}
+
+// ReceiveData implements IO.ReceiveData.
+func (t *transcriptIO) ReceiveData() ([]byte, error) {
+	val, err := t.io.ReceiveData()
+	if err != nil {
+		return nil, err
+	}
+	t.record('<', val)
+	return val, nil
+}
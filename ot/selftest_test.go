@@ -0,0 +1,49 @@
+//
+// selftest_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ot
+
+import (
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	if err := SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelfTestTranscript(t *testing.T) {
+	for _, test := range selfTests {
+		if len(test.transcript) == 0 {
+			continue
+		}
+		digest, err := test.run(true)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		// The deterministic transcripts must be reproducible.
+		again, err := test.run(true)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if digest != again {
+			t.Errorf("%s: transcript not stable: %s != %s",
+				test.name, digest, again)
+		}
+		// The random transcripts must differ from the known answer.
+		random, err := test.run(false)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if random == test.transcript {
+			t.Errorf("%s: random transcript matches the known answer",
+				test.name)
+		}
+	}
+}
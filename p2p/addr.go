@@ -0,0 +1,73 @@
+//
+// addr.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+// UnixPrefix is the address prefix that selects Unix domain sockets
+// for co-located parties, for example "unix:/tmp/mpc.sock". All other
+// addresses are TCP addresses.
+const UnixPrefix = "unix:"
+
+// splitAddr returns the network and address for the Listen and Dial
+// functions of the net package.
+func splitAddr(addr string) (string, string) {
+	if strings.HasPrefix(addr, UnixPrefix) {
+		return "unix", addr[len(UnixPrefix):]
+	}
+	return "tcp", addr
+}
+
+// Listen announces on the address addr. The "unix:/path" addresses
+// listen at the Unix domain socket path. A stale socket file, left
+// behind by a listener that was not closed, is removed before
+// listening. The socket file is removed when the listener is closed.
+func Listen(addr string) (net.Listener, error) {
+	network, address := splitAddr(addr)
+	if network == "unix" {
+		if err := removeStaleSocket(address); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen(network, address)
+}
+
+// Dial connects to the address addr. The address syntax is the same
+// as with Listen.
+func Dial(addr string) (net.Conn, error) {
+	return net.Dial(splitAddr(addr))
+}
+
+// removeStaleSocket removes the Unix domain socket file path if no
+// listener accepts connections at it. The function does not remove
+// files that are not sockets.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		// The socket is in use.
+		conn.Close()
+		return nil
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,135 @@
+//
+// addr_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+)
+
+func TestUnixSocketOT(t *testing.T) {
+	const size = 64
+
+	path := filepath.Join(t.TempDir(), "ot.sock")
+	addr := UnixPrefix + path
+
+	ln, err := Listen(addr)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	wires := make([]ot.Wire, size)
+	flags := make([]bool, size)
+	for i := 0; i < size; i++ {
+		var data ot.LabelData
+		if _, err := rand.Read(data[:]); err != nil {
+			t.Fatal(err)
+		}
+		wires[i].L0.SetData(&data)
+		if _, err := rand.Read(data[:]); err != nil {
+			t.Fatal(err)
+		}
+		wires[i].L1.SetData(&data)
+		flags[i] = i%3 == 0
+	}
+
+	done := make(chan error)
+	go func() {
+		nc, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		conn := NewConn(nc)
+		defer conn.Close()
+
+		sender := ot.NewCO()
+		if err := sender.InitSender(conn); err != nil {
+			done <- err
+			return
+		}
+		done <- sender.Send(wires)
+	}()
+
+	nc, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn := NewConn(nc)
+
+	labels := make([]ot.Label, size)
+	receiver := ot.NewCO()
+	if err := receiver.InitReceiver(conn); err != nil {
+		t.Fatalf("InitReceiver failed: %v", err)
+	}
+	if err := receiver.Receive(flags, labels); err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("sender failed: %v", err)
+	}
+	conn.Close()
+
+	for i := 0; i < size; i++ {
+		expected := wires[i].L0
+		if flags[i] {
+			expected = wires[i].L1
+		}
+		if !labels[i].Equal(expected) {
+			t.Errorf("label %d mismatch: got %v, expected %v",
+				i, labels[i], expected)
+		}
+	}
+
+	if err := ln.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("socket file not removed: %v", err)
+	}
+}
+
+func TestUnixSocketStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stale.sock")
+	addr := UnixPrefix + path
+
+	// Leave a stale socket file behind.
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("net.Listen failed: %v", err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("stale socket file missing: %v", err)
+	}
+
+	ln, err = Listen(addr)
+	if err != nil {
+		t.Fatalf("Listen failed with stale socket: %v", err)
+	}
+	defer ln.Close()
+
+	// The active socket must not be removed.
+	_, err = Listen(addr)
+	if err == nil {
+		t.Errorf("Listen succeeded with active socket")
+	}
+	nc, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	nc.Close()
+}
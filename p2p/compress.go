@@ -0,0 +1,226 @@
+//
+// compress.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+// Compressed block types.
+const (
+	blockRaw   byte = 0
+	blockFlate byte = 1
+)
+
+// SendCompressed compresses the data in probe windows of
+// compressProbe bytes. If the compression of a window saves less than
+// 1/16 of the data, the next compressSkip bytes are sent uncompressed
+// before the compression is probed again.
+const (
+	compressProbe = 64 * 1024
+	compressSkip  = 4 * compressProbe
+)
+
+// maxBlock specifies the maximum size of the uncompressed data of a
+// block. The raw blocks must fit in the read buffer so the limit
+// applies to the compressed blocks too.
+const maxBlock = readBufSize
+
+// compressor implements the compression state of a connection.
+type compressor struct {
+	skip int
+	in   uint64
+	out  uint64
+	buf  bytes.Buffer
+	w    *flate.Writer
+	r    io.ReadCloser
+}
+
+func (c *compressor) compress(data []byte) ([]byte, error) {
+	c.buf.Reset()
+	if c.w == nil {
+		w, err := flate.NewWriter(&c.buf, flate.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		c.w = w
+	} else {
+		c.w.Reset(&c.buf)
+	}
+	if _, err := c.w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := c.w.Close(); err != nil {
+		return nil, err
+	}
+	// The block is sent uncompressed if the compression does not
+	// reduce its size.
+	c.in += uint64(len(data))
+	c.out += uint64(min(len(data), c.buf.Len()))
+
+	if c.in >= compressProbe {
+		if c.out > c.in-c.in/16 {
+			c.skip = compressSkip
+		}
+		c.in = 0
+		c.out = 0
+	}
+
+	return c.buf.Bytes(), nil
+}
+
+func (c *compressor) decompress(data []byte) ([]byte, error) {
+	if c.r == nil {
+		c.r = flate.NewReader(bytes.NewReader(data))
+	} else {
+		err := c.r.(flate.Resetter).Reset(bytes.NewReader(data), nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// The limit protects the receiver from the blocks that decompress
+	// to huge data.
+	result, err := io.ReadAll(io.LimitReader(c.r, maxBlock+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(result) > maxBlock {
+		return nil, fmt.Errorf("decompressed block too big: > %d", maxBlock)
+	}
+	return result, nil
+}
+
+// SendCompressed sends the data as a length-prefixed block. The data
+// must be at most 1 MB long. The block is compressed with flate if the compression reduces its size. If
+// the compression does not help for the recent blocks, it is
+// disabled for a while and the blocks are sent uncompressed.
+func (c *Conn) SendCompressed(val []byte) error {
+	if len(val) > maxBlock {
+		return fmt.Errorf("compressed block too big: %d > %d",
+			len(val), maxBlock)
+	}
+	kind := blockRaw
+	data := val
+	if c.compress.skip > 0 {
+		c.compress.skip -= min(c.compress.skip, len(val))
+	} else {
+		compressed, err := c.compress.compress(val)
+		if err != nil {
+			return err
+		}
+		if len(compressed) < len(val) {
+			kind = blockFlate
+			data = compressed
+		}
+	}
+	if err := c.NeedSpace(5); err != nil {
+		return err
+	}
+	c.WriteBuf[c.WritePos] = kind
+	c.WritePos++
+	if err := c.sendUint32(len(data)); err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		if c.WritePos >= len(c.WriteBuf) {
+			if err := c.Flush(); err != nil {
+				return err
+			}
+		}
+		n := copy(c.WriteBuf[c.WritePos:], data)
+		c.WritePos += n
+		data = data[n:]
+	}
+	if c.Trace != nil {
+		c.Trace.data(traceSend, "compressed", val)
+	}
+	return nil
+}
+
+// ReceiveCompressed receives a block sent with SendCompressed.
+func (c *Conn) ReceiveCompressed() ([]byte, error) {
+	if c.ReadStart+1 > c.ReadEnd {
+		if err := c.Fill(1); err != nil {
+			return nil, err
+		}
+	}
+	kind := c.ReadBuf[c.ReadStart]
+	c.ReadStart++
+
+	n, err := c.receiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	if n > len(c.ReadBuf) {
+		return nil, fmt.Errorf("compressed block too big: %d > %d",
+			n, len(c.ReadBuf))
+	}
+	if c.ReadStart+n > c.ReadEnd {
+		if err := c.Fill(n); err != nil {
+			return nil, err
+		}
+	}
+	data := c.ReadBuf[c.ReadStart : c.ReadStart+n]
+	c.ReadStart += n
+
+	var result []byte
+	switch kind {
+	case blockRaw:
+		result = make([]byte, n)
+		copy(result, data)
+
+	case blockFlate:
+		result, err = c.compress.decompress(data)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid compressed block type: %d", kind)
+	}
+	if c.Trace != nil {
+		c.Trace.data(traceRecv, "compressed", result)
+	}
+	return result, nil
+}
+
+// CompressedConn returns a read-only connection that reads the data
+// of the consecutive blocks sent with SendCompressed. The connection
+// receives the next block from c only when it has consumed all data
+// of the previous block.
+func (c *Conn) CompressedConn() *Conn {
+	return NewConn(&blockReader{
+		conn: c,
+	})
+}
+
+type blockReader struct {
+	conn *Conn
+	data []byte
+}
+
+func (r *blockReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		data, err := r.conn.ReceiveCompressed()
+		if err != nil {
+			return 0, err
+		}
+		r.data = data
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (r *blockReader) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("compressed connection is read-only")
+}
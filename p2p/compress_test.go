@@ -0,0 +1,149 @@
+//
+// compress_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+)
+
+func TestCompressed(t *testing.T) {
+	random := make([]byte, 100*1024)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	blocks := [][]byte{
+		bytes.Repeat([]byte("Hello, world!"), 1000),
+		random,
+		[]byte{42},
+	}
+
+	p0, p1 := Pipe()
+	w := NewConn(p0)
+	go func() {
+		for _, block := range blocks {
+			if err := w.SendCompressed(block); err != nil {
+				t.Errorf("SendCompressed: %v", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+	}()
+
+	c := NewConn(p1)
+	for idx, block := range blocks {
+		data, err := c.ReceiveCompressed()
+		if err != nil {
+			t.Fatalf("ReceiveCompressed: %v", err)
+		}
+		if !bytes.Equal(data, block) {
+			t.Errorf("block %d: data mismatch", idx)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	sent := w.Stats.Sent.Load()
+	if sent >= uint64(len(blocks[0])+len(blocks[1])) {
+		t.Errorf("blocks not compressed: sent %d bytes", sent)
+	}
+}
+
+func TestCompressedAutoDisable(t *testing.T) {
+	var blocks [][]byte
+	for i := 0; i < 10; i++ {
+		block := make([]byte, compressProbe/8)
+		if _, err := rand.Read(block); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	p0, p1 := Pipe()
+	w := NewConn(p0)
+	done := make(chan bool)
+	go func() {
+		for _, block := range blocks {
+			if err := w.SendCompressed(block); err != nil {
+				t.Errorf("SendCompressed: %v", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+		done <- true
+	}()
+
+	c := NewConn(p1)
+	gc := c.CompressedConn()
+	for idx, block := range blocks {
+		data := make([]byte, len(block))
+		for i := range data {
+			v, err := gc.ReceiveByte()
+			if err != nil {
+				t.Fatalf("ReceiveByte: %v", err)
+			}
+			data[i] = v
+		}
+		if !bytes.Equal(data, block) {
+			t.Errorf("block %d: data mismatch", idx)
+		}
+	}
+	<-done
+
+	// The first probe window disables the compression and the last
+	// two blocks are sent uncompressed.
+	skip := compressSkip - 2*compressProbe/8
+	if w.compress.skip != skip {
+		t.Errorf("compression skip %d, expected %d", w.compress.skip, skip)
+	}
+	if w.compress.in != 0 {
+		t.Errorf("compressed %d bytes after probe window", w.compress.in)
+	}
+	if err := gc.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestCompressedLimit(t *testing.T) {
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(make([]byte, maxBlock+1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(blockFlate)
+	binary.Write(&buf, binary.BigEndian, uint32(compressed.Len()))
+	buf.Write(compressed.Bytes())
+
+	c := NewConn(&buf)
+	if _, err := c.ReceiveCompressed(); err == nil {
+		t.Errorf("ReceiveCompressed accepted %d decompressed bytes",
+			maxBlock+1)
+	}
+
+	w := NewConn(new(bytes.Buffer))
+	if err := w.SendCompressed(make([]byte, maxBlock+1)); err == nil {
+		t.Errorf("SendCompressed accepted %d bytes", maxBlock+1)
+	}
+}
@@ -0,0 +1,40 @@
+//
+// logger.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NopLogger returns a logger that discards all messages. It is the
+// default logger of the networks and the protocol players.
+func NopLogger() *slog.Logger {
+	return slog.New(nopHandler{})
+}
+
+// nopHandler implements a slog.Handler that is not enabled for any
+// level.
+type nopHandler struct{}
+
+func (h nopHandler) Enabled(context.Context, slog.Level) bool {
+	return false
+}
+
+func (h nopHandler) Handle(context.Context, slog.Record) error {
+	return nil
+}
+
+func (h nopHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h nopHandler) WithGroup(string) slog.Handler {
+	return h
+}
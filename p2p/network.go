@@ -9,7 +9,7 @@ package p2p
 import (
 	"crypto/rsa"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/big"
 	"net"
 	"sync"
@@ -25,11 +25,14 @@ type Network struct {
 	Peers    map[int]*Peer
 	addr     string
 	listener net.Listener
+	logger   *slog.Logger
 }
 
-// NewNetwork creats a new peer-to-peer network.
+// NewNetwork creats a new peer-to-peer network. The addr specifies
+// the TCP address or the "unix:/path" Unix domain socket where the
+// network listens for peers.
 func NewNetwork(addr string, id int) (*Network, error) {
-	listener, err := net.Listen("tcp", addr)
+	listener, err := Listen(addr)
 	if err != nil {
 		return nil, err
 	}
@@ -38,20 +41,89 @@ func NewNetwork(addr string, id int) (*Network, error) {
 		Peers:    make(map[int]*Peer),
 		addr:     addr,
 		listener: listener,
+		logger:   NopLogger(),
 	}
 	go nw.acceptLoop()
 	return nw, nil
 }
 
+// SetLogger sets the logger for the network and its peers. The
+// connection events are logged at the info level and the protocol
+// steps at the debug level. By default, the network does not log
+// anything.
+func (nw *Network) SetLogger(logger *slog.Logger) {
+	nw.m.Lock()
+	nw.logger = logger
+	nw.m.Unlock()
+}
+
+// Logger returns the network's logger.
+func (nw *Network) Logger() *slog.Logger {
+	nw.m.Lock()
+	defer nw.m.Unlock()
+	return nw.logger
+}
+
 // Close closes the network.
 func (nw *Network) Close() error {
 	return nw.listener.Close()
 }
 
-// AddPeer adds a peer to the network.
+// RetryPolicy specifies how AddPeer retries the failed connection
+// attempts to a peer.
+type RetryPolicy struct {
+	// InitialDelay is the delay after the first failed attempt.
+	InitialDelay time.Duration
+	// MaxDelay limits the delay between attempts. The value 0 does
+	// not limit the delay.
+	MaxDelay time.Duration
+	// Multiplier scales the delay after each failed attempt. The
+	// values less than 1 keep the delay constant.
+	Multiplier float64
+	// MaxAttempts specifies the maximum number of connection
+	// attempts. The value 0 retries forever.
+	MaxAttempts int
+}
+
+// DefaultRetryPolicy retries connections forever every 5 seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	InitialDelay: 5 * time.Second,
+}
+
+// Delay returns the delay after the failed connection attempt
+// attempt. The attempts are numbered from 1.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay)
+	if p.Multiplier > 1 {
+		for i := 1; i < attempt; i++ {
+			delay *= p.Multiplier
+			if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+				break
+			}
+		}
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// AddPeer adds a peer to the network. The addr specifies the peer's
+// address with the syntax of NewNetwork. The failed connection
+// attempts are retried with DefaultRetryPolicy.
 func (nw *Network) AddPeer(addr string, id int) error {
+	return nw.AddPeerRetry(addr, id, DefaultRetryPolicy)
+}
+
+// AddPeerRetry adds a peer to the network like AddPeer but retries
+// the failed connection attempts according to the policy. The
+// function returns an error if it can't connect to the peer in
+// policy.MaxAttempts attempts.
+func (nw *Network) AddPeerRetry(addr string, id int,
+	policy RetryPolicy) error {
+
 	// Try to connect to peer.
-	for {
+	for attempt := 1; ; attempt++ {
 		// Check if we have already accepted peer `id`.
 		nw.m.Lock()
 		_, ok := nw.Peers[id]
@@ -60,16 +132,20 @@ func (nw *Network) AddPeer(addr string, id int) error {
 			return nil
 		}
 
-		log.Printf("NW %d: Connecting to peer %d...\n", nw.ID, id)
-		nc, err := net.Dial("tcp", addr)
+		nw.Logger().Info("connecting to peer", "nw", nw.ID, "peer", id)
+		nc, err := Dial(addr)
 		if err != nil {
-			delay := 5 * time.Second
-			log.Printf("NW %d: Connect to %s failed, retrying in %s\n",
-				nw.ID, addr, delay)
+			if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+				return fmt.Errorf("connect to peer %d at %s failed "+
+					"after %d attempts: %w", id, addr, attempt, err)
+			}
+			delay := policy.Delay(attempt)
+			nw.Logger().Warn("connect failed", "nw", nw.ID, "addr", addr,
+				"err", err, "retry", delay)
 			<-time.After(delay)
 			continue
 		}
-		log.Printf("NW %d: Connected to %s\n", nw.ID, addr)
+		nw.Logger().Info("connected", "nw", nw.ID, "addr", addr)
 		conn := NewConn(nc)
 
 		if err := conn.SendUint32(nw.ID); err != nil {
@@ -81,7 +157,8 @@ func (nw *Network) AddPeer(addr string, id int) error {
 			return err
 		}
 		if err := nw.newPeer(true, conn, id); err != nil {
-			fmt.Printf("Failed to add peer: %s\n", err)
+			nw.Logger().Error("failed to add peer", "nw", nw.ID,
+				"peer", id, "err", err)
 		}
 	}
 }
@@ -106,7 +183,7 @@ func (nw *Network) acceptLoop() {
 	for {
 		nc, err := nw.listener.Accept()
 		if err != nil {
-			log.Printf("NW %d: accept failed: %s\n", nw.ID, err)
+			nw.Logger().Error("accept failed", "nw", nw.ID, "err", err)
 			return
 		}
 		conn := NewConn(nc)
@@ -114,14 +191,15 @@ func (nw *Network) acceptLoop() {
 		// Read peer ID.
 		id, err := conn.ReceiveUint32()
 		if err != nil {
-			log.Printf("NW %d: I/O error: %s\n", nw.ID, err)
+			nw.Logger().Warn("I/O error", "nw", nw.ID, "err", err)
 			conn.Close()
 			continue
 		}
 
 		err = nw.newPeer(false, conn, id)
 		if err != nil {
-			log.Printf("inbound connection error: %s\n", err)
+			nw.Logger().Error("inbound connection error", "nw", nw.ID,
+				"err", err)
 		}
 	}
 }
@@ -131,13 +209,14 @@ func (nw *Network) newPeer(client bool, conn *Conn, id int) error {
 	peer, ok := nw.Peers[id]
 	if ok {
 		nw.m.Unlock()
-		log.Printf("NW %d: peer %d already connected\n", nw.ID, id)
+		nw.Logger().Debug("peer already connected", "nw", nw.ID, "peer", id)
 		return conn.Close()
 	}
 	peer = &Peer{
 		id:     id,
 		conn:   conn,
 		client: client,
+		nw:     nw,
 	}
 	nw.Peers[id] = peer
 	nw.m.Unlock()
@@ -150,6 +229,7 @@ type Peer struct {
 	id         int
 	conn       *Conn
 	client     bool
+	nw         *Network
 	otSender   *ot.Sender
 	otReceiver *ot.Receiver
 }
@@ -168,7 +248,7 @@ func (peer *Peer) Ping() error {
 }
 
 func (peer *Peer) init() error {
-	fmt.Printf("peer %d: init\n", peer.id)
+	peer.nw.Logger().Info("peer init", "peer", peer.id)
 
 	// Read peer public key.
 	finished := make(chan error)
@@ -234,7 +314,7 @@ func (peer *Peer) OTLambda(count int, choices, x1, x2 *big.Int) (
 		mode = "OT Lambda server"
 	}
 
-	fmt.Printf("   - %s for peer %d: count=%d\n", mode, peer.id, count)
+	peer.nw.Logger().Debug(mode, "peer", peer.id, "count", count)
 
 	if peer.client {
 		// Client queries first.
@@ -365,7 +445,7 @@ func (peer *Peer) OTR(chA, chB, chC *big.Int,
 		mode = "OT R server"
 	}
 
-	fmt.Printf("   - %s for peer %d: count=%d\n", mode, peer.id, len(x1Ag))
+	peer.nw.Logger().Debug(mode, "peer", peer.id, "count", len(x1Ag))
 
 	if peer.client {
 		ra, rb, rc, err = peer.otrQueries(len(x1Ag), chA, chB, chC)
@@ -513,7 +593,7 @@ func (peer *Peer) ExchangeGates(ag, bg, cg, dg [][]ot.Label, lo *big.Int) (
 		mode = "Exch server"
 	}
 
-	fmt.Printf("   - %s for peer %d\n", mode, peer.id)
+	peer.nw.Logger().Debug(mode, "peer", peer.id)
 
 	if peer.client {
 		err = peer.exchangeSend(ag, bg, cg, dg, lo)
@@ -0,0 +1,108 @@
+//
+// network_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   2,
+	}
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for idx, e := range expected {
+		if d := policy.Delay(idx + 1); d != e {
+			t.Errorf("Delay(%d)=%s, expected %s", idx+1, d, e)
+		}
+	}
+	if d := DefaultRetryPolicy.Delay(10); d != 5*time.Second {
+		t.Errorf("DefaultRetryPolicy.Delay(10)=%s, expected 5s", d)
+	}
+}
+
+func TestAddPeerRetry(t *testing.T) {
+	dir := t.TempDir()
+	nw, err := NewNetwork(UnixPrefix+filepath.Join(dir, "nw.sock"), 0)
+	if err != nil {
+		t.Fatalf("NewNetwork failed: %v", err)
+	}
+	defer nw.Close()
+
+	policy := RetryPolicy{
+		InitialDelay: 10 * time.Millisecond,
+		MaxAttempts:  2,
+	}
+	start := time.Now()
+	err = nw.AddPeerRetry(UnixPrefix+filepath.Join(dir, "dead.sock"), 1,
+		policy)
+	if err == nil {
+		t.Fatalf("AddPeerRetry succeeded with dead address")
+	}
+	if !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < policy.InitialDelay {
+		t.Errorf("AddPeerRetry returned after %s, expected one retry", elapsed)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("AddPeerRetry did not give up: %s", elapsed)
+	}
+}
+
+func TestNetworkLogger(t *testing.T) {
+	if NopLogger().Enabled(context.Background(), slog.LevelError) {
+		t.Errorf("NopLogger is enabled")
+	}
+
+	dir := t.TempDir()
+	nw, err := NewNetwork(UnixPrefix+filepath.Join(dir, "nw.sock"), 0)
+	if err != nil {
+		t.Fatalf("NewNetwork failed: %v", err)
+	}
+	defer nw.Close()
+
+	var buf bytes.Buffer
+	nw.SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	policy := RetryPolicy{
+		InitialDelay: 10 * time.Millisecond,
+		MaxAttempts:  2,
+	}
+	err = nw.AddPeerRetry(UnixPrefix+filepath.Join(dir, "dead.sock"), 1,
+		policy)
+	if err == nil {
+		t.Fatalf("AddPeerRetry succeeded with dead address")
+	}
+	log := buf.String()
+	for _, msg := range []string{
+		"level=INFO msg=\"connecting to peer\" nw=0 peer=1",
+		"level=WARN msg=\"connect failed\"",
+	} {
+		if !strings.Contains(log, msg) {
+			t.Errorf("log does not contain %q:\n%s", msg, log)
+		}
+	}
+}
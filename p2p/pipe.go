@@ -0,0 +1,54 @@
+//
+// pipe.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"io"
+)
+
+// PipeConn is one end of an in-memory bidirectional byte stream. It
+// implements io.ReadWriteCloser and it can be used as the transport
+// of a Conn.
+type PipeConn struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+// Pipe creates a synchronous in-memory bidirectional byte stream and
+// returns its two ends. The data written to one end can be read from
+// the other end. The stream is built from two io.Pipe pairs so a
+// write blocks until the peer reads the data.
+func Pipe() (*PipeConn, *PipeConn) {
+	var p0, p1 PipeConn
+
+	p0.r, p1.w = io.Pipe()
+	p1.r, p0.w = io.Pipe()
+
+	return &p0, &p1
+}
+
+// Read implements io.Reader.
+func (p *PipeConn) Read(data []byte) (n int, err error) {
+	return p.r.Read(data)
+}
+
+// Write implements io.Writer.
+func (p *PipeConn) Write(data []byte) (n int, err error) {
+	return p.w.Write(data)
+}
+
+// Close closes both directions of the stream. The peer's reads return
+// io.EOF after the data written before the close and the peer's
+// writes return io.ErrClosedPipe.
+func (p *PipeConn) Close() error {
+	if err := p.r.Close(); err != nil {
+		return err
+	}
+	return p.w.Close()
+}
@@ -32,7 +32,11 @@ type Conn struct {
 	ReadStart int
 	ReadEnd   int
 	Stats     IOStats
+	// Trace specifies an optional tracer for the sent and received
+	// values.
+	Trace *Tracer
 
+	compress   compressor
 	fromWriter chan []byte
 	toWriter   chan []byte
 	writerErr  error
@@ -78,6 +82,9 @@ func (stats IOStats) Sum() uint64 {
 }
 
 // NewConn creates a new connection around the argument connection.
+// The connection can be any ordered and reliable byte stream, for
+// example a net.Conn, a WebSocket or SSH channel, or the in-memory
+// Pipe. If the connection implements io.Closer, Close closes it.
 func NewConn(conn io.ReadWriter) *Conn {
 	c := &Conn{
 		conn:       conn,
@@ -85,6 +92,7 @@ func NewConn(conn io.ReadWriter) *Conn {
 		fromWriter: make(chan []byte, numBuffers),
 		toWriter:   make(chan []byte, numBuffers),
 		Stats:      NewIOStats(),
+		Trace:      newEnvTracer(),
 	}
 
 	go c.writer()
@@ -165,7 +173,7 @@ func (c *Conn) Close() error {
 	}
 	// Wait that flush completes.
 	close(c.toWriter)
-	for range <-c.fromWriter {
+	for range c.fromWriter {
 	}
 	if c.writerErr != nil {
 		return c.writerErr
@@ -186,6 +194,9 @@ func (c *Conn) SendByte(val byte) error {
 	}
 	c.WriteBuf[c.WritePos] = val
 	c.WritePos++
+	if c.Trace != nil {
+		c.Trace.value(traceSend, "byte", int(val))
+	}
 	return nil
 }
 
@@ -199,11 +210,24 @@ func (c *Conn) SendUint16(val int) error {
 	c.WriteBuf[c.WritePos+0] = byte((uint32(val) >> 8) & 0xff)
 	c.WriteBuf[c.WritePos+1] = byte(uint32(val) & 0xff)
 	c.WritePos += 2
+	if c.Trace != nil {
+		c.Trace.value(traceSend, "uint16", val)
+	}
 	return nil
 }
 
 // SendUint32 sends an uint32 value.
 func (c *Conn) SendUint32(val int) error {
+	if err := c.sendUint32(val); err != nil {
+		return err
+	}
+	if c.Trace != nil {
+		c.Trace.value(traceSend, "uint32", val)
+	}
+	return nil
+}
+
+func (c *Conn) sendUint32(val int) error {
 	if c.WritePos+4 > len(c.WriteBuf) {
 		if err := c.Flush(); err != nil {
 			return err
@@ -224,12 +248,15 @@ func (c *Conn) SendData(val []byte) error {
 			return err
 		}
 	}
-	err := c.SendUint32(len(val))
+	err := c.sendUint32(len(val))
 	if err != nil {
 		return err
 	}
 	copy(c.WriteBuf[c.WritePos:], val)
 	c.WritePos += len(val)
+	if c.Trace != nil {
+		c.Trace.data(traceSend, "data", val)
+	}
 	return nil
 }
 
@@ -243,7 +270,9 @@ func (c *Conn) SendLabel(val ot.Label, data *ot.LabelData) error {
 	}
 	copy(c.WriteBuf[c.WritePos:], bytes)
 	c.WritePos += len(bytes)
-
+	if c.Trace != nil {
+		c.Trace.data(traceSend, "label", bytes)
+	}
 	return nil
 }
 
@@ -274,6 +303,9 @@ func (c *Conn) ReceiveByte() (byte, error) {
 	}
 	val := c.ReadBuf[c.ReadStart]
 	c.ReadStart++
+	if c.Trace != nil {
+		c.Trace.value(traceRecv, "byte", int(val))
+	}
 	return val, nil
 }
 
@@ -288,12 +320,25 @@ func (c *Conn) ReceiveUint16() (int, error) {
 	val <<= 8
 	val |= uint32(c.ReadBuf[c.ReadStart+1])
 	c.ReadStart += 2
-
+	if c.Trace != nil {
+		c.Trace.value(traceRecv, "uint16", int(val))
+	}
 	return int(val), nil
 }
 
 // ReceiveUint32 receives an uint32 value.
 func (c *Conn) ReceiveUint32() (int, error) {
+	val, err := c.receiveUint32()
+	if err != nil {
+		return 0, err
+	}
+	if c.Trace != nil {
+		c.Trace.value(traceRecv, "uint32", val)
+	}
+	return val, nil
+}
+
+func (c *Conn) receiveUint32() (int, error) {
 	if c.ReadStart+4 > c.ReadEnd {
 		if err := c.Fill(4); err != nil {
 			return 0, err
@@ -313,7 +358,7 @@ func (c *Conn) ReceiveUint32() (int, error) {
 
 // ReceiveData receives binary data.
 func (c *Conn) ReceiveData() ([]byte, error) {
-	len, err := c.ReceiveUint32()
+	len, err := c.receiveUint32()
 	if err != nil {
 		return nil, err
 	}
@@ -326,7 +371,9 @@ func (c *Conn) ReceiveData() ([]byte, error) {
 	result := make([]byte, len)
 	copy(result, c.ReadBuf[c.ReadStart:c.ReadStart+len])
 	c.ReadStart += len
-
+	if c.Trace != nil {
+		c.Trace.data(traceRecv, "data", result)
+	}
 	return result, nil
 }
 
@@ -339,7 +386,9 @@ func (c *Conn) ReceiveLabel(val *ot.Label, data *ot.LabelData) error {
 	}
 	copy(data[:], c.ReadBuf[c.ReadStart:c.ReadStart+len(data)])
 	c.ReadStart += len(data)
-
+	if c.Trace != nil {
+		c.Trace.data(traceRecv, "label", data[:])
+	}
 	val.SetData(data)
 	return nil
 }
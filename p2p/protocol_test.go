@@ -10,39 +10,10 @@ package p2p
 
 import (
 	"fmt"
-	"io"
+	"strings"
 	"testing"
 )
 
-type pipe struct {
-	r *io.PipeReader
-	w *io.PipeWriter
-}
-
-func (p *pipe) Close() error {
-	if err := p.r.Close(); err != nil {
-		return err
-	}
-	return p.w.Close()
-}
-
-func (p *pipe) Read(data []byte) (n int, err error) {
-	return p.r.Read(data)
-}
-
-func (p *pipe) Write(data []byte) (n int, err error) {
-	return p.w.Write(data)
-}
-
-func newPipes() (*pipe, *pipe) {
-	var p0, p1 pipe
-
-	p0.r, p1.w = io.Pipe()
-	p1.r, p0.w = io.Pipe()
-
-	return &p0, &p1
-}
-
 var tests = []interface{}{
 	byte(42),
 	uint16(43),
@@ -83,7 +54,7 @@ func writer(c *Conn) {
 }
 
 func TestProtocol(t *testing.T) {
-	p0, p1 := newPipes()
+	p0, p1 := Pipe()
 
 	go writer(NewConn(p0))
 
@@ -135,3 +106,52 @@ func TestProtocol(t *testing.T) {
 		t.Errorf("Close: %v", err)
 	}
 }
+
+func TestTrace(t *testing.T) {
+	p0, p1 := Pipe()
+
+	var sent, recvd strings.Builder
+
+	w := NewConn(p0)
+	w.Trace = NewTracer(&sent, "w: ", true)
+	done := make(chan bool)
+	go func() {
+		writer(w)
+		done <- true
+	}()
+
+	c := NewConn(p1)
+	c.Trace = NewTracer(&recvd, "r: ", false)
+
+	if _, err := c.ReceiveByte(); err != nil {
+		t.Fatalf("ReceiveByte: %v", err)
+	}
+	if _, err := c.ReceiveUint16(); err != nil {
+		t.Fatalf("ReceiveUint16: %v", err)
+	}
+	if _, err := c.ReceiveUint32(); err != nil {
+		t.Fatalf("ReceiveUint32: %v", err)
+	}
+	if _, err := c.ReceiveString(); err != nil {
+		t.Fatalf("ReceiveString: %v", err)
+	}
+	<-done
+
+	expected := `w: send byte 42
+w: send uint16 43
+w: send uint32 44
+w: send data 13 bytes
+w:   00000000  48 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21           |Hello, world!|
+`
+	if sent.String() != expected {
+		t.Errorf("send trace:\n%s\nexpected:\n%s", sent.String(), expected)
+	}
+	expected = `r: recv byte 42
+r: recv uint16 43
+r: recv uint32 44
+r: recv data 13 bytes
+`
+	if recvd.String() != expected {
+		t.Errorf("recv trace:\n%s\nexpected:\n%s", recvd.String(), expected)
+	}
+}
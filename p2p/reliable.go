@@ -0,0 +1,374 @@
+//
+// reliable.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Reliable frame types.
+const (
+	frameData byte = iota
+	frameFin
+	frameAck
+	frameNack
+)
+
+const (
+	// reliableHeader is the frame header size: the frame type and
+	// the 64-bit sequence number.
+	reliableHeader = 9
+	// reliableMTU is the maximum payload size of data frames.
+	reliableMTU = 1200
+	// reliableWindow is the maximum number of unacknowledged frames
+	// and the size of the receiver's reorder buffer.
+	reliableWindow = 256
+	// reliableRTO is the retransmission timeout of unacknowledged
+	// frames.
+	reliableRTO = 100 * time.Millisecond
+	// reliableRetries is the number of retransmissions after which
+	// the peer is considered unreachable.
+	reliableRetries = 100
+	// reliableLinger specifies how long a closed connection keeps
+	// acknowledging the peer's retransmissions.
+	reliableLinger = 2 * reliableRTO
+)
+
+// ErrPeerUnreachable is returned when the peer does not acknowledge
+// the sent frames.
+var ErrPeerUnreachable = errors.New("peer unreachable")
+
+// Reliable implements an ordered byte stream over a packet transport
+// that may drop, duplicate, and reorder packets. Each Read and Write
+// call of the transport must receive and send exactly one packet, for
+// example, as with a connected UDP socket. The Reliable implements
+// io.ReadWriteCloser and it can be used as the transport of a Conn:
+//
+//	conn := p2p.NewConn(p2p.NewReliable(udp))
+//
+// The data is sent in sequence-numbered frames. The receiver buffers
+// out-of-order frames, drops duplicates, and acknowledges the frames
+// cumulatively. If the receiver detects a gap in the sequence, it
+// requests the missing frame immediately. Otherwise the sender
+// retransmits the unacknowledged frames after a timeout.
+type Reliable struct {
+	conn    io.ReadWriteCloser
+	writeMu sync.Mutex
+
+	m        sync.Mutex
+	c        *sync.Cond
+	err      error
+	closing  bool
+	closed   bool
+	sendSeq  uint64
+	unacked  map[uint64]*outFrame
+	recvNext uint64
+	reorder  map[uint64]inFrame
+	data     []byte
+	fin      bool
+	done     chan bool
+}
+
+type outFrame struct {
+	data    []byte
+	sent    time.Time
+	retries int
+}
+
+type inFrame struct {
+	fin  bool
+	data []byte
+}
+
+// NewReliable creates a new reliable stream over the packet
+// transport conn. The conn is closed when the stream is closed so
+// that the stream's receiver goroutine blocked in conn.Read
+// terminates.
+func NewReliable(conn io.ReadWriteCloser) *Reliable {
+	r := &Reliable{
+		conn:    conn,
+		unacked: make(map[uint64]*outFrame),
+		reorder: make(map[uint64]inFrame),
+		done:    make(chan bool),
+	}
+	r.c = sync.NewCond(&r.m)
+
+	go r.receiver()
+	go r.retransmitter()
+
+	return r
+}
+
+// Read implements io.Reader.
+func (r *Reliable) Read(p []byte) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for len(r.data) == 0 {
+		if r.fin {
+			return 0, io.EOF
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.c.Wait()
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// Write implements io.Writer.
+func (r *Reliable) Write(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		l := min(len(p)-n, reliableMTU)
+		if err := r.send(frameData, p[n:n+l]); err != nil {
+			return n, err
+		}
+		n += l
+	}
+	return n, nil
+}
+
+// send sends a new data or fin frame. The function blocks while the
+// send window is full.
+func (r *Reliable) send(kind byte, data []byte) error {
+	r.m.Lock()
+	for r.err == nil && len(r.unacked) >= reliableWindow {
+		r.c.Wait()
+	}
+	if r.err != nil {
+		r.m.Unlock()
+		return r.err
+	}
+	frame := make([]byte, reliableHeader+len(data))
+	frame[0] = kind
+	binary.BigEndian.PutUint64(frame[1:], r.sendSeq)
+	copy(frame[reliableHeader:], data)
+
+	r.unacked[r.sendSeq] = &outFrame{
+		data: frame,
+		sent: time.Now(),
+	}
+	r.sendSeq++
+	r.m.Unlock()
+
+	return r.write(frame)
+}
+
+// sendControl sends an ack or nack frame for the sequence number seq.
+func (r *Reliable) sendControl(kind byte, seq uint64) error {
+	var frame [reliableHeader]byte
+	frame[0] = kind
+	binary.BigEndian.PutUint64(frame[1:], seq)
+	return r.write(frame[:])
+}
+
+func (r *Reliable) write(frame []byte) error {
+	r.writeMu.Lock()
+	_, err := r.conn.Write(frame)
+	r.writeMu.Unlock()
+	if err != nil {
+		r.fail(err)
+	}
+	return err
+}
+
+// fail terminates the stream with the error err.
+func (r *Reliable) fail(err error) {
+	r.m.Lock()
+	if r.err == nil && !r.closed {
+		r.err = err
+	}
+	r.c.Broadcast()
+	r.m.Unlock()
+}
+
+func (r *Reliable) receiver() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.conn.Read(buf)
+		if err != nil {
+			r.fail(err)
+			return
+		}
+		if n < reliableHeader {
+			// Ignore truncated frames.
+			continue
+		}
+		kind := buf[0]
+		seq := binary.BigEndian.Uint64(buf[1:])
+
+		switch kind {
+		case frameData, frameFin:
+			r.receive(kind == frameFin, seq, buf[reliableHeader:n])
+
+		case frameAck, frameNack:
+			r.ack(kind == frameNack, seq)
+		}
+	}
+}
+
+// receive handles the data or fin frame seq and acknowledges all
+// frames received in order. If there are gaps in the received
+// frames, receive requests the first missing frame.
+func (r *Reliable) receive(fin bool, seq uint64, data []byte) {
+	r.m.Lock()
+	_, ok := r.reorder[seq]
+	if !ok && seq >= r.recvNext && seq < r.recvNext+reliableWindow {
+		r.reorder[seq] = inFrame{
+			fin:  fin,
+			data: append([]byte(nil), data...),
+		}
+		for {
+			frame, ok := r.reorder[r.recvNext]
+			if !ok {
+				break
+			}
+			delete(r.reorder, r.recvNext)
+			r.recvNext++
+			if frame.fin {
+				r.fin = true
+			} else {
+				r.data = append(r.data, frame.data...)
+			}
+		}
+		r.c.Broadcast()
+	}
+	next := r.recvNext
+	gap := len(r.reorder) > 0
+	r.m.Unlock()
+
+	if gap {
+		r.sendControl(frameNack, next)
+	} else {
+		r.sendControl(frameAck, next)
+	}
+}
+
+// ack handles the cumulative acknowledgement of all frames before
+// seq. If nack is true, the frame seq is missing from the peer and
+// it is retransmitted.
+func (r *Reliable) ack(nack bool, seq uint64) {
+	var retransmit []byte
+
+	r.m.Lock()
+	for s := range r.unacked {
+		if s < seq {
+			delete(r.unacked, s)
+		}
+	}
+	if nack {
+		// Nacks are sent for all out-of-order frames so resend the
+		// missing frame only if it was not sent recently.
+		frame, ok := r.unacked[seq]
+		now := time.Now()
+		if ok && now.Sub(frame.sent) >= reliableRTO/4 {
+			frame.sent = now
+			retransmit = frame.data
+		}
+	}
+	r.c.Broadcast()
+	r.m.Unlock()
+
+	if retransmit != nil {
+		r.write(retransmit)
+	}
+}
+
+func (r *Reliable) retransmitter() {
+	ticker := time.NewTicker(reliableRTO / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case now := <-ticker.C:
+			var frames [][]byte
+			var err error
+
+			r.m.Lock()
+			for _, frame := range r.unacked {
+				if now.Sub(frame.sent) < reliableRTO {
+					continue
+				}
+				if frame.retries >= reliableRetries {
+					err = ErrPeerUnreachable
+					break
+				}
+				frame.retries++
+				frame.sent = now
+				frames = append(frames, frame.data)
+			}
+			r.m.Unlock()
+
+			if err != nil {
+				r.fail(err)
+				return
+			}
+			for _, frame := range frames {
+				if r.write(frame) != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close sends a fin frame and waits until the peer has acknowledged
+// all sent data and closed its side of the stream. The closed stream
+// keeps acknowledging the peer's retransmissions for a short while
+// before it closes the underlying transport. Close can be called
+// many times and concurrently; only the first call closes the stream
+// and the other calls return nil immediately.
+func (r *Reliable) Close() error {
+	r.m.Lock()
+	closing := r.closing
+	r.closing = true
+	r.m.Unlock()
+	if closing {
+		return nil
+	}
+
+	err := r.send(frameFin, nil)
+	if err == nil {
+		// The peer's fin is not retransmitted by us so bound the
+		// wait for it in case the peer never closes its side.
+		timer := time.AfterFunc(reliableRetries*reliableRTO, func() {
+			r.fail(ErrPeerUnreachable)
+		})
+		r.m.Lock()
+		for r.err == nil && (len(r.unacked) > 0 || !r.fin) {
+			r.c.Wait()
+		}
+		err = r.err
+		r.m.Unlock()
+		timer.Stop()
+	}
+
+	r.m.Lock()
+	r.closed = true
+	r.m.Unlock()
+
+	close(r.done)
+	if err != nil {
+		r.conn.Close()
+		return err
+	}
+	time.AfterFunc(reliableLinger, func() {
+		r.conn.Close()
+	})
+	return nil
+}
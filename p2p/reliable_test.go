@@ -0,0 +1,231 @@
+//
+// reliable_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	mrand "math/rand"
+	"sync"
+	"testing"
+)
+
+// packetQueue implements a lossy packet queue that drops, duplicates,
+// and reorders packets.
+type packetQueue struct {
+	m       sync.Mutex
+	c       *sync.Cond
+	rand    *mrand.Rand
+	packets [][]byte
+	closed  bool
+	dropped int
+	duped   int
+}
+
+func newPacketQueue(seed int64) *packetQueue {
+	q := &packetQueue{
+		rand: mrand.New(mrand.NewSource(seed)),
+	}
+	q.c = sync.NewCond(&q.m)
+	return q
+}
+
+func (q *packetQueue) push(data []byte) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if q.closed {
+		return
+	}
+	count := 1
+	switch v := q.rand.Intn(100); {
+	case v < 5:
+		q.dropped++
+		count = 0
+	case v < 10:
+		q.duped++
+		count = 2
+	}
+	for i := 0; i < count; i++ {
+		q.packets = append(q.packets, append([]byte(nil), data...))
+	}
+	q.c.Broadcast()
+}
+
+func (q *packetQueue) pop() ([]byte, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	for len(q.packets) == 0 {
+		if q.closed {
+			return nil, io.EOF
+		}
+		q.c.Wait()
+	}
+	idx := q.rand.Intn(min(len(q.packets), 8))
+	packet := q.packets[idx]
+	q.packets = append(q.packets[:idx], q.packets[idx+1:]...)
+	return packet, nil
+}
+
+func (q *packetQueue) close() {
+	q.m.Lock()
+	q.closed = true
+	q.c.Broadcast()
+	q.m.Unlock()
+}
+
+type lossyConn struct {
+	in  *packetQueue
+	out *packetQueue
+}
+
+func (c *lossyConn) Read(p []byte) (int, error) {
+	packet, err := c.in.pop()
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, packet), nil
+}
+
+func (c *lossyConn) Write(p []byte) (int, error) {
+	c.out.push(p)
+	return len(p), nil
+}
+
+func (c *lossyConn) Close() error {
+	c.in.close()
+	return nil
+}
+
+func newLossyPipes() (*lossyConn, *lossyConn) {
+	q0 := newPacketQueue(1)
+	q1 := newPacketQueue(2)
+
+	return &lossyConn{in: q0, out: q1}, &lossyConn{in: q1, out: q0}
+}
+
+const reliableChunk = 32 * 1024
+
+func TestReliable(t *testing.T) {
+	data := make([]byte, 512*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	reply := []byte("Hello, world!")
+
+	p0, p1 := newLossyPipes()
+
+	done := make(chan error)
+	go func() {
+		c := NewConn(NewReliable(p0))
+		writer(c)
+		for i := 0; i < len(data); i += reliableChunk {
+			if err := c.SendData(data[i : i+reliableChunk]); err != nil {
+				done <- err
+				return
+			}
+		}
+		if err := c.Flush(); err != nil {
+			done <- err
+			return
+		}
+		v, err := c.ReceiveData()
+		if err != nil {
+			done <- err
+			return
+		}
+		if !bytes.Equal(v, reply) {
+			t.Errorf("ReceiveData: got %q, expected %q", v, reply)
+		}
+		done <- c.Close()
+	}()
+
+	c := NewConn(NewReliable(p1))
+	if v, err := c.ReceiveByte(); err != nil || v != 42 {
+		t.Fatalf("ReceiveByte: %v %v", v, err)
+	}
+	if v, err := c.ReceiveUint16(); err != nil || v != 43 {
+		t.Fatalf("ReceiveUint16: %v %v", v, err)
+	}
+	if v, err := c.ReceiveUint32(); err != nil || v != 44 {
+		t.Fatalf("ReceiveUint32: %v %v", v, err)
+	}
+	if v, err := c.ReceiveString(); err != nil || v != "Hello, world!" {
+		t.Fatalf("ReceiveString: %v %v", v, err)
+	}
+	for i := 0; i < len(data); i += reliableChunk {
+		v, err := c.ReceiveData()
+		if err != nil {
+			t.Fatalf("ReceiveData: %v", err)
+		}
+		if !bytes.Equal(v, data[i:i+reliableChunk]) {
+			t.Errorf("ReceiveData: chunk %d mismatch", i/reliableChunk)
+		}
+	}
+	if err := c.SendData(reply); err != nil {
+		t.Fatalf("SendData: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("peer: %v", err)
+	}
+
+	if p0.out.dropped == 0 || p0.out.duped == 0 {
+		t.Errorf("transport did not drop or duplicate packets")
+	}
+	t.Logf("dropped=%d, duplicated=%d",
+		p0.out.dropped+p1.out.dropped, p0.out.duped+p1.out.duped)
+}
+
+func TestReliableEOF(t *testing.T) {
+	p0, p1 := newLossyPipes()
+
+	r0 := NewReliable(p0)
+	r1 := NewReliable(p1)
+
+	done := make(chan error)
+	go func() {
+		if _, err := r0.Write([]byte("Hello")); err != nil {
+			done <- err
+			return
+		}
+		done <- r0.Close()
+	}()
+
+	data, err := io.ReadAll(r1)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(data) != "Hello" {
+		t.Errorf("got %q, expected %q", data, "Hello")
+	}
+	// Concurrent closes must not close the stream twice.
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = r1.Close()
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+//
+// trace.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TraceEnv specifies the environment variable that enables message
+// tracing for new connections. The value "1" traces the messages to
+// the standard error and the value "dump" adds hex dumps of the
+// message data.
+const TraceEnv = "MPC_P2P_TRACE"
+
+// Tracer logs the values sent and received over a connection. Each
+// value is logged on its own line with its direction, type, and
+// value or size.
+type Tracer struct {
+	Out    io.Writer
+	Prefix string
+	// Dump specifies if the data values are hex dumped.
+	Dump bool
+	m    sync.Mutex
+}
+
+// NewTracer creates a new tracer writing to out.
+func NewTracer(out io.Writer, prefix string, dump bool) *Tracer {
+	return &Tracer{
+		Out:    out,
+		Prefix: prefix,
+		Dump:   dump,
+	}
+}
+
+// newEnvTracer creates a tracer from the TraceEnv environment
+// variable. The function returns nil if the tracing is not enabled.
+func newEnvTracer() *Tracer {
+	switch os.Getenv(TraceEnv) {
+	case "", "0":
+		return nil
+	case "dump":
+		return NewTracer(os.Stderr, "", true)
+	default:
+		return NewTracer(os.Stderr, "", false)
+	}
+}
+
+const (
+	traceSend = "send"
+	traceRecv = "recv"
+)
+
+// value logs the integer value of the type.
+func (t *Tracer) value(dir, kind string, val int) {
+	t.m.Lock()
+	fmt.Fprintf(t.Out, "%s%s %s %d\n", t.Prefix, dir, kind, val)
+	t.m.Unlock()
+}
+
+// data logs the data of the type.
+func (t *Tracer) data(dir, kind string, data []byte) {
+	t.m.Lock()
+	fmt.Fprintf(t.Out, "%s%s %s %d bytes\n", t.Prefix, dir, kind, len(data))
+	if t.Dump && len(data) > 0 {
+		dump := strings.TrimSuffix(hex.Dump(data), "\n")
+		for _, line := range strings.Split(dump, "\n") {
+			fmt.Fprintf(t.Out, "%s  %s\n", t.Prefix, line)
+		}
+	}
+	t.m.Unlock()
+}
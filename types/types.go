@@ -94,6 +94,14 @@ type Info struct {
 	ElementType *Info
 	ArraySize   Size
 	Offset      Size
+	// Variants holds the variants of union types. The unions are
+	// structs with the Tag and Payload fields and the value of the
+	// active variant is stored at the start of the payload.
+	Variants []StructField
+	// Untyped is set for constants whose type is resolved from the
+	// context where they are used, for example the integer literal
+	// `1`.
+	Untyped bool
 }
 
 // Undefined defines type info for undefined types.
@@ -241,7 +249,21 @@ func (i *Info) Instantiate(o Info) bool {
 			i.Type = TPtr
 			i.ElementType = o.ElementType
 
-		case TInt:
+		case TInt, TUint:
+			if o.Untyped && (o.Type == TInt || o.Type == TUint) {
+				// Untyped integer constant adopts the type of the
+				// lvalue.
+				if i.Concrete() {
+					return false
+				}
+				i.IsConcrete = true
+				i.Bits = o.Bits
+				i.MinBits = o.Bits
+				return true
+			}
+			if i.Type != TInt {
+				return false
+			}
 			switch o.Type {
 			case TUint:
 				if o.MinBits < o.Bits {
@@ -363,6 +385,14 @@ func (i Info) Equal(o Info) bool {
 				return false
 			}
 		}
+		if len(i.Variants) != len(o.Variants) {
+			return false
+		}
+		for idx, ie := range i.Variants {
+			if !ie.Type.Equal(o.Variants[idx].Type) {
+				return false
+			}
+		}
 		return true
 
 	case TArray: